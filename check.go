@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/server"
+)
+
+// checkConfig loads the configuration at the given path without connecting to S3,
+// reports its warnings and errors, and eventually prints the effective configuration.
+// It returns the exit code of the program.
+func checkConfig(configPath string, printEffective bool, stdout, stderr io.Writer) int {
+	cfg, warnings, err := config.Load(configPath)
+
+	for _, warning := range warnings {
+		_, _ = fmt.Fprintln(stderr, "warning:", warning)
+	}
+
+	if err != nil {
+		for i, line := range strings.Split(err.Error(), "\n") {
+			if i == 0 {
+				_, _ = fmt.Fprintln(stderr, "error:", line)
+			} else {
+				_, _ = fmt.Fprintln(stderr, "      ", line)
+			}
+		}
+
+		return 1
+	}
+
+	if printEffective {
+		err = config.WriteEffective(stdout, cfg)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, "error:", err)
+
+			return 1
+		}
+
+		return 0
+	}
+
+	_, _ = fmt.Fprintf(stdout, "The configuration %q is valid (%d warnings)\n", configPath, len(warnings))
+
+	return 0
+}
+
+// testExpressions runs the expression tests of the configuration at the given path,
+// along with the ones of the given tests file if any, and reports their diffs and evaluation durations.
+// It returns the exit code of the program.
+func testExpressions(configPath, testsPath string, stdout, stderr io.Writer) int {
+	cfg, _, err := config.Load(configPath)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "error:", err)
+
+		return 1
+	}
+
+	err = logger.Init(cfg.Log.LogLevel, cfg.Log.ColorLogs, cfg.Log.JSONLogFormat, cfg.Log.JSONLogFields)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "error: can't initialize logger:", err)
+
+		return 1
+	}
+
+	tests := cfg.Tests
+
+	if testsPath != "" {
+		fileTests, err := config.LoadTests(testsPath, cfg)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, "error:", err)
+
+			return 1
+		}
+
+		tests = append(tests, fileTests...)
+	}
+
+	if len(tests) == 0 {
+		_, _ = fmt.Fprintln(stderr, "error: no expression tests defined")
+
+		return 1
+	}
+
+	failed := 0
+
+	for _, result := range server.RunExprTests(context.Background(), cfg, tests) {
+		status := "PASS"
+
+		if !result.Passed() {
+			status = "FAIL"
+			failed++
+		}
+
+		_, _ = fmt.Fprintf(stdout, "--- %s: %s (%s/%s)\n", status, result.Test.Name, result.Test.Group, result.Test.Type)
+
+		if result.Err != nil {
+			_, _ = fmt.Fprintf(stdout, "    %s: %v\n", result.Test.Source, result.Err)
+
+			continue
+		}
+
+		for _, outcome := range result.Expressions {
+			_, _ = fmt.Fprintf(stdout, "    %-20s %s\n", outcome.Name, outcome.Duration)
+
+			switch {
+			case outcome.Err != nil:
+				_, _ = fmt.Fprintln(stdout, "        error:", outcome.Err)
+			case outcome.Diff != "":
+				_, _ = fmt.Fprintln(stdout, "        unexpected output (-want +got):")
+
+				for line := range strings.Lines(outcome.Diff) {
+					_, _ = fmt.Fprint(stdout, "        ", line)
+				}
+			}
+		}
+	}
+
+	_, _ = fmt.Fprintf(stdout, "%d tests, %d passed, %d failed\n", len(tests), len(tests)-failed, failed)
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
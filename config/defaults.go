@@ -4,6 +4,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/expr-lang/expr/conf"
 	"github.com/rs/zerolog"
 )
 
@@ -19,9 +20,17 @@ func defaultConfig() Config {
 				PMTilesURL: "https://tile.openstreetmap.org/{z}/{x}/{y}.png",
 			},
 		},
+		Products: Products{
+			ExpressionLimits: defaultExpressionLimits(),
+			Gazetteer:        defaultGazetteer(),
+		},
 		Cache: Cache{
-			CacheDir:        os.TempDir(),
-			RetentionPeriod: 7 * 24 * time.Hour,
+			CacheDir:         os.TempDir(),
+			RetentionPeriod:  7 * 24 * time.Hour,
+			DeepZoom:         defaultDeepZoom(),
+			MaxTIFFPixels:    100_000_000,
+			MaxDecodedPixels: 100_000_000,
+			Export:           defaultExport(),
 		},
 		Log: Log{
 			LogLevel:      zerolog.LevelInfoValue,
@@ -41,6 +50,41 @@ func defaultConfig() Config {
 				Max:   20 * time.Second,
 				Count: 10,
 			},
+			ExprDurationBuckets: HistogramsBuckets{
+				Min:   10 * time.Microsecond,
+				Max:   1 * time.Second,
+				Count: 10,
+			},
 		},
 	}
 }
+
+func defaultExpressionLimits() ExpressionLimits {
+	return ExpressionLimits{
+		Timeout:      5 * time.Second,
+		MaxNodes:     conf.DefaultMaxNodes,
+		MemoryBudget: conf.DefaultMemoryBudget,
+		MaxFileSize:  64 << 20, // 64 MiB
+	}
+}
+
+func defaultGazetteer() Gazetteer {
+	return Gazetteer{
+		MaxDistance:          50,
+		VillageMaxPopulation: 5000,
+	}
+}
+
+func defaultDeepZoom() DeepZoom {
+	return DeepZoom{
+		MinSize:  4096,
+		TileSize: 256,
+	}
+}
+
+func defaultExport() Export {
+	return Export{
+		MaxImages:           100,
+		MaxSignedObjectSize: 1 << 30,
+	}
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+const redacted = "<redacted>"
+
+// Redacted returns a copy of this configuration with its secrets hidden: the S3 access secret,
+// the passwords of the URLs it contains, and the text values read from !file tags or environment variables.
+func (cfg Config) Redacted() Config {
+	if cfg.S3.AccessSecret != "" {
+		cfg.S3.AccessSecret = redacted
+	}
+
+	for _, field := range cfg.SecretFields {
+		redactedCfg, ok := redactField(reflect.ValueOf(cfg), field).Interface().(Config)
+		if ok {
+			cfg = redactedCfg
+		}
+	}
+
+	cfg.Products.FullProductRootURL = redactURL(cfg.Products.FullProductRootURL)
+
+	if cfg.Products.ExternalViewers != nil {
+		viewers := make(map[string]string, len(cfg.Products.ExternalViewers))
+
+		for name, viewerURL := range cfg.Products.ExternalViewers {
+			viewers[name] = redactURL(viewerURL)
+		}
+
+		cfg.Products.ExternalViewers = viewers
+	}
+
+	return cfg
+}
+
+// redactField returns a copy of the given value whose text field at the given path, made of the YAML keys
+// and sequence indexes leading to it, is redacted. The maps and slices on the path are copied, not modified.
+// The value is returned as is if the path doesn't lead to a text field.
+func redactField(v reflect.Value, path []string) reflect.Value {
+	if len(path) == 0 {
+		if v.Kind() != reflect.String || v.String() == "" {
+			return v
+		}
+
+		return reflect.ValueOf(redacted).Convert(v.Type())
+	}
+
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		elem := redactField(v.Elem(), path)
+		if v.Kind() == reflect.Interface {
+			result := reflect.New(v.Type()).Elem()
+			result.Set(elem)
+
+			return result
+		}
+
+		result := reflect.New(v.Type().Elem())
+		result.Elem().Set(elem)
+
+		return result
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+
+			if name != path[0] || !field.IsExported() {
+				continue
+			}
+
+			result := reflect.New(v.Type()).Elem()
+			result.Set(v)
+			result.Field(i).Set(redactField(v.Field(i), path[1:]))
+
+			return result
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v
+		}
+
+		key := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+
+		elem := v.MapIndex(key)
+		if !elem.IsValid() {
+			return v
+		}
+
+		result := reflect.MakeMapWithSize(v.Type(), v.Len())
+
+		iter := v.MapRange()
+		for iter.Next() {
+			result.SetMapIndex(iter.Key(), iter.Value())
+		}
+
+		result.SetMapIndex(key, redactField(elem, path[1:]))
+
+		return result
+	case reflect.Slice:
+		idx, err := strconv.Atoi(path[0])
+		if err != nil || idx < 0 || idx >= v.Len() {
+			return v
+		}
+
+		result := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(result, v)
+		result.Index(idx).Set(redactField(v.Index(idx), path[1:]))
+
+		return result
+	}
+
+	return v
+}
+
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+
+		return strings.Replace(u.String(), url.QueryEscape(redacted), redacted, 1)
+	}
+
+	return rawURL
+}
+
+// WriteEffective writes the given configuration as YAML, with its secrets redacted.
+// The image groups and types are written with the dynamic data they inherit,
+// and annotated with the position where they have been defined.
+func WriteEffective(w io.Writer, cfg Config) error {
+	cfg = cfg.Redacted()
+	cfg.Products.ImageGroups = effectiveImageGroups(cfg.Products.ImageGroups)
+
+	var doc yaml.Node
+
+	err := doc.Encode(cfg)
+	if err != nil {
+		return fmt.Errorf("can't encode the configuration: %w", err)
+	}
+
+	groupsNode := lookupNode(&doc, "products", "imageGroups")
+	if groupsNode != nil && groupsNode.Kind == yaml.SequenceNode {
+		for i, groupNode := range groupsNode.Content {
+			annotateSource(groupNode, cfg.Products.ImageGroups[i].Source)
+
+			typesNode := lookupNode(groupNode, "types")
+			if typesNode == nil || typesNode.Kind != yaml.SequenceNode {
+				continue
+			}
+
+			for j, typeNode := range typesNode.Content {
+				annotateSource(typeNode, cfg.Products.ImageGroups[i].Types[j].Source)
+			}
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+
+	err = encoder.Encode(&doc)
+	if err != nil {
+		return fmt.Errorf("can't write the configuration: %w", err)
+	}
+
+	return encoder.Close() //nolint:wrapcheck
+}
+
+// effectiveImageGroups restores the file selectors kinds with their parameters,
+// as they were written in the configuration before being parsed.
+func effectiveImageGroups(groups []ImageGroup) []ImageGroup {
+	result := make([]ImageGroup, len(groups))
+
+	for i, group := range groups {
+		group.DynamicData = effectiveDynamicData(group.DynamicData)
+		group.Types = append([]ImageType(nil), group.Types...)
+
+		for j, imgType := range group.Types {
+			group.Types[j].DynamicData = effectiveDynamicData(imgType.DynamicData)
+		}
+
+		result[i] = group
+	}
+
+	return result
+}
+
+func effectiveDynamicData(dynData DynamicData) DynamicData {
+	dynData.FileSelectors = maps.Clone(dynData.FileSelectors)
+
+	for name, selector := range dynData.FileSelectors {
+		if len(selector.KindParams) > 0 {
+			selector.Kind = fmt.Sprintf("%s(%s)", selector.Kind, strings.Join(selector.KindParams, ", "))
+			dynData.FileSelectors[name] = selector
+		}
+	}
+
+	return dynData
+}
+
+func annotateSource(node *yaml.Node, source string) {
+	if source != "" {
+		node.HeadComment = "defined at " + source
+	}
+}
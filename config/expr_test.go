@@ -20,18 +20,46 @@ func TestExprFunctions(t *testing.T) {
 
 	date := time.Date(2026, 2, 26, 11, 34, 0, 0, time.Local) //nolint: gosmopolitan
 
+	footprint := `let fp = {"corner": {
+		"upper-left": {"coordinates": {"lon": 0, "lat": 1}}, "upper-right": {"coordinates": {"lon": 1, "lat": 1}},
+		"lower-left": {"coordinates": {"lon": 0, "lat": 0}}, "lower-right": {"coordinates": {"lon": 1, "lat": 0}},
+	}}; `
+
 	exprByFunc := map[string]string{
-		"_call":         `_call("__dummyFn__")`,
-		"_exist":        `_exist("jsonFile")`,
-		"_fileDate":     `_fileDate("jsonFile", "2006-01-02 15:04:05")`,
-		"_jq":           `_jq("jsonFile", ".key")`,
-		"_loadJSON":     `_loadJSON("jsonFile")`,
-		"_merge":        `_merge({"a": 1}, {"b": 2})`,
-		"_replaceRegex": `_replaceRegex("some/value", "/", "@")`,
-		"_s3Key":        `_s3Key("jsonFile")`,
-		"_s3Uri":        `_s3Uri("jsonFile")`,
-		"_title":        `_title("some str")`,
-		"_xpath":        `_xpath("xmlFile", "//node")`,
+		"_addDuration":      `_addDuration("2026-02-26T11:34:00Z", "1d2h")`,
+		"_area":             footprint + `_round(_area(fp), 1)`,
+		"_bbox":             footprint + `_bbox(fp)`,
+		"_call":             `_call("__dummyFn__")`,
+		"_centroid":         footprint + `_centroid(fp)`,
+		"_dateDiff":         `_dateDiff("2026-02-26", "2026-03-01", "d")`,
+		"_exist":            `_exist("jsonFile")`,
+		"_fileDate":         `_fileDate("jsonFile", "2006-01-02 15:04:05")`,
+		"_files":            `map(_files("bands"), .S3Path)`,
+		"_formatBytes":      `_formatBytes(1572864)`,
+		"_formatDate":       `_formatDate("2026-02-26T11:34:00Z", "2006-01-02 15:04 MST", "Europe/Paris")`,
+		"_formatNumber":     `_formatNumber(1234567.891, 2)`,
+		"_geotiffFootprint": `map(_bbox(_geotiffFootprint("tiffFile")), _round(#, 4))`,
+		"_jq":               `_jq("yamlFile", ".bands[1]")`,
+		"_jqValue":          `_jqValue(_loadCSV("csvFile"), "map(.band)")`,
+		"_loadCSV":          `_loadCSV("csvFile")`,
+		"_loadINI":          `_loadINI("iniFile")`,
+		"_loadJSON":         `_loadJSON("jsonFile")`,
+		"_loadTOML":         `_loadTOML("tomlFile")`,
+		"_loadYAML":         `_loadYAML("yamlFile")`,
+		"_merge":            `_merge({"a": 1}, {"b": 2})`,
+		"_parseDate":        `_parseDate("26/02/2026 11:34", "02/01/2006 15:04", "Europe/Paris")`,
+		"_replaceRegex":     `_replaceRegex("some/value", "/", "@")`,
+		"_reverseGeocode":   footprint + `_reverseGeocode(fp)`,
+		"_round":            `_round(3.14159, 2)`,
+		"_s3Key":            `_s3Key("jsonFile")`,
+		"_s3Keys":           `_s3Keys("bands")`,
+		"_s3Uri":            `_s3Uri("jsonFile")`,
+		"_title":            `_title("some str")`,
+		"_toWGS84":          `_toWGS84(500000, 0, "EPSG:32631")`,
+		"_wkt":              footprint + `_wkt(fp)`,
+		"_xpath":            `_xpath("xmlFile", "//node")`,
+		"_xpathAll":         `_xpathAll("nsXmlFile", "//t:item/@id")`,
+		"_xpathNodes":       `_xpathNodes("xmlFile", "//node")`,
 	}
 
 	exprCfg := conf.CreateNew()
@@ -50,23 +78,53 @@ func TestExprFunctions(t *testing.T) {
 		t.Errorf("Tested expr functions don't match declared ones (-want +got):\n%s", diff)
 	}
 
-	expressions, err := parseExpressions(exprByFunc)
+	expressions, err := parseExpressions(exprByFunc, defaultExpressionLimits())
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	expectedOutputs := map[string]any{
-		"_call":         7,
-		"_exist":        true,
-		"_fileDate":     "2026-02-26 11:34:00",
-		"_jq":           "value",
+		"_addDuration":      time.Date(2026, 2, 27, 13, 34, 0, 0, time.UTC),
+		"_area":             12391.4,
+		"_bbox":             []float64{0, 0, 1, 1},
+		"_call":             7,
+		"_centroid":         map[string]any{"lon": 0.5, "lat": 0.5},
+		"_dateDiff":         3.0,
+		"_exist":            true,
+		"_fileDate":         "2026-02-26 11:34:00",
+		"_files":            []any{"path/to/b1.tif", "path/to/b2.tif"},
+		"_formatBytes":      "1.5 MiB",
+		"_formatDate":       "2026-02-26 12:34 CET",
+		"_formatNumber":     "1,234,567.89",
+		"_geotiffFootprint": []any{2.3171, 37.9438, 2.3217, 37.9456},
+		"_jq":               "B03",
+		"_jqValue":          []any{"B02", "B03"},
+		"_loadCSV": []any{
+			map[string]any{"band": "B02", "wavelength": "490"},
+			map[string]any{"band": "B03", "wavelength": "560"},
+		},
+		"_loadINI":      map[string]any{"satellite": "S2A", "processing": map[string]any{"level": "2"}},
 		"_loadJSON":     map[string]any{"key": "value"},
+		"_loadTOML":     map[string]any{"satellite": "S2A", "processing": map[string]any{"level": 2.0}},
+		"_loadYAML":     map[string]any{"satellite": "S2A", "bands": []any{"B02", "B03"}},
 		"_merge":        map[string]any{"a": 1, "b": 2},
+		"_parseDate":    time.Date(2026, 2, 26, 10, 34, 0, 0, time.UTC),
 		"_replaceRegex": "some@value",
-		"_s3Key":        "path/to/file.json",
-		"_s3Uri":        "s3://bkt/path/to/file.json",
-		"_title":        "Some Str",
-		"_xpath":        "data",
+		"_reverseGeocode": []any{map[string]any{
+			"name": "Atlantis", "states": []any{map[string]any{"name": "Rings", "counties": []any{}}},
+		}},
+		"_round":    3.14,
+		"_s3Key":    "path/to/file.json",
+		"_s3Keys":   []string{"path/to/b1.tif", "path/to/b2.tif"},
+		"_s3Uri":    "s3://bkt/path/to/file.json",
+		"_title":    "Some Str",
+		"_toWGS84":  map[string]any{"lon": 3.0, "lat": 0.0},
+		"_wkt":      "POLYGON ((0 1, 1 1, 1 0, 0 0, 0 1))",
+		"_xpath":    "data",
+		"_xpathAll": []any{"1", "2"},
+		"_xpathNodes": []any{map[string]any{
+			"name": "node", "namespace": "", "text": "data", "attributes": map[string]any{}, "children": []any{},
+		}},
 	}
 
 	dummyExpr, err := expr.Compile(`7`, expr.Env(types.ExprEnv{}))
@@ -89,10 +147,30 @@ func TestExprFunctions(t *testing.T) {
 				CacheKey: "./testdata/file.xml",
 				Date:     date,
 			},
+			"csvFile":  {S3Bucket: "bkt", S3Path: "path/to/file.csv", CacheKey: "./testdata/file.csv"},
+			"iniFile":  {S3Bucket: "bkt", S3Path: "path/to/file.txt", CacheKey: "./testdata/file.txt"},
+			"tiffFile": {S3Bucket: "bkt", S3Path: "path/to/file.tif", CacheKey: "./testdata/file.tif"},
+			"tomlFile": {S3Bucket: "bkt", S3Path: "path/to/file.toml", CacheKey: "./testdata/file.toml"},
+			"yamlFile": {S3Bucket: "bkt", S3Path: "path/to/file.yaml", CacheKey: "./testdata/file.yaml"},
+			"nsXmlFile": {
+				S3Bucket: "bkt",
+				S3Path:   "path/to/namespaced.xml",
+				CacheKey: "./testdata/namespaced.xml",
+			},
+		},
+		Namespaces: map[string]map[string]string{
+			"nsXmlFile": {"t": "urn:test"},
+		},
+		FileLists: map[string][]types.DynamicInputFile{
+			"bands": {
+				{S3Bucket: "bkt", S3Path: "path/to/b1.tif"},
+				{S3Bucket: "bkt", S3Path: "path/to/b2.tif"},
+			},
 		},
 		Exprs: map[string]*vm.Program{
 			"__dummyFn__": dummyExpr,
 		},
+		Geocoder: stubGeocoder{},
 	}
 
 	for name, prgm := range expressions {
@@ -114,7 +192,9 @@ func TestExprFunctionAdditionalBranches(t *testing.T) {
 
 	expressions, err := parseExpressions(map[string]string{
 		"fileDateDefault": `_fileDate("jsonFile")`,
-	})
+		"jqFormat":        `_jq("jsonFile", ".key", "yaml")`,
+		"csvSeparator":    `_loadCSV("csvFile", ";")`,
+	}, defaultExpressionLimits())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -128,6 +208,7 @@ func TestExprFunctionAdditionalBranches(t *testing.T) {
 				CacheKey: "./testdata/file.json",
 				Date:     date,
 			},
+			"csvFile": {S3Bucket: "bkt", S3Path: "path/to/file.csv", CacheKey: "./testdata/file.csv"},
 		},
 	}
 
@@ -139,6 +220,28 @@ func TestExprFunctionAdditionalBranches(t *testing.T) {
 	if output != date.String() {
 		t.Fatalf("Unexpected _fileDate default output: want %q, got %q.", date.String(), output)
 	}
+
+	output, err = expr.Run(expressions["jqFormat"], env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output != "value" {
+		t.Fatalf("Unexpected _jq output with an explicit format: want %q, got %q.", "value", output)
+	}
+
+	output, err = expr.Run(expressions["csvSeparator"], env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRows := []any{
+		map[string]any{"band,wavelength": "B02,490"},
+		map[string]any{"band,wavelength": "B03,560"},
+	}
+	if diff := cmp.Diff(expectedRows, output); diff != "" {
+		t.Fatalf("Unexpected _loadCSV output with a separator (-want +got):\n%s", diff)
+	}
 }
 
 func TestExprFunctionErrors(t *testing.T) {
@@ -216,7 +319,7 @@ func TestExprFunctionErrors(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			expressions, err := parseExpressions(map[string]string{"expr": tc.expression})
+			expressions, err := parseExpressions(map[string]string{"expr": tc.expression}, defaultExpressionLimits())
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -242,7 +345,7 @@ func TestExprFunctionErrors(t *testing.T) {
 func mustParseExpression(t *testing.T, rawExpr string) *vm.Program {
 	t.Helper()
 
-	expressions, err := parseExpressions(map[string]string{"expr": rawExpr})
+	expressions, err := parseExpressions(map[string]string{"expr": rawExpr}, defaultExpressionLimits())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -259,3 +362,14 @@ func jsonFileEnvFiles() map[string]types.DynamicInputFile {
 		},
 	}
 }
+
+// stubGeocoder returns a fixed country for a single ring of corners.
+type stubGeocoder struct{}
+
+func (stubGeocoder) ReverseGeocode(rings [][][2]float64) []types.GeonamesObject {
+	if len(rings) != 1 || len(rings[0]) != 5 {
+		return nil
+	}
+
+	return []types.GeonamesObject{{Name: "Atlantis", States: []types.GeonamesState{{Name: "Rings", Counties: []types.GeonamesCounty{}}}}}
+}
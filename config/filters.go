@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	errInvalidFilter           = errors.New("invalid dynamic filter")
+	errUnknownFilterExpression = errors.New("unknown expression")
+)
+
+// filterUIHints lists the UI hints each type of dynamic filter can be rendered with, the first one being the default.
+var filterUIHints = map[DynamicFilterType][]DynamicFilterUIHint{ //nolint: gochecknoglobals
+	DynamicFilterTypeString:  {DynamicFilterUIHintDropdown},
+	DynamicFilterTypeEnum:    {DynamicFilterUIHintDropdown},
+	DynamicFilterTypeNumber:  {DynamicFilterUIHintRange, DynamicFilterUIHintDropdown},
+	DynamicFilterTypeDate:    {DynamicFilterUIHintDateRange, DynamicFilterUIHintDropdown},
+	DynamicFilterTypeBoolean: {DynamicFilterUIHintDropdown},
+}
+
+func validateDynamicFilters(filters []DynamicFilter) []error {
+	var errs []error
+
+	names := make(map[string]bool, len(filters))
+
+	for i, filter := range filters {
+		if filter.Name == "" { //nolint: gocritic
+			errs = append(errs, fmt.Errorf("empty name for dynamic filter n°%d", i+1))
+		} else if names[filter.Name] {
+			errs = append(errs, fmt.Errorf("duplicate dynamic filter name %q", filter.Name))
+		} else {
+			names[filter.Name] = true
+		}
+
+		if filter.Expression == "" {
+			errs = append(errs, fmt.Errorf("empty expression for dynamic filter n°%d", i+1))
+		}
+
+		err := validateDynamicFilter(filter)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dynamic filter n°%d: %w", i+1, err))
+		}
+	}
+
+	return errs
+}
+
+func validateDynamicFilter(filter DynamicFilter) error {
+	filterType := filter.Type
+	if filterType == "" {
+		filterType = DynamicFilterTypeString
+	}
+
+	hints, found := filterUIHints[filterType]
+	if !found {
+		return fmt.Errorf("%w: unknown type %q (accepted values are: %q, %q, %q, %q, %q)", errInvalidFilter, filter.Type,
+			DynamicFilterTypeString, DynamicFilterTypeEnum, DynamicFilterTypeNumber, DynamicFilterTypeDate, DynamicFilterTypeBoolean)
+	}
+
+	if filter.UIHint != "" && !slices.Contains(hints, filter.UIHint) {
+		return fmt.Errorf("%w: UI hint %q can't be used with type %q (accepted values are: %q)", errInvalidFilter, filter.UIHint, filterType, hints)
+	}
+
+	if filterType == DynamicFilterTypeEnum && len(filter.Values) == 0 {
+		return fmt.Errorf("%w: no values given for the enum", errInvalidFilter)
+	}
+
+	if filterType != DynamicFilterTypeEnum && len(filter.Values) > 0 {
+		return fmt.Errorf("%w: values can only be given for the enum type", errInvalidFilter)
+	}
+
+	return nil
+}
+
+// setFilterDefaults sets the type and the UI hint of the dynamic filters that don't define them.
+func setFilterDefaults(filters []DynamicFilter) {
+	for i, filter := range filters {
+		if filter.Type == "" {
+			filters[i].Type = DynamicFilterTypeString
+		}
+
+		if filter.UIHint == "" {
+			filters[i].UIHint = filterUIHints[filters[i].Type][0]
+		}
+	}
+}
+
+// mergeDynamicFilters returns the filters of the parent, replaced by the ones of the child having the same name,
+// followed by the other filters of the child.
+func mergeDynamicFilters(child, parent []DynamicFilter) []DynamicFilter {
+	result := slices.Clone(parent)
+
+	for _, filter := range child {
+		idx := slices.IndexFunc(result, func(f DynamicFilter) bool { return f.Name == filter.Name })
+		if idx >= 0 {
+			result[idx] = filter
+		} else {
+			result = append(result, filter)
+		}
+	}
+
+	setFilterDefaults(result)
+
+	return result
+}
+
+// applicableDynamicFilters returns the given filters whose expression is defined for the given type.
+// The inherited filters are skipped when their expression isn't defined,
+// whereas the ones declared by the type itself must reference one of its expressions.
+func applicableDynamicFilters(imgType *ImageType, filters []DynamicFilter) ([]DynamicFilter, error) {
+	var applicable []DynamicFilter
+
+	for _, filter := range filters {
+		if _, found := imgType.DynamicData.ExpressionsPrograms[filter.Expression]; found {
+			applicable = append(applicable, filter)
+
+			continue
+		}
+
+		if slices.ContainsFunc(imgType.DynamicFilters, func(f DynamicFilter) bool { return f.Name == filter.Name }) {
+			return nil, fmt.Errorf("dynamic filter %q: %w %q", filter.Name, errUnknownFilterExpression, filter.Expression)
+		}
+	}
+
+	return applicable, nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSetFilterDefaults(t *testing.T) {
+	t.Parallel()
+
+	filters := []DynamicFilter{
+		{Name: "a"},
+		{Name: "b", Type: DynamicFilterTypeNumber},
+		{Name: "c", Type: DynamicFilterTypeNumber, UIHint: DynamicFilterUIHintDropdown},
+		{Name: "d", Type: DynamicFilterTypeDate},
+		{Name: "e", Type: DynamicFilterTypeEnum, Values: []string{"x", "y"}},
+	}
+
+	for _, filter := range filters {
+		if err := validateDynamicFilter(filter); err != nil {
+			t.Fatalf("Expected filter %q to be valid, got %v", filter.Name, err)
+		}
+	}
+
+	setFilterDefaults(filters)
+
+	expected := []DynamicFilter{
+		{Name: "a", Type: DynamicFilterTypeString, UIHint: DynamicFilterUIHintDropdown},
+		{Name: "b", Type: DynamicFilterTypeNumber, UIHint: DynamicFilterUIHintRange},
+		{Name: "c", Type: DynamicFilterTypeNumber, UIHint: DynamicFilterUIHintDropdown},
+		{Name: "d", Type: DynamicFilterTypeDate, UIHint: DynamicFilterUIHintDateRange},
+		{Name: "e", Type: DynamicFilterTypeEnum, UIHint: DynamicFilterUIHintDropdown, Values: []string{"x", "y"}},
+	}
+
+	if diff := cmp.Diff(expected, filters); diff != "" {
+		t.Fatalf("Unexpected filters (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadScopedDynamicFilters(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yml")
+
+	writeFile(t, configPath, `
+s3:
+  mode: "polling"
+  pollingPeriod: 10s
+
+products:
+  dynamicData:
+    expressions:
+      title: '"title"'
+  dynamicFilters:
+    - name: "Title"
+      expression: "title"
+    - name: "Satellite"
+      expression: "satellite"
+  imageGroups:
+    - groupName: "Group 1"
+      dynamicData:
+        expressions:
+          satellite: '"S2"'
+      dynamicFilters:
+        - name: "Title"
+          expression: "title"
+          type: enum
+          values: ["title"]
+      types:
+        - name: "A"
+          dynamicData:
+            expressions:
+              cloudCover: "12.5"
+          dynamicFilters:
+            - name: "Cloud cover"
+              expression: "cloudCover"
+              type: number
+        - name: "B"
+    - groupName: "Group 2"
+      types:
+        - name: "C"
+`)
+
+	cfg, _, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %q.", err.Error())
+	}
+
+	title := DynamicFilter{Name: "Title", Expression: "title", Type: DynamicFilterTypeEnum, UIHint: DynamicFilterUIHintDropdown, Values: []string{"title"}}
+	satellite := DynamicFilter{Name: "Satellite", Expression: "satellite", Type: DynamicFilterTypeString, UIHint: DynamicFilterUIHintDropdown}
+	expected := map[string][]DynamicFilter{
+		"A": {title, satellite, {Name: "Cloud cover", Expression: "cloudCover", Type: DynamicFilterTypeNumber, UIHint: DynamicFilterUIHintRange}},
+		"B": {title, satellite},
+		"C": {{Name: "Title", Expression: "title", Type: DynamicFilterTypeString, UIHint: DynamicFilterUIHintDropdown}},
+	}
+	got := make(map[string][]DynamicFilter)
+
+	for _, group := range cfg.Products.ImageGroups {
+		for _, typ := range group.Types {
+			got[typ.Name] = typ.DynamicFilters
+		}
+	}
+
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("Unexpected dynamic filters (-want +got):\n%s", diff)
+	}
+
+	writeFile(t, configPath, `
+s3:
+  mode: "polling"
+  pollingPeriod: 10s
+
+products:
+  imageGroups:
+    - groupName: "Group 1"
+      types:
+        - name: "A"
+          dynamicFilters:
+            - name: "Cloud cover"
+              expression: "cloudCover"
+`)
+
+	_, _, err = Load(configPath)
+	if !errors.Is(err, errUnknownFilterExpression) {
+		t.Fatalf("Expected error %q, got %v.", errUnknownFilterExpression, err)
+	}
+}
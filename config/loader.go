@@ -6,8 +6,10 @@ import (
 	"maps"
 	"math"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -17,7 +19,6 @@ import (
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/vm"
-	"go.yaml.in/yaml/v4"
 )
 
 const defaultCacheDirName = "s3_image_server"
@@ -32,23 +33,40 @@ var (
 	errNoImageGroupsSpecified = errors.New("no image groups specified")
 	errDuplicate              = errors.New("duplicate")
 	errTooHighValue           = errors.New("too high value")
+	errCallCycle              = errors.New("_call cycle")
 )
 
 func Load(configPath string) (Config, []string, error) {
-	file, err := os.Open(configPath)
+	content, err := os.ReadFile(configPath)
 	if err != nil {
 		return Config{}, nil, err //nolint:wrapcheck
 	}
 
-	defer file.Close()
+	doc, info, err := parseDocument(content, configPath)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
 
 	var cfg = defaultConfig()
 
-	err = yaml.NewDecoder(file).Decode(&cfg)
+	err = doc.Decode(&cfg)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	cfg.FieldSources = fieldSources(configPath, doc)
+	setImageGroupsSources(configPath, doc, cfg.Products.ImageGroups)
+	prepareTests(configPath, doc, cfg.Tests)
+
+	includedGroups, includedInfo, err := includeFragments(cfg.Products.Include, filepath.Dir(configPath), len(cfg.Products.ImageGroups))
 	if err != nil {
 		return Config{}, nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	cfg.Products.ImageGroups = append(cfg.Products.ImageGroups, includedGroups...)
+	cfg.SourceFiles = slices.Concat([]string{configPath}, info.files, includedInfo.files)
+	cfg.SecretFields = slices.Concat(info.secretFields, includedInfo.secretFields)
+
 	warnings, err := cfg.validate()
 	if err != nil {
 		return Config{}, warnings, fmt.Errorf("%w: %w", errInvalidConfig, err)
@@ -69,53 +87,45 @@ func (cfg *Config) validate() ([]string, error) {
 	switch cfg.S3.Mode {
 	case S3ModePolling:
 		if cfg.S3.PollingPeriod < time.Second {
-			errs = append(errs, fmt.Errorf("polling period must be at least one second, not %q", cfg.S3.PollingPeriod))
+			errs = append(errs, cfg.withFieldSource("s3.pollingPeriod", fmt.Errorf("polling period must be at least one second, not %q", cfg.S3.PollingPeriod)))
 		}
 	case S3ModeEvent:
 		if cfg.S3.PollingPeriod > 0 {
 			warnings = append(warnings, "polling period is ignored when in event mode")
 		}
 	default:
-		errs = append(errs, fmt.Errorf("unknown S3 mode %q (allowed values are '%s' / '%s')", cfg.S3.Mode, S3ModePolling, S3ModeEvent))
+		errs = append(errs, cfg.withFieldSource("s3.mode", fmt.Errorf("unknown S3 mode %q (allowed values are '%s' / '%s')", cfg.S3.Mode, S3ModePolling, S3ModeEvent)))
 	}
 
-	dynamicFilterNames := make(map[string]bool, len(cfg.Products.DynamicFilters))
-
-	for i, filter := range cfg.Products.DynamicFilters {
-		if filter.Name == "" { //nolint: gocritic
-			errs = append(errs, fmt.Errorf("empty name for dynamic filter n°%d", i+1))
-		} else if dynamicFilterNames[filter.Name] {
-			errs = append(errs, fmt.Errorf("duplicate dynamic filter name %q", filter.Name))
-		} else {
-			dynamicFilterNames[filter.Name] = true
-		}
-
-		if filter.Expression == "" {
-			errs = append(errs, fmt.Errorf("empty expression for dynamic filter n°%d", i+1))
-		}
+	for _, filterErr := range validateDynamicFilters(cfg.Products.DynamicFilters) {
+		errs = append(errs, cfg.withFieldSource("products.dynamicFilters", filterErr))
 	}
 
 	err := validateFileSelectors(cfg.Products.DynamicData.FileSelectors)
 	if err != nil {
-		errs = append(errs, fmt.Errorf("invalid products file selectors: %w", err))
+		errs = append(errs, cfg.withFieldSource("products.dynamicData.fileSelectors", fmt.Errorf("invalid products file selectors: %w", err)))
 	}
 
 	if len(cfg.Products.ImageGroups) == 0 {
-		errs = append(errs, errNoImageGroupsSpecified)
+		errs = append(errs, cfg.withFieldSource("products", errNoImageGroupsSpecified))
 	}
 
 	imageGroupNames := make(map[string]bool)
 
 	for _, grp := range cfg.Products.ImageGroups {
 		if imageGroupNames[grp.GroupName] {
-			errs = append(errs, fmt.Errorf("image group name %q is %w", grp.GroupName, errDuplicate))
+			errs = append(errs, withSource(grp.Source, fmt.Errorf("image group name %q is %w", grp.GroupName, errDuplicate)))
 
 			break
 		}
 
 		err := validateFileSelectors(grp.DynamicData.FileSelectors)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("invalid file selectors in group %q: %w", grp.GroupName, err))
+			errs = append(errs, withSource(grp.Source, fmt.Errorf("invalid file selectors in group %q: %w", grp.GroupName, err)))
+		}
+
+		for _, filterErr := range validateDynamicFilters(grp.DynamicFilters) {
+			errs = append(errs, withSource(grp.Source, fmt.Errorf("in group %q: %w", grp.GroupName, filterErr)))
 		}
 
 		imageGroupNames[grp.GroupName] = true
@@ -123,7 +133,7 @@ func (cfg *Config) validate() ([]string, error) {
 
 		for _, typ := range grp.Types {
 			if imageTypeNames[typ.Name] {
-				errs = append(errs, fmt.Errorf("image type name %q of group %q is %w", typ.Name, grp.GroupName, errDuplicate))
+				errs = append(errs, withSource(typ.Source, fmt.Errorf("image type name %q of group %q is %w", typ.Name, grp.GroupName, errDuplicate)))
 
 				break
 			}
@@ -143,19 +153,77 @@ func (cfg *Config) validate() ([]string, error) {
 
 			err := validateFileSelectors(typ.DynamicData.FileSelectors)
 			if err != nil {
-				errs = append(errs, fmt.Errorf("invalid file selectors in type %q/%q: %w", typ.Name, grp.GroupName, err))
+				errs = append(errs, withSource(typ.Source, fmt.Errorf("invalid file selectors in type %q/%q: %w", typ.Name, grp.GroupName, err)))
+			}
+
+			for _, filterErr := range validateDynamicFilters(typ.DynamicFilters) {
+				errs = append(errs, withSource(typ.Source, fmt.Errorf("in type %q/%q: %w", typ.Name, grp.GroupName, filterErr)))
 			}
 
 			imageTypeNames[typ.Name] = true
 		}
 	}
 
+	if len(errs) == 0 {
+		warnings = append(warnings, validateImageTypesOverlap(cfg.Products.ImageGroups)...)
+	}
+
+	if cfg.Products.ExpressionLimits.Timeout < 0 {
+		errs = append(errs, cfg.withFieldSource("products.expressionLimits.timeout", fmt.Errorf("products.expressionLimits.timeout can't be negative (%s)", cfg.Products.ExpressionLimits.Timeout)))
+	}
+
+	if cfg.Products.ExpressionLimits.MaxFileSize < 0 {
+		errs = append(errs, cfg.withFieldSource("products.expressionLimits.maxFileSize", fmt.Errorf("products.expressionLimits.maxFileSize can't be negative (%d)", cfg.Products.ExpressionLimits.MaxFileSize)))
+	}
+
+	gazetteer := cfg.Products.Gazetteer
+	if gazetteer.CitiesFile == "" && (gazetteer.Admin1CodesFile != "" || gazetteer.Admin2CodesFile != "" || gazetteer.CountryInfoFile != "") {
+		errs = append(errs, cfg.withFieldSource("products.gazetteer", errors.New("products.gazetteer.citiesFile is required to use the other gazetteer files")))
+	}
+
+	if gazetteer.MaxDistance < 0 {
+		errs = append(errs, cfg.withFieldSource("products.gazetteer.maxDistance", fmt.Errorf("products.gazetteer.maxDistance can't be negative (%g)", gazetteer.MaxDistance)))
+	}
+
+	if cfg.Cache.DeepZoom.MinSize < 0 {
+		errs = append(errs, cfg.withFieldSource("cache.deepZoom.minSize", fmt.Errorf("cache.deepZoom.minSize can't be negative (%d)", cfg.Cache.DeepZoom.MinSize)))
+	}
+
+	if cfg.Cache.DeepZoom.TileSize <= 0 {
+		errs = append(errs, cfg.withFieldSource("cache.deepZoom.tileSize", fmt.Errorf("cache.deepZoom.tileSize must be positive (%d)", cfg.Cache.DeepZoom.TileSize)))
+	}
+
+	if cfg.Cache.MaxTIFFPixels < 0 {
+		errs = append(errs, cfg.withFieldSource("cache.maxTIFFPixels", fmt.Errorf("cache.maxTIFFPixels can't be negative (%d)", cfg.Cache.MaxTIFFPixels)))
+	}
+
+	if cfg.Cache.MaxDecodedPixels < 0 {
+		errs = append(errs, cfg.withFieldSource("cache.maxDecodedPixels", fmt.Errorf("cache.maxDecodedPixels can't be negative (%d)", cfg.Cache.MaxDecodedPixels)))
+	}
+
+	if cfg.Cache.Export.MaxImages < 0 {
+		errs = append(errs, cfg.withFieldSource("cache.export.maxImages", fmt.Errorf("cache.export.maxImages can't be negative (%d)", cfg.Cache.Export.MaxImages)))
+	}
+
+	if cfg.Cache.Export.MaxSignedObjectSize < 0 {
+		errs = append(errs, cfg.withFieldSource("cache.export.maxSignedObjectSize", fmt.Errorf("cache.export.maxSignedObjectSize can't be negative (%d)", cfg.Cache.Export.MaxSignedObjectSize)))
+	}
+
+	err = validateTests(cfg.Tests, cfg.Products.ImageGroups)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	if cfg.UI.ScaleInitialPercentage > math.MaxInt {
-		errs = append(errs, fmt.Errorf("ui.scaleInitialPercentage has a %w (%d)", errTooHighValue, cfg.UI.ScaleInitialPercentage))
+		errs = append(errs, cfg.withFieldSource("ui.scaleInitialPercentage", fmt.Errorf("ui.scaleInitialPercentage has a %w (%d)", errTooHighValue, cfg.UI.ScaleInitialPercentage)))
 	}
 
 	if cfg.UI.MaxImagesDisplayCount > math.MaxInt {
-		errs = append(errs, fmt.Errorf("ui.maxImagesDisplayCount as a %w (%d)", errTooHighValue, cfg.UI.MaxImagesDisplayCount))
+		errs = append(errs, cfg.withFieldSource("ui.maxImagesDisplayCount", fmt.Errorf("ui.maxImagesDisplayCount as a %w (%d)", errTooHighValue, cfg.UI.MaxImagesDisplayCount)))
+	}
+
+	if cfg.UI.Map.PMTilesFile != "" && cfg.UI.Map.MBTilesFile != "" {
+		errs = append(errs, cfg.withFieldSource("ui.map.pmtilesFile", errors.New("ui.map.pmtilesFile and ui.map.mbtilesFile can't be used together")))
 	}
 
 	return warnings, errors.Join(errs...)
@@ -166,6 +234,32 @@ func validateFileSelectors(fileSelectors map[string]FileSelector) error {
 		if selector.Kind != FileSelectorKindCached && selector.Kind != FileSelectorKindSignedURL && !fullProductSignedURLRegexp.MatchString(selector.Kind) && !externalViewerURLRegexp.MatchString(selector.Kind) {
 			return fmt.Errorf("selector %q: unknown kind %q (accepted values are: %q, %q, %q, %q)", name, selector.Kind, FileSelectorKindCached, FileSelectorKindSignedURL, FileSelectorKindFullProductSignedURL, FileSelectorKindExternalViewerURL)
 		}
+
+		if selector.Multiple {
+			if name == types.ObjectPreview {
+				return fmt.Errorf("selector %q: the preview can't match multiple objects", name)
+			}
+
+			if externalViewerURLRegexp.MatchString(selector.Kind) {
+				return fmt.Errorf("selector %q: multiple objects are not supported by kind %q", name, FileSelectorKindExternalViewerURL)
+			}
+		}
+
+		if selector.Member != "" {
+			if selector.Kind != FileSelectorKindCached {
+				return fmt.Errorf("selector %q: archive members are only supported by kind %q", name, FileSelectorKindCached)
+			}
+
+			if _, err := path.Match(selector.Member, ""); err != nil {
+				return fmt.Errorf("selector %q: invalid member pattern %q: %w", name, selector.Member, err)
+			}
+		}
+
+		for prefix, uri := range selector.Namespaces {
+			if prefix == "" || strings.Contains(prefix, ":") || uri == "" {
+				return fmt.Errorf("selector %q: invalid namespace %q: %q", name, prefix, uri)
+			}
+		}
 	}
 
 	return nil
@@ -187,6 +281,8 @@ func (cfg *Config) process() (err error) {
 		cfg.UI.BaseURL = "/"
 	}
 
+	setFilterDefaults(cfg.Products.DynamicFilters)
+
 	cfg.Products.TargetRelativeRgx, err = regexp.Compile(cfg.Products.TargetRelativeRegexp)
 	if err != nil {
 		return fmt.Errorf("can't parse products.targetRelativeRegexp: %w", err)
@@ -194,13 +290,26 @@ func (cfg *Config) process() (err error) {
 
 	for g, imgGroup := range cfg.Products.ImageGroups {
 		cfg.Products.ImageGroups[g].DynamicData = mergeDynamicData(imgGroup.DynamicData, cfg.Products.DynamicData)
+		cfg.Products.ImageGroups[g].DynamicFilters = mergeDynamicFilters(imgGroup.DynamicFilters, cfg.Products.DynamicFilters)
 
 		for t, imgType := range imgGroup.Types {
+			err = parseProductMatching(imgGroup.GroupName, &cfg.Products.ImageGroups[g].Types[t])
+			if err != nil {
+				return withSource(imgType.Source, err)
+			}
+
 			cfg.Products.ImageGroups[g].Types[t].DynamicData = mergeDynamicData(imgType.DynamicData, cfg.Products.ImageGroups[g].DynamicData)
 
-			err = ParseDynamicData(imgGroup.GroupName, imgType.Name, &cfg.Products.ImageGroups[g].Types[t].DynamicData, cfg.Products.ExternalViewers)
+			err = parseDynamicData(imgGroup.GroupName, imgType.Name, &cfg.Products.ImageGroups[g].Types[t].DynamicData, cfg.Products.ExternalViewers, cfg.Products.ExpressionLimits)
 			if err != nil {
-				return err
+				return withSource(imgType.Source, err)
+			}
+
+			typ := &cfg.Products.ImageGroups[g].Types[t]
+
+			typ.DynamicFilters, err = applicableDynamicFilters(typ, mergeDynamicFilters(imgType.DynamicFilters, cfg.Products.ImageGroups[g].DynamicFilters))
+			if err != nil {
+				return withSource(imgType.Source, fmt.Errorf("in type %q/%q: %w", imgType.Name, imgGroup.GroupName, err))
 			}
 		}
 	}
@@ -228,13 +337,19 @@ func mergeDynamicData(child, parent DynamicData) DynamicData {
 	return result
 }
 
+// ParseDynamicData parses the file selectors and the expressions of the given dynamic data,
+// with the default expression limits.
 func ParseDynamicData(imgGroup, imgType string, dynData *DynamicData, externalViewers map[string]string) error {
+	return parseDynamicData(imgGroup, imgType, dynData, externalViewers, defaultExpressionLimits())
+}
+
+func parseDynamicData(imgGroup, imgType string, dynData *DynamicData, externalViewers map[string]string, limits ExpressionLimits) error {
 	err := parseFileSelectors(dynData.FileSelectors)
 	if err != nil {
 		return fmt.Errorf("can't parse products.imageGroups[%q].types[%q].dynamicData.fileSelectors: %w", imgGroup, imgType, err)
 	}
 
-	dynData.ExpressionsPrograms, err = parseExpressions(dynData.Expressions)
+	dynData.ExpressionsPrograms, err = parseExpressions(dynData.Expressions, limits)
 	if err != nil {
 		return fmt.Errorf("can't parse products.imageGroups[%q].types[%q].dynamicData.expressions: %w", imgGroup, imgType, err)
 	}
@@ -301,7 +416,7 @@ func parseFileSelectors(fileSelectors map[string]FileSelector) error {
 	return nil
 }
 
-func parseExpressions(expressions map[string]string) (map[string]*vm.Program, error) {
+func parseExpressions(expressions map[string]string, limits ExpressionLimits) (map[string]*vm.Program, error) {
 	result := make(map[string]*vm.Program, len(expressions))
 
 	options := append( //nolint: gocritic
@@ -309,6 +424,7 @@ func parseExpressions(expressions map[string]string) (map[string]*vm.Program, er
 		expr.Env(types.ExprEnv{}),
 		expr.WithContext("Ctx"),
 		expr.Patch(types.ExprEnvInjector{}),
+		expr.MaxNodes(limits.MaxNodes),
 	)
 
 	if testing.Testing() {
@@ -329,6 +445,11 @@ func parseExpressions(expressions map[string]string) (map[string]*vm.Program, er
 		result[name] = program
 	}
 
+	err := checkCallCycles(result)
+	if err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
@@ -339,7 +460,7 @@ type exprValidator struct {
 func (ev *exprValidator) Visit(node *ast.Node) {
 	if callNode, ok := (*node).(*ast.CallNode); ok { //nolint: nestif
 		if callee, ok := callNode.Callee.(*ast.IdentifierNode); ok {
-			switch callee.Value { //nolint: gocritic
+			switch callee.Value {
 			case "_replaceRegex":
 				regexParam, ok := callNode.Arguments[1].(*ast.StringNode)
 				if !ok {
@@ -351,6 +472,24 @@ func (ev *exprValidator) Visit(node *ast.Node) {
 					ev.errs = append(ev.errs, fmt.Errorf("_replaceRegex: %w", err))
 					return
 				}
+			case "_formatDate", "_parseDate":
+				if len(callNode.Arguments) < 3 {
+					return
+				}
+
+				if tzParam, ok := callNode.Arguments[2].(*ast.StringNode); ok {
+					if _, err := time.LoadLocation(tzParam.Value); err != nil {
+						ev.errs = append(ev.errs, fmt.Errorf("%s: %w", callee.Value, err))
+					}
+				}
+			case "_jq":
+				if len(callNode.Arguments) < 4 { // the context is the first argument
+					return
+				}
+
+				if formatParam, ok := callNode.Arguments[3].(*ast.StringNode); ok && !types.IsFileFormat(formatParam.Value) {
+					ev.errs = append(ev.errs, fmt.Errorf("_jq: unknown file format %q", formatParam.Value))
+				}
 			}
 		}
 	}
@@ -363,3 +502,79 @@ func validateExpression(node ast.Node) error {
 
 	return errors.Join(v.errs...)
 }
+
+// checkCallCycles returns an error if the given expressions call each other in a cycle through _call.
+// Only the calls with a literal expression name can be checked.
+func checkCallCycles(programs map[string]*vm.Program) error {
+	calls := make(map[string][]string, len(programs))
+
+	for name, program := range programs {
+		var v callCollector
+
+		node := program.Node()
+		ast.Walk(&node, &v)
+
+		calls[name] = v.callees
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(calls))
+
+	var visit func(path []string) error
+
+	visit = func(path []string) error {
+		name := path[len(path)-1]
+
+		switch state[name] {
+		case visiting:
+			start := slices.Index(path, name)
+
+			return fmt.Errorf("%w: %s", errCallCycle, strings.Join(path[start:], " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+
+		for _, callee := range calls[name] {
+			err := visit(append(slices.Clip(path), callee))
+			if err != nil {
+				return err
+			}
+		}
+
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(calls)) {
+		if state[name] == unvisited {
+			err := visit([]string{name})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type callCollector struct {
+	callees []string
+}
+
+func (cc *callCollector) Visit(node *ast.Node) {
+	if callNode, ok := (*node).(*ast.CallNode); ok {
+		if callee, ok := callNode.Callee.(*ast.IdentifierNode); ok && callee.Value == "_call" && len(callNode.Arguments) > 0 {
+			if exprName, ok := callNode.Arguments[0].(*ast.StringNode); ok {
+				cc.callees = append(cc.callees, exprName.Value)
+			}
+		}
+	}
+}
@@ -48,6 +48,8 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 					},
 				},
 				Products: Products{
+					ExpressionLimits: defaultExpressionLimits(),
+					Gazetteer:        defaultGazetteer(),
 					ExternalViewers: map[string]string{
 						"viewer1": "localhost:8080",
 					},
@@ -91,8 +93,9 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 							},
 							Types: []ImageType{
 								{
-									Name:        "1",
-									DisplayName: "One",
+									Name:          "1",
+									DisplayName:   "One",
+									ProductPrefix: "one/",
 									DynamicData: DynamicData{
 										FileSelectors: map[string]FileSelector{
 											"preview": {
@@ -115,10 +118,12 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 											"image": nil,
 										},
 									},
+									Source: "./testdata/valid_cfg.yml:40",
 								},
 								{
-									Name:        "2",
-									DisplayName: "Two",
+									Name:         "2",
+									DisplayName:  "Two",
+									ProductRegex: "^two/[0-9]{4}/TYPE_2/",
 									DynamicData: DynamicData{
 										FileSelectors: map[string]FileSelector{
 											"preview": {
@@ -162,14 +167,20 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 											"extUri":    nil,
 										},
 									},
+									Source: "./testdata/valid_cfg.yml:46",
 								},
 							},
+							Source: "./testdata/valid_cfg.yml:28",
 						},
 					},
 				},
 				Cache: Cache{
-					CacheDir:        "/tmp/s3_image_server",
-					RetentionPeriod: 7 * 24 * time.Hour,
+					CacheDir:         "/tmp/s3_image_server",
+					RetentionPeriod:  7 * 24 * time.Hour,
+					DeepZoom:         defaultDeepZoom(),
+					MaxTIFFPixels:    100_000_000,
+					MaxDecodedPixels: 100_000_000,
+					Export:           defaultExport(),
 				},
 				Log: Log{
 					LogLevel:      "info",
@@ -192,7 +203,13 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 						Max:   1 * time.Second,
 						Count: 5,
 					},
+					ExprDurationBuckets: HistogramsBuckets{
+						Min:   10 * time.Microsecond,
+						Max:   1 * time.Second,
+						Count: 10,
+					},
 				},
+				SourceFiles: []string{"./testdata/valid_cfg.yml"},
 			},
 			expectedWarnings: []string{
 				`no file selector provided for object type "localization", in type "Group 1"/"1"`,
@@ -216,6 +233,8 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 					},
 				},
 				Products: Products{
+					ExpressionLimits: defaultExpressionLimits(),
+					Gazetteer:        defaultGazetteer(),
 					ImageGroups: []ImageGroup{
 						{
 							GroupName: "Group 1",
@@ -223,12 +242,17 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 								FileSelectors: map[string]FileSelector{},
 								Expressions:   map[string]string{},
 							},
+							Source: "./testdata/s3_endpoint_transform.yml:7",
 						},
 					},
 				},
 				Cache: Cache{
-					CacheDir:        "/tmp/s3_image_server",
-					RetentionPeriod: 7 * 24 * time.Hour,
+					CacheDir:         "/tmp/s3_image_server",
+					RetentionPeriod:  7 * 24 * time.Hour,
+					DeepZoom:         defaultDeepZoom(),
+					MaxTIFFPixels:    100_000_000,
+					MaxDecodedPixels: 100_000_000,
+					Export:           defaultExport(),
 				},
 				Log: Log{
 					LogLevel:  "info",
@@ -246,7 +270,13 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 						Max:   20 * time.Second,
 						Count: 10,
 					},
+					ExprDurationBuckets: HistogramsBuckets{
+						Min:   10 * time.Microsecond,
+						Max:   1 * time.Second,
+						Count: 10,
+					},
 				},
+				SourceFiles: []string{"./testdata/s3_endpoint_transform.yml"},
 			},
 			expectedError: "",
 		},
@@ -261,7 +291,7 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 				`no file selector provided for object type "geonames", in type "grp"/"typ"`,
 				`no file selector provided for object type "localization", in type "grp"/"typ"`,
 			},
-			expectedError: `the config is invalid: image type name "typ" of group "grp" is duplicate`,
+			expectedError: `the config is invalid: ./testdata/invalid_cfg.yml:11: image type name "typ" of group "grp" is duplicate`,
 		},
 	}
 
@@ -286,7 +316,7 @@ func TestLoad(t *testing.T) { //nolint: maintidx
 				t.Errorf("Unexpected warnings (-wanted +got):\n%s", diff)
 			}
 
-			if diff := cmp.Diff(tc.expectedConfig, cfg, ignoreType[*regexp.Regexp](), ignoreType[*vm.Program]()); diff != "" {
+			if diff := cmp.Diff(tc.expectedConfig, cfg, ignoreType[*regexp.Regexp](), ignoreType[*vm.Program](), cmpopts.IgnoreFields(Config{}, "FieldSources")); diff != "" {
 				t.Fatal("Unexpected config (-wanted +got):\n", diff)
 			}
 		})
@@ -360,6 +390,24 @@ func TestValidate(t *testing.T) {
 				`duplicate dynamic filter name "filter"`,
 			},
 		},
+		{
+			name: "invalid typed dynamic filters",
+			mutate: func(cfg *Config) {
+				cfg.Products.DynamicFilters = []DynamicFilter{
+					{Name: "a", Expression: "1", Type: "color"},
+					{Name: "b", Expression: "1", Type: DynamicFilterTypeString, UIHint: DynamicFilterUIHintRange},
+					{Name: "c", Expression: "1", Type: DynamicFilterTypeEnum},
+					{Name: "d", Expression: "1", Type: DynamicFilterTypeNumber, Values: []string{"1"}},
+					{Name: "e", Expression: "1", Type: DynamicFilterTypeDate, UIHint: DynamicFilterUIHintDateRange},
+				}
+			},
+			expectedErrors: []string{
+				`dynamic filter n°1: invalid dynamic filter: unknown type "color"`,
+				`dynamic filter n°2: invalid dynamic filter: UI hint "range" can't be used with type "string"`,
+				"dynamic filter n°3: invalid dynamic filter: no values given for the enum",
+				"dynamic filter n°4: invalid dynamic filter: values can only be given for the enum type",
+			},
+		},
 		{
 			name: "unknown products selector kind",
 			mutate: func(cfg *Config) {
@@ -415,6 +463,59 @@ func TestValidate(t *testing.T) {
 			},
 			expectedErrors: []string{`invalid file selectors in type "typ"/"grp": selector "bad": unknown kind "unknown"`},
 		},
+		{
+			name: "invalid multiple selectors",
+			mutate: func(cfg *Config) {
+				cfg.Products.ImageGroups[0].DynamicData.FileSelectors = map[string]FileSelector{
+					"preview": {
+						Regex:    ".*",
+						Kind:     FileSelectorKindCached,
+						Multiple: true,
+					},
+				}
+				cfg.Products.ImageGroups[0].Types[0].DynamicData.FileSelectors["ext"] = FileSelector{
+					Regex:    ".*",
+					Kind:     "externalViewerURL(viewer, expr)",
+					Multiple: true,
+				}
+			},
+			expectedErrors: []string{
+				`invalid file selectors in group "grp": selector "preview": the preview can't match multiple objects`,
+				`invalid file selectors in type "typ"/"grp": selector "ext": multiple objects are not supported by kind "externalViewerURL"`,
+			},
+		},
+		{
+			name: "invalid selector namespace",
+			mutate: func(cfg *Config) {
+				cfg.Products.ImageGroups[0].Types[0].DynamicData.FileSelectors["metadata"] = FileSelector{
+					Regex:      ".*",
+					Kind:       FileSelectorKindCached,
+					Namespaces: map[string]string{"gmd": ""},
+				}
+			},
+			expectedErrors: []string{`invalid file selectors in type "typ"/"grp": selector "metadata": invalid namespace "gmd": ""`},
+		},
+		{
+			name: "invalid archive members",
+			mutate: func(cfg *Config) {
+				cfg.Products.ImageGroups[0].DynamicData.FileSelectors = map[string]FileSelector{
+					"quicklook": {
+						Regex:  `\.zip$`,
+						Kind:   FileSelectorKindSignedURL,
+						Member: "*.png",
+					},
+				}
+				cfg.Products.ImageGroups[0].Types[0].DynamicData.FileSelectors["metadata"] = FileSelector{
+					Regex:  `\.zip$`,
+					Kind:   FileSelectorKindCached,
+					Member: "[",
+				}
+			},
+			expectedErrors: []string{
+				`invalid file selectors in group "grp": selector "quicklook": archive members are only supported by kind "cached"`,
+				`invalid file selectors in type "typ"/"grp": selector "metadata": invalid member pattern "[": syntax error in pattern`,
+			},
+		},
 		{
 			name: "too high UI values",
 			mutate: func(cfg *Config) {
@@ -426,6 +527,49 @@ func TestValidate(t *testing.T) {
 				"ui.maxImagesDisplayCount as a too high value",
 			},
 		},
+		{
+			name: "both local map tiles",
+			mutate: func(cfg *Config) {
+				cfg.UI.Map.PMTilesFile = "map.pmtiles"
+				cfg.UI.Map.MBTilesFile = "map.mbtiles"
+			},
+			expectedErrors: []string{"ui.map.pmtilesFile and ui.map.mbtilesFile can't be used together"},
+		},
+		{
+			name: "invalid deep zoom sizes",
+			mutate: func(cfg *Config) {
+				cfg.Cache.DeepZoom = DeepZoom{MinSize: -1, TileSize: 0}
+			},
+			expectedErrors: []string{
+				"cache.deepZoom.minSize can't be negative (-1)",
+				"cache.deepZoom.tileSize must be positive (0)",
+			},
+		},
+		{
+			name: "negative tiff pixel limit",
+			mutate: func(cfg *Config) {
+				cfg.Cache.MaxTIFFPixels = -1
+			},
+			expectedErrors: []string{"cache.maxTIFFPixels can't be negative (-1)"},
+		},
+		{
+			name: "negative decoded pixel limit",
+			mutate: func(cfg *Config) {
+				cfg.Cache.MaxDecodedPixels = -1
+			},
+			expectedErrors: []string{"cache.maxDecodedPixels can't be negative (-1)"},
+		},
+		{
+			name: "negative export limits",
+			mutate: func(cfg *Config) {
+				cfg.Cache.Export.MaxImages = -1
+				cfg.Cache.Export.MaxSignedObjectSize = -1
+			},
+			expectedErrors: []string{
+				"cache.export.maxImages can't be negative (-1)",
+				"cache.export.maxSignedObjectSize can't be negative (-1)",
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -823,13 +967,23 @@ func TestParseExpressionsErrors(t *testing.T) {
 			expression:    `_replaceRegex("value", "[", "replacement")`,
 			expectedError: `expression "expr": _replaceRegex: error parsing regexp: missing closing ]`,
 		},
+		{
+			name:          "unknown time zone",
+			expression:    `_formatDate(Files.preview.Date, "2006-01-02", "Mars/Olympus_Mons")`,
+			expectedError: `expression "expr": _formatDate: unknown time zone Mars/Olympus_Mons`,
+		},
+		{
+			name:          "unknown file format",
+			expression:    `_jq("metadata", ".key", "xlsx")`,
+			expectedError: `expression "expr": _jq: unknown file format "xlsx"`,
+		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			_, err := parseExpressions(map[string]string{"expr": tc.expression})
+			_, err := parseExpressions(map[string]string{"expr": tc.expression}, defaultExpressionLimits())
 			if err == nil {
 				t.Fatal("Expected an error, got none.")
 			}
@@ -841,6 +995,84 @@ func TestParseExpressionsErrors(t *testing.T) {
 	}
 }
 
+func TestParseExpressionsLimits(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		expressions   map[string]string
+		limits        ExpressionLimits
+		expectedError string
+	}{
+		{
+			name: "calls without cycle",
+			expressions: map[string]string{
+				"a": `_call("b") + _call("c")`,
+				"b": `_call("c")`,
+				"c": `"c"`,
+			},
+			limits: defaultExpressionLimits(),
+		},
+		{
+			name: "dynamic call",
+			expressions: map[string]string{
+				"a": `_call(Files.preview.S3Path)`,
+			},
+			limits: defaultExpressionLimits(),
+		},
+		{
+			name: "self call",
+			expressions: map[string]string{
+				"a": `_call("a")`,
+			},
+			limits:        defaultExpressionLimits(),
+			expectedError: "_call cycle: a -> a",
+		},
+		{
+			name: "call cycle",
+			expressions: map[string]string{
+				"a": `"a"`,
+				"b": `_call("c")`,
+				"c": `_call("a") + _call("d")`,
+				"d": `_call("b")`,
+			},
+			limits:        defaultExpressionLimits(),
+			expectedError: "_call cycle: b -> c -> d -> b",
+		},
+		{
+			name: "too many nodes",
+			expressions: map[string]string{
+				"a": `1 + 2 + 3 + 4`,
+			},
+			limits:        ExpressionLimits{MaxNodes: 3},
+			expectedError: `expression "a": compilation failed: expression exceeds maximum allowed nodes`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseExpressions(tc.expressions, tc.limits)
+			if err != nil {
+				if tc.expectedError == "" {
+					t.Fatalf("Expected no error, but got %q.", err.Error())
+				}
+
+				if !strings.Contains(err.Error(), tc.expectedError) {
+					t.Fatalf("Expected error to contain %q, got %q.", tc.expectedError, err.Error())
+				}
+
+				return
+			}
+
+			if tc.expectedError != "" {
+				t.Fatalf("Expected error %q, got none.", tc.expectedError)
+			}
+		})
+	}
+}
+
 func requiredObjectFileSelectors() map[string]FileSelector {
 	return map[string]FileSelector{
 		"preview": {
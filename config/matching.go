@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/utils"
+
+	"github.com/expr-lang/expr"
+)
+
+// ProductMatchEnv is the environment of the productMatch expressions.
+type ProductMatchEnv struct {
+	Bucket string
+	Key    string
+}
+
+// MatchesObject returns whether the given object belongs to this image type.
+// All the matching criteria defined for the type must be satisfied.
+func (typ ImageType) MatchesObject(bucket, objectKey string) (bool, error) {
+	if !strings.HasPrefix(objectKey, typ.ProductPrefix) {
+		return false, nil
+	}
+
+	if typ.ProductRgx != nil && !typ.ProductRgx.MatchString(objectKey) {
+		return false, nil
+	}
+
+	if typ.ProductMatchProgram != nil {
+		output, err := expr.Run(typ.ProductMatchProgram, ProductMatchEnv{Bucket: bucket, Key: objectKey})
+		if err != nil {
+			return false, fmt.Errorf("productMatch of type %q: %w", typ.Name, err)
+		}
+
+		match, _ := output.(bool)
+
+		return match, nil
+	}
+
+	return true, nil
+}
+
+// ListingPrefix returns the S3 prefix under which all the objects of this type are located.
+// It is the product prefix if any, or the literal prefix of the product regex when it is anchored.
+func (typ ImageType) ListingPrefix() string {
+	if typ.ProductPrefix != "" || typ.ProductRegex == "" {
+		return typ.ProductPrefix
+	}
+
+	re, err := syntax.Parse(typ.ProductRegex, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+
+	prefix, anchored, _ := regexPrefix(re)
+	if !anchored {
+		return ""
+	}
+
+	return prefix
+}
+
+// regexPrefix returns the literal text each match of the given regex starts with, whether these matches
+// are anchored at the beginning of the text, and whether the regex is only made of this text.
+// Unlike [regexp.Regexp.LiteralPrefix], it handles the regexes which can't be matched in one pass.
+func regexPrefix(re *syntax.Regexp) (prefix string, anchored, literal bool) {
+	switch re.Op { //nolint:exhaustive
+	case syntax.OpBeginText:
+		return "", true, true
+	case syntax.OpEmptyMatch:
+		return "", false, true
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return "", false, false
+		}
+
+		return string(re.Rune), false, true
+	case syntax.OpCapture:
+		return regexPrefix(re.Sub[0])
+	case syntax.OpConcat:
+		var sb strings.Builder
+
+		for _, sub := range re.Sub {
+			subPrefix, subAnchored, subLiteral := regexPrefix(sub)
+			// An anchor is only meaningful before any text.
+			anchored = anchored || subAnchored && sb.Len() == 0
+
+			sb.WriteString(subPrefix)
+
+			if !subLiteral {
+				return sb.String(), anchored, false
+			}
+		}
+
+		return sb.String(), anchored, true
+	case syntax.OpAlternate:
+		prefixes := make([]string, len(re.Sub))
+		anchored = true
+
+		for i, sub := range re.Sub {
+			var subAnchored bool
+
+			prefixes[i], subAnchored, _ = regexPrefix(sub)
+			anchored = anchored && subAnchored
+		}
+
+		return utils.CommonPrefix(prefixes...), anchored, false
+	default:
+		return "", false, false
+	}
+}
+
+func (typ ImageType) hasMatchingRules() bool {
+	return typ.ProductRegex != "" || typ.ProductMatch != ""
+}
+
+func parseProductMatching(imgGroup string, typ *ImageType) (err error) {
+	if typ.ProductRegex != "" {
+		typ.ProductRgx, err = regexp.Compile(typ.ProductRegex)
+		if err != nil {
+			return fmt.Errorf("can't parse products.imageGroups[%q].types[%q].productRegex: %w", imgGroup, typ.Name, err)
+		}
+	}
+
+	if typ.ProductMatch != "" {
+		typ.ProductMatchProgram, err = expr.Compile(typ.ProductMatch, expr.Env(ProductMatchEnv{}), expr.AsBool())
+		if err != nil {
+			return fmt.Errorf("can't parse products.imageGroups[%q].types[%q].productMatch: %w", imgGroup, typ.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateImageTypesOverlap reports the image types that can't be reached,
+// because the objects they match are already claimed by a type defined before them in the same bucket,
+// and the types with matching rules whose bucket has to be listed entirely.
+// Regexes and expressions are only compared as text: other overlaps between them are not detected.
+func validateImageTypesOverlap(imageGroups []ImageGroup) []string {
+	type typeRef struct {
+		group string
+		typ   ImageType
+	}
+
+	var warnings []string
+
+	typesPerBucket := make(map[string][]typeRef)
+
+	for _, grp := range imageGroups {
+		for _, typ := range grp.Types {
+			if typ.hasMatchingRules() && typ.ListingPrefix() == "" {
+				warnings = append(warnings, fmt.Sprintf("image type %q/%q has no listing prefix, so its whole bucket will be listed: "+
+					"set its productPrefix, or start its productRegex with ^ and a literal text", grp.GroupName, typ.Name))
+			}
+
+			for _, previous := range typesPerBucket[grp.Bucket] {
+				prev := previous.typ
+				// The objects of the type are also under the prefix of the previous one.
+				underPrefix := strings.HasPrefix(typ.ListingPrefix(), prev.ProductPrefix)
+
+				switch {
+				case prev.ProductPrefix == typ.ProductPrefix && prev.ProductRegex == typ.ProductRegex && prev.ProductMatch == typ.ProductMatch:
+					warnings = append(warnings, fmt.Sprintf("image type %q/%q has the same matching rules as %q/%q and will never match", grp.GroupName, typ.Name, previous.group, prev.Name))
+				case underPrefix && !prev.hasMatchingRules():
+					warnings = append(warnings, fmt.Sprintf("image type %q/%q is shadowed by %q/%q, whose product prefix %q already matches all its objects", grp.GroupName, typ.Name, previous.group, prev.Name, prev.ProductPrefix))
+				case underPrefix && (prev.ProductRegex == "" || prev.ProductRegex == typ.ProductRegex) && (prev.ProductMatch == "" || prev.ProductMatch == typ.ProductMatch):
+					warnings = append(warnings, fmt.Sprintf("image type %q/%q is shadowed by %q/%q, whose matching rules are also rules of its own and already match all its objects", grp.GroupName, typ.Name, previous.group, prev.Name))
+				}
+			}
+
+			typesPerBucket[grp.Bucket] = append(typesPerBucket[grp.Bucket], typeRef{grp.GroupName, typ})
+		}
+	}
+
+	return warnings
+}
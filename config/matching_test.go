@@ -0,0 +1,181 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestImageTypeMatchesObject(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		typ            ImageType
+		expectedPrefix string
+		matching       []string
+		notMatching    []string
+	}{
+		{
+			name:           "prefix only",
+			typ:            ImageType{Name: "typ", ProductPrefix: "site/TYPE_A/"},
+			expectedPrefix: "site/TYPE_A/",
+			matching:       []string{"site/TYPE_A/1/preview.jpg"},
+			notMatching:    []string{"site/TYPE_B/1/preview.jpg"},
+		},
+		{
+			name:           "anchored regex",
+			typ:            ImageType{Name: "typ", ProductRegex: `^site/\d{4}/\d{2}/TYPE_A/`},
+			expectedPrefix: "site/",
+			matching:       []string{"site/2024/10/TYPE_A/1/preview.jpg"},
+			notMatching:    []string{"site/2024/10/TYPE_B/1/preview.jpg", "other/site/2024/10/TYPE_A/preview.jpg"},
+		},
+		{
+			name:           "anchored regex not matched in one pass",
+			typ:            ImageType{Name: "typ", ProductRegex: `^site/.*/TYPE_A/`},
+			expectedPrefix: "site/",
+			matching:       []string{"site/2024/10/TYPE_A/1/preview.jpg"},
+			notMatching:    []string{"site/2024/10/TYPE_B/1/preview.jpg", "other/site/2024/TYPE_A/preview.jpg"},
+		},
+		{
+			name:           "anchored alternation",
+			typ:            ImageType{Name: "typ", ProductRegex: `^site/(TYPE_A|TYPE_B)/|^site/archive/`},
+			expectedPrefix: "site/",
+			matching:       []string{"site/TYPE_B/1/preview.jpg", "site/archive/1/preview.jpg"},
+			notMatching:    []string{"site/TYPE_C/1/preview.jpg"},
+		},
+		{
+			name:           "alternation of which one branch is not anchored",
+			typ:            ImageType{Name: "typ", ProductRegex: `^site/TYPE_A/|/TYPE_B/`},
+			expectedPrefix: "",
+			matching:       []string{"site/TYPE_A/1/preview.jpg", "other/TYPE_B/1/preview.jpg"},
+			notMatching:    []string{"site/TYPE_C/1/preview.jpg"},
+		},
+		{
+			name:           "case insensitive regex",
+			typ:            ImageType{Name: "typ", ProductRegex: `^(?i)site/TYPE_A/`},
+			expectedPrefix: "",
+			matching:       []string{"SITE/type_a/1/preview.jpg"},
+			notMatching:    []string{"site/TYPE_B/1/preview.jpg"},
+		},
+		{
+			name:           "anchored regex with a capture",
+			typ:            ImageType{Name: "typ", ProductRegex: `^(site/TYPE_A)/\d+/`},
+			expectedPrefix: "site/TYPE_A/",
+			matching:       []string{"site/TYPE_A/1/preview.jpg"},
+			notMatching:    []string{"site/TYPE_AB/1/preview.jpg"},
+		},
+		{
+			name:           "unanchored regex",
+			typ:            ImageType{Name: "typ", ProductRegex: `/TYPE_A/`},
+			expectedPrefix: "",
+			matching:       []string{"site/2024/10/TYPE_A/1/preview.jpg", "other/TYPE_A/preview.jpg"},
+			notMatching:    []string{"site/2024/10/TYPE_B/1/preview.jpg"},
+		},
+		{
+			name:           "prefix and expression",
+			typ:            ImageType{Name: "typ", ProductPrefix: "site/", ProductMatch: `split(Key, "/")[3] == "TYPE_A" && Bucket == "bkt"`},
+			expectedPrefix: "site/",
+			matching:       []string{"site/2024/10/TYPE_A/1/preview.jpg"},
+			notMatching:    []string{"site/2024/10/TYPE_B/1/preview.jpg", "other/2024/10/TYPE_A/1/preview.jpg"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			typ := tc.typ
+
+			err := parseProductMatching("grp", &typ)
+			if err != nil {
+				t.Fatal("Unexpected error:", err)
+			}
+
+			if prefix := typ.ListingPrefix(); prefix != tc.expectedPrefix {
+				t.Fatalf("Unexpected listing prefix: want %q, got %q", tc.expectedPrefix, prefix)
+			}
+
+			for key, expected := range map[bool][]string{true: tc.matching, false: tc.notMatching} {
+				for _, objectKey := range expected {
+					match, err := typ.MatchesObject("bkt", objectKey)
+					if err != nil {
+						t.Fatalf("Unexpected error for %q: %v", objectKey, err)
+					}
+
+					if match != key {
+						t.Fatalf("Unexpected match result for %q: want %t, got %t", objectKey, key, match)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseProductMatchingErrors(t *testing.T) {
+	t.Parallel()
+
+	err := parseProductMatching("grp", &ImageType{Name: "typ", ProductRegex: "["})
+	if err == nil || err.Error() != "can't parse products.imageGroups[\"grp\"].types[\"typ\"].productRegex: error parsing regexp: missing closing ]: `[`" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = parseProductMatching("grp", &ImageType{Name: "typ", ProductMatch: `Key + 1`})
+	if err == nil {
+		t.Fatal("Expected an error for a non-boolean expression, got none.")
+	}
+}
+
+func TestValidateImageTypesOverlap(t *testing.T) {
+	t.Parallel()
+
+	groups := []ImageGroup{
+		{
+			GroupName: "grp1",
+			Bucket:    "bkt",
+			Types: []ImageType{
+				{Name: "a", ProductRegex: `^site/\d{4}/TYPE_A/`},
+				{Name: "all", ProductPrefix: "site/"},
+				{Name: "b", ProductPrefix: "site/TYPE_B/"},
+				{Name: "c", ProductRegex: `^site/\d{4}/TYPE_C/`},
+			},
+		},
+		{
+			GroupName: "grp4",
+			Bucket:    "bkt-4",
+			Types: []ImageType{
+				{Name: "d", ProductRegex: `^site/.*/TYPE_D/`},
+				{Name: "d-recent", ProductRegex: `^site/.*/TYPE_D/`, ProductMatch: `Key contains "/2024/"`},
+				{Name: "e", ProductMatch: `Key contains "/TYPE_E/"`},
+			},
+		},
+		{
+			GroupName: "grp2",
+			Bucket:    "bkt",
+			Types: []ImageType{
+				{Name: "a2", ProductRegex: `^site/\d{4}/TYPE_A/`},
+			},
+		},
+		{
+			GroupName: "grp3",
+			Bucket:    "other-bkt",
+			Types: []ImageType{
+				{Name: "a", ProductRegex: `^site/\d{4}/TYPE_A/`},
+			},
+		},
+	}
+
+	expected := []string{
+		`image type "grp1"/"b" is shadowed by "grp1"/"all", whose product prefix "site/" already matches all its objects`,
+		`image type "grp1"/"c" is shadowed by "grp1"/"all", whose product prefix "site/" already matches all its objects`,
+		`image type "grp4"/"d-recent" is shadowed by "grp4"/"d", whose matching rules are also rules of its own and already match all its objects`,
+		`image type "grp4"/"e" has no listing prefix, so its whole bucket will be listed: set its productPrefix, or start its productRegex with ^ and a literal text`,
+		`image type "grp2"/"a2" has the same matching rules as "grp1"/"a" and will never match`,
+		`image type "grp2"/"a2" is shadowed by "grp1"/"all", whose product prefix "site/" already matches all its objects`,
+	}
+
+	if diff := cmp.Diff(expected, validateImageTypesOverlap(groups), cmpopts.EquateEmpty()); diff != "" {
+		t.Fatalf("Unexpected warnings (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
+)
+
+// DefaultWatchPeriod is the interval at which the configuration files modification times are checked.
+const DefaultWatchPeriod = 5 * time.Second
+
+// Watch reloads the configuration at the given path each time one of its source files changes,
+// or when the process receives a SIGHUP, and hands it to onReload.
+// The source files are the [Config.SourceFiles] of the current configuration,
+// whose modification times are checked every period.
+// A configuration that can't be loaded is logged and ignored, the current one is kept.
+func Watch(ctx context.Context, configPath string, sourceFiles []string, period time.Duration, onReload func(cfg Config, warnings []string)) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	if len(sourceFiles) == 0 {
+		sourceFiles = []string{configPath}
+	}
+
+	lastModTimes := fileModTimes(sourceFiles)
+
+	go func() {
+		defer signal.Stop(sighup)
+
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-sighup:
+				logger.Info("Received SIGHUP, reloading the configuration ...")
+			case <-ticker.C:
+				changed := changedFile(sourceFiles, lastModTimes)
+				if changed == "" {
+					continue
+				}
+
+				logger.Infof("Configuration file %q has changed, reloading it ...", changed)
+			case <-ctx.Done():
+				return
+			}
+
+			lastModTimes = fileModTimes(sourceFiles)
+
+			cfg, warnings, err := Load(configPath)
+			if err != nil {
+				logger.Errorf("Can't reload configuration, keeping the current one: %v", err)
+
+				continue
+			}
+
+			// The reloaded configuration may include other fragments or secrets.
+			sourceFiles = cfg.SourceFiles
+			lastModTimes = fileModTimes(sourceFiles)
+
+			onReload(cfg, warnings)
+		}
+	}()
+}
+
+// RestartRequiredChanges returns the sections that differ between the two given configurations
+// and whose changes are only taken into account after a restart.
+func RestartRequiredChanges(current, next Config) []string {
+	var sections []string
+
+	if current.S3 != next.S3 {
+		sections = append(sections, "s3")
+	}
+
+	if current.UI.WebServerPort != next.UI.WebServerPort {
+		sections = append(sections, "ui.webServerPort")
+	}
+
+	if current.UI.BaseURL != next.UI.BaseURL {
+		sections = append(sections, "ui.baseURL")
+	}
+
+	if current.Cache != next.Cache {
+		sections = append(sections, "cache")
+	}
+
+	if !reflect.DeepEqual(current.Log, next.Log) {
+		sections = append(sections, "log")
+	}
+
+	if !reflect.DeepEqual(current.Monitoring, next.Monitoring) {
+		sections = append(sections, "monitoring")
+	}
+
+	return sections
+}
+
+// KeepRestartRequiredSections returns the next configuration,
+// with the sections that require a restart taken from the current one.
+func KeepRestartRequiredSections(current, next Config) Config {
+	next.S3 = current.S3
+	next.UI.WebServerPort = current.UI.WebServerPort
+	next.UI.BaseURL = current.UI.BaseURL
+	next.Cache = current.Cache
+	next.Log = current.Log
+	next.Monitoring = current.Monitoring
+
+	return next
+}
+
+// fileModTimes returns the modification time of each of the given files.
+func fileModTimes(paths []string) map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(paths))
+
+	for _, path := range paths {
+		modTimes[path] = fileModTime(path)
+	}
+
+	return modTimes
+}
+
+// changedFile returns the first of the given files whose modification time differs from the given one, if any.
+func changedFile(paths []string, modTimes map[string]time.Time) string {
+	for _, path := range paths {
+		if !fileModTime(path).Equal(modTimes[path]) {
+			return path
+		}
+	}
+
+	return ""
+}
+
+func fileModTime(path string) time.Time {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return stat.ModTime()
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("./testdata/valid_cfg.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfgPath := filepath.Join(t.TempDir(), "config.yml")
+
+	err = os.WriteFile(cfgPath, content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan Config, 1)
+
+	Watch(t.Context(), cfgPath, nil, 10*time.Millisecond, func(cfg Config, _ []string) {
+		reloaded <- cfg
+	})
+
+	select {
+	case <-reloaded:
+		t.Fatal("the configuration shouldn't be reloaded while the file is unchanged")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	modTime := time.Now().Add(time.Minute)
+
+	err = os.Chtimes(cfgPath, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cfg := <-reloaded:
+		if len(cfg.Products.ImageGroups) == 0 {
+			t.Fatal("expected the reloaded configuration to have image groups")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the configuration has not been reloaded")
+	}
+}
+
+func TestWatchSourceFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "secrets", "s3_secret"), "s3cr3t")
+	writeFile(t, filepath.Join(dir, "groups.d", "01_group.yml"), `
+groupName: "Group 2"
+types:
+  - name: "A"
+`)
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+s3:
+  mode: "event"
+  accessSecret: !file secrets/s3_secret
+
+products:
+  include:
+    - groups.d
+  imageGroups:
+    - groupName: "Group 1"
+`)
+
+	cfg, _, err := Load(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan Config, 1)
+
+	Watch(t.Context(), filepath.Join(dir, "config.yml"), cfg.SourceFiles, 10*time.Millisecond, func(cfg Config, _ []string) {
+		reloaded <- cfg
+	})
+
+	waitReload := func(change string) Config {
+		t.Helper()
+
+		select {
+		case cfg := <-reloaded:
+			return cfg
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the configuration has not been reloaded after %s", change)
+		}
+
+		return Config{}
+	}
+
+	modTime := time.Now().Add(time.Minute)
+
+	writeFile(t, filepath.Join(dir, "secrets", "s3_secret"), "n3w s3cr3t")
+
+	err = os.Chtimes(filepath.Join(dir, "secrets", "s3_secret"), modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg = waitReload("a secret change"); cfg.S3.AccessSecret != "n3w s3cr3t" {
+		t.Fatalf("unexpected secret %q", cfg.S3.AccessSecret)
+	}
+
+	writeFile(t, filepath.Join(dir, "groups.d", "02_group.yml"), `
+groupName: "Group 3"
+types:
+  - name: "B"
+`)
+
+	modTime = modTime.Add(time.Minute)
+
+	err = os.Chtimes(filepath.Join(dir, "groups.d"), modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg = waitReload("a fragment addition"); len(cfg.Products.ImageGroups) != 3 {
+		t.Fatalf("expected 3 image groups, got %d", len(cfg.Products.ImageGroups))
+	}
+}
+
+func TestRestartRequiredChanges(t *testing.T) {
+	t.Parallel()
+
+	current := Config{
+		S3:    S3{Endpoint: "localhost:9000"},
+		UI:    UI{WebServerPort: 8080, WindowTitle: "before"},
+		Cache: Cache{CacheDir: "/tmp/cache"},
+		Log:   Log{LogLevel: "info"},
+	}
+
+	next := current
+	next.UI.WindowTitle = "after"
+	next.Products.MaxObjectsAge = time.Hour
+
+	if diff := cmp.Diff([]string(nil), RestartRequiredChanges(current, next)); diff != "" {
+		t.Fatalf("unexpected sections (-want +got):\n%s", diff)
+	}
+
+	next.S3.Endpoint = "localhost:9001"
+	next.UI.WebServerPort = 8081
+	next.Log.LogLevel = "debug"
+
+	if diff := cmp.Diff([]string{"s3", "ui.webServerPort", "log"}, RestartRequiredChanges(current, next)); diff != "" {
+		t.Fatalf("unexpected sections (-want +got):\n%s", diff)
+	}
+
+	kept := KeepRestartRequiredSections(current, next)
+	if kept.S3 != current.S3 || kept.UI.WebServerPort != current.UI.WebServerPort || kept.Log.LogLevel != current.Log.LogLevel {
+		t.Fatalf("restart-required sections should have been kept: %+v", kept)
+	}
+
+	if kept.UI.WindowTitle != "after" || kept.Products.MaxObjectsAge != time.Hour {
+		t.Fatalf("reloadable sections should have been updated: %+v", kept)
+	}
+}
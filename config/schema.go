@@ -0,0 +1,101 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches the durations accepted by [time.ParseDuration], e.g. 1h30m or 500ms.
+const durationPattern = `^-?(0|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)$`
+
+var (
+	durationType = reflect.TypeFor[time.Duration]() //nolint: gochecknoglobals
+	timeType     = reflect.TypeFor[time.Time]()     //nolint: gochecknoglobals
+)
+
+// fieldSchemas holds the schemas of the fields whose type is too loose to describe their accepted values.
+var fieldSchemas = map[string]map[string]any{ //nolint: gochecknoglobals
+	"S3.Mode": {"type": "string", "enum": []string{S3ModePolling, S3ModeEvent}},
+	"FileSelector.Kind": {
+		"type":    "string",
+		"pattern": `^(cached|signedURL|fullProductSignedURL\(\w+\)|externalViewerURL\(\w+,\s*\w+\))$`,
+	},
+	"DynamicFilter.Type": {
+		"type": "string",
+		"enum": []string{DynamicFilterTypeString, DynamicFilterTypeEnum, DynamicFilterTypeNumber, DynamicFilterTypeDate, DynamicFilterTypeBoolean},
+	},
+	"DynamicFilter.UIHint": {"type": "string", "enum": []string{DynamicFilterUIHintDropdown, DynamicFilterUIHintRange, DynamicFilterUIHintDateRange}},
+	"Log.LogLevel":         {"type": "string", "enum": []string{"trace", "debug", "info", "warn", "error", "fatal", "panic", "disabled"}},
+}
+
+// JSONSchema returns the JSON Schema of the configuration file,
+// which editors can use to validate and autocomplete it.
+func JSONSchema() ([]byte, error) {
+	schema := schemaOf(reflect.TypeFor[Config]())
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = "S3 Image Server configuration"
+
+	result, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal JSON schema: %w", err)
+	}
+
+	return result, nil
+}
+
+func schemaOf(typ reflect.Type) map[string]any {
+	if typ == durationType {
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	}
+
+	if typ == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch typ.Kind() { //nolint:exhaustive
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(typ.Elem())}
+	case reflect.Pointer:
+		return schemaOf(typ.Elem())
+	case reflect.Struct:
+		properties := make(map[string]any, typ.NumField())
+
+		for field := range typ.Fields() {
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+
+			if fieldSchema, found := fieldSchemas[typ.Name()+"."+field.Name]; found {
+				properties[name] = fieldSchema
+			} else {
+				properties[name] = schemaOf(field.Type)
+			}
+		}
+
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	default: // any
+		return map[string]any{}
+	}
+}
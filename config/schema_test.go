@@ -0,0 +1,106 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+func TestJSONSchema(t *testing.T) {
+	t.Parallel()
+
+	rawSchema, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+
+	var schema map[string]any
+
+	err = json.Unmarshal(rawSchema, &schema)
+	if err != nil {
+		t.Fatalf("Invalid JSON schema: %v", err)
+	}
+
+	for _, path := range []string{"./testdata/valid_cfg.yml", "../resources/sample-config.yml"} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var document any
+
+		err = yaml.Unmarshal(content, &document)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkAgainstSchema(t, path, document, schema)
+	}
+
+	checkAgainstSchema(t, "unknown field", map[string]any{"s3": map[string]any{"endpoitn": "localhost"}}, schema, "s3.endpoitn: unknown property")
+	checkAgainstSchema(t, "unknown mode", map[string]any{"s3": map[string]any{"mode": "push"}}, schema, `s3.mode: "push" is not an allowed value`)
+	checkAgainstSchema(t, "invalid duration", map[string]any{"cache": map[string]any{"retentionPeriod": "7 days"}}, schema, `cache.retentionPeriod: "7 days" doesn't match the pattern`)
+}
+
+// checkAgainstSchema validates the given document against the subset of JSON Schema produced by [JSONSchema].
+func checkAgainstSchema(t *testing.T, name string, document any, schema map[string]any, expectedErrors ...string) {
+	t.Helper()
+
+	var errs []string
+
+	var check func(path string, value any, schema map[string]any)
+
+	check = func(path string, value any, schema map[string]any) {
+		switch v := value.(type) {
+		case map[string]any:
+			properties, _ := schema["properties"].(map[string]any)
+
+			for key, child := range v {
+				if propSchema, found := properties[key]; found {
+					check(path+"."+key, child, propSchema.(map[string]any)) //nolint: forcetypeassert
+				} else if additional, ok := schema["additionalProperties"].(map[string]any); ok {
+					check(path+"."+key, child, additional)
+				} else if schema["additionalProperties"] == false {
+					errs = append(errs, path[1:]+"."+key+": unknown property")
+				}
+			}
+		case []any:
+			if items, ok := schema["items"].(map[string]any); ok {
+				for _, item := range v {
+					check(path+"[]", item, items)
+				}
+			}
+		case string:
+			if enum, ok := schema["enum"].([]any); ok {
+				allowed := false
+
+				for _, e := range enum {
+					allowed = allowed || e == v
+				}
+
+				if !allowed {
+					errs = append(errs, path[1:]+": \""+v+"\" is not an allowed value")
+				}
+			}
+
+			if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(v) {
+				errs = append(errs, path[1:]+": \""+v+"\" doesn't match the pattern")
+			}
+		}
+	}
+
+	check("", document, schema)
+
+	if len(errs) != len(expectedErrors) {
+		t.Fatalf("%s: unexpected validation errors: got %q, want %q", name, errs, expectedErrors)
+	}
+
+	for i := range errs {
+		if errs[i] != expectedErrors[i] {
+			t.Fatalf("%s: unexpected validation errors: got %q, want %q", name, errs, expectedErrors)
+		}
+	}
+}
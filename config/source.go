@@ -0,0 +1,448 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+const fileTag = "!file"
+
+var (
+	errUnsetEnvVar        = errors.New("environment variable is not set")
+	errUnterminatedEnvVar = errors.New("unterminated environment variable reference")
+	errInvalidFragment    = errors.New("a fragment must contain an image group or a list of image groups")
+	errNoFragmentFound    = errors.New("no fragment found")
+)
+
+// sourceInfo describes where the values of a configuration document come from, besides the document itself.
+type sourceInfo struct {
+	// files are the paths of the other files read: the fragments, their directories and the !file secrets.
+	files []string
+	// secretFields are the paths, as YAML keys and sequence indexes, of the values read from a !file tag
+	// or interpolated from an environment variable, which are redacted when the configuration is printed.
+	secretFields [][]string
+}
+
+// readDocument reads and parses the YAML file at the given path.
+func readDocument(path string) (*yaml.Node, sourceInfo, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, sourceInfo{}, err //nolint:wrapcheck
+	}
+
+	return parseDocument(content, path)
+}
+
+// parseDocument parses the given YAML content, read from the given path,
+// then resolves its environment variable references and its !file tags.
+func parseDocument(content []byte, path string) (*yaml.Node, sourceInfo, error) {
+	var doc yaml.Node
+
+	err := yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return nil, sourceInfo{}, err //nolint:wrapcheck
+	}
+
+	var info sourceInfo
+
+	err = resolveNode(&doc, filepath.Dir(path), nil, &info)
+	if err != nil {
+		return nil, sourceInfo{}, fmt.Errorf("%s:%w", path, err)
+	}
+
+	return &doc, info, nil
+}
+
+// resolveNode interpolates the environment variables of the scalar values of the given node and its children,
+// but the expressions, and replaces the scalars tagged with !file with the content of the file they reference.
+// The given path is the one of the node in the document, the files read and the secret fields are added to info.
+func resolveNode(node *yaml.Node, baseDir string, path []string, info *sourceInfo) error {
+	switch node.Kind { //nolint:exhaustive
+	case yaml.ScalarNode:
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			err := resolveNode(node.Content[i], baseDir, path, info)
+			if err != nil {
+				return err
+			}
+
+			err = resolveNode(node.Content[i+1], baseDir, append(slices.Clip(path), node.Content[i].Value), info)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			err := resolveNode(child, baseDir, append(slices.Clip(path), strconv.Itoa(i)), info)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		for _, child := range node.Content {
+			err := resolveNode(child, baseDir, path, info)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	value, fromEnv := node.Value, false
+
+	if !isExpressionField(path) {
+		var err error
+
+		value, fromEnv, err = interpolateEnv(node.Value)
+		if err != nil {
+			return fmt.Errorf("%d: %w", node.Line, err)
+		}
+	}
+
+	if fromEnv || node.Tag == fileTag {
+		info.secretFields = append(info.secretFields, slices.Clone(path))
+	}
+
+	if node.Tag == fileTag {
+		secretPath := value
+		if !filepath.IsAbs(secretPath) {
+			secretPath = filepath.Join(baseDir, secretPath)
+		}
+
+		info.files = append(info.files, secretPath)
+
+		content, err := os.ReadFile(secretPath)
+		if err != nil {
+			return fmt.Errorf("%d: can't read %s file: %w", node.Line, fileTag, err)
+		}
+
+		node.SetString(strings.TrimRight(string(content), "\r\n"))
+		node.Style = yaml.DoubleQuotedStyle
+
+		return nil
+	}
+
+	if value != node.Value {
+		node.Value = value
+
+		if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Tag = "" // let the interpolated value be resolved to its actual type
+		}
+	}
+
+	return nil
+}
+
+// isExpressionField reports whether the field at the given path holds an expression,
+// whose ${ sequences are left to the expr and jq languages.
+func isExpressionField(path []string) bool {
+	if len(path) >= 2 && path[len(path)-2] == "expressions" {
+		return true
+	}
+
+	return len(path) >= 1 && (path[len(path)-1] == "expression" || path[len(path)-1] == "productMatch")
+}
+
+// interpolateEnv replaces the ${VAR} and ${VAR:-default} references with the value of the environment variable,
+// and tells whether any of them has been replaced by the value of a variable rather than its default.
+// The $${ sequence is kept as a literal ${.
+func interpolateEnv(value string) (string, bool, error) {
+	if !strings.Contains(value, "${") {
+		return value, false, nil
+	}
+
+	var (
+		sb      strings.Builder
+		fromEnv bool
+	)
+
+	for {
+		idx := strings.Index(value, "${")
+		if idx < 0 {
+			sb.WriteString(value)
+
+			return sb.String(), fromEnv, nil
+		}
+
+		if idx > 0 && value[idx-1] == '$' {
+			sb.WriteString(value[:idx-1])
+			sb.WriteString("${")
+
+			value = value[idx+2:]
+
+			continue
+		}
+
+		end := strings.IndexByte(value[idx:], '}')
+		if end < 0 {
+			return "", false, fmt.Errorf("%w %q", errUnterminatedEnvVar, value[idx:])
+		}
+
+		sb.WriteString(value[:idx])
+
+		name, defaultValue, hasDefault := strings.Cut(value[idx+2:idx+end], ":-")
+
+		envValue, found := os.LookupEnv(name)
+
+		switch {
+		case found && envValue != "":
+			sb.WriteString(envValue)
+
+			fromEnv = true
+		case hasDefault:
+			sb.WriteString(defaultValue)
+		case !found:
+			return "", false, fmt.Errorf("%w: %q", errUnsetEnvVar, name)
+		}
+
+		value = value[idx+end+1:]
+	}
+}
+
+// includeFragments loads the image groups of the fragments referenced by products.include.
+// Each entry is a file, a glob pattern or a directory whose .yml and .yaml files are loaded in lexical order.
+// Relative paths are resolved from the directory of the configuration file.
+// The groups are appended to the configuration ones from the given index, on which their secret fields depend.
+// The files of the returned info are the ones the groups were read from, with their !file secrets,
+// and the directories holding the fragments matched by a directory or a glob pattern.
+func includeFragments(includes []string, baseDir string, firstGroup int) ([]ImageGroup, sourceInfo, error) {
+	var (
+		groups []ImageGroup
+		info   sourceInfo
+	)
+
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(baseDir, include)
+		}
+
+		// The modification time of the directories changes when fragments are added or removed.
+		if stat, err := os.Stat(include); err == nil && stat.IsDir() {
+			info.files = append(info.files, include)
+		} else if strings.ContainsAny(include, "*?[") {
+			info.files = append(info.files, filepath.Dir(include))
+		}
+
+		paths, err := fragmentPaths(include)
+		if err != nil {
+			return nil, sourceInfo{}, fmt.Errorf("can't include %q: %w", include, err)
+		}
+
+		for _, path := range paths {
+			fragmentGroups, fragmentInfo, err := loadFragment(path, firstGroup+len(groups))
+			if err != nil {
+				return nil, sourceInfo{}, fmt.Errorf("can't include %q: %w", path, err)
+			}
+
+			groups = append(groups, fragmentGroups...)
+			info.files = append(info.files, path)
+			info.files = append(info.files, fragmentInfo.files...)
+			info.secretFields = append(info.secretFields, fragmentInfo.secretFields...)
+		}
+	}
+
+	return groups, info, nil
+}
+
+func fragmentPaths(include string) ([]string, error) {
+	stat, err := os.Stat(include)
+	if err == nil && stat.IsDir() {
+		entries, err := os.ReadDir(include)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		var paths []string
+
+		for _, entry := range entries {
+			if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == ".yml" || ext == ".yaml") {
+				paths = append(paths, filepath.Join(include, entry.Name()))
+			}
+		}
+
+		return paths, nil
+	}
+
+	paths, err := filepath.Glob(include)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if len(paths) == 0 {
+		return nil, errNoFragmentFound
+	}
+
+	slices.Sort(paths)
+
+	return paths, nil
+}
+
+// loadFragment loads the image groups of the fragment at the given path,
+// whose paths of the secret fields are given from the index of its first group in the configuration.
+func loadFragment(path string, firstGroup int) ([]ImageGroup, sourceInfo, error) {
+	doc, info, err := readDocument(path)
+	if err != nil {
+		return nil, sourceInfo{}, err
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, info, nil
+	}
+
+	root := doc.Content[0]
+
+	var groupNodes []*yaml.Node
+
+	switch root.Kind { //nolint:exhaustive
+	case yaml.MappingNode:
+		groupNodes = []*yaml.Node{root}
+
+		for i, field := range info.secretFields {
+			info.secretFields[i] = slices.Concat([]string{"products", "imageGroups", strconv.Itoa(firstGroup)}, field)
+		}
+	case yaml.SequenceNode:
+		groupNodes = root.Content
+
+		for i, field := range info.secretFields {
+			groupIdx, _ := strconv.Atoi(field[0])
+			info.secretFields[i] = slices.Concat([]string{"products", "imageGroups", strconv.Itoa(firstGroup + groupIdx)}, field[1:])
+		}
+	default:
+		return nil, sourceInfo{}, errInvalidFragment
+	}
+
+	groups := make([]ImageGroup, len(groupNodes))
+
+	for i, node := range groupNodes {
+		err = node.Decode(&groups[i])
+		if err != nil {
+			return nil, sourceInfo{}, fmt.Errorf("failed to parse fragment: %w", err)
+		}
+
+		setSources(path, node, &groups[i])
+	}
+
+	return groups, info, nil
+}
+
+// setImageGroupsSources records where each image group, and each of its types, has been defined.
+func setImageGroupsSources(path string, doc *yaml.Node, groups []ImageGroup) {
+	groupsNode := lookupNode(doc, "products", "imageGroups")
+	if groupsNode == nil || groupsNode.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for i, node := range groupsNode.Content {
+		if i >= len(groups) {
+			return
+		}
+
+		setSources(path, node, &groups[i])
+	}
+}
+
+func setSources(path string, groupNode *yaml.Node, group *ImageGroup) {
+	group.Source = fmt.Sprintf("%s:%d", path, groupNode.Line)
+
+	typesNode := lookupNode(groupNode, "types")
+	if typesNode == nil || typesNode.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for i, node := range typesNode.Content {
+		if i >= len(group.Types) {
+			return
+		}
+
+		group.Types[i].Source = fmt.Sprintf("%s:%d", path, node.Line)
+	}
+}
+
+// lookupNode returns the node found by following the given mapping keys, or nil.
+func lookupNode(node *yaml.Node, keys ...string) *yaml.Node {
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+
+		node = node.Content[0]
+	}
+
+	for _, key := range keys {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		var next *yaml.Node
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+
+				break
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		node = next
+	}
+
+	return node
+}
+
+// fieldSources returns the positions of the mapping keys of the given document, outside of its sequences,
+// by their dotted path.
+func fieldSources(path string, doc *yaml.Node) map[string]string {
+	sources := make(map[string]string)
+
+	var walk func(node *yaml.Node, prefix string)
+
+	walk = func(node *yaml.Node, prefix string) {
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			field := prefix + node.Content[i].Value
+
+			sources[field] = fmt.Sprintf("%s:%d", path, node.Content[i].Line)
+
+			walk(node.Content[i+1], field+".")
+		}
+	}
+
+	if root := lookupNode(doc); root != nil {
+		walk(root, "")
+	}
+
+	return sources
+}
+
+// withFieldSource prefixes the given error with the position where the given field has been defined, if known.
+func (cfg *Config) withFieldSource(field string, err error) error {
+	return withSource(cfg.FieldSources[field], err)
+}
+
+// withSource prefixes the given error with the position where the faulty element has been defined, if known.
+func withSource(source string, err error) error {
+	if source == "" || err == nil {
+		return err
+	}
+
+	return fmt.Errorf("%s: %w", source, err)
+}
@@ -0,0 +1,301 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	t.Setenv("S3IS_TEST_HOST", "minio")
+	t.Setenv("S3IS_TEST_EMPTY", "")
+
+	cases := []struct {
+		name          string
+		value         string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "no reference",
+			value:    "preview.jpg$",
+			expected: "preview.jpg$",
+		},
+		{
+			name:     "set variable",
+			value:    "http://${S3IS_TEST_HOST}:9000",
+			expected: "http://minio:9000",
+		},
+		{
+			name:     "default value",
+			value:    "${S3IS_TEST_UNSET:-localhost}:${S3IS_TEST_PORT:-9000}",
+			expected: "localhost:9000",
+		},
+		{
+			name:     "empty variable with default value",
+			value:    "${S3IS_TEST_EMPTY:-fallback}",
+			expected: "fallback",
+		},
+		{
+			name:     "empty variable without default value",
+			value:    "a${S3IS_TEST_EMPTY}b",
+			expected: "ab",
+		},
+		{
+			name:     "escaped reference",
+			value:    "$${S3IS_TEST_HOST} ${S3IS_TEST_HOST}",
+			expected: "${S3IS_TEST_HOST} minio",
+		},
+		{
+			name:          "unset variable",
+			value:         "${S3IS_TEST_UNSET}",
+			expectedError: `environment variable is not set: "S3IS_TEST_UNSET"`,
+		},
+		{
+			name:          "unterminated reference",
+			value:         "${S3IS_TEST_HOST",
+			expectedError: `unterminated environment variable reference "${S3IS_TEST_HOST"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, _, err := interpolateEnv(tc.value)
+			if err != nil {
+				if tc.expectedError == "" {
+					t.Fatalf("Expected no error, but got %q.", err.Error())
+				} else if err.Error() != tc.expectedError {
+					t.Fatalf("Unexpected error:\nwant: %q\ngot:  %q.", tc.expectedError, err.Error())
+				}
+
+				return
+			}
+
+			if tc.expectedError != "" {
+				t.Fatal("Expected an error, but got none.")
+			}
+
+			if got != tc.expected {
+				t.Fatalf("Unexpected value:\nwant: %q\ngot:  %q.", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadWithIncludesAndSecrets(t *testing.T) {
+	t.Setenv("S3IS_TEST_ENDPOINT", "minio:9000")
+	t.Setenv("S3IS_TEST_PERIOD", "30s")
+
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "secrets", "s3_secret"), "s3cr3t\n")
+	writeFile(t, filepath.Join(dir, "groups.d", "01_group.yml"), `
+groupName: "Group 2"
+bucket: "${S3IS_TEST_BUCKET:-bucket-2}"
+types:
+  - name: "A"
+`)
+	writeFile(t, filepath.Join(dir, "groups.d", "02_groups.yaml"), `
+- groupName: "Group 3"
+  types:
+    - name: "B"
+    - name: "C"
+`)
+	writeFile(t, filepath.Join(dir, "groups.d", "README.md"), "not a fragment")
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+s3:
+  mode: "polling"
+  pollingPeriod: ${S3IS_TEST_PERIOD}
+  endpoint: "${S3IS_TEST_ENDPOINT}"
+  accessSecret: !file secrets/s3_secret
+
+products:
+  include:
+    - groups.d
+  imageGroups:
+    - groupName: "Group 1"
+`)
+
+	cfg, _, err := Load(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %q.", err.Error())
+	}
+
+	if cfg.S3.Endpoint != "minio:9000" || cfg.S3.PollingPeriod != 30*time.Second || cfg.S3.AccessSecret != "s3cr3t" {
+		t.Fatalf("Unexpected S3 config: %+v", cfg.S3)
+	}
+
+	type groupSummary struct {
+		Name, Bucket, Source string
+		TypeSources          []string
+	}
+
+	got := make([]groupSummary, 0, len(cfg.Products.ImageGroups))
+
+	for _, grp := range cfg.Products.ImageGroups {
+		summary := groupSummary{Name: grp.GroupName, Bucket: grp.Bucket, Source: grp.Source}
+
+		for _, typ := range grp.Types {
+			summary.TypeSources = append(summary.TypeSources, typ.Source)
+		}
+
+		got = append(got, summary)
+	}
+
+	expected := []groupSummary{
+		{Name: "Group 1", Source: filepath.Join(dir, "config.yml") + ":12"},
+		{Name: "Group 2", Bucket: "bucket-2", Source: filepath.Join(dir, "groups.d", "01_group.yml") + ":2", TypeSources: []string{filepath.Join(dir, "groups.d", "01_group.yml") + ":5"}},
+		{Name: "Group 3", Source: filepath.Join(dir, "groups.d", "02_groups.yaml") + ":2", TypeSources: []string{filepath.Join(dir, "groups.d", "02_groups.yaml") + ":4", filepath.Join(dir, "groups.d", "02_groups.yaml") + ":5"}},
+	}
+
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("Unexpected image groups (-want +got):\n%s", diff)
+	}
+
+	expectedSources := []string{
+		filepath.Join(dir, "config.yml"),
+		filepath.Join(dir, "secrets", "s3_secret"),
+		filepath.Join(dir, "groups.d"),
+		filepath.Join(dir, "groups.d", "01_group.yml"),
+		filepath.Join(dir, "groups.d", "02_groups.yaml"),
+	}
+
+	if diff := cmp.Diff(expectedSources, cfg.SourceFiles); diff != "" {
+		t.Fatalf("Unexpected source files (-want +got):\n%s", diff)
+	}
+
+	// The bucket of the fragment is the default one of its variable, which is not set.
+	expectedSecretFields := [][]string{{"s3", "pollingPeriod"}, {"s3", "endpoint"}, {"s3", "accessSecret"}}
+
+	if diff := cmp.Diff(expectedSecretFields, cfg.SecretFields); diff != "" {
+		t.Fatalf("Unexpected secret fields (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadReportsFragmentSource(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "groups", "group.yml"), `
+- groupName: "Group 2"
+  types:
+    - name: "A"
+    - name: "A"
+`)
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+s3:
+  mode: "event"
+
+products:
+  include:
+    - groups/*.yml
+  imageGroups:
+    - groupName: "Group 1"
+`)
+
+	_, _, err := Load(filepath.Join(dir, "config.yml"))
+	if err == nil {
+		t.Fatal("Expected an error, but got none.")
+	}
+
+	expected := `the config is invalid: ` + filepath.Join(dir, "groups", "group.yml") + `:5: image type name "A" of group "Group 2" is duplicate`
+	if err.Error() != expected {
+		t.Fatalf("Unexpected error:\nwant: %q\ngot:  %q.", expected, err.Error())
+	}
+}
+
+func TestLoadReportsFieldSource(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+s3:
+  mode: "event"
+
+products:
+  imageGroups:
+    - groupName: "Group 1"
+      types:
+        - name: "A"
+
+cache:
+  deepZoom:
+    minSize: -1
+  maxTIFFPixels: -1
+`)
+
+	_, _, err := Load(filepath.Join(dir, "config.yml"))
+	if err == nil {
+		t.Fatal("Expected an error, but got none.")
+	}
+
+	configPath := filepath.Join(dir, "config.yml")
+	expected := "the config is invalid: " + configPath + ":13: cache.deepZoom.minSize can't be negative (-1)\n" +
+		configPath + ":14: cache.maxTIFFPixels can't be negative (-1)"
+
+	if err.Error() != expected {
+		t.Fatalf("Unexpected error:\nwant: %q\ngot:  %q.", expected, err.Error())
+	}
+}
+
+func TestLoadKeepsExpressions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+s3:
+  mode: "event"
+  endpoint: "${S3IS_TEST_UNSET_ENDPOINT:-localhost:9000}"
+
+products:
+  dynamicData:
+    expressions:
+      title: '"${S3IS_TEST_UNSET}"'
+  dynamicFilters:
+    - name: "Label"
+      expression: '"${S3IS_TEST_UNSET}"'
+      type: "string"
+  imageGroups:
+    - groupName: "Group 1"
+      types:
+        - name: "A"
+          productMatch: 'Key != "${S3IS_TEST_UNSET}"'
+`)
+
+	cfg, _, err := Load(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %q.", err.Error())
+	}
+
+	got := []string{
+		cfg.S3.Endpoint,
+		cfg.Products.DynamicData.Expressions["title"],
+		cfg.Products.DynamicFilters[0].Expression,
+		cfg.Products.ImageGroups[0].Types[0].ProductMatch,
+	}
+	expected := []string{"localhost:9000", `"${S3IS_TEST_UNSET}"`, `"${S3IS_TEST_UNSET}"`, `Key != "${S3IS_TEST_UNSET}"`}
+
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("Unexpected values (-want +got):\n%s", diff)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
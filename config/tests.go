@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"go.yaml.in/yaml/v4"
+)
+
+var errUnknownTestTarget = errors.New("unknown image")
+
+// LoadTests reads the expression tests defined under the tests key of the file at the given path,
+// and checks that they target image types of the given configuration.
+func LoadTests(path string, cfg Config) ([]ExprTest, error) {
+	doc, _, err := readDocument(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tests: %w", err)
+	}
+
+	var file struct {
+		Tests []ExprTest `yaml:"tests"`
+	}
+
+	err = doc.Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tests: %w", err)
+	}
+
+	prepareTests(path, doc, file.Tests)
+
+	err = validateTests(file.Tests, cfg.Products.ImageGroups)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tests: %w", err)
+	}
+
+	return file.Tests, nil
+}
+
+// prepareTests records where each test has been defined,
+// and resolves the paths of its fixtures from the directory of the file defining it.
+func prepareTests(path string, doc *yaml.Node, tests []ExprTest) {
+	testsNode := lookupNode(doc, "tests")
+	baseDir := filepath.Dir(path)
+
+	for i := range tests {
+		if testsNode != nil && testsNode.Kind == yaml.SequenceNode && i < len(testsNode.Content) {
+			tests[i].Source = fmt.Sprintf("%s:%d", path, testsNode.Content[i].Line)
+		}
+
+		for _, files := range tests[i].Files {
+			for j, file := range files {
+				if file.Path != "" && !filepath.IsAbs(file.Path) {
+					files[j].Path = filepath.Join(baseDir, file.Path)
+				}
+			}
+		}
+	}
+}
+
+func validateTests(tests []ExprTest, groups []ImageGroup) error {
+	errs := make([]error, 0)
+	testNames := make(map[string]bool, len(tests))
+
+	for i, test := range tests {
+		switch {
+		case test.Name == "":
+			errs = append(errs, withSource(test.Source, fmt.Errorf("empty name for test n°%d", i+1)))
+		case testNames[test.Name]:
+			errs = append(errs, withSource(test.Source, fmt.Errorf("test name %q is %w", test.Name, errDuplicate)))
+		default:
+			testNames[test.Name] = true
+		}
+
+		if !hasImageType(groups, test.Group, test.Type) {
+			errs = append(errs, withSource(test.Source, fmt.Errorf("test %q: %w %q/%q", test.Name, errUnknownTestTarget, test.Group, test.Type)))
+		}
+
+		if test.ObjectKey == "" {
+			errs = append(errs, withSource(test.Source, fmt.Errorf("test %q: empty object key", test.Name)))
+		}
+
+		if len(test.Expected) == 0 {
+			errs = append(errs, withSource(test.Source, fmt.Errorf("test %q: no expected output", test.Name)))
+		}
+
+		for selector, files := range test.Files {
+			for _, file := range files {
+				if file.Path == "" {
+					errs = append(errs, withSource(test.Source, fmt.Errorf("test %q: empty fixture path for selector %q", test.Name, selector)))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func hasImageType(groups []ImageGroup, groupName, typeName string) bool {
+	for _, grp := range groups {
+		if grp.GroupName != groupName {
+			continue
+		}
+
+		for _, typ := range grp.Types {
+			if typ.Name == typeName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
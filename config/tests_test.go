@@ -0,0 +1,124 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadTests(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+s3:
+  mode: "polling"
+  pollingPeriod: 10s
+
+products:
+  imageGroups:
+    - groupName: "Group 1"
+      types:
+        - name: "A"
+
+tests:
+  - name: "in config"
+    group: "Group 1"
+    type: "A"
+    objectKey: "products/1/preview.jpg"
+    files:
+      info:
+        - path: "fixtures/info.json"
+    expected:
+      productBasePath: "products/1"
+`)
+	writeFile(t, filepath.Join(dir, "tests", "more.yml"), `
+tests:
+  - name: "in file"
+    group: "Group 1"
+    type: "A"
+    objectKey: "products/2/preview.jpg"
+    files:
+      info:
+        - path: "/abs/info.json"
+          key: "products/2/info.json"
+    expected:
+      productBasePath: "products/2"
+  - name: "unknown type"
+    group: "Group 1"
+    type: "B"
+    objectKey: "products/3/preview.jpg"
+`)
+	writeFile(t, filepath.Join(dir, "tests", "valid.yml"), `
+tests:
+  - name: "in file"
+    group: "Group 1"
+    type: "A"
+    objectKey: "products/2/preview.jpg"
+    files:
+      info:
+        - path: "/abs/info.json"
+          key: "products/2/info.json"
+    expected:
+      productBasePath: "products/2"
+`)
+
+	cfg, _, err := Load(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %q.", err.Error())
+	}
+
+	expectedConfigTests := []ExprTest{
+		{
+			Name:      "in config",
+			Group:     "Group 1",
+			Type:      "A",
+			ObjectKey: "products/1/preview.jpg",
+			Files:     map[string][]TestFile{"info": {{Path: filepath.Join(dir, "fixtures", "info.json")}}},
+			Expected:  map[string]any{"productBasePath": "products/1"},
+			Source:    filepath.Join(dir, "config.yml") + ":13",
+		},
+	}
+
+	if diff := cmp.Diff(expectedConfigTests, cfg.Tests); diff != "" {
+		t.Fatalf("Unexpected config tests (-want +got):\n%s", diff)
+	}
+
+	tests, err := LoadTests(filepath.Join(dir, "tests", "valid.yml"), cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %q.", err.Error())
+	}
+
+	expectedFileTests := []ExprTest{
+		{
+			Name:      "in file",
+			Group:     "Group 1",
+			Type:      "A",
+			ObjectKey: "products/2/preview.jpg",
+			Files:     map[string][]TestFile{"info": {{Path: "/abs/info.json", Key: "products/2/info.json"}}},
+			Expected:  map[string]any{"productBasePath": "products/2"},
+			Source:    filepath.Join(dir, "tests", "valid.yml") + ":3",
+		},
+	}
+
+	if diff := cmp.Diff(expectedFileTests, tests); diff != "" {
+		t.Fatalf("Unexpected file tests (-want +got):\n%s", diff)
+	}
+
+	_, err = LoadTests(filepath.Join(dir, "tests", "more.yml"), cfg)
+	if err == nil {
+		t.Fatal("Expected an error, but got none.")
+	}
+
+	for _, expected := range []string{
+		filepath.Join(dir, "tests", "more.yml") + `:13: test "unknown type": unknown image "Group 1"/"B"`,
+		`test "unknown type": no expected output`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected the error to contain %q, got %q.", expected, err.Error())
+		}
+	}
+}
@@ -23,6 +23,24 @@ const (
 	FileSelectorKindExternalViewerURL    FileSelectorKind = "externalViewerURL"
 )
 
+type DynamicFilterType = string
+
+const (
+	DynamicFilterTypeString  DynamicFilterType = "string"
+	DynamicFilterTypeEnum    DynamicFilterType = "enum"
+	DynamicFilterTypeNumber  DynamicFilterType = "number"
+	DynamicFilterTypeDate    DynamicFilterType = "date"
+	DynamicFilterTypeBoolean DynamicFilterType = "boolean"
+)
+
+type DynamicFilterUIHint = string
+
+const (
+	DynamicFilterUIHintDropdown  DynamicFilterUIHint = "dropdown"
+	DynamicFilterUIHintRange     DynamicFilterUIHint = "range"
+	DynamicFilterUIHintDateRange DynamicFilterUIHint = "dateRange"
+)
+
 type (
 	Config struct {
 		S3         S3         `yaml:"s3"`
@@ -31,6 +49,16 @@ type (
 		Cache      Cache      `yaml:"cache"`
 		Log        Log        `yaml:"log"`
 		Monitoring Monitoring `yaml:"monitoring"`
+		Tests      []ExprTest `yaml:"tests"`
+		// SourceFiles are the paths of the files the configuration was loaded from: the configuration file,
+		// its included fragments and their directories, and the files read for the !file tags.
+		SourceFiles []string `yaml:"-"`
+		// SecretFields are the paths, as YAML keys and sequence indexes, of the values read from a !file tag
+		// or interpolated from an environment variable, which are redacted when the configuration is printed.
+		SecretFields [][]string `yaml:"-"`
+		// FieldSources maps the dotted paths of the mappings and fields of the configuration file,
+		// like "cache.deepZoom.minSize", to the position ("file:line") where they have been defined.
+		FieldSources map[string]string `yaml:"-"`
 	}
 
 	S3 struct {
@@ -65,11 +93,61 @@ type (
 		DynamicData          DynamicData       `yaml:"dynamicData"`
 		DynamicFilters       []DynamicFilter   `yaml:"dynamicFilters"`
 		ImageGroups          []ImageGroup      `yaml:"imageGroups"`
+		Include              []string          `yaml:"include"`
+		ExpressionLimits     ExpressionLimits  `yaml:"expressionLimits"`
+		Gazetteer            Gazetteer         `yaml:"gazetteer"`
+	}
+
+	// Gazetteer locates the GeoNames dump files (https://download.geonames.org/export/dump/)
+	// used by _reverseGeocode. It is disabled if no cities file is given.
+	Gazetteer struct {
+		CitiesFile      string `yaml:"citiesFile"`
+		Admin1CodesFile string `yaml:"admin1CodesFile"`
+		Admin2CodesFile string `yaml:"admin2CodesFile"`
+		CountryInfoFile string `yaml:"countryInfoFile"`
+		// MaxDistance is the distance, in km, up to which the nearest city is returned for the footprints containing none.
+		MaxDistance float64 `yaml:"maxDistance"`
+		// VillageMaxPopulation is the population under which a place is listed as a village rather than a city.
+		VillageMaxPopulation int `yaml:"villageMaxPopulation"`
+	}
+
+	// ExpressionLimits bounds the resources used by the expressions, a zero value disables the limit.
+	ExpressionLimits struct {
+		// Timeout is the maximum duration of an evaluation, including the expressions it calls.
+		Timeout time.Duration `yaml:"timeout"`
+		// MaxNodes is the maximum number of nodes of an expression, checked when it is parsed.
+		MaxNodes uint `yaml:"maxNodes"`
+		// MemoryBudget is the maximum number of allocations made by an evaluation.
+		MemoryBudget uint `yaml:"memoryBudget"`
+		// MaxFileSize is the maximum size, in bytes, of the files read by the loader functions.
+		MaxFileSize int64 `yaml:"maxFileSize"`
 	}
 
 	Cache struct {
 		CacheDir        string        `yaml:"cacheDir"`
 		RetentionPeriod time.Duration `yaml:"retentionPeriod"`
+		DeepZoom        DeepZoom      `yaml:"deepZoom"`
+		// MaxTIFFPixels is the number of pixels above which the TIFF previews aren't converted to PNG. 0 disables the limit.
+		MaxTIFFPixels int `yaml:"maxTIFFPixels"`
+		// MaxDecodedPixels is the number of pixels above which the previews aren't decoded to be cropped or tiled. 0 disables the limit.
+		MaxDecodedPixels int    `yaml:"maxDecodedPixels"`
+		Export           Export `yaml:"export"`
+	}
+
+	// DeepZoom configures the tile pyramids generated for the large previews, on their first display.
+	DeepZoom struct {
+		// MinSize is the width or height, in pixels, from which a preview is tiled. 0 disables the tiling.
+		MinSize int `yaml:"minSize"`
+		// TileSize is the width and height of the tiles, in pixels.
+		TileSize int `yaml:"tileSize"`
+	}
+
+	// Export bounds the archives of the export API, a zero value disabling the limit.
+	Export struct {
+		// MaxImages is the maximum number of images of an archive.
+		MaxImages int `yaml:"maxImages"`
+		// MaxSignedObjectSize is the maximum size, in bytes, of the objects downloaded for their signed URL.
+		MaxSignedObjectSize int64 `yaml:"maxSignedObjectSize"`
 	}
 
 	Log struct {
@@ -85,6 +163,7 @@ type (
 		ProductLabels           []string          `yaml:"productLabels"`
 		RequestDurationBuckets  HistogramsBuckets `yaml:"requestDurationBuckets"`
 		S3ListDurationBuckets   HistogramsBuckets `yaml:"s3ListDurationBuckets"`
+		ExprDurationBuckets     HistogramsBuckets `yaml:"exprDurationBuckets"`
 	}
 
 	HistogramsBuckets struct {
@@ -96,6 +175,11 @@ type (
 	UIMap struct {
 		PMTilesURL      string `yaml:"pmtilesURL"`
 		PMTilesStyleURL string `yaml:"pmtilesStyleURL"`
+		// PMTilesFile and MBTilesFile are local tile archives served by the web server instead of PMTilesURL.
+		PMTilesFile string `yaml:"pmtilesFile"`
+		MBTilesFile string `yaml:"mbtilesFile"`
+		// StyleDir holds the style.json file served instead of PMTilesStyleURL, along with the glyphs and sprites it refers to.
+		StyleDir string `yaml:"styleDir"`
 	}
 
 	DynamicData struct {
@@ -110,24 +194,66 @@ type (
 		Kind       FileSelectorKind `yaml:"kind"`
 		KindParams []string         `yaml:"-"`
 		Link       bool             `yaml:"link"`
+		Multiple   bool             `yaml:"multiple"`
+		// Member is the pattern of the entry to extract from the zip or tar archives matched by the selector.
+		Member string `yaml:"member"`
+		// Namespaces maps the prefixes usable in the XPath expressions on the file to their namespace URI.
+		Namespaces map[string]string `yaml:"namespaces"`
 	}
 
 	DynamicFilter struct {
-		Name       string `yaml:"name"`
-		Expression string `yaml:"expression"`
+		Name       string              `yaml:"name"`
+		Expression string              `yaml:"expression"`
+		Type       DynamicFilterType   `yaml:"type"`
+		UIHint     DynamicFilterUIHint `yaml:"uiHint"`
+		// Values are the accepted values of an enum filter, in the order they are displayed.
+		Values []string `yaml:"values"`
 	}
 
 	ImageGroup struct {
-		GroupName   string      `yaml:"groupName"`
-		Bucket      string      `yaml:"bucket"`
-		DynamicData DynamicData `yaml:"dynamicData"`
-		Types       []ImageType `yaml:"types"`
+		GroupName      string          `yaml:"groupName"`
+		Bucket         string          `yaml:"bucket"`
+		DynamicData    DynamicData     `yaml:"dynamicData"`
+		DynamicFilters []DynamicFilter `yaml:"dynamicFilters"`
+		Types          []ImageType     `yaml:"types"`
+		// Source is the position ("file:line") where this group has been defined.
+		Source string `yaml:"-"`
 	}
 
 	ImageType struct {
-		Name          string      `yaml:"name"`
-		DisplayName   string      `yaml:"displayName"`
-		ProductPrefix string      `yaml:"productPrefix"`
-		DynamicData   DynamicData `yaml:"dynamicData"`
+		Name                string         `yaml:"name"`
+		DisplayName         string         `yaml:"displayName"`
+		ProductPrefix       string         `yaml:"productPrefix"`
+		ProductRegex        string         `yaml:"productRegex"`
+		ProductRgx          *regexp.Regexp `yaml:"-"`
+		ProductMatch        string         `yaml:"productMatch"`
+		ProductMatchProgram *vm.Program    `yaml:"-"`
+		DynamicData         DynamicData    `yaml:"dynamicData"`
+		// DynamicFilters are, once the configuration is loaded, the filters inherited from the group and the products
+		// along with the ones of the type, restricted to those whose expression is defined for the type.
+		DynamicFilters []DynamicFilter `yaml:"dynamicFilters"`
+		// Source is the position ("file:line") where this type has been defined.
+		Source string `yaml:"-"`
+	}
+
+	// ExprTest describes the outputs expected from the expressions of an image type for a given object.
+	ExprTest struct {
+		Name         string                `yaml:"name"`
+		Group        string                `yaml:"group"`
+		Type         string                `yaml:"type"`
+		ObjectKey    string                `yaml:"objectKey"`
+		LastModified time.Time             `yaml:"lastModified"`
+		Files        map[string][]TestFile `yaml:"files"`
+		Expected     map[string]any        `yaml:"expected"`
+		// Source is the position ("file:line") where this test has been defined.
+		Source string `yaml:"-"`
+	}
+
+	// TestFile is a fixture standing for an object matched by a file selector.
+	TestFile struct {
+		// Path is the local path of the fixture, relative to the file defining the test.
+		Path string `yaml:"path"`
+		// Key is the S3 key of the object, which defaults to the fixture name in the directory of the test object key.
+		Key string `yaml:"key"`
 	}
 )
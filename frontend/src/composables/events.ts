@@ -1,4 +1,4 @@
-type EventType = "ObjectCreated" | "ObjectRemoved";
+type EventType = "ObjectCreated" | "ObjectRemoved" | "Reset";
 
 type ObjectType = "preview" | "target" | "dynamic_input";
 
@@ -1,14 +1,14 @@
 import { describe, expect, it } from "vitest";
 
 import { applyFilters } from "@/composables/filters";
-import type { ImageSummary } from "@/models/image";
+import type { DynamicFilterValue, ImageSummary } from "@/models/image";
 
 function makeSummary(params: {
   key: string;
   group: string;
   type: string;
   date: string;
-  dyn: Record<string, string>;
+  dyn: Record<string, DynamicFilterValue>;
 }): ImageSummary {
   return {
     bucket: "bucket",
@@ -59,6 +59,56 @@ describe("applyFilters", () => {
     expect(out.map((x) => x.key)).toEqual(["alpha-key"]);
   });
 
+  it("matches typed filter values", () => {
+    const day = makeSummary({
+      key: "day",
+      group: "g",
+      type: "t",
+      date: "2025-01-01T00:00:00.000Z",
+      dyn: { night: false, cloudCover: 0 },
+    });
+    const night = makeSummary({
+      key: "night",
+      group: "g",
+      type: "t",
+      date: "2025-01-02T00:00:00.000Z",
+      dyn: { night: true, cloudCover: null },
+    });
+
+    const out = applyFilters(
+      [day, night],
+      { night: { false: true, true: false }, cloudCover: { "0": true } },
+      { g: ["t"] },
+      ""
+    );
+    expect(out.map((x) => x.key)).toEqual(["day"]);
+  });
+
+  it("ignores filters not applying to the type of the image", () => {
+    const scoped = makeSummary({
+      key: "scoped",
+      group: "g",
+      type: "t1",
+      date: "2025-01-01T00:00:00.000Z",
+      dyn: { mode: "dev" },
+    });
+    const unscoped = makeSummary({
+      key: "unscoped",
+      group: "g",
+      type: "t2",
+      date: "2025-01-02T00:00:00.000Z",
+      dyn: {},
+    });
+
+    const out = applyFilters(
+      [scoped, unscoped],
+      { mode: { prod: true, dev: false } },
+      { g: ["t1", "t2"] },
+      ""
+    );
+    expect(out.map((x) => x.key)).toEqual(["unscoped"]);
+  });
+
   it("returns newest-first ordering after filtering", () => {
     const older = makeSummary({
       key: "older",
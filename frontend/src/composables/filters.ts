@@ -9,8 +9,12 @@ export function applyFilters(
 ): ImageSummary[] {
   let filtered = summaries.filter((img) => {
     for (const [filter, values] of Object.entries(filters)) {
+      if (!(filter in img.dynamicFilters)) {
+        continue; // the filter doesn't apply to the type of the image
+      }
+
       const imgValue = img.dynamicFilters[filter];
-      if (!imgValue || !values[imgValue]) {
+      if (imgValue === null || !values[String(imgValue)]) {
         return false;
       }
     }
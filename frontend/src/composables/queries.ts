@@ -52,9 +52,12 @@ const GET_IMAGE = gql`
           width
           height
         }
+        deepZoomManifest
       }
       localization {
         corner
+        crs
+        geometry
         cachedObject {
           lastModified
           cacheKey
@@ -8,6 +8,8 @@ export type ImageSize = {
   height: number;
 };
 
+export type DynamicFilterValue = string | number | boolean | null;
+
 export class ImageSummary {
   bucket: string;
   key: string;
@@ -16,9 +18,10 @@ export class ImageSummary {
   type: string;
   geonames: Geonames | null;
   productInfo: ProductInformation | null;
-  dynamicFilters: Record<string, string>;
+  dynamicFilters: Record<string, DynamicFilterValue>;
   cachedObject: CachedObject;
   size: ImageSize;
+  deepZoomManifest: string; // empty when the preview isn't tiled
 
   _hasBeenUpdated: boolean;
   _lastModified: Date;
@@ -31,9 +34,10 @@ export class ImageSummary {
     type: string,
     geonames: Geonames | null,
     productInfo: ProductInformation | null,
-    dynamicFilters: Record<string, string>,
+    dynamicFilters: Record<string, DynamicFilterValue>,
     cachedObject: CachedObject,
     size: ImageSize,
+    deepZoomManifest: string,
     hasBeenUpdated: boolean,
     _lastModified: Date
   ) {
@@ -47,6 +51,7 @@ export class ImageSummary {
     this.dynamicFilters = dynamicFilters;
     this.cachedObject = cachedObject;
     this.size = size;
+    this.deepZoomManifest = deepZoomManifest;
     this._hasBeenUpdated = hasBeenUpdated;
     this._lastModified = _lastModified;
   }
@@ -25,12 +25,21 @@ export class LocalizationCorner {
   }
 }
 
+// GeoJSON Polygon or MultiPolygon footprint.
+export type Geometry =
+  | { type: "Polygon"; coordinates: number[][][] }
+  | { type: "MultiPolygon"; coordinates: number[][][][] };
+
 export class Localization {
   corner: LocalizationCorner;
+  crs: string;
+  geometry: Geometry | null;
   cachedObject: CachedObject;
 
-  constructor(corner: LocalizationCorner, cachedObject: CachedObject) {
+  constructor(corner: LocalizationCorner, crs: string, geometry: Geometry | null, cachedObject: CachedObject) {
     this.corner = corner;
+    this.crs = crs;
+    this.geometry = geometry;
     this.cachedObject = cachedObject;
   }
 }
@@ -1,10 +1,12 @@
 export class ImageType {
   name: string;
   displayName: string;
+  dynamicFilters: string[];
 
-  constructor(name: string, displayName: string) {
+  constructor(name: string, displayName: string, dynamicFilters: string[]) {
     this.name = name;
     this.displayName = displayName;
+    this.dynamicFilters = dynamicFilters;
   }
 }
 
@@ -20,6 +22,9 @@ export class ImageGroup {
   }
 }
 
+// How to load the map tiles: a PMTiles archive, or XYZ vector or raster tiles.
+export type MapTilesType = "pmtiles" | "vector" | "raster";
+
 export class StaticInfo {
   softwareVersion: string;
   windowTitle: string;
@@ -30,6 +35,7 @@ export class StaticInfo {
   maxImagesDisplayCount: number;
   pmtilesURL: string;
   pmtilesStyleURL: string;
+  mapTilesType: MapTilesType;
   imageGroups: ImageGroup[];
   dynamicFilters: string[];
 
@@ -43,6 +49,7 @@ export class StaticInfo {
     maxImagesDisplayCount: number,
     pmtilesURL: string,
     pmtilesStyleURL: string,
+    mapTilesType: MapTilesType,
     imageGroups: ImageGroup[],
     dynamicFilters: string[]
   ) {
@@ -55,6 +62,7 @@ export class StaticInfo {
     this.maxImagesDisplayCount = maxImagesDisplayCount;
     this.pmtilesURL = pmtilesURL;
     this.pmtilesStyleURL = pmtilesStyleURL;
+    this.mapTilesType = mapTilesType;
     this.imageGroups = imageGroups;
     this.dynamicFilters = dynamicFilters;
   }
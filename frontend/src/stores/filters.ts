@@ -1,9 +1,10 @@
 import { defineStore } from "pinia";
+import type { DynamicFilterValue } from "@/models/image";
 
 export const useFilterStore = defineStore("filters", {
   state: () => {
     return {
-      tempFilters: [] as Record<string, string>[] | null,
+      tempFilters: [] as Record<string, DynamicFilterValue>[] | null,
       checkedFilters: {} as Record<string, Record<string, boolean>>,
       checkedTypes: {} as Record<string, string[]>,
       searchQuery: "",
@@ -31,7 +32,7 @@ export const useFilterStore = defineStore("filters", {
         }
       }
     },
-    addFilterOptions(filterOptions: Record<string, string>) {
+    addFilterOptions(filterOptions: Record<string, DynamicFilterValue>) {
       if (this.tempFilters != null) {
         // Filter modes are not initialized yet, store the filter options temporarily
         this.tempFilters.push(filterOptions);
@@ -39,8 +40,13 @@ export const useFilterStore = defineStore("filters", {
       }
 
       for (const [filter, value] of Object.entries(filterOptions)) {
-        if (this.checkedFilters[filter] && this.checkedFilters[filter][value] === undefined) {
-          this.checkedFilters[filter][value] = true; // checked by default
+        if (value === null) {
+          continue;
+        }
+
+        const option = String(value);
+        if (this.checkedFilters[filter] && this.checkedFilters[filter][option] === undefined) {
+          this.checkedFilters[filter][option] = true; // checked by default
         }
       }
     },
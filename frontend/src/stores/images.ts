@@ -131,6 +131,9 @@ export const useImageStore = defineStore("images", {
         } else if (updated) {
           // TODO
         }
+      } else if (event.eventType === "Reset") {
+        // The server configuration has been reloaded, static info and summaries must be fetched again
+        window.location.reload();
       } else {
         console.warn("Unknown event type", event.eventType);
       }
@@ -0,0 +1,263 @@
+// Package deepzoom splits large images into Deep Zoom (DZI) tile pyramids,
+// letting the viewers load only the tiles of the region and resolution they display.
+package deepzoom
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/utils"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// ManifestSuffix is appended to the path of an image to get the one of its manifest.
+	ManifestSuffix = ".dzi"
+	// tilesDirSuffix is appended to the path of an image to get the directory of its tiles,
+	// which holds a directory per level, named after it, with the tiles named <column>_<row>.<format>.
+	tilesDirSuffix = "_files"
+)
+
+const (
+	formatJPEG  = "jpg"
+	formatPNG   = "png"
+	jpegQuality = 90
+	dziXMLNS    = "http://schemas.microsoft.com/deepzoom/2008"
+)
+
+var errInvalidTileSize = errors.New("invalid tile size")
+
+// Manifest is the DZI description of a pyramid. Its levels go from 0, a single pixel,
+// to the full resolution, each one being half the size of the next one, rounded up.
+type Manifest struct {
+	XMLName  xml.Name `xml:"Image"`
+	XMLNS    string   `xml:"xmlns,attr"`
+	Format   string   `xml:"Format,attr"`
+	Overlap  int      `xml:"Overlap,attr"`
+	TileSize int      `xml:"TileSize,attr"`
+	Size     struct {
+		Width  int `xml:"Width,attr"`
+		Height int `xml:"Height,attr"`
+	} `xml:"Size"`
+}
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// ImagePath returns the path of the image a manifest or tile path belongs to, or false if it is neither.
+func ImagePath(path string) (string, bool) {
+	if imagePath, found := strings.CutSuffix(path, ManifestSuffix); found {
+		return imagePath, imagePath != ""
+	}
+
+	idx := strings.LastIndex(path, tilesDirSuffix+"/")
+	if idx <= 0 {
+		return "", false
+	}
+
+	return path[:idx], true
+}
+
+// IsFresh reports whether the pyramid of the given image has been generated from its current version.
+func IsFresh(imagePath string) (bool, error) {
+	imageInfo, err := os.Stat(imagePath)
+	if err != nil {
+		return false, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	manifestInfo, err := os.Stat(imagePath + ManifestSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	// The manifest takes the modification time of the image it was generated from.
+	return manifestInfo.ModTime().Equal(imageInfo.ModTime()), nil
+}
+
+// Generate writes the pyramid of the given image next to it, replacing the previous one.
+// PNG images give PNG tiles, keeping their transparency, the others JPEG tiles.
+// Images of more than maxPixels pixels are refused with [utils.ErrImageTooLarge], before being decoded, if maxPixels is positive.
+func Generate(imagePath string, tileSize, maxPixels int) error {
+	if tileSize <= 0 {
+		return fmt.Errorf("%w: %d", errInvalidTileSize, tileSize)
+	}
+
+	imageInfo, err := os.Stat(imagePath)
+	if err != nil {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	img, format, err := decode(imagePath, maxPixels)
+	if err != nil {
+		return fmt.Errorf("decoding image: %w", err)
+	}
+
+	manifest := Manifest{XMLNS: dziXMLNS, Format: formatJPEG, TileSize: tileSize}
+	manifest.Size.Width, manifest.Size.Height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	if format == formatPNG {
+		manifest.Format = formatPNG
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(imagePath), filepath.Base(imagePath)+tilesDirSuffix+"-*")
+	if err != nil {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	for level := maxLevel(manifest.Size.Width, manifest.Size.Height); level >= 0; level-- {
+		err = writeLevel(filepath.Join(tmpDir, strconv.Itoa(level)), img, tileSize, manifest.Format)
+		if err != nil {
+			return fmt.Errorf("writing level %d: %w", level, err)
+		}
+
+		if level > 0 {
+			img = halve(img)
+		}
+	}
+
+	// The manifest is written last, the pyramid being complete once it exists.
+	err = Remove(imagePath)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpDir, imagePath+tilesDirSuffix)
+	if err != nil {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	return writeManifest(imagePath+ManifestSuffix, manifest, imageInfo)
+}
+
+// Remove deletes the pyramid of the given image, if any.
+func Remove(imagePath string) error {
+	if err := os.Remove(imagePath + ManifestSuffix); err != nil && !os.IsNotExist(err) {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	return os.RemoveAll(imagePath + tilesDirSuffix) //nolint: wrapcheck // wrapped by caller
+}
+
+func decode(imagePath string, maxPixels int) (image.Image, string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, "", err //nolint: wrapcheck // wrapped by caller
+	}
+
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, "", err //nolint: wrapcheck // wrapped by caller
+	}
+
+	if maxPixels > 0 && cfg.Width*cfg.Height > maxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d pixels, the limit being %d", utils.ErrImageTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err //nolint: wrapcheck // wrapped by caller
+	}
+
+	return image.Decode(f) //nolint: wrapcheck // wrapped by caller
+}
+
+// maxLevel returns the level of the full resolution, the first one whose size reaches the one of the image.
+func maxLevel(width, height int) int {
+	return bits.Len(uint(max(width, height) - 1)) //nolint: gosec // images have a positive size
+}
+
+// halve returns the given image scaled down by 2, rounding its size up.
+func halve(img image.Image) image.Image {
+	bounds := img.Bounds()
+	halved := image.NewRGBA(image.Rect(0, 0, (bounds.Dx()+1)/2, (bounds.Dy()+1)/2))
+
+	draw.BiLinear.Scale(halved, halved.Bounds(), img, bounds, draw.Src, nil)
+
+	return halved
+}
+
+func writeLevel(dir string, img image.Image, tileSize int, format string) error {
+	err := os.Mkdir(dir, 0o700)
+	if err != nil {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	bounds := img.Bounds()
+
+	for row := 0; row*tileSize < bounds.Dy(); row++ {
+		for col := 0; col*tileSize < bounds.Dx(); col++ {
+			rect := image.Rect(col*tileSize, row*tileSize, (col+1)*tileSize, (row+1)*tileSize).Add(bounds.Min).Intersect(bounds)
+			tilePath := filepath.Join(dir, fmt.Sprintf("%d_%d.%s", col, row, format))
+
+			err = writeTile(tilePath, img.(subImager).SubImage(rect), format) //nolint: forcetypeassert // all the decoded images are
+			if err != nil {
+				return fmt.Errorf("tile %d_%d: %w", col, row, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeTile(tilePath string, tile image.Image, format string) error {
+	f, err := os.Create(tilePath)
+	if err != nil {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	if format == formatPNG {
+		err = png.Encode(f, tile)
+	} else {
+		err = jpeg.Encode(f, tile, &jpeg.Options{Quality: jpegQuality})
+	}
+
+	return closeFile(f, err)
+}
+
+func writeManifest(manifestPath string, manifest Manifest, imageInfo os.FileInfo) error {
+	f, err := os.Create(manifestPath)
+	if err != nil {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	_, err = io.WriteString(f, xml.Header)
+	if err == nil {
+		err = xml.NewEncoder(f).Encode(manifest)
+	}
+
+	err = closeFile(f, err)
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(manifestPath, imageInfo.ModTime(), imageInfo.ModTime()) //nolint: wrapcheck // wrapped by caller
+}
+
+// closeFile closes the given file, returning the given error first.
+func closeFile(f *os.File, err error) error {
+	closeErr := f.Close()
+	if err != nil {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	return closeErr //nolint: wrapcheck // wrapped by caller
+}
@@ -0,0 +1,185 @@
+package deepzoom
+
+import (
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/utils"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestImagePath(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		path          string
+		expectedPath  string
+		expectedFound bool
+	}{
+		{"bkt/img/preview.jpg.dzi", "bkt/img/preview.jpg", true},
+		{"bkt/img/preview.jpg_files/12/3_4.jpg", "bkt/img/preview.jpg", true},
+		{"bkt/my_files/img/preview.png_files/0/0_0.png", "bkt/my_files/img/preview.png", true},
+		{"bkt/img/preview.jpg", "", false},
+		{".dzi", "", false},
+		{"_files/0/0_0.jpg", "", false},
+	}
+
+	for _, tc := range cases {
+		imagePath, found := ImagePath(tc.path)
+		if imagePath != tc.expectedPath || found != tc.expectedFound {
+			t.Errorf("ImagePath(%q): want %q, %t, got %q, %t", tc.path, tc.expectedPath, tc.expectedFound, imagePath, found)
+		}
+	}
+}
+
+func writePNG(t *testing.T, imagePath string, width, height int) {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		img.Set(x, x*height/width, color.NRGBA{R: 255, A: 255})
+	}
+
+	f, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if err = png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func imageSize(t *testing.T, imagePath string) image.Point {
+	t.Helper()
+
+	f, err := os.Open(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return image.Pt(cfg.Width, cfg.Height)
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	imagePath := filepath.Join(t.TempDir(), "preview.png")
+	writePNG(t, imagePath, 600, 300)
+
+	if fresh, err := IsFresh(imagePath); err != nil || fresh {
+		t.Fatalf("Expected no pyramid yet, got %t, %v", fresh, err)
+	}
+
+	if err := Generate(imagePath, 256, 0); err != nil {
+		t.Fatal("Failed to generate the pyramid:", err)
+	}
+
+	data, err := os.ReadFile(imagePath + ManifestSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest Manifest
+	if err = xml.Unmarshal(data, &manifest); err != nil {
+		t.Fatal("Failed to decode the manifest:", err)
+	}
+
+	expected := Manifest{XMLName: xml.Name{Space: dziXMLNS, Local: "Image"}, XMLNS: dziXMLNS, Format: formatPNG, TileSize: 256}
+	expected.Size.Width, expected.Size.Height = 600, 300
+
+	if diff := cmp.Diff(expected, manifest); diff != "" {
+		t.Errorf("Unexpected manifest (-want +got):\n%s", diff)
+	}
+
+	for tile, expectedSize := range map[string]image.Point{
+		"10/0_0.png": image.Pt(256, 256),
+		"10/2_1.png": image.Pt(88, 44),
+		"9/1_0.png":  image.Pt(44, 150),
+		"8/0_0.png":  image.Pt(150, 75),
+		"1/0_0.png":  image.Pt(2, 1),
+		"0/0_0.png":  image.Pt(1, 1),
+	} {
+		if size := imageSize(t, filepath.Join(imagePath+tilesDirSuffix, tile)); size != expectedSize {
+			t.Errorf("Unexpected size of tile %s: want %v, got %v", tile, expectedSize, size)
+		}
+	}
+
+	if _, err = os.Stat(filepath.Join(imagePath+tilesDirSuffix, "10", "3_0.png")); !os.IsNotExist(err) {
+		t.Errorf("Expected no tile beyond the image, got %v", err)
+	}
+
+	if fresh, err := IsFresh(imagePath); err != nil || !fresh {
+		t.Fatalf("Expected a fresh pyramid, got %t, %v", fresh, err)
+	}
+
+	// A new version of the image makes the pyramid outdated.
+	if err = os.Chtimes(imagePath, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if fresh, err := IsFresh(imagePath); err != nil || fresh {
+		t.Fatalf("Expected an outdated pyramid, got %t, %v", fresh, err)
+	}
+
+	if err = Remove(imagePath); err != nil {
+		t.Fatal("Failed to remove the pyramid:", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(imagePath))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected only the image to be left, got %v, %v", entries, err)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	notAnImage := filepath.Join(dir, "preview.jpg")
+
+	if err := os.WriteFile(notAnImage, []byte("not an image"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Generate(notAnImage, 256, 0); err == nil {
+		t.Error("Expected an error for an invalid image")
+	}
+
+	if err := Generate(notAnImage, 0, 0); err == nil {
+		t.Error("Expected an error for an invalid tile size")
+	}
+
+	if err := Generate(filepath.Join(dir, "missing.jpg"), 256, 0); !os.IsNotExist(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	tooLarge := filepath.Join(dir, "preview.png")
+	writePNG(t, tooLarge, 600, 300)
+
+	if err := Generate(tooLarge, 256, 600*300-1); !errors.Is(err, utils.ErrImageTooLarge) {
+		t.Errorf("Expected a too large image error, got %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected no leftover files, got %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,205 @@
+// Package gazetteer reverse geocodes footprints offline, from the dump files published by GeoNames
+// (https://download.geonames.org/export/dump/).
+package gazetteer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Columns of the GeoNames cities files (cities500.txt, cities15000.txt...).
+const (
+	colName        = 1
+	colLatitude    = 4
+	colLongitude   = 5
+	colCountryCode = 8
+	colAdmin1Code  = 10
+	colAdmin2Code  = 11
+	colPopulation  = 14
+	citiesColumns  = 15
+)
+
+// countryInfoNameColumn is the column of the country name in countryInfo.txt.
+const countryInfoNameColumn = 4
+
+// maxLineSize is the size of the longest line of the dump files, which list many alternate names.
+const maxLineSize = 1 << 20
+
+var errInvalidLine = errors.New("invalid line")
+
+// Options locates the dump files of the gazetteer.
+type Options struct {
+	// CitiesFile lists the populated places, e.g. cities15000.txt. It is required.
+	CitiesFile string
+	// Admin1CodesFile, Admin2CodesFile and CountryInfoFile give the names of the states, counties and countries,
+	// e.g. admin1CodesASCII.txt, admin2Codes.txt and countryInfo.txt. Their codes are used when they are missing.
+	Admin1CodesFile string
+	Admin2CodesFile string
+	CountryInfoFile string
+	// MaxDistance is the distance, in km, up to which the nearest place is returned for the footprints containing none.
+	MaxDistance float64
+	// VillageMaxPopulation is the population under which a place is a village rather than a city.
+	VillageMaxPopulation int
+}
+
+type place struct {
+	name        string
+	lon, lat    float64
+	countryCode string
+	admin1Code  string
+	admin2Code  string
+	population  int
+}
+
+// Gazetteer holds the places of a GeoNames dump, indexed by 1° cells.
+type Gazetteer struct {
+	places               []place
+	cells                map[cell][]int
+	countries            map[string]string
+	admin1               map[string]string
+	admin2               map[string]string
+	maxDistance          float64
+	villageMaxPopulation int
+}
+
+type cell struct {
+	lon, lat int
+}
+
+func cellOf(lon, lat float64) cell {
+	return cell{lon: int(math.Floor(lon)), lat: int(math.Floor(lat))}
+}
+
+// Load reads the dump files given by the options.
+func Load(opts Options) (*Gazetteer, error) {
+	if opts.CitiesFile == "" {
+		return nil, errors.New("no cities file given")
+	}
+
+	gazetteer := &Gazetteer{
+		cells:                make(map[cell][]int),
+		maxDistance:          opts.MaxDistance,
+		villageMaxPopulation: opts.VillageMaxPopulation,
+	}
+
+	err := readTSV(opts.CitiesFile, func(fields []string) error {
+		p, err := parsePlace(fields)
+		if err != nil {
+			return err
+		}
+
+		c := cellOf(p.lon, p.lat)
+		gazetteer.cells[c] = append(gazetteer.cells[c], len(gazetteer.places))
+		gazetteer.places = append(gazetteer.places, p)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading cities: %w", err)
+	}
+
+	gazetteer.countries, err = readNames(opts.CountryInfoFile, countryInfoNameColumn)
+	if err != nil {
+		return nil, fmt.Errorf("reading countries: %w", err)
+	}
+
+	gazetteer.admin1, err = readNames(opts.Admin1CodesFile, 1)
+	if err != nil {
+		return nil, fmt.Errorf("reading admin1 codes: %w", err)
+	}
+
+	gazetteer.admin2, err = readNames(opts.Admin2CodesFile, 1)
+	if err != nil {
+		return nil, fmt.Errorf("reading admin2 codes: %w", err)
+	}
+
+	return gazetteer, nil
+}
+
+// Len returns the number of places of the gazetteer.
+func (g *Gazetteer) Len() int {
+	return len(g.places)
+}
+
+func parsePlace(fields []string) (place, error) {
+	if len(fields) < citiesColumns {
+		return place{}, fmt.Errorf("%w: %d columns, expected at least %d", errInvalidLine, len(fields), citiesColumns)
+	}
+
+	lat, err := strconv.ParseFloat(fields[colLatitude], 64)
+	if err != nil {
+		return place{}, fmt.Errorf("%w: latitude: %w", errInvalidLine, err)
+	}
+
+	lon, err := strconv.ParseFloat(fields[colLongitude], 64)
+	if err != nil {
+		return place{}, fmt.Errorf("%w: longitude: %w", errInvalidLine, err)
+	}
+
+	population, _ := strconv.Atoi(fields[colPopulation]) // often empty
+
+	return place{
+		name:        fields[colName],
+		lon:         lon,
+		lat:         lat,
+		countryCode: fields[colCountryCode],
+		admin1Code:  fields[colAdmin1Code],
+		admin2Code:  fields[colAdmin2Code],
+		population:  population,
+	}, nil
+}
+
+// readNames maps the codes of the first column of the given file to the names of the given column.
+// An empty path gives an empty map.
+func readNames(filePath string, nameColumn int) (map[string]string, error) {
+	names := make(map[string]string)
+
+	if filePath == "" {
+		return names, nil
+	}
+
+	err := readTSV(filePath, func(fields []string) error {
+		if len(fields) <= nameColumn {
+			return fmt.Errorf("%w: %d columns, expected at least %d", errInvalidLine, len(fields), nameColumn+1)
+		}
+
+		names[fields[0]] = fields[nameColumn]
+
+		return nil
+	})
+
+	return names, err
+}
+
+// readTSV calls the given function with the fields of each line of the given tab-separated file,
+// skipping the empty lines and the comments.
+func readTSV(filePath string, handle func(fields []string) error) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		err = handle(strings.Split(line, "\t"))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+
+	return scanner.Err() //nolint: wrapcheck // wrapped by caller
+}
@@ -0,0 +1,137 @@
+package gazetteer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func loadTestGazetteer(t *testing.T, maxDistance float64) *Gazetteer {
+	t.Helper()
+
+	gazetteer, err := Load(Options{
+		CitiesFile:           filepath.Join("testdata", "cities.txt"),
+		Admin1CodesFile:      filepath.Join("testdata", "admin1CodesASCII.txt"),
+		Admin2CodesFile:      filepath.Join("testdata", "admin2Codes.txt"),
+		CountryInfoFile:      filepath.Join("testdata", "countryInfo.txt"),
+		MaxDistance:          maxDistance,
+		VillageMaxPopulation: 5000,
+	})
+	if err != nil {
+		t.Fatal("Failed to load gazetteer:", err)
+	}
+
+	return gazetteer
+}
+
+func box(minLon, minLat, maxLon, maxLat float64) [][2]float64 {
+	return [][2]float64{{minLon, maxLat}, {maxLon, maxLat}, {maxLon, minLat}, {minLon, minLat}, {minLon, maxLat}}
+}
+
+func places(names ...string) []types.GeonamesPlace {
+	result := []types.GeonamesPlace{}
+
+	for _, name := range names {
+		result = append(result, types.GeonamesPlace{Name: name})
+	}
+
+	return result
+}
+
+func TestReverseGeocode(t *testing.T) {
+	t.Parallel()
+
+	gazetteer := loadTestGazetteer(t, 50)
+
+	if gazetteer.Len() != 7 {
+		t.Fatalf("Unexpected number of places %d", gazetteer.Len())
+	}
+
+	cases := []struct {
+		name     string
+		rings    [][][2]float64
+		expected []types.GeonamesObject
+	}{
+		{
+			name:  "places in the footprint",
+			rings: [][][2]float64{box(2, 48.3, 2.5, 49)},
+			expected: []types.GeonamesObject{{
+				Name: "France",
+				States: []types.GeonamesState{{
+					Name: "Île-de-France",
+					Counties: []types.GeonamesCounty{
+						{Name: "Paris", Cities: places("Paris"), Villages: places()},
+						{Name: "Hauts-de-Seine", Cities: places("Boulogne-Billancourt"), Villages: places()},
+						{Name: "Yvelines", Cities: places("Versailles"), Villages: places()},
+						{Name: "Essonne", Cities: places(), Villages: places("Milly-la-Forêt")},
+					},
+				}},
+			}},
+		},
+		{
+			name:  "several polygons",
+			rings: [][][2]float64{box(4, 45, 5, 46), box(2.3, 48.8, 2.4, 48.9)},
+			expected: []types.GeonamesObject{{
+				Name: "France",
+				States: []types.GeonamesState{
+					{Name: "Île-de-France", Counties: []types.GeonamesCounty{{Name: "Paris", Cities: places("Paris"), Villages: places()}}},
+					{Name: "Auvergne-Rhône-Alpes", Counties: []types.GeonamesCounty{{Name: "Rhône", Cities: places("Lyon"), Villages: places()}}},
+				},
+			}},
+		},
+		{
+			name:  "footprint crossing the antimeridian",
+			rings: [][][2]float64{box(178, -19, 180.5, -16)},
+			expected: []types.GeonamesObject{{
+				Name: "Fiji",
+				States: []types.GeonamesState{
+					{Name: "Central", Counties: []types.GeonamesCounty{{Name: "Central", Cities: places("Suva"), Villages: places()}}},
+					{Name: "03", Counties: []types.GeonamesCounty{{Name: "03", Cities: places(), Villages: places("Waiyevo")}}},
+				},
+			}},
+		},
+		{
+			name:  "nearest place",
+			rings: [][][2]float64{box(4.9, 45.8, 5, 45.9)},
+			expected: []types.GeonamesObject{{
+				Name:   "France",
+				States: []types.GeonamesState{{Name: "Auvergne-Rhône-Alpes", Counties: []types.GeonamesCounty{{Name: "Rhône", Cities: places("Lyon"), Villages: places()}}}},
+			}},
+		},
+		{
+			name:     "too far from any place",
+			rings:    [][][2]float64{box(-30, 30, -29, 31)},
+			expected: []types.GeonamesObject{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tc.expected, gazetteer.ReverseGeocode(tc.rings)); diff != "" {
+				t.Errorf("Unexpected places (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]Options{
+		"no cities file":      {},
+		"missing cities file": {CitiesFile: filepath.Join("testdata", "missing.txt")},
+		"invalid cities file": {CitiesFile: filepath.Join("testdata", "admin2Codes.txt")},
+		"missing admin file":  {CitiesFile: filepath.Join("testdata", "cities.txt"), Admin1CodesFile: filepath.Join("testdata", "missing.txt")},
+	}
+
+	for name, opts := range cases {
+		if _, err := Load(opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package gazetteer
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+)
+
+// earthMeanRadius is the mean radius of the Earth, in km.
+const earthMeanRadius = 6371.0
+
+// kmPerDegree is the length of a degree of latitude, in km.
+const kmPerDegree = 111.32
+
+// ReverseGeocode returns the places located in the given polygons, given by their exterior rings of [lon, lat] positions,
+// grouped by country, state and county. When they contain none, the place nearest to their center is returned,
+// provided it is closer than the maximum distance.
+// Places are ordered by decreasing population, and so are the levels holding them, by the one of their biggest place.
+func (g *Gazetteer) ReverseGeocode(rings [][][2]float64) []types.GeonamesObject {
+	found := make(map[int]bool)
+
+	for _, ring := range rings {
+		for _, idx := range g.placesInRing(ring) {
+			found[idx] = true
+		}
+	}
+
+	if len(found) == 0 {
+		if idx, ok := g.nearestPlace(rings); ok {
+			found[idx] = true
+		}
+	}
+
+	indexes := make([]int, 0, len(found))
+	for idx := range found {
+		indexes = append(indexes, idx)
+	}
+
+	slices.SortFunc(indexes, func(a, b int) int {
+		return cmp.Or(
+			cmp.Compare(g.places[b].population, g.places[a].population),
+			cmp.Compare(g.places[a].name, g.places[b].name),
+		)
+	})
+
+	return g.hierarchy(indexes)
+}
+
+// placesInRing returns the indexes of the places located in the given ring.
+func (g *Gazetteer) placesInRing(ring [][2]float64) []int {
+	if len(ring) == 0 {
+		return nil
+	}
+
+	minLon, minLat, maxLon, maxLat := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+
+	for _, position := range ring {
+		minLon, maxLon = min(minLon, position[0]), max(maxLon, position[0])
+		minLat, maxLat = min(minLat, position[1]), max(maxLat, position[1])
+	}
+
+	var indexes []int
+
+	minCell, maxCell := cellOf(minLon, minLat), cellOf(maxLon, maxLat)
+
+	for lat := minCell.lat; lat <= maxCell.lat; lat++ {
+		// Rings crossing the antimeridian have longitudes beyond 180°, whose cells are the ones of the western hemisphere.
+		for lon := minCell.lon; lon <= maxCell.lon && lon < minCell.lon+360; lon++ {
+			for _, idx := range g.cells[cell{lon: wrapCellLon(lon), lat: lat}] {
+				p := g.places[idx]
+
+				placeLon := p.lon
+				if placeLon < minLon {
+					placeLon += 360
+				}
+
+				if inRing(placeLon, p.lat, ring) {
+					indexes = append(indexes, idx)
+				}
+			}
+		}
+	}
+
+	return indexes
+}
+
+// nearestPlace returns the index of the place nearest to the center of the given rings,
+// if one is closer than the maximum distance.
+func (g *Gazetteer) nearestPlace(rings [][][2]float64) (int, bool) {
+	var (
+		lonSum, latSum float64
+		count          int
+	)
+
+	for _, ring := range rings {
+		// The last position of a closed ring repeats the first one.
+		for _, position := range ring[:max(len(ring)-1, 0)] {
+			lonSum += position[0]
+			latSum += position[1]
+			count++
+		}
+	}
+
+	if count == 0 || g.maxDistance <= 0 {
+		return 0, false
+	}
+
+	centerLon, centerLat := lonSum/float64(count), latSum/float64(count)
+	center := cellOf(centerLon, centerLat)
+	latRadius := int(math.Ceil(g.maxDistance / kmPerDegree))
+	lonRadius := min(180, int(math.Ceil(float64(latRadius)/max(math.Cos(centerLat*math.Pi/180), 0.01))))
+
+	nearest, nearestDistance := -1, g.maxDistance
+
+	for lat := center.lat - latRadius; lat <= center.lat+latRadius; lat++ {
+		for lon := center.lon - lonRadius; lon <= center.lon+lonRadius && lon < center.lon-lonRadius+360; lon++ {
+			for _, idx := range g.cells[cell{lon: wrapCellLon(lon), lat: lat}] {
+				distance := haversine(centerLon, centerLat, g.places[idx].lon, g.places[idx].lat)
+				if distance <= nearestDistance {
+					nearest, nearestDistance = idx, distance
+				}
+			}
+		}
+	}
+
+	return nearest, nearest >= 0
+}
+
+// hierarchy groups the given places by country, state and county, keeping their order.
+func (g *Gazetteer) hierarchy(indexes []int) []types.GeonamesObject {
+	objects := []types.GeonamesObject{}
+	countries := make(map[string]int)
+	states := make(map[string]int)
+	counties := make(map[string]int)
+
+	for _, idx := range indexes {
+		p := g.places[idx]
+		admin1Key := p.countryCode + "." + p.admin1Code
+		admin2Key := admin1Key + "." + p.admin2Code
+
+		c, found := countries[p.countryCode]
+		if !found {
+			c = len(objects)
+			countries[p.countryCode] = c
+			objects = append(objects, types.GeonamesObject{Name: nameOr(g.countries, p.countryCode, p.countryCode), States: []types.GeonamesState{}})
+		}
+
+		country := &objects[c]
+
+		s, found := states[admin1Key]
+		if !found {
+			s = len(country.States)
+			states[admin1Key] = s
+			country.States = append(country.States, types.GeonamesState{Name: nameOr(g.admin1, admin1Key, p.admin1Code), Counties: []types.GeonamesCounty{}})
+		}
+
+		state := &country.States[s]
+
+		k, found := counties[admin2Key]
+		if !found {
+			k = len(state.Counties)
+			counties[admin2Key] = k
+			// Many countries have no counties, the places are then grouped under the name of their state.
+			state.Counties = append(state.Counties, types.GeonamesCounty{
+				Name:     nameOr(g.admin2, admin2Key, cmp.Or(p.admin2Code, state.Name)),
+				Cities:   []types.GeonamesPlace{},
+				Villages: []types.GeonamesPlace{},
+			})
+		}
+
+		county := &state.Counties[k]
+
+		if p.population < g.villageMaxPopulation {
+			county.Villages = append(county.Villages, types.GeonamesPlace{Name: p.name})
+		} else {
+			county.Cities = append(county.Cities, types.GeonamesPlace{Name: p.name})
+		}
+	}
+
+	return objects
+}
+
+func nameOr(names map[string]string, key, fallback string) string {
+	if name, found := names[key]; found && name != "" {
+		return name
+	}
+
+	return fallback
+}
+
+// wrapCellLon brings the given cell longitude back to [-180, 180).
+func wrapCellLon(lon int) int {
+	return ((lon+180)%360+360)%360 - 180
+}
+
+// inRing reports whether the given point is inside the given ring, with the even-odd rule.
+func inRing(lon, lat float64, ring [][2]float64) bool {
+	inside := false
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > lat) != (b[1] > lat) && lon < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// haversine returns the great-circle distance, in km, between the two given points.
+func haversine(lon1, lat1, lon2, lat2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthMeanRadius * math.Asin(math.Sqrt(a))
+}
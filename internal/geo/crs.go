@@ -0,0 +1,233 @@
+// Package geo converts coordinates between reference systems, reads the georeferencing of GeoTIFF files
+// and maps geographic coordinates to image pixels.
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EPSG codes of the reference systems handled without parameters.
+const (
+	EPSGWGS84       = 4326
+	EPSGWebMercator = 3857
+	EPSGLambert93   = 2154
+)
+
+// WGS 84 ellipsoid. GRS 80, used by ETRS89, NAD83 and RGF93, only differs by a tenth of a millimeter.
+const (
+	semiMajorAxis = 6378137.0
+	flattening    = 1 / 298.257223563
+)
+
+// UTM projection parameters.
+const (
+	utmScaleFactor   = 0.9996
+	utmFalseEasting  = 500000.0
+	utmFalseNorthing = 10000000.0
+)
+
+var ErrUnsupportedCRS = errors.New("unsupported coordinate reference system")
+
+// geographicCRS lists the geographic systems whose datum matches WGS 84 within a few meters,
+// whose coordinates are used as is.
+var geographicCRS = map[int]bool{ //nolint: gochecknoglobals
+	EPSGWGS84: true,
+	4171:      true, // RGF93
+	4258:      true, // ETRS89
+	4269:      true, // NAD83
+}
+
+// ParseCRS returns the EPSG code of the given reference system, written as "EPSG:32631", "32631",
+// "urn:ogc:def:crs:EPSG::32631" or "http://www.opengis.net/def/crs/EPSG/0/32631".
+// "CRS84" and "WGS84" stand for EPSG:4326, which is also the default when the given string is empty.
+func ParseCRS(crs string) (int, error) {
+	crs = strings.TrimSpace(crs)
+
+	switch strings.ToUpper(crs) {
+	case "", "CRS84", "OGC:CRS84", "URN:OGC:DEF:CRS:OGC:1.3:CRS84", "WGS84":
+		return EPSGWGS84, nil
+	}
+
+	code := crs
+	if i := strings.LastIndexAny(crs, ":/"); i >= 0 {
+		code = crs[i+1:]
+	}
+
+	epsg, err := strconv.Atoi(code)
+	if err != nil || epsg <= 0 {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedCRS, crs)
+	}
+
+	return epsg, nil
+}
+
+// ToWGS84 converts the given coordinates, expressed in the reference system with the given EPSG code,
+// to a WGS 84 longitude and latitude, in degrees.
+// Supported systems are WGS 84 and the geographic systems sharing its datum, Web Mercator,
+// the UTM zones on WGS 84, ETRS89 and NAD83, Lambert 93 and the French conic conformal zones (CC42 to CC50).
+func ToWGS84(epsg int, x, y float64) (lon, lat float64, err error) {
+	switch {
+	case geographicCRS[epsg]:
+		return x, y, nil
+	case epsg == EPSGWebMercator || epsg == 900913:
+		return webMercatorToWGS84(x, y)
+	case epsg > 32600 && epsg <= 32660:
+		return utmToWGS84(epsg-32600, false, x, y)
+	case epsg > 32700 && epsg <= 32760:
+		return utmToWGS84(epsg-32700, true, x, y)
+	case epsg >= 25828 && epsg <= 25838: // ETRS89 / UTM
+		return utmToWGS84(epsg-25800, false, x, y)
+	case epsg > 26900 && epsg <= 26923: // NAD83 / UTM
+		return utmToWGS84(epsg-26900, false, x, y)
+	case epsg == EPSGLambert93:
+		return lambert93.toWGS84(x, y)
+	case epsg >= 3942 && epsg <= 3950:
+		return conicConformalZone(epsg-3900).toWGS84(x, y)
+	default:
+		return 0, 0, fmt.Errorf("%w: EPSG:%d", ErrUnsupportedCRS, epsg)
+	}
+}
+
+// NormalizeAntimeridian brings the given longitudes back to [-180, 180], then, if they span more than half the globe,
+// which happens when the footprint they describe crosses the antimeridian, shifts the western ones by 360°
+// so that the footprint stays continuous.
+func NormalizeAntimeridian(lons []float64) {
+	minLon, maxLon := math.Inf(1), math.Inf(-1)
+
+	for i, lon := range lons {
+		if lon < -180 || lon > 180 {
+			lon = math.Mod(lon+180, 360)
+			if lon < 0 {
+				lon += 360
+			}
+
+			lons[i] = lon - 180
+		}
+
+		minLon, maxLon = min(minLon, lons[i]), max(maxLon, lons[i])
+	}
+
+	if maxLon-minLon <= 180 {
+		return
+	}
+
+	for i, lon := range lons {
+		if lon < 0 {
+			lons[i] = lon + 360
+		}
+	}
+}
+
+func webMercatorToWGS84(x, y float64) (lon, lat float64, err error) {
+	lon = toDegrees(x / semiMajorAxis)
+	lat = toDegrees(math.Atan(math.Sinh(y / semiMajorAxis)))
+
+	return lon, lat, nil
+}
+
+// utmToWGS84 inverts the transverse Mercator projection of the given UTM zone, following Snyder's series.
+func utmToWGS84(zone int, south bool, easting, northing float64) (lon, lat float64, err error) {
+	e2 := flattening * (2 - flattening)
+	ep2 := e2 / (1 - e2)
+
+	x := easting - utmFalseEasting
+	y := northing
+
+	if south {
+		y -= utmFalseNorthing
+	}
+
+	m := y / utmScaleFactor
+	mu := m / (semiMajorAxis * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+
+	phi1 := mu +
+		(3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+
+	sinPhi1, cosPhi1, tanPhi1 := math.Sin(phi1), math.Cos(phi1), math.Tan(phi1)
+	c1 := ep2 * cosPhi1 * cosPhi1
+	t1 := tanPhi1 * tanPhi1
+	n1 := semiMajorAxis / math.Sqrt(1-e2*sinPhi1*sinPhi1)
+	r1 := semiMajorAxis * (1 - e2) / math.Pow(1-e2*sinPhi1*sinPhi1, 1.5)
+	d := x / (n1 * utmScaleFactor)
+
+	latRad := phi1 - (n1*tanPhi1/r1)*
+		(d*d/2-
+			(5+3*t1+10*c1-4*c1*c1-9*ep2)*math.Pow(d, 4)/24+
+			(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*math.Pow(d, 6)/720)
+	lonRad := (d -
+		(1+2*t1+c1)*math.Pow(d, 3)/6 +
+		(5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*math.Pow(d, 5)/120) / cosPhi1
+
+	centralMeridian := float64(zone*6 - 183)
+
+	return centralMeridian + toDegrees(lonRad), toDegrees(latRad), nil
+}
+
+// lambertConformalConic holds the parameters of a Lambert conformal conic projection with two standard parallels,
+// in degrees and meters.
+type lambertConformalConic struct {
+	lat0, lat1, lat2, lon0 float64
+	falseEasting           float64
+	falseNorthing          float64
+}
+
+var lambert93 = lambertConformalConic{ //nolint: gochecknoglobals
+	lat0: 46.5, lat1: 49, lat2: 44, lon0: 3,
+	falseEasting: 700000, falseNorthing: 6600000,
+}
+
+// conicConformalZone returns the projection of the French conic conformal zone centered on the given latitude.
+func conicConformalZone(lat0 int) lambertConformalConic {
+	return lambertConformalConic{
+		lat0: float64(lat0), lat1: float64(lat0) - 0.75, lat2: float64(lat0) + 0.75, lon0: 3,
+		falseEasting: 1700000, falseNorthing: float64(lat0-41)*1000000 + 200000,
+	}
+}
+
+// toWGS84 inverts the projection, following Snyder's formulas.
+func (p lambertConformalConic) toWGS84(x, y float64) (lon, lat float64, err error) {
+	e := math.Sqrt(flattening * (2 - flattening))
+
+	m := func(phi float64) float64 {
+		return math.Cos(phi) / math.Sqrt(1-e*e*math.Sin(phi)*math.Sin(phi))
+	}
+	t := func(phi float64) float64 {
+		return math.Tan(math.Pi/4-phi/2) / math.Pow((1-e*math.Sin(phi))/(1+e*math.Sin(phi)), e/2)
+	}
+
+	phi0, phi1, phi2 := toRadians(p.lat0), toRadians(p.lat1), toRadians(p.lat2)
+	n := (math.Log(m(phi1)) - math.Log(m(phi2))) / (math.Log(t(phi1)) - math.Log(t(phi2)))
+	f := m(phi1) / (n * math.Pow(t(phi1), n))
+	rho0 := semiMajorAxis * f * math.Pow(t(phi0), n)
+
+	dx, dy := x-p.falseEasting, rho0-(y-p.falseNorthing)
+
+	rho := math.Copysign(math.Hypot(dx, dy), n)
+	theta := math.Atan2(math.Copysign(1, n)*dx, math.Copysign(1, n)*dy)
+	tp := math.Pow(rho/(semiMajorAxis*f), 1/n)
+
+	// The latitude is the fixed point of the isometric latitude equation, which converges in a few iterations.
+	phi := math.Pi/2 - 2*math.Atan(tp)
+
+	for range 10 {
+		phi = math.Pi/2 - 2*math.Atan(tp*math.Pow((1-e*math.Sin(phi))/(1+e*math.Sin(phi)), e/2))
+	}
+
+	return p.lon0 + toDegrees(theta/n), toDegrees(phi), nil
+}
+
+func toDegrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,108 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestToWGS84(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		epsg        int
+		x, y        float64
+		expectedLon float64
+		expectedLat float64
+		expectedErr error
+	}{
+		{name: "WGS 84", epsg: EPSGWGS84, x: 2.5, y: 48.5, expectedLon: 2.5, expectedLat: 48.5},
+		{name: "Web Mercator origin", epsg: EPSGWebMercator, expectedLon: 0, expectedLat: 0},
+		{name: "Web Mercator antimeridian", epsg: EPSGWebMercator, x: 20037508.342789244, y: 0, expectedLon: 180, expectedLat: 0},
+		{name: "Web Mercator Paris", epsg: EPSGWebMercator, x: 261845.7, y: 6250564.3, expectedLon: 2.3522, expectedLat: 48.8566},
+		{name: "UTM central meridian", epsg: 32631, x: 500000, y: 0, expectedLon: 3, expectedLat: 0},
+		{name: "UTM north", epsg: 32631, x: 448251.9, y: 5411932.8, expectedLon: 2.2945, expectedLat: 48.8582},
+		{name: "UTM south equator", epsg: 32756, x: 500000, y: 10000000, expectedLon: 153, expectedLat: 0},
+		{name: "UTM south", epsg: 32756, x: 448251.9, y: 4588067.2, expectedLon: 152.2945, expectedLat: -48.8582},
+		{name: "ETRS89 UTM", epsg: 25831, x: 448251.9, y: 5411932.8, expectedLon: 2.2945, expectedLat: 48.8582},
+		{name: "Lambert 93 origin", epsg: EPSGLambert93, x: 700000, y: 6600000, expectedLon: 3, expectedLat: 46.5},
+		{name: "Lambert 93 Paris", epsg: EPSGLambert93, x: 652216.626, y: 6861681.5, expectedLon: 2.3488, expectedLat: 48.8534},
+		{name: "Lambert 93 Strasbourg", epsg: EPSGLambert93, x: 1050163.944, y: 6841622.715, expectedLon: 7.75, expectedLat: 48.58},
+		{name: "conic conformal zone origin", epsg: 3946, x: 1700000, y: 5200000, expectedLon: 3, expectedLat: 46},
+		{name: "unsupported", epsg: 27700, expectedErr: ErrUnsupportedCRS},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			lon, lat, err := ToWGS84(tc.epsg, tc.x, tc.y)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error: want %v, got %v", tc.expectedErr, err)
+			}
+
+			if math.Abs(lon-tc.expectedLon) > 1e-4 || math.Abs(lat-tc.expectedLat) > 1e-4 {
+				t.Fatalf("unexpected coordinates: want (%f, %f), got (%f, %f)", tc.expectedLon, tc.expectedLat, lon, lat)
+			}
+		})
+	}
+}
+
+func TestParseCRS(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		expectedEPSG int
+		expectedErr  error
+	}{
+		"":                            {expectedEPSG: EPSGWGS84},
+		"CRS84":                       {expectedEPSG: EPSGWGS84},
+		"EPSG:32631":                  {expectedEPSG: 32631},
+		"epsg:2154":                   {expectedEPSG: EPSGLambert93},
+		" 3857 ":                      {expectedEPSG: EPSGWebMercator},
+		"urn:ogc:def:crs:EPSG::32756": {expectedEPSG: 32756},
+		"http://www.opengis.net/def/crs/EPSG/0/4326": {expectedEPSG: EPSGWGS84},
+		"EPSG:":      {expectedErr: ErrUnsupportedCRS},
+		"Lambert 93": {expectedErr: ErrUnsupportedCRS},
+	}
+
+	for crs, tc := range cases {
+		epsg, err := ParseCRS(crs)
+		if !errors.Is(err, tc.expectedErr) {
+			t.Fatalf("%q: unexpected error: want %v, got %v", crs, tc.expectedErr, err)
+		}
+
+		if epsg != tc.expectedEPSG {
+			t.Errorf("%q: want EPSG:%d, got EPSG:%d", crs, tc.expectedEPSG, epsg)
+		}
+	}
+}
+
+func TestNormalizeAntimeridian(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		lons     []float64
+		expected []float64
+	}{
+		{name: "regular", lons: []float64{10, 11, 11, 10}, expected: []float64{10, 11, 11, 10}},
+		{name: "out of range", lons: []float64{190, 191, -170, -520}, expected: []float64{-170, -169, -170, -160}},
+		{name: "crossing", lons: []float64{179, -179, -179, 179}, expected: []float64{179, 181, 181, 179}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			NormalizeAntimeridian(tc.lons)
+
+			if diff := cmp.Diff(tc.expected, tc.lons); diff != "" {
+				t.Errorf("unexpected longitudes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package geo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// TIFF tags holding the size and the georeferencing of the image.
+const (
+	tagImageWidth          = 256
+	tagImageLength         = 257
+	tagModelPixelScale     = 33550
+	tagModelTiepoint       = 33922
+	tagModelTransformation = 34264
+	tagGeoKeyDirectory     = 34735
+)
+
+// GeoKeys describing the reference system of the image.
+const (
+	keyModelType       = 1024
+	keyRasterType      = 1025
+	keyGeographicType  = 2048
+	keyProjectedCSType = 3072
+)
+
+const (
+	modelTypeProjected  = 1
+	modelTypeGeographic = 2
+	rasterPixelIsPoint  = 2
+	userDefined         = 32767
+)
+
+// TIFF field types.
+const (
+	typeShort  = 3
+	typeLong   = 4
+	typeDouble = 12
+)
+
+var (
+	ErrNotGeoreferenced = errors.New("the image is not georeferenced")
+	errInvalidTIFF      = errors.New("invalid TIFF file")
+)
+
+// GeoTIFF is the georeferencing of a GeoTIFF image.
+type GeoTIFF struct {
+	Width, Height int
+	// PixelScale, Tiepoint and Transformation are the values of the ModelPixelScale,
+	// ModelTiepoint and ModelTransformation tags, empty when absent.
+	PixelScale     []float64
+	Tiepoint       []float64
+	Transformation []float64
+	// GeoKeys maps the numeric GeoKeys to their value.
+	GeoKeys map[int]int
+}
+
+// ReadGeoTIFF reads the georeferencing tags of the first image of the TIFF file at the given path.
+func ReadGeoTIFF(filePath string) (GeoTIFF, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return GeoTIFF{}, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	defer f.Close()
+
+	return readGeoTIFF(f)
+}
+
+func readGeoTIFF(r io.ReaderAt) (GeoTIFF, error) {
+	header := make([]byte, 8)
+
+	_, err := r.ReadAt(header, 0)
+	if err != nil {
+		return GeoTIFF{}, fmt.Errorf("%w: %w", errInvalidTIFF, err)
+	}
+
+	var order binary.ByteOrder
+
+	switch string(header[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return GeoTIFF{}, fmt.Errorf("%w: unknown header %q", errInvalidTIFF, header[:4])
+	}
+
+	ifdOffset := int64(order.Uint32(header[4:]))
+	countBytes := make([]byte, 2)
+
+	_, err = r.ReadAt(countBytes, ifdOffset)
+	if err != nil {
+		return GeoTIFF{}, fmt.Errorf("%w: %w", errInvalidTIFF, err)
+	}
+
+	entries := make([]byte, 12*int(order.Uint16(countBytes)))
+
+	_, err = r.ReadAt(entries, ifdOffset+2)
+	if err != nil {
+		return GeoTIFF{}, fmt.Errorf("%w: %w", errInvalidTIFF, err)
+	}
+
+	geoTIFF := GeoTIFF{GeoKeys: make(map[int]int)}
+
+	var geoKeyDirectory []float64
+
+	for entry := range len(entries) / 12 {
+		field := entries[entry*12 : (entry+1)*12]
+		tag := order.Uint16(field)
+
+		var target *[]float64
+
+		switch tag {
+		case tagImageWidth, tagImageLength:
+			var values []float64
+
+			values, err = readField(r, order, field)
+			if err != nil || len(values) == 0 {
+				return GeoTIFF{}, fmt.Errorf("%w: can't read the image size: %w", errInvalidTIFF, err)
+			}
+
+			if tag == tagImageWidth {
+				geoTIFF.Width = int(values[0])
+			} else {
+				geoTIFF.Height = int(values[0])
+			}
+
+			continue
+		case tagModelPixelScale:
+			target = &geoTIFF.PixelScale
+		case tagModelTiepoint:
+			target = &geoTIFF.Tiepoint
+		case tagModelTransformation:
+			target = &geoTIFF.Transformation
+		case tagGeoKeyDirectory:
+			target = &geoKeyDirectory
+		default:
+			continue
+		}
+
+		*target, err = readField(r, order, field)
+		if err != nil {
+			return GeoTIFF{}, fmt.Errorf("%w: tag %d: %w", errInvalidTIFF, tag, err)
+		}
+	}
+
+	// The directory starts with a header of 4 values, the last one being the number of keys,
+	// followed by the keys as (ID, location, count, value). Only the keys holding a short value are kept.
+	if len(geoKeyDirectory) >= 4 {
+		for i := 4; i+3 < len(geoKeyDirectory) && (i-4)/4 < int(geoKeyDirectory[3]); i += 4 {
+			if geoKeyDirectory[i+1] == 0 {
+				geoTIFF.GeoKeys[int(geoKeyDirectory[i])] = int(geoKeyDirectory[i+3])
+			}
+		}
+	}
+
+	return geoTIFF, nil
+}
+
+// readField returns the numeric values of the given IFD entry.
+func readField(r io.ReaderAt, order binary.ByteOrder, field []byte) ([]float64, error) {
+	fieldType := order.Uint16(field[2:])
+	count := int(order.Uint32(field[4:]))
+
+	var size int
+
+	switch fieldType {
+	case typeShort:
+		size = 2
+	case typeLong:
+		size = 4
+	case typeDouble:
+		size = 8
+	default:
+		return nil, fmt.Errorf("unsupported field type %d", fieldType)
+	}
+
+	const maxValues = 1 << 16
+
+	if count > maxValues {
+		return nil, fmt.Errorf("too many values: %d", count)
+	}
+
+	data := field[8:12]
+
+	if count*size > 4 {
+		data = make([]byte, count*size)
+
+		_, err := r.ReadAt(data, int64(order.Uint32(field[8:])))
+		if err != nil {
+			return nil, err //nolint: wrapcheck // wrapped by caller
+		}
+	}
+
+	values := make([]float64, count)
+
+	for i := range values {
+		switch fieldType {
+		case typeShort:
+			values[i] = float64(order.Uint16(data[i*2:]))
+		case typeLong:
+			values[i] = float64(order.Uint32(data[i*4:]))
+		case typeDouble:
+			values[i] = math.Float64frombits(order.Uint64(data[i*8:]))
+		}
+	}
+
+	return values, nil
+}
+
+// EPSG returns the EPSG code of the reference system of the image.
+func (g GeoTIFF) EPSG() (int, error) {
+	switch g.GeoKeys[keyModelType] {
+	case modelTypeGeographic:
+		code, found := g.GeoKeys[keyGeographicType]
+		if !found {
+			return EPSGWGS84, nil
+		}
+
+		if code == userDefined {
+			return 0, fmt.Errorf("%w: user-defined geographic system", ErrUnsupportedCRS)
+		}
+
+		return code, nil
+	case modelTypeProjected:
+		code, found := g.GeoKeys[keyProjectedCSType]
+		if !found || code == userDefined {
+			return 0, fmt.Errorf("%w: user-defined projected system", ErrUnsupportedCRS)
+		}
+
+		return code, nil
+	default:
+		return 0, fmt.Errorf("%w: model type %d", ErrUnsupportedCRS, g.GeoKeys[keyModelType])
+	}
+}
+
+// ModelCoordinates returns the coordinates, in the reference system of the image, of the given raster position.
+// The raster position (0, 0) is the upper left corner of the image.
+func (g GeoTIFF) ModelCoordinates(i, j float64) (x, y float64, err error) {
+	// Point rasters map the positions to the center of the pixels instead of their upper left corner.
+	if g.GeoKeys[keyRasterType] == rasterPixelIsPoint {
+		i, j = i-0.5, j-0.5
+	}
+
+	switch {
+	case len(g.Transformation) >= 8:
+		t := g.Transformation
+
+		return t[0]*i + t[1]*j + t[3], t[4]*i + t[5]*j + t[7], nil
+	case len(g.Tiepoint) >= 6 && len(g.PixelScale) >= 2:
+		tp, scale := g.Tiepoint, g.PixelScale
+
+		return tp[3] + (i-tp[0])*scale[0], tp[4] - (j-tp[1])*scale[1], nil
+	default:
+		return 0, 0, ErrNotGeoreferenced
+	}
+}
+
+// Corners returns the WGS 84 [lon, lat] coordinates of the upper left, upper right, lower right and lower left corners of the image.
+func (g GeoTIFF) Corners() ([4][2]float64, error) {
+	epsg, err := g.EPSG()
+	if err != nil {
+		return [4][2]float64{}, err
+	}
+
+	w, h := float64(g.Width), float64(g.Height)
+
+	var corners [4][2]float64
+
+	for c, position := range [4][2]float64{{0, 0}, {w, 0}, {w, h}, {0, h}} {
+		x, y, err := g.ModelCoordinates(position[0], position[1])
+		if err != nil {
+			return [4][2]float64{}, err
+		}
+
+		corners[c][0], corners[c][1], err = ToWGS84(epsg, x, y)
+		if err != nil {
+			return [4][2]float64{}, err
+		}
+	}
+
+	return corners, nil
+}
@@ -0,0 +1,194 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+type tiffEntry struct {
+	tag, fieldType uint16
+	values         []float64
+}
+
+// encodeTIFF returns a TIFF file, without image data, holding a single IFD with the given entries.
+func encodeTIFF(t *testing.T, order binary.ByteOrder, entries []tiffEntry) []byte {
+	t.Helper()
+
+	sizes := map[uint16]int{typeShort: 2, typeLong: 4, typeDouble: 8}
+	dataOffset := 8 + 2 + 12*len(entries) + 4
+
+	var ifd, data bytes.Buffer
+
+	write := func(buf *bytes.Buffer, value any) {
+		if err := binary.Write(buf, order, value); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	write(&ifd, uint16(len(entries))) //nolint: gosec // small test data
+
+	for _, entry := range entries {
+		var field bytes.Buffer
+
+		for _, value := range entry.values {
+			switch entry.fieldType {
+			case typeShort:
+				write(&field, uint16(value))
+			case typeLong:
+				write(&field, uint32(value))
+			case typeDouble:
+				write(&field, math.Float64bits(value))
+			}
+		}
+
+		write(&ifd, entry.tag)
+		write(&ifd, entry.fieldType)
+		write(&ifd, uint32(len(entry.values))) //nolint: gosec // small test data
+
+		if len(entry.values)*sizes[entry.fieldType] > 4 {
+			write(&ifd, uint32(dataOffset+data.Len())) //nolint: gosec // small test data
+			data.Write(field.Bytes())
+		} else {
+			ifd.Write(append(field.Bytes(), make([]byte, 4-field.Len())...))
+		}
+	}
+
+	write(&ifd, uint32(0))
+
+	var file bytes.Buffer
+
+	if order == binary.LittleEndian {
+		file.WriteString("II*\x00")
+	} else {
+		file.WriteString("MM\x00*")
+	}
+
+	write(&file, uint32(8))
+	file.Write(ifd.Bytes())
+	file.Write(data.Bytes())
+
+	return file.Bytes()
+}
+
+func geoKeys(keys ...float64) tiffEntry {
+	directory := []float64{1, 1, 0, float64(len(keys) / 2)}
+
+	for i := 0; i+1 < len(keys); i += 2 {
+		directory = append(directory, keys[i], 0, 1, keys[i+1])
+	}
+
+	return tiffEntry{tagGeoKeyDirectory, typeShort, directory}
+}
+
+func TestGeoTIFFCorners(t *testing.T) {
+	t.Parallel()
+
+	size := []tiffEntry{{tagImageWidth, typeShort, []float64{4}}, {tagImageLength, typeLong, []float64{2}}}
+
+	cases := []struct {
+		name            string
+		order           binary.ByteOrder
+		entries         []tiffEntry
+		expectedCorners [4][2]float64
+		expectedErr     error
+	}{
+		{
+			name:  "geographic tiepoint and scale",
+			order: binary.LittleEndian,
+			entries: append(size,
+				tiffEntry{tagModelPixelScale, typeDouble, []float64{0.5, 0.25, 0}},
+				tiffEntry{tagModelTiepoint, typeDouble, []float64{0, 0, 0, 10, 20, 0}},
+				geoKeys(keyModelType, modelTypeGeographic, keyGeographicType, EPSGWGS84),
+			),
+			expectedCorners: [4][2]float64{{10, 20}, {12, 20}, {12, 19.5}, {10, 19.5}},
+		},
+		{
+			name:  "pixel is point",
+			order: binary.BigEndian,
+			entries: append(size,
+				tiffEntry{tagModelPixelScale, typeDouble, []float64{1, 1, 0}},
+				tiffEntry{tagModelTiepoint, typeDouble, []float64{0, 0, 0, 10, 20, 0}},
+				geoKeys(keyModelType, modelTypeGeographic, keyRasterType, rasterPixelIsPoint),
+			),
+			expectedCorners: [4][2]float64{{9.5, 20.5}, {13.5, 20.5}, {13.5, 18.5}, {9.5, 18.5}},
+		},
+		{
+			name:  "transformation matrix",
+			order: binary.LittleEndian,
+			entries: append(size,
+				tiffEntry{tagModelTransformation, typeDouble, []float64{1, 0, 0, 10, 0, -1, 0, 20, 0, 0, 0, 0, 0, 0, 0, 1}},
+				geoKeys(keyModelType, modelTypeGeographic),
+			),
+			expectedCorners: [4][2]float64{{10, 20}, {14, 20}, {14, 18}, {10, 18}},
+		},
+		{
+			name:  "projected",
+			order: binary.LittleEndian,
+			entries: append(size,
+				tiffEntry{tagModelPixelScale, typeDouble, []float64{10, 10, 0}},
+				tiffEntry{tagModelTiepoint, typeDouble, []float64{2, 1, 0, 500020, 10, 0}},
+				geoKeys(keyModelType, modelTypeProjected, keyProjectedCSType, 32631),
+			),
+			expectedCorners: [4][2]float64{{3, 0.0002}, {3.0004, 0.0002}, {3.0004, 0.0000}, {3, 0.0000}},
+		},
+		{
+			name:        "not georeferenced",
+			order:       binary.LittleEndian,
+			entries:     append(size, geoKeys(keyModelType, modelTypeGeographic)),
+			expectedErr: ErrNotGeoreferenced,
+		},
+		{
+			name:  "user-defined system",
+			order: binary.LittleEndian,
+			entries: append(size,
+				tiffEntry{tagModelPixelScale, typeDouble, []float64{1, 1, 0}},
+				tiffEntry{tagModelTiepoint, typeDouble, []float64{0, 0, 0, 10, 20, 0}},
+				geoKeys(keyModelType, modelTypeProjected, keyProjectedCSType, userDefined),
+			),
+			expectedErr: ErrUnsupportedCRS,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			geoTIFF, err := readGeoTIFF(bytes.NewReader(encodeTIFF(t, tc.order, tc.entries)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			corners, err := geoTIFF.Corners()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error: want %v, got %v", tc.expectedErr, err)
+			}
+
+			for c := range corners {
+				if math.Abs(corners[c][0]-tc.expectedCorners[c][0]) > 1e-4 || math.Abs(corners[c][1]-tc.expectedCorners[c][1]) > 1e-4 {
+					t.Fatalf("unexpected corners: want %v, got %v", tc.expectedCorners, corners)
+				}
+			}
+		})
+	}
+}
+
+func TestReadGeoTIFFInvalid(t *testing.T) {
+	t.Parallel()
+
+	for name, content := range map[string][]byte{
+		"empty":      {},
+		"not a tiff": []byte("\x89PNG\r\n\x1a\n"),
+		"truncated":  []byte("II*\x00\x08\x00\x00\x00\x05\x00"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := readGeoTIFF(bytes.NewReader(content)); !errors.Is(err, errInvalidTIFF) {
+				t.Fatalf("expected an invalid TIFF error, got %v", err)
+			}
+		})
+	}
+}
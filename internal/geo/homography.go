@@ -0,0 +1,89 @@
+package geo
+
+import (
+	"errors"
+	"math"
+)
+
+// degenerateEpsilon is the pivot under which the corners are considered aligned.
+const degenerateEpsilon = 1e-12
+
+var ErrDegenerateQuad = errors.New("three of the corners are aligned")
+
+// Homography is a projective transform of the plane, as the row-major 3x3 matrix mapping [x, y, 1].
+// It maps any quadrilateral to any other, an affine transform being the case of the parallelograms.
+type Homography [9]float64
+
+// NewHomography returns the projective transform mapping each of the four given source points to the matching
+// destination point, e.g. the geographic corners of an image to its pixel corners.
+func NewHomography(src, dst [4][2]float64) (Homography, error) {
+	// Each pair of points gives two equations on the 8 unknown coefficients, the last one being 1:
+	// u = (h0 x + h1 y + h2) / (h6 x + h7 y + 1) and v = (h3 x + h4 y + h5) / (h6 x + h7 y + 1).
+	var system [8][9]float64
+
+	for i := range 4 {
+		x, y, u, v := src[i][0], src[i][1], dst[i][0], dst[i][1]
+		system[2*i] = [9]float64{x, y, 1, 0, 0, 0, -u * x, -u * y, u}
+		system[2*i+1] = [9]float64{0, 0, 0, x, y, 1, -v * x, -v * y, v}
+	}
+
+	coefficients, err := solve(system)
+	if err != nil {
+		return Homography{}, err
+	}
+
+	var h Homography
+
+	copy(h[:8], coefficients[:])
+	h[8] = 1
+
+	return h, nil
+}
+
+// Apply returns the image of the given point.
+func (h Homography) Apply(x, y float64) (u, v float64) {
+	w := h[6]*x + h[7]*y + h[8]
+
+	return (h[0]*x + h[1]*y + h[2]) / w, (h[3]*x + h[4]*y + h[5]) / w
+}
+
+// solve solves the given augmented linear system by Gaussian elimination with partial pivoting.
+func solve(system [8][9]float64) ([8]float64, error) {
+	const n = 8
+
+	for col := range n {
+		pivot := col
+
+		for row := col + 1; row < n; row++ {
+			if math.Abs(system[row][col]) > math.Abs(system[pivot][col]) {
+				pivot = row
+			}
+		}
+
+		if math.Abs(system[pivot][col]) < degenerateEpsilon {
+			return [8]float64{}, ErrDegenerateQuad
+		}
+
+		system[col], system[pivot] = system[pivot], system[col]
+
+		for row := col + 1; row < n; row++ {
+			factor := system[row][col] / system[col][col]
+			for k := col; k <= n; k++ {
+				system[row][k] -= factor * system[col][k]
+			}
+		}
+	}
+
+	var solution [8]float64
+
+	for row := n - 1; row >= 0; row-- {
+		sum := system[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= system[row][k] * solution[k]
+		}
+
+		solution[row] = sum / system[row][row]
+	}
+
+	return solution, nil
+}
@@ -0,0 +1,67 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestHomography(t *testing.T) {
+	t.Parallel()
+
+	pixels := [4][2]float64{{0, 0}, {1000, 0}, {1000, 500}, {0, 500}}
+
+	cases := []struct {
+		name        string
+		corners     [4][2]float64 // UL, UR, LR, LL
+		points      [][4]float64  // x, y, expected u, expected v
+		expectedErr error
+	}{
+		{
+			name:    "north-up rectangle",
+			corners: [4][2]float64{{2, 49}, {3, 49}, {3, 48}, {2, 48}},
+			points:  [][4]float64{{2.5, 48.5, 500, 250}, {2.1, 48.9, 100, 50}, {3.5, 47, 1500, 1000}},
+		},
+		{
+			name:    "rotated parallelogram",
+			corners: [4][2]float64{{0, 1}, {1, 2}, {2, 1}, {1, 0}},
+			points:  [][4]float64{{1, 1, 500, 250}, {0.5, 0.5, 0, 250}},
+		},
+		{
+			name:    "trapezoid",
+			corners: [4][2]float64{{-1, 1}, {1, 1}, {2, 0}, {-2, 0}},
+			points:  [][4]float64{{0, 1, 500, 0}, {0, 0, 500, 500}, {-1.5, 0.5, 0, 2000.0 / 6}},
+		},
+		{
+			name:        "aligned corners",
+			corners:     [4][2]float64{{0, 0}, {1, 1}, {2, 2}, {0, 1}},
+			expectedErr: ErrDegenerateQuad,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := NewHomography(tc.corners, pixels)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			for i, corner := range tc.corners {
+				tc.points = append(tc.points, [4]float64{corner[0], corner[1], pixels[i][0], pixels[i][1]})
+			}
+
+			for _, p := range tc.points {
+				u, v := h.Apply(p[0], p[1])
+				if math.Abs(u-p[2]) > 1e-6 || math.Abs(v-p[3]) > 1e-6 {
+					t.Errorf("Apply(%v, %v): want %v, %v, got %v, %v", p[0], p[1], p[2], p[3], u, v)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package observability
 
 import (
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -18,6 +19,10 @@ type Metrics struct {
 	CacheFilesPerBucket     *prometheus.GaugeVec
 	CacheSizePerBucket      *prometheus.GaugeVec
 	S3SignedURLRegenCounter prometheus.Counter
+	ExprErrorsCounter       *prometheus.CounterVec
+	ExprDuration            *prometheus.HistogramVec
+	ExprCacheCounter        *prometheus.CounterVec
+	ExprAbandoned           prometheus.GaugeFunc
 }
 
 func New(cfg config.Monitoring) *Metrics {
@@ -68,5 +73,26 @@ func New(cfg config.Monitoring) *Metrics {
 			Help:        "The total number of S3 signed URL regenerations",
 			ConstLabels: constLabels,
 		}),
+		ExprErrorsCounter: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name:        "expression_errors_total",
+			Help:        "The total number of failed expression evaluations, by the limit they exceeded",
+			ConstLabels: constLabels,
+		}, []string{"group", "type", "expression", "reason"}),
+		ExprDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "expression_duration_seconds",
+			Help:        "The duration of the expression evaluations which didn't hit the cache",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBucketsRange(cfg.ExprDurationBuckets.Min.Seconds(), cfg.ExprDurationBuckets.Max.Seconds(), cfg.ExprDurationBuckets.Count),
+		}, []string{"group", "type", "expression"}),
+		ExprCacheCounter: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name:        "expression_cache_total",
+			Help:        "The total number of expression cache lookups, by result (hit or miss)",
+			ConstLabels: constLabels,
+		}, []string{"group", "type", "expression", "result"}),
+		ExprAbandoned: promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "expression_abandoned_evaluations",
+			Help:        "The number of expression evaluations which timed out but are still running",
+			ConstLabels: constLabels,
+		}, func() float64 { return float64(types.AbandonedExprs()) }),
 	}
 }
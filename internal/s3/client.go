@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
@@ -40,10 +41,12 @@ type Client interface {
 	PollOnce(ctx context.Context, bucket string, s3Chan chan Event, timeout time.Duration) error
 	DownloadObject(ctx context.Context, bucket, objectKey, destPath string) error
 	GenerateSignedURL(ctx context.Context, bucket, objectKey string) (*url.URL, error)
+	UpdateProductsConfig(productsCfg config.Products)
 }
 
 type s3Client struct {
 	productsCfg             config.Products
+	infoLock                *sync.RWMutex
 	specificInfoPerBucket   map[string]bucketSpecificInfo
 	commonPrefixesPerBucket map[string]string
 	gatherer                *observability.Metrics
@@ -88,11 +91,24 @@ func NewClient(cfg config.Config, gatherer *observability.Metrics) (Client, erro
 		return nil, fmt.Errorf("failed to initialize s3 client: %w", err)
 	}
 
-	prefixesPerBucket := make(map[string][]string, len(cfg.Products.ImageGroups))
+	specificInfoPerBucket, commonPrefixPerBucket := computeBucketsInfo(cfg.Products)
 
-	for _, imgGroup := range cfg.Products.ImageGroups {
+	return s3Client{
+		productsCfg:             cfg.Products,
+		infoLock:                new(sync.RWMutex),
+		specificInfoPerBucket:   specificInfoPerBucket,
+		commonPrefixesPerBucket: commonPrefixPerBucket,
+		gatherer:                gatherer,
+		client:                  client,
+	}, nil
+}
+
+func computeBucketsInfo(productsCfg config.Products) (map[string]bucketSpecificInfo, map[string]string) {
+	prefixesPerBucket := make(map[string][]string, len(productsCfg.ImageGroups))
+
+	for _, imgGroup := range productsCfg.ImageGroups {
 		for _, imgType := range imgGroup.Types {
-			prefixesPerBucket[imgGroup.Bucket] = append(prefixesPerBucket[imgGroup.Bucket], imgType.ProductPrefix)
+			prefixesPerBucket[imgGroup.Bucket] = append(prefixesPerBucket[imgGroup.Bucket], imgType.ListingPrefix())
 		}
 	}
 
@@ -107,13 +123,33 @@ func NewClient(cfg config.Config, gatherer *observability.Metrics) (Client, erro
 		commonPrefixPerBucket[bucket] = commonPrefix
 	}
 
-	return s3Client{
-		productsCfg:             cfg.Products,
-		specificInfoPerBucket:   specificInfoPerBucket,
-		commonPrefixesPerBucket: commonPrefixPerBucket,
-		gatherer:                gatherer,
-		client:                  client,
-	}, nil
+	return specificInfoPerBucket, commonPrefixPerBucket
+}
+
+// UpdateProductsConfig recomputes the listing prefixes of the buckets from the given products configuration.
+// Existing bucket subscriptions keep the prefix they were created with.
+func (s3 s3Client) UpdateProductsConfig(productsCfg config.Products) {
+	specificInfoPerBucket, commonPrefixPerBucket := computeBucketsInfo(productsCfg)
+
+	s3.infoLock.Lock()
+	defer s3.infoLock.Unlock()
+
+	clear(s3.specificInfoPerBucket)
+	clear(s3.commonPrefixesPerBucket)
+
+	for bucket, info := range specificInfoPerBucket {
+		s3.specificInfoPerBucket[bucket] = info
+		s3.commonPrefixesPerBucket[bucket] = commonPrefixPerBucket[bucket]
+	}
+}
+
+func (s3 s3Client) bucketInfo(bucket string) (bucketSpecificInfo, bool) {
+	s3.infoLock.RLock()
+	defer s3.infoLock.RUnlock()
+
+	info, found := s3.specificInfoPerBucket[bucket]
+
+	return info, found
 }
 
 func (s3 s3Client) BucketExists(ctx context.Context, bucket string) (bool, error) {
@@ -129,10 +165,13 @@ func (s3 s3Client) BucketExists(ctx context.Context, bucket string) (bool, error
 }
 
 func (s3 s3Client) SubscribeToBucket(ctx context.Context, bucket string, s3Chan chan Event) error {
+	info, _ := s3.bucketInfo(bucket)
+	commonPrefix := info.commonPrefix
+
 	notifs := s3.client.ListenBucketNotification(
 		ctx,
 		bucket,
-		s3.specificInfoPerBucket[bucket].commonPrefix, "",
+		commonPrefix, "",
 		[]string{"s3:ObjectCreated:*", "s3:ObjectRemoved:*"},
 	)
 
@@ -183,7 +222,8 @@ func (s3 s3Client) PollOnce(ctx context.Context, bucket string, s3Chan chan Even
 		}
 	}()
 
-	commonPrefix := s3.specificInfoPerBucket[bucket].commonPrefix
+	info, _ := s3.bucketInfo(bucket)
+	commonPrefix := info.commonPrefix
 	currentTime := time.Now()
 
 	objects := s3.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: commonPrefix, Recursive: true})
@@ -204,7 +244,11 @@ func (s3 s3Client) PollOnce(ctx context.Context, bucket string, s3Chan chan Even
 			ObjectLastModified: object.LastModified,
 		}
 
-		s3Chan <- event
+		select {
+		case s3Chan <- event:
+		case <-ctx.Done():
+			return ctx.Err() //nolint:wrapcheck
+		}
 	}
 
 	return nil
@@ -252,7 +296,7 @@ func (s3 s3Client) handleEvent(bucket string, notif notification.Info, eventChan
 // It may be whether the defaultPreviewFilename or the image type's specific previewFilename,
 // since a more granular filter will be done later.
 func (s3 s3Client) matchesPreviewFilename(bucket, objectKey string) bool {
-	specificInfo, bucketExists := s3.specificInfoPerBucket[bucket]
+	specificInfo, bucketExists := s3.bucketInfo(bucket)
 	if !bucketExists {
 		return false
 	}
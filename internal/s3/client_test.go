@@ -134,3 +134,55 @@ func TestNewClient(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateProductsConfig(t *testing.T) {
+	t.Parallel()
+
+	client, err := NewClient(config.Config{
+		S3: config.S3{
+			Endpoint: "localhost:9000",
+		},
+		Products: config.Products{
+			ImageGroups: []config.ImageGroup{
+				{
+					Bucket: "bucket-a",
+					Types: []config.ImageType{
+						{ProductPrefix: "products/a/"},
+					},
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	client.UpdateProductsConfig(config.Products{
+		ImageGroups: []config.ImageGroup{
+			{
+				Bucket: "bucket-b",
+				Types: []config.ImageType{
+					{ProductPrefix: "products/b/one/"},
+					{ProductPrefix: "products/b/two/"},
+				},
+			},
+		},
+	})
+
+	typedClient, ok := client.(s3Client)
+	if !ok {
+		t.Fatalf("NewClient() returned unexpected type %T", client)
+	}
+
+	expectedSpecificInfo := map[string]bucketSpecificInfo{
+		"bucket-b": {commonPrefix: "products/b/"},
+	}
+
+	if !reflect.DeepEqual(typedClient.specificInfoPerBucket, expectedSpecificInfo) {
+		t.Fatalf("specificInfoPerBucket mismatch: got %#v, want %#v", typedClient.specificInfoPerBucket, expectedSpecificInfo)
+	}
+
+	if _, found := typedClient.bucketInfo("bucket-a"); found {
+		t.Fatal("expected bucket-a to be forgotten")
+	}
+}
@@ -0,0 +1,308 @@
+package search
+
+import (
+	"cmp"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+)
+
+// MaxClusterZoom is the zoom level from which the footprints are returned individually.
+const MaxClusterZoom = 14
+
+// clusterCellsPerTile is the number of cluster cells along each side of a 256 pixels map tile,
+// making the cells 64 pixels wide.
+const clusterCellsPerTile = 4
+
+// maxMercatorLat is the latitude beyond which Web Mercator maps are cut.
+const maxMercatorLat = 85.05112878
+
+// Footprint is the footprint of an image, in WGS 84.
+type Footprint struct {
+	Group    string
+	Type     string
+	Geometry types.Geometry
+}
+
+// Cluster is a group of footprints close to each other, or a single footprint.
+type Cluster struct {
+	Lon, Lat float64
+	Count    int
+	// BBox bounds the footprints of the cluster, as [min lon, min lat, max lon, max lat].
+	BBox   [4]float64
+	Counts []types.ClusterCount
+	// Key and Footprint are only set for the clusters holding a single footprint.
+	Key       *Key
+	Footprint *Footprint
+}
+
+type indexedFootprint struct {
+	Footprint
+
+	bbox [4]float64
+	// lon and lat locate the center of the bounding box, lon being brought back to [-180, 180).
+	lon, lat float64
+}
+
+// FootprintIndex indexes the footprints by the 1° cell of their center, safe for concurrent use.
+type FootprintIndex struct {
+	l          sync.RWMutex
+	footprints map[Key]indexedFootprint
+	cells      map[cell]map[Key]bool
+}
+
+type cell struct {
+	lon, lat int
+}
+
+func NewFootprintIndex() *FootprintIndex {
+	return &FootprintIndex{
+		footprints: make(map[Key]indexedFootprint),
+		cells:      make(map[cell]map[Key]bool),
+	}
+}
+
+// Update replaces the footprint of the given image. Footprints without position are ignored.
+func (idx *FootprintIndex) Update(key Key, footprint Footprint) {
+	idx.l.Lock()
+	defer idx.l.Unlock()
+
+	idx.remove(key)
+	idx.add(key, footprint)
+}
+
+// Replace replaces all the footprints of the index with the given ones.
+func (idx *FootprintIndex) Replace(footprints map[Key]Footprint) {
+	replacement := NewFootprintIndex()
+
+	for key, footprint := range footprints {
+		replacement.add(key, footprint)
+	}
+
+	idx.l.Lock()
+	defer idx.l.Unlock()
+
+	idx.footprints, idx.cells = replacement.footprints, replacement.cells
+}
+
+// Remove removes the footprint of the given image.
+func (idx *FootprintIndex) Remove(key Key) {
+	idx.l.Lock()
+	defer idx.l.Unlock()
+
+	idx.remove(key)
+}
+
+// Len returns the number of indexed footprints.
+func (idx *FootprintIndex) Len() int {
+	idx.l.RLock()
+	defer idx.l.RUnlock()
+
+	return len(idx.footprints)
+}
+
+func (idx *FootprintIndex) add(key Key, footprint Footprint) {
+	bbox, ok := boundingBox(footprint.Geometry)
+	if !ok {
+		return
+	}
+
+	indexed := indexedFootprint{
+		Footprint: footprint,
+		bbox:      bbox,
+		lon:       wrapLon((bbox[0] + bbox[2]) / 2),
+		lat:       (bbox[1] + bbox[3]) / 2,
+	}
+
+	c := cellOf(indexed.lon, indexed.lat)
+	if idx.cells[c] == nil {
+		idx.cells[c] = make(map[Key]bool)
+	}
+
+	idx.cells[c][key] = true
+	idx.footprints[key] = indexed
+}
+
+func (idx *FootprintIndex) remove(key Key) {
+	indexed, found := idx.footprints[key]
+	if !found {
+		return
+	}
+
+	c := cellOf(indexed.lon, indexed.lat)
+
+	delete(idx.cells[c], key)
+
+	if len(idx.cells[c]) == 0 {
+		delete(idx.cells, c)
+	}
+
+	delete(idx.footprints, key)
+}
+
+// Clusters groups the footprints whose center is in the given bounding box, [min lon, min lat, max lon, max lat],
+// by cells of 64 pixels of a Web Mercator map at the given zoom level. A bounding box whose min lon is greater
+// than its max lon crosses the antimeridian. Only the footprints kept by the given function are considered.
+// From MaxClusterZoom, and for the cells holding a single footprint, the footprints are returned individually.
+// The clusters are ordered by decreasing count.
+func (idx *FootprintIndex) Clusters(bbox [4]float64, zoom int, keep func(Key, Footprint) bool) []Cluster {
+	groups := make(map[[2]int][]member)
+	cellsPerSide := float64(int(1)<<min(max(zoom, 0), MaxClusterZoom)) * clusterCellsPerTile
+
+	// The index isn't locked anymore when calling keep, which may lock the cache.
+	for _, m := range idx.within(bbox) {
+		if keep != nil && !keep(m.key, m.footprint.Footprint) {
+			continue
+		}
+
+		// From the cluster zoom, every footprint gets its own group.
+		group := [2]int{-1, len(groups)}
+		if zoom < MaxClusterZoom {
+			x, y := webMercator(m.footprint.lon, m.footprint.lat)
+			group = [2]int{int(x * cellsPerSide), int(y * cellsPerSide)}
+		}
+
+		groups[group] = append(groups[group], m)
+	}
+
+	clusters := make([]Cluster, 0, len(groups))
+
+	for _, members := range groups {
+		cluster := Cluster{
+			Count: len(members),
+			BBox:  [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)},
+		}
+		counts := make(map[[2]string]int)
+
+		for _, m := range members {
+			cluster.Lon += m.footprint.lon / float64(len(members))
+			cluster.Lat += m.footprint.lat / float64(len(members))
+			cluster.BBox = [4]float64{
+				min(cluster.BBox[0], m.footprint.bbox[0]), min(cluster.BBox[1], m.footprint.bbox[1]),
+				max(cluster.BBox[2], m.footprint.bbox[2]), max(cluster.BBox[3], m.footprint.bbox[3]),
+			}
+			counts[[2]string{m.footprint.Group, m.footprint.Type}]++
+		}
+
+		for _, groupType := range slices.SortedFunc(maps.Keys(counts), func(a, b [2]string) int {
+			return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]))
+		}) {
+			cluster.Counts = append(cluster.Counts, types.ClusterCount{Group: groupType[0], Type: groupType[1], Count: counts[groupType]})
+		}
+
+		if len(members) == 1 {
+			key, footprint := members[0].key, members[0].footprint.Footprint
+			cluster.Key, cluster.Footprint = &key, &footprint
+		}
+
+		clusters = append(clusters, cluster)
+	}
+
+	slices.SortFunc(clusters, func(a, b Cluster) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Lon, b.Lon), cmp.Compare(a.Lat, b.Lat))
+	})
+
+	return clusters
+}
+
+type member struct {
+	key       Key
+	footprint indexedFootprint
+}
+
+// within returns the footprints whose center is in the given bounding box.
+func (idx *FootprintIndex) within(bbox [4]float64) []member {
+	if slices.ContainsFunc(bbox[:], func(v float64) bool { return math.IsNaN(v) || math.IsInf(v, 0) }) {
+		return nil
+	}
+
+	// Clamped so that the number of cells to look up stays bounded whatever the box.
+	bbox[1], bbox[3] = max(bbox[1], -90), min(bbox[3], 90)
+	if bbox[1] > bbox[3] {
+		return nil
+	}
+
+	idx.l.RLock()
+	defer idx.l.RUnlock()
+
+	var members []member
+
+	for _, lonRange := range lonRanges(bbox[0], bbox[2]) {
+		minCell, maxCell := cellOf(lonRange[0], bbox[1]), cellOf(lonRange[1], bbox[3])
+
+		for lat := minCell.lat; lat <= maxCell.lat; lat++ {
+			for lon := minCell.lon; lon <= maxCell.lon; lon++ {
+				for key := range idx.cells[cell{lon: lon, lat: lat}] {
+					footprint := idx.footprints[key]
+					if footprint.lon >= lonRange[0] && footprint.lon <= lonRange[1] && footprint.lat >= bbox[1] && footprint.lat <= bbox[3] {
+						members = append(members, member{key: key, footprint: footprint})
+					}
+				}
+			}
+		}
+	}
+
+	return members
+}
+
+// boundingBox returns the bounding box of the given geometry, as [min lon, min lat, max lon, max lat].
+func boundingBox(geometry types.Geometry) ([4]float64, bool) {
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+
+	for _, polygon := range geometry.Polygons {
+		for _, ring := range polygon {
+			for _, position := range ring {
+				bbox = [4]float64{
+					min(bbox[0], position[0]), min(bbox[1], position[1]),
+					max(bbox[2], position[0]), max(bbox[3], position[1]),
+				}
+			}
+		}
+	}
+
+	return bbox, !math.IsInf(bbox[0], 1)
+}
+
+// lonRanges brings the given longitude range back to [-180, 180], splitting it in two if it crosses the antimeridian.
+func lonRanges(minLon, maxLon float64) [][2]float64 {
+	if maxLon-minLon >= 360 {
+		return [][2]float64{{-180, 180}}
+	}
+
+	if minLon, maxLon = wrapLon(minLon), wrapLon(maxLon); maxLon == -180 {
+		maxLon = 180
+	}
+
+	if minLon <= maxLon {
+		return [][2]float64{{minLon, maxLon}}
+	}
+
+	return [][2]float64{{minLon, 180}, {-180, maxLon}}
+}
+
+// webMercator returns the position of the given point on a Web Mercator map, from (0, 0) at its upper left corner
+// to (1, 1) at its lower right one.
+func webMercator(lon, lat float64) (x, y float64) {
+	lat = min(max(lat, -maxMercatorLat), maxMercatorLat) * math.Pi / 180
+	x = (lon + 180) / 360
+	y = (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2
+
+	return min(max(x, 0), math.Nextafter(1, 0)), min(max(y, 0), math.Nextafter(1, 0))
+}
+
+// wrapLon brings the given longitude back to [-180, 180).
+func wrapLon(lon float64) float64 {
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+
+	return lon - 180
+}
+
+func cellOf(lon, lat float64) cell {
+	return cell{lon: int(math.Floor(lon)), lat: int(math.Floor(lat))}
+}
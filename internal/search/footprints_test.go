@@ -0,0 +1,185 @@
+package search
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// square returns the footprint of a square of the given half side around the given center.
+func square(group, typ string, lon, lat, halfSide float64) Footprint {
+	ring := [][2]float64{
+		{lon - halfSide, lat + halfSide}, {lon + halfSide, lat + halfSide},
+		{lon + halfSide, lat - halfSide}, {lon - halfSide, lat - halfSide},
+		{lon - halfSide, lat + halfSide},
+	}
+
+	return Footprint{Group: group, Type: typ, Geometry: types.Geometry{Type: types.GeometryPolygon, Polygons: [][][][2]float64{{ring}}}}
+}
+
+func TestFootprintIndexClusters(t *testing.T) {
+	t.Parallel()
+
+	toulouse := square("optical", "L1", 1.44, 43.6, 0.1)
+	blagnac := square("radar", "L2", 1.36, 43.64, 0.1)
+	muret := square("optical", "L1", 1.32, 43.46, 0.1)
+	lyon := square("optical", "L2", 4.84, 45.76, 0.1)
+	// Crosses the antimeridian, its longitudes being kept continuous.
+	fiji := square("radar", "L1", 180, -17, 1)
+
+	idx := NewFootprintIndex()
+	idx.Replace(map[Key]Footprint{
+		{"bkt", "toulouse"}: toulouse,
+		{"bkt", "blagnac"}:  blagnac,
+		{"bkt", "muret"}:    muret,
+		{"bkt", "lyon"}:     lyon,
+		{"bkt", "fiji"}:     fiji,
+		{"bkt", "empty"}:    {Group: "optical", Type: "L1"},
+	})
+
+	if idx.Len() != 5 {
+		t.Fatalf("Expected the footprint without position to be ignored, got %d footprints", idx.Len())
+	}
+
+	ptr := func(key Key) *Key { return &key }
+	ptrFootprint := func(footprint Footprint) *Footprint { return &footprint }
+
+	cases := []struct {
+		name     string
+		bbox     [4]float64
+		zoom     int
+		keep     func(Key, Footprint) bool
+		expected []Cluster
+	}{
+		{
+			name: "clustered",
+			bbox: [4]float64{-10, 40, 10, 50},
+			zoom: 5,
+			expected: []Cluster{
+				{
+					Lon: 1.373333, Lat: 43.566667, Count: 3,
+					BBox: [4]float64{1.22, 43.36, 1.54, 43.74},
+					Counts: []types.ClusterCount{
+						{Group: "optical", Type: "L1", Count: 2},
+						{Group: "radar", Type: "L2", Count: 1},
+					},
+				},
+				{
+					Lon: 4.84, Lat: 45.76, Count: 1,
+					BBox:      [4]float64{4.74, 45.66, 4.94, 45.86},
+					Counts:    []types.ClusterCount{{Group: "optical", Type: "L2", Count: 1}},
+					Key:       ptr(Key{"bkt", "lyon"}),
+					Footprint: ptrFootprint(lyon),
+				},
+			},
+		},
+		{
+			name: "filtered",
+			bbox: [4]float64{-10, 40, 10, 50},
+			zoom: 5,
+			keep: func(_ Key, footprint Footprint) bool { return footprint.Group == "optical" && footprint.Type == "L1" },
+			expected: []Cluster{
+				{
+					Lon: 1.38, Lat: 43.53, Count: 2,
+					BBox:   [4]float64{1.22, 43.36, 1.54, 43.7},
+					Counts: []types.ClusterCount{{Group: "optical", Type: "L1", Count: 2}},
+				},
+			},
+		},
+		{
+			name: "individual footprints at high zoom",
+			bbox: [4]float64{1.4, 43.5, 1.5, 43.7},
+			zoom: MaxClusterZoom,
+			expected: []Cluster{
+				{
+					Lon: 1.44, Lat: 43.6, Count: 1,
+					BBox:      [4]float64{1.34, 43.5, 1.54, 43.7},
+					Counts:    []types.ClusterCount{{Group: "optical", Type: "L1", Count: 1}},
+					Key:       ptr(Key{"bkt", "toulouse"}),
+					Footprint: ptrFootprint(toulouse),
+				},
+			},
+		},
+		{
+			name: "across the antimeridian",
+			bbox: [4]float64{170, -20, -170, -10},
+			zoom: 3,
+			expected: []Cluster{
+				{
+					Lon: -180, Lat: -17, Count: 1,
+					BBox:      [4]float64{179, -18, 181, -16},
+					Counts:    []types.ClusterCount{{Group: "radar", Type: "L1", Count: 1}},
+					Key:       ptr(Key{"bkt", "fiji"}),
+					Footprint: ptrFootprint(fiji),
+				},
+			},
+		},
+		{
+			name:     "outside",
+			bbox:     [4]float64{-80, -10, -70, 0},
+			zoom:     8,
+			expected: []Cluster{},
+		},
+		{
+			// Without clamping, the cells of a billion degrees of latitude would be looked up.
+			name: "huge latitudes",
+			bbox: [4]float64{4, -1e9, 5, 1e300},
+			zoom: 5,
+			expected: []Cluster{
+				{
+					Lon: 4.84, Lat: 45.76, Count: 1,
+					BBox:      [4]float64{4.74, 45.66, 4.94, 45.86},
+					Counts:    []types.ClusterCount{{Group: "optical", Type: "L2", Count: 1}},
+					Key:       ptr(Key{"bkt", "lyon"}),
+					Footprint: ptrFootprint(lyon),
+				},
+			},
+		},
+		{
+			name:     "not finite",
+			bbox:     [4]float64{math.Inf(-1), 40, math.NaN(), 50},
+			zoom:     5,
+			expected: []Cluster{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			clusters := idx.Clusters(tc.bbox, tc.zoom, tc.keep)
+			if diff := cmp.Diff(tc.expected, clusters, cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+				t.Errorf("Unexpected clusters (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFootprintIndexUpdateRemove(t *testing.T) {
+	t.Parallel()
+
+	idx := NewFootprintIndex()
+	key := Key{"bkt", "img"}
+	world := [4]float64{-180, -90, 180, 90}
+
+	idx.Update(key, square("optical", "L1", 1.44, 43.6, 0.1))
+	idx.Update(key, square("optical", "L1", 4.84, 45.76, 0.1))
+
+	if clusters := idx.Clusters([4]float64{1, 43, 2, 44}, 10, nil); len(clusters) != 0 {
+		t.Fatalf("Expected the previous footprint to be replaced, got %v", clusters)
+	}
+
+	if clusters := idx.Clusters(world, 0, nil); len(clusters) != 1 {
+		t.Fatalf("Expected the new footprint to be found, got %v", clusters)
+	}
+
+	idx.Remove(key)
+
+	if idx.Len() != 0 || len(idx.cells) != 0 {
+		t.Fatalf("Expected an empty index, got %d footprints and %d cells", idx.Len(), len(idx.cells))
+	}
+}
@@ -0,0 +1,306 @@
+// Package search indexes the place names and the product information of the cached images,
+// and finds them back with accent-insensitive fuzzy matching. It also indexes their footprints,
+// to cluster them by zoom level.
+package search
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Weights of the fields of a document, place names being what the users look for first.
+const (
+	placeWeight = 2.0
+	textWeight  = 1.0
+)
+
+// Scores of a query term depending on how it matches an indexed term, fuzzy matches being lowered by their distance.
+const (
+	exactScore  = 1.0
+	prefixScore = 0.8
+	fuzzyScore  = 0.6
+)
+
+// minPrefixLength is the length from which a query term matches the indexed terms it starts.
+const minPrefixLength = 3
+
+// Key identifies an image.
+type Key struct {
+	Bucket string
+	Name   string
+}
+
+// Document holds the texts of an image.
+type Document struct {
+	// Places are the names of the countries, states, counties, cities and villages of the image.
+	Places []string
+	// Texts are the other texts of the image, like its product information.
+	Texts []string
+}
+
+// Result is an image matching a query, with the relevance of the match.
+type Result struct {
+	Key   Key
+	Score float64
+}
+
+// Index is an in-memory inverted index of the terms of the documents, safe for concurrent use.
+type Index struct {
+	l sync.RWMutex
+	// map[term][key] -> weight of the term in the document
+	terms map[string]map[Key]float64
+	// map[key] -> terms of the document
+	docs map[Key][]string
+}
+
+func NewIndex() *Index {
+	return &Index{
+		terms: make(map[string]map[Key]float64),
+		docs:  make(map[Key][]string),
+	}
+}
+
+// Update replaces the document of the given image.
+func (idx *Index) Update(key Key, doc Document) {
+	weights := documentTerms(doc)
+
+	idx.l.Lock()
+	defer idx.l.Unlock()
+
+	idx.remove(key)
+	idx.add(key, weights)
+}
+
+// Replace replaces all the documents of the index with the given ones.
+func (idx *Index) Replace(docs map[Key]Document) {
+	replacement := NewIndex()
+
+	for key, doc := range docs {
+		replacement.add(key, documentTerms(doc))
+	}
+
+	idx.l.Lock()
+	defer idx.l.Unlock()
+
+	idx.terms, idx.docs = replacement.terms, replacement.docs
+}
+
+// documentTerms maps the terms of the given document to the weight of the most important field holding them.
+func documentTerms(doc Document) map[string]float64 {
+	weights := make(map[string]float64)
+
+	for _, field := range []struct {
+		texts  []string
+		weight float64
+	}{{doc.Places, placeWeight}, {doc.Texts, textWeight}} {
+		for _, text := range field.texts {
+			for _, term := range Tokenize(text) {
+				weights[term] = max(weights[term], field.weight)
+			}
+		}
+	}
+
+	return weights
+}
+
+func (idx *Index) add(key Key, weights map[string]float64) {
+	if len(weights) == 0 {
+		return
+	}
+
+	terms := make([]string, 0, len(weights))
+
+	for term, weight := range weights {
+		if idx.terms[term] == nil {
+			idx.terms[term] = make(map[Key]float64)
+		}
+
+		idx.terms[term][key] = weight
+		terms = append(terms, term)
+	}
+
+	idx.docs[key] = terms
+}
+
+// Remove removes the document of the given image.
+func (idx *Index) Remove(key Key) {
+	idx.l.Lock()
+	defer idx.l.Unlock()
+
+	idx.remove(key)
+}
+
+func (idx *Index) remove(key Key) {
+	for _, term := range idx.docs[key] {
+		delete(idx.terms[term], key)
+
+		if len(idx.terms[term]) == 0 {
+			delete(idx.terms, term)
+		}
+	}
+
+	delete(idx.docs, key)
+}
+
+// Len returns the number of indexed documents.
+func (idx *Index) Len() int {
+	idx.l.RLock()
+	defer idx.l.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Search returns the images matching all the terms of the given query, from the most relevant.
+// A query term matches the indexed terms equal to it, starting with it, or within a few typos of it,
+// ignoring case and accents. At most limit results are returned, all of them if limit isn't positive.
+func (idx *Index) Search(query string, limit int) []Result {
+	queryTerms := Tokenize(query)
+	if len(queryTerms) == 0 {
+		return []Result{}
+	}
+
+	idx.l.RLock()
+	defer idx.l.RUnlock()
+
+	var scores map[Key]float64
+
+	for _, queryTerm := range queryTerms {
+		termScores := make(map[Key]float64)
+
+		for term, keys := range idx.terms {
+			score := matchScore(queryTerm, term)
+			if score == 0 {
+				continue
+			}
+
+			for key, weight := range keys {
+				if scores != nil {
+					if _, found := scores[key]; !found {
+						continue
+					}
+				}
+
+				termScores[key] = max(termScores[key], score*weight)
+			}
+		}
+
+		// Each query term must match, the documents missing one are dropped.
+		for key, score := range scores {
+			if _, found := termScores[key]; found {
+				termScores[key] += score
+			}
+		}
+
+		scores = termScores
+	}
+
+	results := make([]Result, 0, len(scores))
+
+	for key, score := range scores {
+		results = append(results, Result{Key: key, Score: score / float64(len(queryTerms))})
+	}
+
+	slices.SortFunc(results, func(a, b Result) int {
+		return cmp.Or(
+			cmp.Compare(b.Score, a.Score),
+			cmp.Compare(a.Key.Bucket, b.Key.Bucket),
+			cmp.Compare(a.Key.Name, b.Key.Name),
+		)
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// matchScore returns how well the given query term matches the given indexed term, 0 if it doesn't.
+func matchScore(queryTerm, term string) float64 {
+	switch {
+	case queryTerm == term:
+		return exactScore
+	case len(queryTerm) >= minPrefixLength && strings.HasPrefix(term, queryTerm):
+		return prefixScore
+	}
+
+	maxDistance := maxEdits(queryTerm)
+	if maxDistance == 0 {
+		return 0
+	}
+
+	distance := levenshtein([]rune(queryTerm), []rune(term), maxDistance)
+	if distance > maxDistance {
+		return 0
+	}
+
+	return fuzzyScore / float64(distance)
+}
+
+// maxEdits returns the number of typos allowed in the given query term, none for the short ones.
+func maxEdits(term string) int {
+	switch length := len([]rune(term)); {
+	case length <= 3:
+		return 0
+	case length <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// levenshtein returns the edit distance between the given strings, or maxDistance+1 once it is known to exceed it.
+func levenshtein(a, b []rune, maxDistance int) int {
+	if diff := len(a) - len(b); diff > maxDistance || -diff > maxDistance {
+		return maxDistance + 1
+	}
+
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := current[0]
+
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+			rowMin = min(rowMin, current[j])
+		}
+
+		if rowMin > maxDistance {
+			return maxDistance + 1
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// Tokenize splits the given text into lower case terms without accents, on any character other than a letter or a digit.
+func Tokenize(text string) []string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), text)
+	if err != nil {
+		folded = text
+	}
+
+	return strings.FieldsFunc(strings.ToLower(folded), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,148 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenize(t *testing.T) {
+	t.Parallel()
+
+	expected := []string{"saint", "etienne", "ile", "de", "france", "l2a"}
+	if diff := cmp.Diff(expected, Tokenize("Saint-Étienne, Île-de-France (L2A)")); diff != "" {
+		t.Errorf("Unexpected terms (-want +got):\n%s", diff)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		a, b        string
+		maxDistance int
+		expected    int
+	}{
+		{"toulouse", "toulouse", 2, 0},
+		{"toulouse", "tolouse", 2, 1},
+		{"toulouse", "tuolouse", 2, 2},
+		{"toulouse", "lyon", 2, 3},
+		{"kitten", "sitting", 3, 3},
+	}
+
+	for _, tc := range cases {
+		if distance := levenshtein([]rune(tc.a), []rune(tc.b), tc.maxDistance); distance != tc.expected {
+			t.Errorf("levenshtein(%q, %q): want %d, got %d", tc.a, tc.b, tc.expected, distance)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex()
+	idx.Update(Key{"bkt", "toulouse"}, Document{Places: []string{"France", "Occitanie", "Haute-Garonne", "Toulouse"}})
+	idx.Update(Key{"bkt", "saint-etienne"}, Document{Places: []string{"France", "Auvergne-Rhône-Alpes", "Loire", "Saint-Étienne"}})
+	idx.Update(Key{"bkt", "toulouse-report"}, Document{
+		Places: []string{"France"},
+		Texts:  []string{"Flood monitoring", "Acquired over Toulouse"},
+	})
+	idx.Update(Key{"other", "lyon"}, Document{Places: []string{"France", "Auvergne-Rhône-Alpes", "Rhône", "Lyon"}})
+
+	cases := []struct {
+		name     string
+		query    string
+		limit    int
+		expected []Result
+	}{
+		{
+			name:  "place before text",
+			query: "Toulouse",
+			expected: []Result{
+				{Key: Key{"bkt", "toulouse"}, Score: 2},
+				{Key: Key{"bkt", "toulouse-report"}, Score: 1},
+			},
+		},
+		{
+			name:     "accents and case",
+			query:    "saint etienne",
+			expected: []Result{{Key: Key{"bkt", "saint-etienne"}, Score: 2}},
+		},
+		{
+			name:  "typo",
+			query: "Tolouse",
+			expected: []Result{
+				{Key: Key{"bkt", "toulouse"}, Score: 1.2},
+				{Key: Key{"bkt", "toulouse-report"}, Score: 0.6},
+			},
+		},
+		{
+			name:  "prefix",
+			query: "auvergne",
+			expected: []Result{
+				{Key: Key{"bkt", "saint-etienne"}, Score: 2},
+				{Key: Key{"other", "lyon"}, Score: 2},
+			},
+		},
+		{
+			name:     "all terms must match",
+			query:    "flood toulouse",
+			expected: []Result{{Key: Key{"bkt", "toulouse-report"}, Score: 1}},
+		},
+		{
+			name:     "limit",
+			query:    "france",
+			limit:    1,
+			expected: []Result{{Key: Key{"bkt", "saint-etienne"}, Score: 2}},
+		},
+		{
+			name:     "no typo on short terms",
+			query:    "lyo",
+			expected: []Result{{Key: Key{"other", "lyon"}, Score: 1.6}},
+		},
+		{
+			name:     "no match",
+			query:    "Paris",
+			expected: []Result{},
+		},
+		{
+			name:     "empty query",
+			query:    " - ",
+			expected: []Result{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tc.expected, idx.Search(tc.query, tc.limit)); diff != "" {
+				t.Errorf("Unexpected results (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIndexUpdateRemove(t *testing.T) {
+	t.Parallel()
+
+	idx := NewIndex()
+	key := Key{"bkt", "img"}
+
+	idx.Update(key, Document{Places: []string{"Toulouse"}})
+	idx.Update(key, Document{Places: []string{"Lyon"}})
+
+	if results := idx.Search("toulouse", 0); len(results) != 0 {
+		t.Fatalf("Expected the previous document to be replaced, got %v", results)
+	}
+
+	if results := idx.Search("lyon", 0); len(results) != 1 {
+		t.Fatalf("Expected the new document to be found, got %v", results)
+	}
+
+	idx.Remove(key)
+
+	if idx.Len() != 0 || len(idx.terms) != 0 {
+		t.Fatalf("Expected an empty index, got %d documents and %d terms", idx.Len(), len(idx.terms))
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/deepzoom"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/observability"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/s3"
@@ -47,6 +48,7 @@ func newBucketCache(s3Client s3.Client, exprMan *expressionManager, bucket, dirP
 func (bc *bucketCache) handleCreateEvent(ctx context.Context, event s3Event, img image) *types.OutEvent {
 	var (
 		subDir   string
+		member   string
 		download = true
 	)
 
@@ -58,6 +60,7 @@ func (bc *bucketCache) handleCreateEvent(ctx context.Context, event s3Event, img
 
 		img.lastModified = event.ObjectLastModified
 		img.s3Key = event.ObjectKey
+		member = event.imgType.DynamicData.FileSelectors[types.ObjectPreview].Member
 	case types.ObjectTarget:
 		if !img.targets[event.ObjectKey].lastUpdate.Before(event.ObjectLastModified) {
 			return nil
@@ -65,29 +68,37 @@ func (bc *bucketCache) handleCreateEvent(ctx context.Context, event s3Event, img
 
 		subDir = targetsDirName
 	case types.ObjectDynamicInput:
-		cachedFile, found := img.dynamicInputFiles[event.InputFile]
-		if found {
-			if !cachedFile.lastUpdate.Before(event.ObjectLastModified) {
+		selector, ok := event.imgType.DynamicData.FileSelectors[event.InputFile]
+		if !ok {
+			logger.Errorf("Input file %q for image type %q/%q is not defined in the config", event.InputFile, event.imgGroup.GroupName, event.imgType.Name)
+
+			return nil
+		}
+
+		// The signed URLs of the objects already known are checked later, as they may have expired.
+		isSignedURL := selector.Kind == config.FileSelectorKindSignedURL || selector.Kind == config.FileSelectorKindFullProductSignedURL
+
+		if selector.Multiple {
+			cachedFile, found := img.multiDynamicInputFiles[event.InputFile][event.ObjectKey]
+			if found && !isSignedURL && !cachedFile.lastUpdate.Before(event.ObjectLastModified) {
+				return nil
+			}
+		} else if cachedFile, found := img.dynamicInputFiles[event.InputFile]; found {
+			if !isSignedURL && !cachedFile.lastUpdate.Before(event.ObjectLastModified) {
 				return nil
 			}
 
 			if cachedFile.value.S3Path != event.ObjectKey {
-				logger.Errorf("Input file %q for image type %q/%q matches multiple objects; this should be fixed ! (files found so far: %q, %q)", event.InputFile, event.imgGroup.GroupName, event.imgType.Name, cachedFile.value.S3Path, event.ObjectKey)
+				logger.Errorf("Input file %q for image type %q/%q matches multiple objects; set 'multiple: true' on its selector to keep all of them (files found so far: %q, %q)", event.InputFile, event.imgGroup.GroupName, event.imgType.Name, cachedFile.value.S3Path, event.ObjectKey)
 
 				return nil
 			}
 		}
 
-		selector, ok := event.imgType.DynamicData.FileSelectors[event.InputFile]
-		if !ok {
-			logger.Errorf("Input file %q for image type %q/%q is not defined in the config", event.InputFile, event.imgGroup.GroupName, event.imgType.Name)
-
-			return nil
-		}
-
 		switch selector.Kind {
 		case config.FileSelectorKindCached:
 			subDir = dynamicInputFilesDirName
+			member = selector.Member
 		case config.FileSelectorKindSignedURL, config.FileSelectorKindFullProductSignedURL, config.FileSelectorKindExternalViewerURL:
 			download = false
 		}
@@ -113,6 +124,7 @@ func (bc *bucketCache) handleCreateEvent(ctx context.Context, event s3Event, img
 		img.lastModified = event.ObjectLastModified
 		img.targets = make(map[string]valueWithLastUpdate[string])
 		img.dynamicInputFiles = make(map[string]valueWithLastUpdate[types.DynamicInputFile])
+		img.multiDynamicInputFiles = make(map[string]map[string]valueWithLastUpdate[types.DynamicInputFile])
 		img.linksFromCache = make(map[string]valueWithLastUpdate[string])
 		img.signedURLs = make(map[string]valueWithLastUpdate[signedURL])
 		img.externalViewerURLs = make(map[string]valueWithLastUpdate[string])
@@ -140,6 +152,45 @@ func (bc *bucketCache) handleCreateEvent(ctx context.Context, event s3Event, img
 		}
 	}
 
+	if member != "" {
+		membersDir := fullFilePath + archiveMembersDirSuffix
+
+		err := os.RemoveAll(membersDir)
+		if err != nil {
+			logger.Errorf("Failed to clear the extracted members of %q: %v", event.ObjectKey, err)
+
+			return nil
+		}
+
+		event.memberPath, err = utils.ExtractArchiveMember(fullFilePath, member, membersDir, bc.cfg.Products.ExpressionLimits.MaxFileSize)
+		if err != nil {
+			logger.Errorf("Failed to extract %q from archive %s/%q: %v", member, event.Bucket, event.ObjectKey, err)
+
+			return nil
+		}
+	}
+
+	if event.ObjectType == types.ObjectPreview && download {
+		previewPath := fullFilePath
+		if event.memberPath != "" {
+			previewPath = filepath.Join(fullFilePath+archiveMembersDirSuffix, event.memberPath)
+		}
+
+		var err error
+
+		event.convertedPreview, err = convertTIFFPreview(previewPath, bc.cfg.Cache.MaxTIFFPixels)
+		if err != nil {
+			logger.Errorf("Failed to convert TIFF preview %s/%q: %v", event.Bucket, event.ObjectKey, err)
+
+			return nil
+		}
+
+		// The tile pyramid of the previous version of the preview is outdated.
+		if img.previewCacheKey != "" {
+			removeDeepZoom(filepath.Join(bc.cfg.Cache.CacheDir, img.previewCacheKey))
+		}
+	}
+
 	eventObj, err := bc.applyObjectTypeSpecificHooks(ctx, event, &img)
 	if err != nil {
 		switch {
@@ -174,14 +225,22 @@ func (bc *bucketCache) applyObjectTypeSpecificHooks(ctx context.Context, event s
 			subdir = subDir[0]
 		}
 
-		return bc.getCacheKey(img.name, subdir, event.baseDirRelativePath())
+		key := bc.getCacheKey(img.name, subdir, event.baseDirRelativePath())
+		if event.memberPath != "" {
+			key = filepath.Join(key+archiveMembersDirSuffix, event.memberPath)
+		}
+
+		return key
 	}
 
 	switch event.ObjectType {
 	case types.ObjectPreview:
 		img.lastModified = event.ObjectLastModified
 		img.previewCacheKey = cacheKey()
-		eventObj = img.summary(ctx, event.baseDir, bc.cfg.Cache.CacheDir, bc.exprManager)
+		if event.convertedPreview {
+			img.previewCacheKey += convertedPreviewSuffix
+		}
+		eventObj = img.summary(ctx, event.baseDir, bc.cfg.Cache, bc.exprManager)
 	case types.ObjectTarget:
 		img.targets[event.ObjectKey] = valueWithLastUpdate[string]{
 			value:      cacheKey(targetsDirName),
@@ -196,7 +255,7 @@ func (bc *bucketCache) applyObjectTypeSpecificHooks(ctx context.Context, event s
 
 		switch selector.Kind {
 		case config.FileSelectorKindCached:
-			img.dynamicInputFiles[event.InputFile] = valueWithLastUpdate[types.DynamicInputFile]{
+			inputFile := valueWithLastUpdate[types.DynamicInputFile]{
 				value: types.DynamicInputFile{
 					S3Bucket: event.Bucket,
 					S3Path:   event.ObjectKey,
@@ -206,6 +265,12 @@ func (bc *bucketCache) applyObjectTypeSpecificHooks(ctx context.Context, event s
 				lastUpdate: event.ObjectLastModified,
 			}
 
+			if selector.Multiple {
+				img.setMultiDynamicInputFile(event.InputFile, event.ObjectKey, inputFile)
+			} else {
+				img.dynamicInputFiles[event.InputFile] = inputFile
+			}
+
 			if selector.Link {
 				img.linksFromCache[event.ObjectKey] = valueWithLastUpdate[string]{
 					value:      cacheKey(dynamicInputFilesDirName),
@@ -224,6 +289,7 @@ func (bc *bucketCache) applyObjectTypeSpecificHooks(ctx context.Context, event s
 				bucket:              event.Bucket,
 				s3Key:               event.ObjectKey,
 				objLastModified:     event.ObjectLastModified,
+				objSize:             event.Size,
 				img:                 *img,
 				exprManager:         bc.exprManager,
 				fullProductProtocol: bc.cfg.Products.FullProductProtocol,
@@ -236,6 +302,24 @@ func (bc *bucketCache) applyObjectTypeSpecificHooks(ctx context.Context, event s
 			}
 
 			img.signedURLs[event.ObjectKey], err = makeSignedURL(ctx, bc.s3Client, signedURLGenReq)
+			if err != nil {
+				break
+			}
+
+			inputFile := valueWithLastUpdate[types.DynamicInputFile]{
+				value: types.DynamicInputFile{
+					S3Bucket: event.Bucket,
+					S3Path:   event.ObjectKey,
+					Date:     event.ObjectLastModified,
+				},
+				lastUpdate: event.ObjectLastModified,
+			}
+
+			if selector.Multiple {
+				img.setMultiDynamicInputFile(event.InputFile, event.ObjectKey, inputFile)
+			} else {
+				img.dynamicInputFiles[event.InputFile] = inputFile
+			}
 		case config.FileSelectorKindExternalViewerURL:
 			if fullProduct, exists := img.externalViewerURLs[event.ObjectKey]; exists {
 				// Checking if we have the latest version of the object.
@@ -269,7 +353,11 @@ func (bc *bucketCache) applyObjectTypeSpecificHooks(ctx context.Context, event s
 			}
 		}
 
-		eventObj = img.dynamicInputFiles[event.InputFile]
+		if selector.Multiple {
+			eventObj = img.multiDynamicInputFiles[event.InputFile][event.ObjectKey]
+		} else {
+			eventObj = img.dynamicInputFiles[event.InputFile]
+		}
 	}
 
 	return eventObj, err
@@ -298,7 +386,11 @@ func (bc *bucketCache) handleRemoveEvent(_ context.Context, event s3Event, img i
 			return nil
 		}
 
-		delete(img.dynamicInputFiles, event.InputFile)
+		if selector.Multiple {
+			delete(img.multiDynamicInputFiles[event.InputFile], event.ObjectKey)
+		} else {
+			delete(img.dynamicInputFiles, event.InputFile)
+		}
 
 		switch selector.Kind {
 		case config.FileSelectorKindCached:
@@ -323,6 +415,19 @@ func (bc *bucketCache) handleRemoveEvent(_ context.Context, event s3Event, img i
 		if err := os.Remove(fullFilePath); err != nil && !os.IsNotExist(err) {
 			logger.Errorf("Failed to delete %q: %v", fullFilePath, err)
 		}
+
+		if err := os.RemoveAll(fullFilePath + archiveMembersDirSuffix); err != nil {
+			logger.Errorf("Failed to delete the extracted members of %q: %v", fullFilePath, err)
+		}
+
+		if event.ObjectType == types.ObjectPreview {
+			if err := os.Remove(fullFilePath + convertedPreviewSuffix); err != nil && !os.IsNotExist(err) {
+				logger.Errorf("Failed to delete the converted preview of %q: %v", fullFilePath, err)
+			}
+
+			removeDeepZoom(fullFilePath)
+			removeDeepZoom(fullFilePath + convertedPreviewSuffix)
+		}
 	}
 
 	if updateImages {
@@ -338,6 +443,35 @@ func (bc *bucketCache) handleRemoveEvent(_ context.Context, event s3Event, img i
 	}
 }
 
+// convertTIFFPreview converts the preview at the given path to PNG if it is a TIFF image,
+// which browsers can't display, and reports whether it did. Images of more than maxPixels pixels are refused.
+func convertTIFFPreview(previewPath string, maxPixels int) (bool, error) {
+	isTIFF, err := utils.IsTIFF(previewPath)
+	if err != nil || !isTIFF {
+		return false, err //nolint:wrapcheck
+	}
+
+	return true, utils.ConvertTIFFToPNG(previewPath, previewPath+convertedPreviewSuffix, maxPixels) //nolint:wrapcheck
+}
+
+// removeDeepZoom deletes the tile pyramid of the preview at the given path, if any.
+func removeDeepZoom(previewPath string) {
+	if err := deepzoom.Remove(previewPath); err != nil {
+		logger.Errorf("Failed to delete the tile pyramid of %q: %v", previewPath, err)
+	}
+}
+
+// previewImage returns the image whose preview has the given cache key. The caller must hold the lock.
+func (bc *bucketCache) previewImage(previewKey string) (image, bool) {
+	for _, img := range bc.images {
+		if img.previewCacheKey == previewKey {
+			return img, true
+		}
+	}
+
+	return image{}, false
+}
+
 func (bc *bucketCache) getCacheKey(imgName, subDir, filename string) string {
 	return filepath.Clean(filepath.Join(bc.bucket, imgName, subDir, filename))
 }
@@ -372,6 +506,37 @@ func (bc *bucketCache) dropImage(imgName, imgBaseDir string) {
 	}
 }
 
+// reload replaces the configuration of this bucket cache,
+// and drops the images whose group or type isn't part of the given ones.
+func (bc *bucketCache) reload(cfg config.Config, imgTypes map[string]map[string]bool) {
+	bc.l.Lock()
+	defer bc.l.Unlock()
+
+	bc.cfg = cfg
+
+	for baseDir, img := range bc.images {
+		if !imgTypes[img.imgGroup][img.imgType] {
+			logger.Debugf("Image type %q/%q is no longer configured", img.imgGroup, img.imgType)
+
+			bc.dropImage(img.name, baseDir)
+		}
+	}
+}
+
+// drop removes all the images of this bucket cache, along with its directory.
+func (bc *bucketCache) drop() {
+	bc.l.Lock()
+	defer bc.l.Unlock()
+
+	for baseDir, img := range bc.images {
+		bc.dropImage(img.name, baseDir)
+	}
+
+	if err := os.RemoveAll(bc.dirPath); err != nil {
+		logger.Errorf("Failed to delete %q: %v", bc.dirPath, err)
+	}
+}
+
 // findSignedURLsToRenew returns S3 signed URLs that will expire before the given deadline.
 func (bc *bucketCache) findSignedURLsToRenew(deadline time.Time, signedURLLifetime time.Duration) map[string]map[string]signedURLRegenerationRequest {
 	bc.l.RLock()
@@ -392,6 +557,7 @@ func (bc *bucketCache) findSignedURLsToRenew(deadline time.Time, signedURLLifeti
 				urlsToRenew[imgName][s3Key] = signedURLRegenerationRequest{
 					paramsExpr:         signedURL.value.paramsExpr,
 					objectLastModified: signedURL.lastUpdate,
+					objectSize:         signedURL.value.objectSize,
 					img:                img,
 				}
 			}
@@ -479,6 +645,7 @@ func (bc *bucketCache) updateMetrics(ctx context.Context, gatherer *observabilit
 type signedURLGenerationRequest struct {
 	bucket, s3Key       string
 	objLastModified     time.Time
+	objSize             int64
 	img                 image
 	injectParams        bool
 	paramsExpr          string
@@ -506,6 +673,7 @@ func makeSignedURL(ctx context.Context, s3Client s3.Client, genReq signedURLGene
 			value:          signURLStr,
 			paramsExpr:     genReq.paramsExpr,
 			generationDate: time.Now().Truncate(time.Second), // truncating to get closer to the actual generation timestamp
+			objectSize:     genReq.objSize,
 		},
 		lastUpdate: genReq.objLastModified,
 	}, nil
@@ -1,18 +1,27 @@
 package server
 
 import (
+	"archive/zip"
 	"context"
 	"errors"
+	goimage "image"
 	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/deepzoom"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/s3"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
 
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
+	"golang.org/x/image/tiff"
 )
 
 func TestGetCacheKey(t *testing.T) {
@@ -495,3 +504,256 @@ func TestFindSignedURLsToRenew(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleCreateEventArchiveMember(t *testing.T) {
+	t.Parallel()
+
+	const (
+		bucket    = "prod"
+		objectKey = "products/1/product.zip"
+	)
+
+	s3Client := S3ClientMock{
+		DownloadObjectFn: func(_ context.Context, _, _, destPath string) error {
+			err := os.MkdirAll(filepath.Dir(destPath), 0o700)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Create(destPath)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			zipWriter := zip.NewWriter(f)
+
+			entry, err := zipWriter.Create("product/metadata.json")
+			if err != nil {
+				return err
+			}
+
+			_, err = entry.Write([]byte(`{"id": 1}`))
+			if err != nil {
+				return err
+			}
+
+			return zipWriter.Close()
+		},
+	}
+	imgType := config.ImageType{
+		Name: "typ",
+		DynamicData: config.DynamicData{
+			FileSelectors: map[string]config.FileSelector{
+				"metadata": {
+					Regex:  `\.zip$`,
+					Rgx:    regexp.MustCompile(`\.zip$`),
+					Kind:   config.FileSelectorKindCached,
+					Member: "*/metadata.json",
+				},
+			},
+		},
+	}
+	cacheDir := t.TempDir()
+	bc := newBucketCache(s3Client, nil, bucket, filepath.Join(cacheDir, bucket), config.Config{Products: config.Products{MaxObjectsAge: time.Hour}})
+	event := s3Event{
+		Event: s3.Event{
+			Bucket:             bucket,
+			EventType:          types.EventCreated,
+			ObjectType:         types.ObjectDynamicInput,
+			InputFile:          "metadata",
+			ObjectKey:          objectKey,
+			ObjectLastModified: time.Date(2026, 6, 7, 12, 0, 0, 0, time.UTC),
+			Time:               time.Now(),
+		},
+		baseDir:  "products/1",
+		imgGroup: config.ImageGroup{GroupName: "grp"},
+		imgType:  imgType,
+	}
+
+	outEvent := bc.handleCreateEvent(t.Context(), event, image{})
+	if outEvent == nil {
+		t.Fatal("Expected an event for the archive")
+	}
+
+	file := bc.images["products/1"].dynamicInputFiles["metadata"].value
+	expectedCacheKey := filepath.Join(bucket, "products@1", dynamicInputFilesDirName, "product.zip"+archiveMembersDirSuffix, "product", "metadata.json")
+
+	if file.CacheKey != expectedCacheKey || file.S3Path != objectKey {
+		t.Fatalf("Unexpected input file: cache key %q, S3 path %q", file.CacheKey, file.S3Path)
+	}
+
+	content, err := os.ReadFile(filepath.Join(cacheDir, file.CacheKey))
+	if err != nil {
+		t.Fatal("Failed to read the extracted member:", err)
+	}
+
+	if string(content) != `{"id": 1}` {
+		t.Fatalf("Unexpected member content %q", content)
+	}
+
+	bc.handleRemoveEvent(t.Context(), event, bc.images["products/1"])
+
+	if _, err = os.Stat(filepath.Join(cacheDir, file.CacheKey)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the extracted member to be removed along with the archive, got %v", err)
+	}
+}
+
+func TestHandleCreateEventMultipleSignedURLs(t *testing.T) {
+	t.Parallel()
+
+	const bucket = "prod"
+
+	var generated []string
+
+	s3Client := S3ClientMock{
+		GenerateSignedURLFn: func(_ context.Context, _, objectKey string) (*url.URL, error) {
+			generated = append(generated, objectKey)
+
+			return url.Parse("https://s3/" + objectKey + "?signature")
+		},
+	}
+	imgType := config.ImageType{
+		Name: "typ",
+		DynamicData: config.DynamicData{
+			FileSelectors: map[string]config.FileSelector{
+				"bands": {Regex: `\.tif$`, Rgx: regexp.MustCompile(`\.tif$`), Kind: config.FileSelectorKindSignedURL, Multiple: true},
+			},
+		},
+	}
+	cacheDir := t.TempDir()
+	bc := newBucketCache(s3Client, nil, bucket, filepath.Join(cacheDir, bucket), config.Config{Products: config.Products{MaxObjectsAge: time.Hour}})
+	lastModified := time.Date(2026, 6, 7, 12, 0, 0, 0, time.UTC)
+
+	newEvent := func(objectKey string) s3Event {
+		return s3Event{
+			Event: s3.Event{
+				Bucket:             bucket,
+				EventType:          types.EventCreated,
+				ObjectType:         types.ObjectDynamicInput,
+				InputFile:          "bands",
+				ObjectKey:          objectKey,
+				ObjectLastModified: lastModified,
+				Time:               time.Now(),
+			},
+			baseDir:  "products/1",
+			imgGroup: config.ImageGroup{GroupName: "grp"},
+			imgType:  imgType,
+		}
+	}
+
+	for _, objectKey := range []string{"products/1/B01.tif", "products/1/B02.tif"} {
+		outEvent := bc.handleCreateEvent(t.Context(), newEvent(objectKey), bc.images["products/1"])
+		if outEvent == nil {
+			t.Fatalf("Expected an event for %q", objectKey)
+		}
+
+		expected := valueWithLastUpdate[types.DynamicInputFile]{
+			value:      types.DynamicInputFile{S3Bucket: bucket, S3Path: objectKey, Date: lastModified},
+			lastUpdate: lastModified,
+		}
+
+		if outEvent.Object != any(expected) {
+			t.Fatalf("Unexpected event object for %q: %+v", objectKey, outEvent.Object)
+		}
+	}
+
+	// The signed URLs still valid aren't generated again.
+	if outEvent := bc.handleCreateEvent(t.Context(), newEvent("products/1/B01.tif"), bc.images["products/1"]); outEvent != nil {
+		t.Fatalf("Expected no event for an object already known, got %+v", outEvent)
+	}
+
+	img := bc.images["products/1"]
+	if len(img.signedURLs) != 2 || len(img.multiDynamicInputFiles["bands"]) != 2 || len(generated) != 2 {
+		t.Fatalf("Expected 2 signed URLs and input files, got %v, %v and %q generated", img.signedURLs, img.multiDynamicInputFiles, generated)
+	}
+
+	bc.handleRemoveEvent(t.Context(), newEvent("products/1/B01.tif"), img)
+
+	img = bc.images["products/1"]
+	if _, found := img.multiDynamicInputFiles["bands"]["products/1/B01.tif"]; found || len(img.signedURLs) != 1 {
+		t.Fatalf("Expected the removed object to be dropped, got %v, %v", img.signedURLs, img.multiDynamicInputFiles)
+	}
+}
+
+func TestHandleCreateEventTIFFPreview(t *testing.T) {
+	t.Parallel()
+
+	const (
+		bucket    = "prod"
+		objectKey = "products/1/preview.tif"
+	)
+
+	s3Client := S3ClientMock{
+		DownloadObjectFn: func(_ context.Context, _, _, destPath string) error {
+			err := os.MkdirAll(filepath.Dir(destPath), 0o700)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Create(destPath)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			return tiff.Encode(f, goimage.NewGray16(goimage.Rect(0, 0, 5, 4)), nil)
+		},
+	}
+	exprManager := new(expressionManager{cacheSums: map[exprCacheKey]exprCacheEntry{}})
+	cacheDir := t.TempDir()
+	cacheCfg := config.Cache{CacheDir: cacheDir, DeepZoom: config.DeepZoom{MinSize: 5, TileSize: 2}}
+	bc := newBucketCache(s3Client, exprManager, bucket, filepath.Join(cacheDir, bucket), config.Config{Cache: cacheCfg, Products: config.Products{MaxObjectsAge: time.Hour}})
+	event := s3Event{
+		Event: s3.Event{
+			Bucket:             bucket,
+			EventType:          types.EventCreated,
+			ObjectType:         types.ObjectPreview,
+			ObjectKey:          objectKey,
+			ObjectLastModified: time.Date(2026, 6, 7, 12, 0, 0, 0, time.UTC),
+			Time:               time.Now(),
+		},
+		baseDir:  "products/1",
+		imgGroup: config.ImageGroup{GroupName: "grp"},
+		imgType:  config.ImageType{Name: "typ"},
+	}
+
+	outEvent := bc.handleCreateEvent(t.Context(), event, image{})
+	if outEvent == nil {
+		t.Fatal("Expected an event for the preview")
+	}
+
+	summary, ok := outEvent.Object.(types.ImageSummary)
+	if !ok {
+		t.Fatalf("Unexpected event object %T", outEvent.Object)
+	}
+
+	expectedCacheKey := filepath.Join(bucket, "products@1", "preview.tif"+convertedPreviewSuffix)
+	if summary.CachedObject.CacheKey != expectedCacheKey {
+		t.Fatalf("Unexpected preview cache key %q, want %q", summary.CachedObject.CacheKey, expectedCacheKey)
+	}
+
+	if summary.Size != (types.ImageSize{Width: 5, Height: 4}) {
+		t.Fatalf("Unexpected preview size %+v", summary.Size)
+	}
+
+	if summary.DeepZoomManifest != expectedCacheKey+deepzoom.ManifestSuffix {
+		t.Fatalf("Unexpected deep zoom manifest %q", summary.DeepZoomManifest)
+	}
+
+	if err := deepzoom.Generate(filepath.Join(cacheDir, expectedCacheKey), cacheCfg.DeepZoom.TileSize, cacheCfg.MaxDecodedPixels); err != nil {
+		t.Fatal("Failed to generate the tile pyramid:", err)
+	}
+
+	bc.handleRemoveEvent(t.Context(), event, bc.images["products/1"])
+
+	if _, err := os.Stat(filepath.Join(cacheDir, expectedCacheKey)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the converted preview to be removed along with the TIFF, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cacheDir, summary.DeepZoomManifest)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the tile pyramid to be removed along with the preview, got %v", err)
+	}
+}
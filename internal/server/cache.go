@@ -4,22 +4,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/deepzoom"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/observability"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/s3"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/search"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
 	"github.com/Maxi-Mega/s3-image-server-v2/utils"
+
+	"golang.org/x/sync/singleflight"
 )
 
 const (
 	targetsDirName           = "__targets__"
 	dynamicInputFilesDirName = "__dynamic_input_files__"
+	// archiveMembersDirSuffix is appended to the path of a cached archive to get the dir of its extracted members.
+	archiveMembersDirSuffix = ".members"
+	// convertedPreviewSuffix is appended to the path of a cached TIFF preview to get its PNG version.
+	convertedPreviewSuffix = ".png"
 )
 
 var (
@@ -29,10 +40,36 @@ var (
 
 type cache struct {
 	gatherer    *observability.Metrics
-	cacheDir    string
+	cacheCfg    config.Cache
+	bucketsLock sync.RWMutex
 	buckets     map[string]*bucketCache
 	outEvents   chan types.OutEvent
 	exprManager *expressionManager
+	// searchIndex holds the place names and product information of the images, updated along with them.
+	searchIndex *search.Index
+	// deepZoomGroup merges the concurrent generations of the tile pyramid of a preview.
+	deepZoomGroup singleflight.Group
+	// footprints holds the footprints of the localized images, to cluster them on the map.
+	footprints *search.FootprintIndex
+	// reindexL guards the rebuilds of the indexes: reindexGen identifies the latest one,
+	// and reindexDirty holds the images indexed while it runs, nil when none does.
+	// It also guards the indexing of the images: indexSeq numbers their snapshots,
+	// and indexPending holds the number of the latest snapshot of each image not indexed yet.
+	reindexL     sync.Mutex
+	reindexGen   uint64
+	reindexDirty map[search.Key]bool
+	indexSeq     uint64
+	indexPending map[search.Key]uint64
+}
+
+// imageIndexing is the snapshot of an image taken to index it without holding the lock of its bucket.
+type imageIndexing struct {
+	key search.Key
+	seq uint64
+	// found is false when the image isn't cached anymore, and must be removed from the indexes.
+	found    bool
+	img      image
+	envFiles envFilesPrecomputed
 }
 
 type image struct {
@@ -44,6 +81,8 @@ type image struct {
 	targets map[string]valueWithLastUpdate[string]
 	// map[config key] -> cache key & last update
 	dynamicInputFiles map[string]valueWithLastUpdate[types.DynamicInputFile]
+	// map[config key] -> map[s3 key] -> cache key & last update, for selectors matching multiple objects
+	multiDynamicInputFiles map[string]map[string]valueWithLastUpdate[types.DynamicInputFile]
 	// map[s3 key] -> cache key & last update
 	linksFromCache map[string]valueWithLastUpdate[string]
 	// map[s3 key] -> signed URL & last update
@@ -55,9 +94,10 @@ type image struct {
 
 // summary returns the [ImageSummary] of this [image],
 // the name parameter corresponds to the image base dir.
-func (img image) summary(ctx context.Context, name, cacheDir string, exprMan *expressionManager) types.ImageSummary {
+func (img image) summary(ctx context.Context, name string, cacheCfg config.Cache, exprMan *expressionManager) types.ImageSummary {
 	var displayName string
 
+	evaluationErrors := make([]types.EvaluationError, 0)
 	envFiles := exprMan.precomputeDynamicFiles(img)
 
 	geonames, err := exprMan.imageGeonames(ctx, img, &envFiles)
@@ -65,6 +105,7 @@ func (img image) summary(ctx context.Context, name, cacheDir string, exprMan *ex
 		logger.Errorf("Failed to evaluate image geonames for %q: %v", img.name, err)
 
 		displayName = "No geonames found"
+		evaluationErrors = append(evaluationErrors, exprMan.evaluationError(img, types.ExprGeonames, err))
 	} else if geonames != nil {
 		displayName = geonames.GetTopLevel()
 	}
@@ -72,18 +113,29 @@ func (img image) summary(ctx context.Context, name, cacheDir string, exprMan *ex
 	productInfo, err := exprMan.productInfo(ctx, img, &envFiles)
 	if err != nil {
 		logger.Errorf("Failed to evaluate product information for %q: %v", img.name, err)
+
+		evaluationErrors = append(evaluationErrors, exprMan.evaluationError(img, types.ExprProductInfo, err))
 	}
 
-	dynamicFilters, err := exprMan.dynamicFilters(ctx, img, &envFiles)
-	if err != nil {
-		logger.Errorf("Failed to evaluate dynamic filters for %q: %v", img.name, err)
+	// The filters which failed are left out, the others being kept.
+	dynamicFilters, errs := exprMan.dynamicFilters(ctx, img, &envFiles)
+	for _, err := range errs {
+		logger.Errorf("Failed to evaluate a dynamic filter for %q: %v", img.name, err)
+
+		evaluationErrors = append(evaluationErrors, exprMan.evaluationError(img, "", err))
 	}
 
-	imgSize, err := utils.GetImageSize(img.previewCacheKey, cacheDir)
+	imgSize, err := utils.GetImageSize(img.previewCacheKey, cacheCfg.CacheDir)
 	if err != nil {
 		logger.Warnf("Failed to get image size of %q: %v", img.previewCacheKey, err)
 	}
 
+	var deepZoomManifest string
+
+	if isDeepZoomed(imgSize, cacheCfg) {
+		deepZoomManifest = img.previewCacheKey + deepzoom.ManifestSuffix
+	}
+
 	return types.ImageSummary{
 		Bucket:         img.bucket,
 		Key:            name,
@@ -97,8 +149,73 @@ func (img image) summary(ctx context.Context, name, cacheDir string, exprMan *ex
 			LastModified: img.lastModified,
 			CacheKey:     img.previewCacheKey,
 		},
-		Size: imgSize,
+		Size:             imgSize,
+		EvaluationErrors: evaluationErrors,
+		DeepZoomManifest: deepZoomManifest,
+	}
+}
+
+// searchDocument returns the texts of this [image] indexed for the search:
+// the names of its geonames and its product information.
+func (img image) searchDocument(ctx context.Context, exprMan *expressionManager, envFiles *envFilesPrecomputed) search.Document {
+	var doc search.Document
+
+	geonames, err := exprMan.imageGeonames(ctx, img, envFiles)
+	if err == nil && geonames != nil {
+		for _, country := range geonames.Objects {
+			doc.Places = append(doc.Places, country.Name)
+
+			for _, state := range country.States {
+				doc.Places = append(doc.Places, state.Name)
+
+				for _, county := range state.Counties {
+					doc.Places = append(doc.Places, county.Name)
+
+					for _, place := range slices.Concat(county.Cities, county.Villages) {
+						doc.Places = append(doc.Places, place.Name)
+					}
+				}
+			}
+		}
 	}
+
+	productInfo, err := exprMan.productInfo(ctx, img, envFiles)
+	if err == nil && productInfo != nil {
+		doc.Texts = append(doc.Texts, productInfo.Title, productInfo.Subtitle)
+		doc.Texts = append(doc.Texts, productInfo.Entries...)
+	}
+
+	// Errors are already reported along with the image summary.
+	return doc
+}
+
+// footprint returns the footprint of the image, or false if it has no localization.
+func (img image) footprint(ctx context.Context, exprMan *expressionManager, envFiles *envFilesPrecomputed) (search.Footprint, bool) {
+	localization, err := exprMan.imageLocalization(ctx, img, envFiles)
+	if err != nil {
+		// Unlike the geonames and the product information, the localization isn't part of the image summary.
+		logger.Errorf("Failed to evaluate localization for %q, left out of the map footprints: %v", img.name, err)
+
+		return search.Footprint{}, false
+	}
+
+	if localization == nil {
+		return search.Footprint{}, false
+	}
+
+	return search.Footprint{Group: img.imgGroup, Type: img.imgType, Geometry: localization.Footprint()}, true
+}
+
+func (img *image) setMultiDynamicInputFile(inputFile, s3Key string, file valueWithLastUpdate[types.DynamicInputFile]) {
+	if img.multiDynamicInputFiles == nil {
+		img.multiDynamicInputFiles = make(map[string]map[string]valueWithLastUpdate[types.DynamicInputFile])
+	}
+
+	if img.multiDynamicInputFiles[inputFile] == nil {
+		img.multiDynamicInputFiles[inputFile] = make(map[string]valueWithLastUpdate[types.DynamicInputFile])
+	}
+
+	img.multiDynamicInputFiles[inputFile][s3Key] = file
 }
 
 type valueWithLastUpdate[T any] struct {
@@ -114,6 +231,8 @@ type signedURL struct {
 	value          string
 	paramsExpr     string
 	generationDate time.Time
+	// objectSize is the size, in bytes, of the object, as listed when the URL was generated.
+	objectSize int64
 }
 
 func (su signedURL) String() string {
@@ -133,6 +252,7 @@ func newCache(cfg config.Config, s3Client s3.Client, outChan chan types.OutEvent
 	}
 
 	exprManager := newExpressionManager(cfg)
+	exprManager.gatherer = gatherer
 
 	buckets := make(map[string]*bucketCache)
 
@@ -153,17 +273,95 @@ func newCache(cfg config.Config, s3Client s3.Client, outChan chan types.OutEvent
 
 	return &cache{
 		gatherer:    gatherer,
-		cacheDir:    cfg.Cache.CacheDir,
+		cacheCfg:    cfg.Cache,
 		buckets:     buckets,
 		outEvents:   outChan,
 		exprManager: exprManager,
+		searchIndex: search.NewIndex(),
+		footprints:  search.NewFootprintIndex(),
 	}, nil
 }
 
+func (c *cache) bucket(name string) (*bucketCache, bool) {
+	c.bucketsLock.RLock()
+	defer c.bucketsLock.RUnlock()
+
+	bc, ok := c.buckets[name]
+
+	return bc, ok
+}
+
+// bucketCaches returns a snapshot of the current bucket caches.
+func (c *cache) bucketCaches() []*bucketCache {
+	c.bucketsLock.RLock()
+	defer c.bucketsLock.RUnlock()
+
+	return slices.Collect(maps.Values(c.buckets))
+}
+
+// reload applies the given configuration to the cache.
+// Caches of the buckets that are no longer used are dropped, new ones are created,
+// and images whose group or type doesn't exist anymore are dropped.
+// The search index is rebuilt in the background, since the expressions giving the indexed texts may have changed.
+func (c *cache) reload(ctx context.Context, cfg config.Config, s3Client s3.Client) error {
+	c.exprManager.reload(cfg)
+	defer func() { go c.reindex(ctx) }()
+
+	// map[bucket][img group][img type]
+	typesPerBucket := make(map[string]map[string]map[string]bool)
+
+	for _, group := range cfg.Products.ImageGroups {
+		if _, found := typesPerBucket[group.Bucket]; !found {
+			typesPerBucket[group.Bucket] = make(map[string]map[string]bool)
+		}
+
+		typesPerBucket[group.Bucket][group.GroupName] = make(map[string]bool, len(group.Types))
+
+		for _, imgType := range group.Types {
+			typesPerBucket[group.Bucket][group.GroupName][imgType.Name] = true
+		}
+	}
+
+	c.bucketsLock.Lock()
+	defer c.bucketsLock.Unlock()
+
+	for name, bucket := range c.buckets {
+		imgTypes, found := typesPerBucket[name]
+		if !found {
+			logger.Infof("Bucket %q is no longer used, dropping its cache", name)
+
+			bucket.drop()
+			delete(c.buckets, name)
+
+			continue
+		}
+
+		bucket.reload(cfg, imgTypes)
+	}
+
+	for name := range typesPerBucket {
+		if _, found := c.buckets[name]; found {
+			continue
+		}
+
+		dir := filepath.Join(c.cacheCfg.CacheDir, name)
+
+		logger.Tracef("Creating cache dir for bucket %q at %s", name, dir)
+
+		if err := utils.CreateDir(dir); err != nil {
+			return fmt.Errorf("can't create cache dir: %w", err)
+		}
+
+		c.buckets[name] = newBucketCache(s3Client, c.exprManager, name, dir, cfg)
+	}
+
+	return nil
+}
+
 func (c *cache) GetAllImages(ctx context.Context, start, end time.Time) types.AllImageSummaries {
 	allImages := make(types.AllImageSummaries)
 
-	for _, bucket := range c.buckets {
+	for _, bucket := range c.bucketCaches() {
 		bucket.l.RLock()
 
 		for name, img := range bucket.images {
@@ -176,7 +374,7 @@ func (c *cache) GetAllImages(ctx context.Context, start, end time.Time) types.Al
 				allImages[grp] = make(map[string][]types.ImageSummary)
 			}
 
-			allImages[grp][typ] = append(allImages[grp][typ], img.summary(ctx, name, c.cacheDir, c.exprManager))
+			allImages[grp][typ] = append(allImages[grp][typ], img.summary(ctx, name, c.cacheCfg, c.exprManager))
 		}
 
 		bucket.l.RUnlock()
@@ -186,7 +384,7 @@ func (c *cache) GetAllImages(ctx context.Context, start, end time.Time) types.Al
 }
 
 func (c *cache) GetImage(ctx context.Context, bucketName, name string) (types.Image, error) {
-	bucket, ok := c.buckets[bucketName]
+	bucket, ok := c.bucket(bucketName)
 	if !ok {
 		return types.Image{}, types.ErrImageNotFound
 	}
@@ -199,35 +397,209 @@ func (c *cache) GetImage(ctx context.Context, bucketName, name string) (types.Im
 		return types.Image{}, types.ErrImageNotFound
 	}
 
+	return c.imageDetails(ctx, name, img), nil
+}
+
+// imageDetails returns the [types.Image] of the given image. The caller must hold the lock of its bucket.
+func (c *cache) imageDetails(ctx context.Context, name string, img image) types.Image {
 	targetFiles := make([]string, 0, len(img.targets))
 
 	for _, target := range img.targets {
 		targetFiles = append(targetFiles, target.value)
 	}
 
-	localization, err := c.exprManager.imageLocalization(ctx, img)
+	summary := img.summary(ctx, name, c.cacheCfg, c.exprManager)
+	evaluationErrors := slices.Clone(summary.EvaluationErrors)
+
+	localization, err := c.exprManager.imageLocalization(ctx, img, nil)
 	if err != nil {
 		logger.Errorf("Failed to evaluate image localization for %q: %v", img.name, err)
+
+		evaluationErrors = append(evaluationErrors, c.exprManager.evaluationError(img, types.ExprLocalization, err))
 	}
 
 	return types.Image{
-		ImageSummary:       img.summary(ctx, name, c.cacheDir, c.exprManager),
+		ImageSummary:       summary,
 		Localization:       localization,
 		CachedFileLinks:    toFilenameValueMap(img.linksFromCache),
 		SignedURLs:         toFilenameValueMap(img.signedURLs),
 		ExternalViewerURLs: toFilenameValueMap(img.externalViewerURLs),
 		TargetFiles:        targetFiles,
-	}, nil
+		EvaluationErrors:   evaluationErrors,
+	}
+}
+
+func (c *cache) DebugImage(ctx context.Context, bucketName, name string) (types.ImageDebug, error) {
+	bucket, ok := c.bucket(bucketName)
+	if !ok {
+		return types.ImageDebug{}, types.ErrImageNotFound
+	}
+
+	// The expressions are evaluated from a snapshot of the image, without holding the lock of the bucket.
+	bucket.l.RLock()
+
+	img, ok := bucket.images[name]
+	if !ok {
+		bucket.l.RUnlock()
+
+		return types.ImageDebug{}, types.ErrImageNotFound
+	}
+
+	envFiles := c.exprManager.precomputeDynamicFiles(img)
+
+	bucket.l.RUnlock()
+
+	return c.exprManager.debug(ctx, img, &envFiles), nil
 }
 
 func (c *cache) GetCachedObject(cacheKey string) ([]byte, error) {
-	return os.ReadFile(filepath.Join(c.cacheDir, cacheKey)) //nolint:wrapcheck
+	return os.ReadFile(filepath.Join(c.cacheCfg.CacheDir, cacheKey)) //nolint:wrapcheck
+}
+
+func (c *cache) GetDeepZoomObject(path string) ([]byte, error) {
+	previewKey, ok := deepzoom.ImagePath(path)
+	if !ok {
+		return nil, types.ErrNotDeepZoomed
+	}
+
+	previewPath := filepath.Join(c.cacheCfg.CacheDir, previewKey)
+
+	fresh, err := deepzoom.IsFresh(previewPath)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if !fresh {
+		_, err, _ = c.deepZoomGroup.Do(previewKey, func() (any, error) {
+			return nil, c.generateDeepZoom(previewKey)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return os.ReadFile(filepath.Join(c.cacheCfg.CacheDir, path)) //nolint:wrapcheck
+}
+
+// generateDeepZoom generates the tile pyramid of the preview with the given cache key,
+// which must be the one of a cached image large enough to be tiled.
+func (c *cache) generateDeepZoom(previewKey string) error {
+	bucketName, _, _ := strings.Cut(previewKey, string(filepath.Separator))
+
+	if !c.isPreview(bucketName, previewKey) {
+		return types.ErrNotDeepZoomed
+	}
+
+	previewPath := filepath.Join(c.cacheCfg.CacheDir, previewKey)
+
+	size, err := utils.GetImageSize(previewKey, c.cacheCfg.CacheDir)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if !isDeepZoomed(size, c.cacheCfg) {
+		return types.ErrNotDeepZoomed
+	}
+
+	start := time.Now()
+
+	err = deepzoom.Generate(previewPath, c.cacheCfg.DeepZoom.TileSize, c.cacheCfg.MaxDecodedPixels)
+	if err != nil {
+		return fmt.Errorf("generating tile pyramid of %q: %w", previewKey, err)
+	}
+
+	logger.Debugf("Generated the tile pyramid of %q in %s", previewKey, time.Since(start))
+
+	return nil
+}
+
+// isPreview reports whether the given cache key is the one of the preview of an image of the given bucket.
+func (c *cache) isPreview(bucketName, previewKey string) bool {
+	bucket, ok := c.bucket(bucketName)
+	if !ok {
+		return false
+	}
+
+	bucket.l.RLock()
+	defer bucket.l.RUnlock()
+
+	_, ok = bucket.previewImage(previewKey)
+
+	return ok
+}
+
+func (c *cache) CropImage(ctx context.Context, cacheKey string, req types.CropRequest) ([]byte, error) {
+	bucketName, _, _ := strings.Cut(cacheKey, string(filepath.Separator))
+
+	if !c.isPreview(bucketName, cacheKey) {
+		return nil, types.ErrImageNotFound
+	}
+
+	if req.BBox != nil {
+		localization, err := c.previewLocalization(ctx, cacheKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if localization == nil {
+			return nil, fmt.Errorf("%w: the image has no localization", types.ErrInvalidCrop)
+		}
+
+		size, err := utils.GetImageSize(cacheKey, c.cacheCfg.CacheDir)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		req.Window, err = localization.PixelWindow(*req.BBox, size.Width, size.Height)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
+
+	return utils.CropImage(filepath.Join(c.cacheCfg.CacheDir, cacheKey), req.Window, req.MaxSize, c.cacheCfg.MaxDecodedPixels, req.Format) //nolint:wrapcheck
+}
+
+// previewLocalization returns the localization of the image whose preview has the given cache key,
+// nil if it has none.
+func (c *cache) previewLocalization(ctx context.Context, previewKey string) (*types.Localization, error) {
+	bucketName, _, _ := strings.Cut(previewKey, string(filepath.Separator))
+
+	bucket, ok := c.bucket(bucketName)
+	if !ok {
+		return nil, types.ErrImageNotFound
+	}
+
+	bucket.l.RLock()
+	defer bucket.l.RUnlock()
+
+	img, ok := bucket.previewImage(previewKey)
+	if !ok {
+		return nil, types.ErrImageNotFound
+	}
+
+	localization, err := c.exprManager.imageLocalization(ctx, img, nil)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating localization of %q: %w", img.name, err)
+	}
+
+	return localization, nil
+}
+
+// isDeepZoomed reports whether a preview of the given size is served as a tile pyramid,
+// the ones too large to be decoded being served as they are.
+func isDeepZoomed(size types.ImageSize, cfg config.Cache) bool {
+	if cfg.MaxDecodedPixels > 0 && size.Width*size.Height > cfg.MaxDecodedPixels {
+		return false
+	}
+
+	return cfg.DeepZoom.MinSize > 0 && max(size.Width, size.Height) >= cfg.DeepZoom.MinSize
 }
 
 func (c *cache) DumpImages() map[string][]string {
-	imagesPerBucket := make(map[string][]string, len(c.buckets))
+	buckets := c.bucketCaches()
+	imagesPerBucket := make(map[string][]string, len(buckets))
 
-	for _, bucket := range c.buckets {
+	for _, bucket := range buckets {
 		bucket.l.RLock()
 
 		imagesPerBucket[bucket.bucket] = make([]string, 0, len(bucket.images))
@@ -242,20 +614,293 @@ func (c *cache) DumpImages() map[string][]string {
 	return imagesPerBucket
 }
 
+func (c *cache) SlowEvaluations(limit int) []types.ExprEvaluation {
+	return c.exprManager.evaluations.slowest(limit)
+}
+
+func (c *cache) DynamicFilterDomains(ctx context.Context, imgGroup, imgType string) []types.DynamicFilterDomain {
+	var imagesValues []map[string]any
+
+	for _, bucket := range c.bucketCaches() {
+		bucket.l.RLock()
+
+		for _, img := range bucket.images {
+			if (imgGroup != "" && img.imgGroup != imgGroup) || (imgType != "" && img.imgType != imgType) {
+				continue
+			}
+
+			// The errors are already reported along with the image summary.
+			values, _ := c.exprManager.dynamicFilters(ctx, img, nil)
+
+			imagesValues = append(imagesValues, values)
+		}
+
+		bucket.l.RUnlock()
+	}
+
+	return filterDomains(c.exprManager.scopedFilterDefs(imgGroup, imgType), imagesValues)
+}
+
+// Search returns the images whose place names or product information match the given query, from the most relevant.
+func (c *cache) Search(query string, limit int) []types.SearchResult {
+	results := make([]types.SearchResult, 0)
+
+	for _, result := range c.searchIndex.Search(query, 0) {
+		// The images dropped when they expire are removed from the index as they are found.
+		if !c.imageExists(result.Key.Bucket, result.Key.Name) {
+			c.searchIndex.Remove(result.Key)
+
+			continue
+		}
+
+		results = append(results, types.SearchResult{Bucket: result.Key.Bucket, Key: result.Key.Name, Score: result.Score})
+
+		if limit > 0 && len(results) == limit {
+			break
+		}
+	}
+
+	return results
+}
+
+func (c *cache) imageExists(bucketName, name string) bool {
+	bucket, ok := c.bucket(bucketName)
+	if !ok {
+		return false
+	}
+
+	bucket.l.RLock()
+	defer bucket.l.RUnlock()
+
+	_, found := bucket.images[name]
+
+	return found
+}
+
+// FootprintClusters returns the clusters of the footprints whose center is in the given bounding box,
+// at the given zoom level. Empty group or type match all of them.
+func (c *cache) FootprintClusters(bbox [4]float64, zoom int, group, typ string) []types.FootprintCluster {
+	clusters := c.footprints.Clusters(bbox, zoom, func(key search.Key, footprint search.Footprint) bool {
+		if (group != "" && footprint.Group != group) || (typ != "" && footprint.Type != typ) {
+			return false
+		}
+
+		// The images dropped when they expire are removed from the index as they are found.
+		if !c.imageExists(key.Bucket, key.Name) {
+			c.footprints.Remove(key)
+
+			return false
+		}
+
+		return true
+	})
+
+	results := make([]types.FootprintCluster, 0, len(clusters))
+
+	for _, cluster := range clusters {
+		result := types.FootprintCluster{
+			Lon:    cluster.Lon,
+			Lat:    cluster.Lat,
+			Count:  cluster.Count,
+			BBox:   cluster.BBox[:],
+			Counts: cluster.Counts,
+		}
+
+		if cluster.Key != nil {
+			result.Image = &types.ClusterImage{Bucket: cluster.Key.Bucket, Key: cluster.Key.Name, Footprint: cluster.Footprint.Geometry}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// reindex rebuilds the search and footprint indexes from a snapshot of the cached images,
+// their expressions being evaluated without holding the locks of the buckets.
+// The images indexed meanwhile are indexed again once the indexes are replaced,
+// and the rebuild is dropped if a newer one started.
+func (c *cache) reindex(ctx context.Context) {
+	c.reindexL.Lock()
+	c.reindexGen++
+	gen := c.reindexGen
+	c.reindexDirty = make(map[search.Key]bool)
+	c.reindexL.Unlock()
+
+	type imageSnapshot struct {
+		key      search.Key
+		img      image
+		envFiles envFilesPrecomputed
+	}
+
+	var snapshots []imageSnapshot
+
+	for _, bucket := range c.bucketCaches() {
+		bucket.l.RLock()
+
+		for name, img := range bucket.images {
+			snapshots = append(snapshots, imageSnapshot{
+				key:      search.Key{Bucket: bucket.bucket, Name: name},
+				img:      img,
+				envFiles: c.exprManager.precomputeDynamicFiles(img),
+			})
+		}
+
+		bucket.l.RUnlock()
+	}
+
+	docs := make(map[search.Key]search.Document, len(snapshots))
+	footprints := make(map[search.Key]search.Footprint)
+
+	for _, snapshot := range snapshots {
+		docs[snapshot.key] = snapshot.img.searchDocument(ctx, c.exprManager, &snapshot.envFiles)
+
+		if footprint, ok := snapshot.img.footprint(ctx, c.exprManager, &snapshot.envFiles); ok {
+			footprints[snapshot.key] = footprint
+		}
+	}
+
+	c.reindexL.Lock()
+
+	if gen != c.reindexGen {
+		c.reindexL.Unlock()
+
+		return
+	}
+
+	dirty := c.reindexDirty
+	c.reindexDirty = nil
+
+	c.searchIndex.Replace(docs)
+	c.footprints.Replace(footprints)
+	c.reindexL.Unlock()
+
+	for key := range dirty {
+		bucket, ok := c.bucket(key.Bucket)
+		if !ok {
+			c.searchIndex.Remove(key)
+			c.footprints.Remove(key)
+
+			continue
+		}
+
+		c.indexImage(ctx, bucket, key.Name)
+	}
+}
+
+// indexImage updates the search document and the footprint of the given image,
+// or removes them if the image isn't cached anymore.
+// The image is read under the lock of the bucket, which the caller must not hold, and evaluated without it.
+func (c *cache) indexImage(ctx context.Context, bucket *bucketCache, name string) {
+	bucket.l.RLock()
+	indexing := c.snapshotIndexing(bucket, name)
+	bucket.l.RUnlock()
+
+	c.applyIndexing(ctx, indexing)
+}
+
+// snapshotIndexing takes the snapshot of the given image to index it. The caller must hold the lock of the bucket.
+func (c *cache) snapshotIndexing(bucket *bucketCache, name string) imageIndexing {
+	indexing := imageIndexing{key: search.Key{Bucket: bucket.bucket, Name: name}}
+
+	c.markIndexed(indexing.key)
+
+	c.reindexL.Lock()
+	c.indexSeq++
+	indexing.seq = c.indexSeq
+
+	if c.indexPending == nil {
+		c.indexPending = make(map[search.Key]uint64)
+	}
+
+	c.indexPending[indexing.key] = indexing.seq
+	c.reindexL.Unlock()
+
+	indexing.img, indexing.found = bucket.images[name]
+	if indexing.found {
+		indexing.envFiles = c.exprManager.precomputeDynamicFiles(indexing.img)
+	}
+
+	return indexing
+}
+
+// applyIndexing evaluates the snapshot of an image and updates the indexes with it,
+// unless a newer snapshot of the image has been taken meanwhile.
+func (c *cache) applyIndexing(ctx context.Context, indexing imageIndexing) {
+	var (
+		doc          search.Document
+		footprint    search.Footprint
+		hasFootprint bool
+	)
+
+	if indexing.found {
+		doc = indexing.img.searchDocument(ctx, c.exprManager, &indexing.envFiles)
+		footprint, hasFootprint = indexing.img.footprint(ctx, c.exprManager, &indexing.envFiles)
+	}
+
+	c.reindexL.Lock()
+	defer c.reindexL.Unlock()
+
+	if c.indexPending[indexing.key] != indexing.seq {
+		return
+	}
+
+	delete(c.indexPending, indexing.key)
+
+	if !indexing.found {
+		c.searchIndex.Remove(indexing.key)
+		c.footprints.Remove(indexing.key)
+
+		return
+	}
+
+	c.searchIndex.Update(indexing.key, doc)
+
+	if hasFootprint {
+		c.footprints.Update(indexing.key, footprint)
+	} else {
+		c.footprints.Remove(indexing.key)
+	}
+}
+
+// markIndexed records the given image as indexed, for the rebuild of the indexes running meanwhile, if any.
+func (c *cache) markIndexed(key search.Key) {
+	c.reindexL.Lock()
+	defer c.reindexL.Unlock()
+
+	if c.reindexDirty != nil {
+		c.reindexDirty[key] = true
+	}
+}
+
 func (c *cache) handleEvent(ctx context.Context, event s3Event) {
-	bucket, ok := c.buckets[event.Bucket]
+	bucket, ok := c.bucket(event.Bucket)
 	if !ok {
 		return
 	}
 
 	c.gatherer.S3EventsCounter.WithLabelValues(event.Bucket).Inc()
 
+	outEvent, indexing := c.applyEvent(ctx, bucket, event)
+	if outEvent == nil {
+		return
+	}
+
+	// The expressions of the image are evaluated for the indexes without holding the lock of the bucket.
+	c.applyIndexing(ctx, indexing)
+
+	c.outEvents <- *outEvent
+}
+
+// applyEvent updates the given bucket with the given event, under its lock.
+// It returns the event to send if the image changed, with the snapshot to index it.
+func (c *cache) applyEvent(ctx context.Context, bucket *bucketCache, event s3Event) (*types.OutEvent, imageIndexing) {
 	bucket.l.Lock()
 	defer bucket.l.Unlock()
 
 	img, ok := bucket.images[event.baseDir]
 	if !ok && event.EventType == types.EventRemoved {
-		return
+		return nil, imageIndexing{}
 	}
 
 	var outEvent *types.OutEvent
@@ -269,13 +914,15 @@ func (c *cache) handleEvent(ctx context.Context, event s3Event) {
 		logger.Warnf("Unknown s3 event %q was handed to cache", event.EventType)
 	}
 
-	if outEvent != nil {
-		c.outEvents <- *outEvent
+	if outEvent == nil {
+		return nil, imageIndexing{}
 	}
+
+	return outEvent, c.snapshotIndexing(bucket, event.baseDir)
 }
 
 func (c *cache) matchesEntry(bucketName string, entry string) (match bool, baseDir string) {
-	bucket, ok := c.buckets[bucketName]
+	bucket, ok := c.bucket(bucketName)
 	if !ok {
 		return false, ""
 	}
@@ -293,9 +940,14 @@ func (c *cache) matchesEntry(bucketName string, entry string) (match bool, baseD
 }
 
 func (c *cache) updateMetrics(ctx context.Context, bucket string) {
+	bc, ok := c.bucket(bucket)
+	if !ok {
+		return
+	}
+
 	t0 := time.Now()
 
-	c.buckets[bucket].updateMetrics(ctx, c.gatherer)
+	bc.updateMetrics(ctx, c.gatherer)
 
 	logger.Debugf("Updating metrics for bucket %q took %v", bucket, time.Since(t0))
 }
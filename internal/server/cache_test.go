@@ -0,0 +1,362 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	goimage "image"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/search"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+	"github.com/Maxi-Mega/s3-image-server-v2/utils"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestCacheSearch(t *testing.T) {
+	t.Parallel()
+
+	dynamicData := config.DynamicData{
+		Expressions: map[string]string{
+			types.ExprGeonames: `[{"name": "France", "states": [{"name": "Occitanie", "counties": [{
+				"name": "Haute-Garonne",
+				"cities": [{"name": Files.preview.S3Path contains "tls" ? "Toulouse" : "Muret"}],
+				"villages": [{"name": "Villemur-sur-Tarn"}]
+			}]}]}]`,
+			types.ExprProductInfo: `{"title": "Acquisition over " + (Files.preview.S3Path contains "tls" ? "Tolosa" : "Garonne")}`,
+		},
+	}
+	exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+
+	bucket := newBucketCache(nil, exprMan, "bkt", t.TempDir(), config.Config{})
+	for _, name := range []string{"tls-1", "tls-2", "muret-1"} {
+		bucket.images[name] = image{name: name, baseDir: name, bucket: "bkt", s3Key: name + "/preview.jpg", imgGroup: imgGroup, imgType: imgType}
+	}
+
+	c := &cache{
+		buckets:     map[string]*bucketCache{"bkt": bucket},
+		exprManager: exprMan,
+		searchIndex: search.NewIndex(),
+		footprints:  search.NewFootprintIndex(),
+	}
+
+	c.reindex(t.Context())
+
+	if diff := cmp.Diff([]types.SearchResult{
+		{Bucket: "bkt", Key: "tls-1", Score: 2},
+		{Bucket: "bkt", Key: "tls-2", Score: 2},
+	}, c.Search("toulouse", 0)); diff != "" {
+		t.Errorf("Unexpected results (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]types.SearchResult{
+		{Bucket: "bkt", Key: "muret-1", Score: 1.5},
+	}, c.Search("acquisition muret", 0)); diff != "" {
+		t.Errorf("Unexpected results (-want +got):\n%s", diff)
+	}
+
+	// Images dropped from the cache are removed from the index, and the others are updated along with them.
+	delete(bucket.images, "tls-1")
+
+	bucket.images["muret-1"] = image{name: "muret-1", baseDir: "muret-1", bucket: "bkt", s3Key: "tls-3/preview.jpg", imgGroup: imgGroup, imgType: imgType}
+	c.indexImage(t.Context(), bucket, "muret-1")
+
+	if diff := cmp.Diff([]types.SearchResult{
+		{Bucket: "bkt", Key: "muret-1", Score: 2},
+		{Bucket: "bkt", Key: "tls-2", Score: 2},
+	}, c.Search("villemur toulouse", 0)); diff != "" {
+		t.Errorf("Unexpected results (-want +got):\n%s", diff)
+	}
+
+	if results := c.Search("toulouse", 1); len(results) != 1 {
+		t.Errorf("Expected a single result, got %v", results)
+	}
+
+	if c.searchIndex.Len() != 2 {
+		t.Errorf("Expected the dropped image to be removed from the index, %d images indexed", c.searchIndex.Len())
+	}
+
+	// A snapshot evaluated after a newer one of the same image is dropped.
+	stale := c.snapshotIndexing(bucket, "tls-2")
+
+	bucket.images["tls-2"] = image{name: "tls-2", baseDir: "tls-2", bucket: "bkt", s3Key: "muret-2/preview.jpg", imgGroup: imgGroup, imgType: imgType}
+	c.applyIndexing(t.Context(), c.snapshotIndexing(bucket, "tls-2"))
+	c.applyIndexing(t.Context(), stale)
+
+	if results := c.Search("tolosa", 0); len(results) != 1 || results[0].Key != "muret-1" {
+		t.Errorf("Expected the stale snapshot to be dropped, got %v", results)
+	}
+}
+
+func TestCacheFootprintClusters(t *testing.T) {
+	t.Parallel()
+
+	dynamicData := config.DynamicData{
+		Expressions: map[string]string{
+			types.ExprLocalization: `Files.preview.S3Path contains "none" ? nil : {"geometry": {"type": "Polygon", "coordinates": [
+				Files.preview.S3Path contains "tls"
+					? [[1.4, 43.6], [1.5, 43.6], [1.5, 43.5], [1.4, 43.5], [1.4, 43.6]]
+					: [[4.8, 45.8], [4.9, 45.8], [4.9, 45.7], [4.8, 45.7], [4.8, 45.8]]
+			]}}`,
+		},
+	}
+	exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+
+	bucket := newBucketCache(nil, exprMan, "bkt", t.TempDir(), config.Config{})
+	for _, name := range []string{"tls-1", "tls-2", "lyon-1", "none-1"} {
+		bucket.images[name] = image{name: name, baseDir: name, bucket: "bkt", s3Key: name + "/preview.jpg", imgGroup: imgGroup, imgType: imgType}
+	}
+
+	c := &cache{
+		buckets:     map[string]*bucketCache{"bkt": bucket},
+		exprManager: exprMan,
+		searchIndex: search.NewIndex(),
+		footprints:  search.NewFootprintIndex(),
+	}
+
+	c.reindex(t.Context())
+
+	lyon := &types.ClusterImage{
+		Bucket: "bkt",
+		Key:    "lyon-1",
+		Footprint: types.Geometry{
+			Type:     types.GeometryPolygon,
+			Polygons: [][][][2]float64{{{{4.8, 45.8}, {4.9, 45.8}, {4.9, 45.7}, {4.8, 45.7}, {4.8, 45.8}}}},
+		},
+	}
+	approx := cmpopts.EquateApprox(0, 1e-9)
+
+	if diff := cmp.Diff([]types.FootprintCluster{
+		{
+			Lon: 1.45, Lat: 43.55, Count: 2,
+			BBox:   []float64{1.4, 43.5, 1.5, 43.6},
+			Counts: []types.ClusterCount{{Group: imgGroup, Type: imgType, Count: 2}},
+		},
+		{
+			Lon: 4.85, Lat: 45.75, Count: 1,
+			BBox:   []float64{4.8, 45.7, 4.9, 45.8},
+			Counts: []types.ClusterCount{{Group: imgGroup, Type: imgType, Count: 1}},
+			Image:  lyon,
+		},
+	}, c.FootprintClusters([4]float64{-10, 40, 10, 50}, 6, "", ""), approx); diff != "" {
+		t.Errorf("Unexpected clusters (-want +got):\n%s", diff)
+	}
+
+	if clusters := c.FootprintClusters([4]float64{-10, 40, 10, 50}, 6, "other", ""); len(clusters) != 0 {
+		t.Errorf("Expected no clusters for another group, got %v", clusters)
+	}
+
+	// Images dropped from the cache are removed from the index.
+	delete(bucket.images, "lyon-1")
+
+	if clusters := c.FootprintClusters([4]float64{-10, 40, 10, 50}, 6, imgGroup, imgType); len(clusters) != 1 {
+		t.Errorf("Expected a single cluster, got %v", clusters)
+	}
+
+	if c.footprints.Len() != 2 {
+		t.Errorf("Expected the dropped image to be removed from the index, %d footprints indexed", c.footprints.Len())
+	}
+}
+
+func TestCacheGetDeepZoomObject(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	imgDir := filepath.Join(cacheDir, "bkt", "img")
+
+	if err := os.MkdirAll(imgDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"preview.png", "target.png"} {
+		f, err := os.Create(filepath.Join(imgDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = png.Encode(f, goimage.NewGray(goimage.Rect(0, 0, 600, 300)))
+		_ = f.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dynamicData := config.DynamicData{}
+	exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+
+	bucket := newBucketCache(nil, exprMan, "bkt", filepath.Join(cacheDir, "bkt"), config.Config{})
+	bucket.images["img"] = image{name: "img", baseDir: "img", bucket: "bkt", previewCacheKey: "bkt/img/preview.png", imgGroup: imgGroup, imgType: imgType}
+
+	newCache := func(minSize int) *cache {
+		return &cache{
+			cacheCfg: config.Cache{CacheDir: cacheDir, DeepZoom: config.DeepZoom{MinSize: minSize, TileSize: 256}},
+			buckets:  map[string]*bucketCache{"bkt": bucket},
+		}
+	}
+	c := newCache(600)
+
+	if manifest := bucket.images["img"].summary(t.Context(), "img", c.cacheCfg, exprMan).DeepZoomManifest; manifest != "bkt/img/preview.png.dzi" {
+		t.Errorf("Unexpected manifest path %q", manifest)
+	}
+
+	// The previews smaller than the min size aren't tiled.
+	for _, minSize := range []int{0, 601} {
+		if _, err := newCache(minSize).GetDeepZoomObject("bkt/img/preview.png.dzi"); !errors.Is(err, types.ErrNotDeepZoomed) {
+			t.Errorf("Min size %d: want %v, got %v", minSize, types.ErrNotDeepZoomed, err)
+		}
+	}
+
+	manifest, err := c.GetDeepZoomObject("bkt/img/preview.png.dzi")
+	if err != nil {
+		t.Fatal("Failed to get the manifest:", err)
+	}
+
+	if !strings.Contains(string(manifest), `<Size Width="600" Height="300"></Size>`) {
+		t.Errorf("Unexpected manifest:\n%s", manifest)
+	}
+
+	tile, err := c.GetDeepZoomObject("bkt/img/preview.png_files/10/2_1.png")
+	if err != nil {
+		t.Fatal("Failed to get a tile:", err)
+	}
+
+	if cfg, err := png.DecodeConfig(bytes.NewReader(tile)); err != nil || cfg.Width != 88 || cfg.Height != 44 {
+		t.Errorf("Unexpected tile: %+v, %v", cfg, err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		path        string
+		expectedErr error
+	}{
+		{name: "not a preview", path: "bkt/img/target.png.dzi", expectedErr: types.ErrNotDeepZoomed},
+		{name: "not a pyramid", path: "bkt/img/preview.png", expectedErr: types.ErrNotDeepZoomed},
+		{name: "missing tile", path: "bkt/img/preview.png_files/10/3_0.png", expectedErr: fs.ErrNotExist},
+		{name: "missing preview", path: "bkt/other/preview.png.dzi", expectedErr: fs.ErrNotExist},
+	} {
+		if _, err = c.GetDeepZoomObject(tc.path); !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s: want %v, got %v", tc.name, tc.expectedErr, err)
+		}
+	}
+}
+
+func TestCacheCropImage(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+
+	for _, name := range []string{"geo", "plain"} {
+		if err := os.MkdirAll(filepath.Join(cacheDir, "bkt", name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Create(filepath.Join(cacheDir, "bkt", name, "preview.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = png.Encode(f, goimage.NewGray(goimage.Rect(0, 0, 200, 100)))
+		_ = f.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dynamicData := config.DynamicData{
+		Expressions: map[string]string{
+			types.ExprLocalization: `Files.preview.S3Path contains "plain" ? nil : {"corner": {
+				"upper-left": {"coordinates": {"lon": 2, "lat": 49}},
+				"upper-right": {"coordinates": {"lon": 4, "lat": 49}},
+				"lower-right": {"coordinates": {"lon": 4, "lat": 48}},
+				"lower-left": {"coordinates": {"lon": 2, "lat": 48}}
+			}}`,
+		},
+	}
+	exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+
+	bucket := newBucketCache(nil, exprMan, "bkt", filepath.Join(cacheDir, "bkt"), config.Config{})
+	for _, name := range []string{"geo", "plain"} {
+		bucket.images[name] = image{
+			name: name, baseDir: name, bucket: "bkt", s3Key: name + "/preview.png",
+			previewCacheKey: "bkt/" + name + "/preview.png", imgGroup: imgGroup, imgType: imgType,
+		}
+	}
+
+	newCache := func(maxPixels int) *cache {
+		return &cache{
+			cacheCfg:    config.Cache{CacheDir: cacheDir, MaxDecodedPixels: maxPixels},
+			buckets:     map[string]*bucketCache{"bkt": bucket},
+			exprManager: exprMan,
+		}
+	}
+
+	cases := []struct {
+		name         string
+		cacheKey     string
+		req          types.CropRequest
+		maxPixels    int
+		expectedSize goimage.Point
+		expectedErr  error
+	}{
+		{name: "window", cacheKey: "bkt/plain/preview.png", req: types.CropRequest{Window: goimage.Rect(10, 10, 60, 30)}, expectedSize: goimage.Pt(50, 20)},
+		{name: "bbox", cacheKey: "bkt/geo/preview.png", req: types.CropRequest{BBox: &[4]float64{3.5, 47, 5, 48.5}}, expectedSize: goimage.Pt(50, 50)},
+		{
+			name:         "resized bbox",
+			cacheKey:     "bkt/geo/preview.png",
+			req:          types.CropRequest{BBox: &[4]float64{2, 48, 4, 49}, MaxSize: 100},
+			expectedSize: goimage.Pt(100, 50),
+		},
+		{name: "bbox outside", cacheKey: "bkt/geo/preview.png", req: types.CropRequest{BBox: &[4]float64{5, 48, 6, 49}}, expectedErr: types.ErrInvalidCrop},
+		{name: "no localization", cacheKey: "bkt/plain/preview.png", req: types.CropRequest{BBox: &[4]float64{2, 48, 4, 49}}, expectedErr: types.ErrInvalidCrop},
+		{name: "bbox of a non-preview", cacheKey: "bkt/geo/target.png", req: types.CropRequest{BBox: &[4]float64{2, 48, 4, 49}}, expectedErr: types.ErrImageNotFound},
+		{name: "window of a non-preview", cacheKey: "bkt/geo/target.png", req: types.CropRequest{Window: goimage.Rect(0, 0, 10, 10)}, expectedErr: types.ErrImageNotFound},
+		{name: "unknown bucket", cacheKey: "other/geo/preview.png", req: types.CropRequest{Window: goimage.Rect(0, 0, 10, 10)}, expectedErr: types.ErrImageNotFound},
+		{
+			name:         "under the pixel limit",
+			cacheKey:     "bkt/plain/preview.png",
+			req:          types.CropRequest{Window: goimage.Rect(0, 0, 10, 10)},
+			maxPixels:    20_000,
+			expectedSize: goimage.Pt(10, 10),
+		},
+		{
+			name:        "over the pixel limit",
+			cacheKey:    "bkt/plain/preview.png",
+			req:         types.CropRequest{Window: goimage.Rect(0, 0, 10, 10)},
+			maxPixels:   19_999,
+			expectedErr: utils.ErrImageTooLarge,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := newCache(tc.maxPixels).CropImage(t.Context(), tc.cacheKey, tc.req)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			cfg, err := png.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal("Failed to decode the crop:", err)
+			}
+
+			if size := goimage.Pt(cfg.Width, cfg.Height); size != tc.expectedSize {
+				t.Errorf("Expected size %v, got %v", tc.expectedSize, size)
+			}
+		})
+	}
+}
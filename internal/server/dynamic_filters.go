@@ -0,0 +1,194 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+)
+
+var (
+	errUnexpectedFilterValue = errors.New("unexpected filter value")
+	errConvertedFilterValue  = errors.New("converted filter value")
+)
+
+// zonelessDateLayouts are the layouts of the dates without time zone accepted for the date filters, taken as UTC.
+var zonelessDateLayouts = []string{"2006-01-02T15:04:05.999999999", time.DateTime, time.DateOnly} //nolint: gochecknoglobals
+
+// filterValue converts the output of the expression of the given filter to the type of the filter.
+// A nil output means the image has no value for the filter, except for the string filters.
+// The outputs of the string filters which are not strings are converted, with an errConvertedFilterValue error.
+func filterValue(filter config.DynamicFilter, output any) (any, error) {
+	if output == nil && filter.Type != config.DynamicFilterTypeString {
+		return nil, nil //nolint: nilnil
+	}
+
+	switch filter.Type {
+	case config.DynamicFilterTypeEnum:
+		value, ok := output.(string)
+		if !ok || !slices.Contains(filter.Values, value) {
+			return nil, fmt.Errorf("%w %v, expected one of %q", errUnexpectedFilterValue, output, filter.Values)
+		}
+
+		return value, nil
+	case config.DynamicFilterTypeNumber:
+		return numberValue(output)
+	case config.DynamicFilterTypeDate:
+		return dateValue(output)
+	case config.DynamicFilterTypeBoolean:
+		value, ok := output.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w %v, expected a boolean", errUnexpectedFilterValue, output)
+		}
+
+		return value, nil
+	}
+
+	value, ok := output.(string)
+	if !ok {
+		value = fmt.Sprint(output)
+
+		return value, fmt.Errorf("%w: expected a string, got %T converted to %q", errConvertedFilterValue, output, value)
+	}
+
+	return value, nil
+}
+
+func numberValue(output any) (float64, error) {
+	value := reflect.ValueOf(output)
+
+	switch value.Kind() { //nolint: exhaustive
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), nil
+	case reflect.String:
+		number, err := strconv.ParseFloat(value.String(), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w %q, expected a number", errUnexpectedFilterValue, value.String())
+		}
+
+		return number, nil
+	default:
+		return 0, fmt.Errorf("%w %v, expected a number", errUnexpectedFilterValue, output)
+	}
+}
+
+func dateValue(output any) (time.Time, error) {
+	switch value := output.(type) {
+	case time.Time:
+		return value, nil
+	case string:
+		if date, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return date, nil
+		}
+
+		for _, layout := range zonelessDateLayouts {
+			if date, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+				return date, nil
+			}
+		}
+
+		return time.Time{}, fmt.Errorf("%w %q, expected an RFC 3339 date, or a date and time without time zone", errUnexpectedFilterValue, value)
+	default:
+		return time.Time{}, fmt.Errorf("%w %v, expected a date", errUnexpectedFilterValue, output)
+	}
+}
+
+// filterDomains computes the domains of the given filters from their values for each image.
+func filterDomains(filters []config.DynamicFilter, imagesValues []map[string]any) []types.DynamicFilterDomain {
+	domains := make([]types.DynamicFilterDomain, len(filters))
+
+	for i, filter := range filters {
+		domain := types.DynamicFilterDomain{
+			Name:   filter.Name,
+			Type:   filter.Type,
+			UIHint: filter.UIHint,
+			Values: make([]any, 0),
+		}
+		distinct := make(map[any]bool)
+		bounded := filter.Type == config.DynamicFilterTypeNumber || filter.Type == config.DynamicFilterTypeDate
+
+		for _, values := range imagesValues {
+			// The images of another type may have a filter with the same name but a different type.
+			value, found := values[filter.Name]
+			if !found || !hasFilterType(filter, value) {
+				continue
+			}
+
+			domain.Count++
+			distinct[value] = true
+
+			if !bounded {
+				continue
+			}
+
+			if domain.Min == nil || compareFilterValues(value, domain.Min) < 0 {
+				domain.Min = value
+			}
+
+			if domain.Max == nil || compareFilterValues(value, domain.Max) > 0 {
+				domain.Max = value
+			}
+		}
+
+		switch {
+		case filter.Type == config.DynamicFilterTypeEnum:
+			for _, value := range filter.Values {
+				domain.Values = append(domain.Values, value)
+			}
+		case filter.UIHint == config.DynamicFilterUIHintDropdown:
+			domain.Values = slices.SortedFunc(maps.Keys(distinct), compareFilterValues)
+		}
+
+		domains[i] = domain
+	}
+
+	return domains
+}
+
+// hasFilterType reports whether the given value, returned by filterValue, is one of a filter of the given type.
+func hasFilterType(filter config.DynamicFilter, value any) bool {
+	switch value.(type) {
+	case float64:
+		return filter.Type == config.DynamicFilterTypeNumber
+	case time.Time:
+		return filter.Type == config.DynamicFilterTypeDate
+	case bool:
+		return filter.Type == config.DynamicFilterTypeBoolean
+	case string:
+		return filter.Type == config.DynamicFilterTypeString || filter.Type == config.DynamicFilterTypeEnum
+	default:
+		return false
+	}
+}
+
+// compareFilterValues compares two values of the same filter.
+// The values of different types, which shouldn't be compared, are ordered by type.
+func compareFilterValues(a, b any) int {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			return cmp.Compare(a, b)
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b)
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			return cmp.Compare(strconv.FormatBool(a), strconv.FormatBool(b))
+		}
+	}
+
+	return cmp.Or(cmp.Compare(fmt.Sprintf("%T", a), fmt.Sprintf("%T", b)), cmp.Compare(fmt.Sprint(a), fmt.Sprint(b)))
+}
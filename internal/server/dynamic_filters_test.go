@@ -0,0 +1,174 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterValue(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2026, 6, 7, 0, 0, 0, 0, time.UTC)
+	enum := config.DynamicFilter{Type: config.DynamicFilterTypeEnum, Values: []string{"low", "high"}}
+
+	cases := []struct {
+		name          string
+		filter        config.DynamicFilter
+		output        any
+		expectedValue any
+		expectedError error
+	}{
+		{"string", config.DynamicFilter{Type: config.DynamicFilterTypeString}, "a", "a", nil},
+		{"string from number", config.DynamicFilter{Type: config.DynamicFilterTypeString}, 42, "42", errConvertedFilterValue},
+		{"enum", enum, "low", "low", nil},
+		{"unknown enum value", enum, "medium", nil, errUnexpectedFilterValue},
+		{"number from int", config.DynamicFilter{Type: config.DynamicFilterTypeNumber}, 12, 12.0, nil},
+		{"number from float", config.DynamicFilter{Type: config.DynamicFilterTypeNumber}, 12.5, 12.5, nil},
+		{"number from string", config.DynamicFilter{Type: config.DynamicFilterTypeNumber}, "0.25", 0.25, nil},
+		{"invalid number", config.DynamicFilter{Type: config.DynamicFilterTypeNumber}, "a lot", nil, errUnexpectedFilterValue},
+		{"date", config.DynamicFilter{Type: config.DynamicFilterTypeDate}, date, date, nil},
+		{"date from RFC 3339 string", config.DynamicFilter{Type: config.DynamicFilterTypeDate}, "2026-06-07T00:00:00Z", date, nil},
+		{"date from date string", config.DynamicFilter{Type: config.DynamicFilterTypeDate}, "2026-06-07", date, nil},
+		{"date from zoneless ISO 8601 string", config.DynamicFilter{Type: config.DynamicFilterTypeDate}, "2026-06-07T10:30:00", date.Add(10*time.Hour + 30*time.Minute), nil},
+		{"date from zoneless date time string", config.DynamicFilter{Type: config.DynamicFilterTypeDate}, "2026-06-07 10:30:00", date.Add(10*time.Hour + 30*time.Minute), nil},
+		{"invalid date", config.DynamicFilter{Type: config.DynamicFilterTypeDate}, "yesterday", nil, errUnexpectedFilterValue},
+		{"boolean", config.DynamicFilter{Type: config.DynamicFilterTypeBoolean}, false, false, nil},
+		{"invalid boolean", config.DynamicFilter{Type: config.DynamicFilterTypeBoolean}, "yes", nil, errUnexpectedFilterValue},
+		{"missing value", config.DynamicFilter{Type: config.DynamicFilterTypeNumber}, nil, nil, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			value, err := filterValue(tc.filter, tc.output)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedError, err)
+			}
+
+			if (err == nil || errors.Is(err, errConvertedFilterValue)) && !cmp.Equal(tc.expectedValue, value) {
+				t.Fatalf("Expected value %v (%T), got %v (%T)", tc.expectedValue, tc.expectedValue, value, value)
+			}
+		})
+	}
+}
+
+func TestFilterDomains(t *testing.T) {
+	t.Parallel()
+
+	early := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	filters := []config.DynamicFilter{
+		{Name: "satellite", Type: config.DynamicFilterTypeString, UIHint: config.DynamicFilterUIHintDropdown},
+		{Name: "quality", Type: config.DynamicFilterTypeEnum, UIHint: config.DynamicFilterUIHintDropdown, Values: []string{"low", "high"}},
+		{Name: "cloudCover", Type: config.DynamicFilterTypeNumber, UIHint: config.DynamicFilterUIHintRange},
+		{Name: "acquisition", Type: config.DynamicFilterTypeDate, UIHint: config.DynamicFilterUIHintDateRange},
+		{Name: "night", Type: config.DynamicFilterTypeBoolean, UIHint: config.DynamicFilterUIHintDropdown},
+	}
+	imagesValues := []map[string]any{
+		{"satellite": "S2", "quality": "high", "cloudCover": 12.5, "acquisition": late, "night": false},
+		{"satellite": "L8", "quality": "high", "cloudCover": 80.0, "acquisition": early, "night": nil},
+		{"satellite": "S2", "cloudCover": 3.0},
+	}
+
+	expected := []types.DynamicFilterDomain{
+		{Name: "satellite", Type: "string", UIHint: "dropdown", Values: []any{"L8", "S2"}, Count: 3},
+		{Name: "quality", Type: "enum", UIHint: "dropdown", Values: []any{"low", "high"}, Count: 2},
+		{Name: "cloudCover", Type: "number", UIHint: "range", Values: []any{}, Min: 3.0, Max: 80.0, Count: 3},
+		{Name: "acquisition", Type: "date", UIHint: "dateRange", Values: []any{}, Min: early, Max: late, Count: 2},
+		{Name: "night", Type: "boolean", UIHint: "dropdown", Values: []any{false}, Count: 1},
+	}
+
+	if diff := cmp.Diff(expected, filterDomains(filters, imagesValues)); diff != "" {
+		t.Fatalf("Unexpected domains (-want +got):\n%s", diff)
+	}
+
+	// Two types may declare filters with the same name but a different type, whose values must be kept apart.
+	sizes := []config.DynamicFilter{
+		{Name: "size", Type: config.DynamicFilterTypeNumber, UIHint: config.DynamicFilterUIHintRange},
+		{Name: "size", Type: config.DynamicFilterTypeString, UIHint: config.DynamicFilterUIHintDropdown},
+	}
+	expected = []types.DynamicFilterDomain{
+		{Name: "size", Type: "number", UIHint: "range", Values: []any{}, Min: 3.0, Max: 12.0, Count: 2},
+		{Name: "size", Type: "string", UIHint: "dropdown", Values: []any{"big"}, Count: 1},
+	}
+
+	if diff := cmp.Diff(expected, filterDomains(sizes, []map[string]any{{"size": "big"}, {"size": 12.0}, {"size": 3.0}})); diff != "" {
+		t.Fatalf("Unexpected domains of same-name filters (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompareFilterValues(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		a, b     any
+		expected int
+	}{
+		{a: 1.0, b: 2.0, expected: -1},
+		{a: "b", b: "a", expected: 1},
+		{a: true, b: false, expected: 1},
+		{a: "big", b: 3.0, expected: 1},
+		{a: 3.0, b: "big", expected: -1},
+	}
+
+	for _, tc := range cases {
+		if result := compareFilterValues(tc.a, tc.b); result != tc.expected {
+			t.Errorf("compareFilterValues(%v, %v): want %d, got %d", tc.a, tc.b, tc.expected, result)
+		}
+	}
+}
+
+func TestScopedFilterDefs(t *testing.T) {
+	t.Parallel()
+
+	title := config.DynamicFilter{Name: "Title", Expression: "title"}
+	cloudCover := config.DynamicFilter{Name: "Cloud cover", Expression: "cloudCover", Type: config.DynamicFilterTypeNumber}
+	satellite := config.DynamicFilter{Name: "Satellite", Expression: "satellite"}
+	satelliteCount := config.DynamicFilter{Name: "Satellite", Expression: "satellites", Type: config.DynamicFilterTypeNumber}
+
+	exprMan := newExpressionManager(config.Config{
+		Products: config.Products{
+			ImageGroups: []config.ImageGroup{
+				{
+					GroupName: "g1",
+					Types: []config.ImageType{
+						{Name: "a", DynamicFilters: []config.DynamicFilter{title, cloudCover}},
+						{Name: "b", DynamicFilters: []config.DynamicFilter{title}},
+					},
+				},
+				{
+					GroupName: "g2",
+					Types: []config.ImageType{
+						{Name: "a", DynamicFilters: []config.DynamicFilter{satellite}},
+						{Name: "b", DynamicFilters: []config.DynamicFilter{satelliteCount}},
+					},
+				},
+			},
+		},
+	})
+
+	cases := []struct {
+		group, typ string
+		expected   []config.DynamicFilter
+	}{
+		{"", "", []config.DynamicFilter{title, cloudCover, satellite, satelliteCount}},
+		{"g1", "", []config.DynamicFilter{title, cloudCover}},
+		{"g1", "b", []config.DynamicFilter{title}},
+		{"", "a", []config.DynamicFilter{title, cloudCover, satellite}},
+		{"g3", "", nil},
+	}
+
+	for _, tc := range cases {
+		if diff := cmp.Diff(tc.expected, exprMan.scopedFilterDefs(tc.group, tc.typ)); diff != "" {
+			t.Errorf("Unexpected filters for %q/%q (-want +got):\n%s", tc.group, tc.typ, diff)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+)
+
+// evaluationLogSize is the number of recent evaluations kept to report the slowest ones.
+const evaluationLogSize = 512
+
+// evaluationLog keeps the most recent expression evaluations.
+type evaluationLog struct {
+	l sync.Mutex
+	// entries is a ring buffer, next being the index of the oldest entry once it is full.
+	entries []types.ExprEvaluation
+	next    int
+}
+
+func (el *evaluationLog) add(evaluation types.ExprEvaluation) {
+	el.l.Lock()
+	defer el.l.Unlock()
+
+	if len(el.entries) < evaluationLogSize {
+		el.entries = append(el.entries, evaluation)
+
+		return
+	}
+
+	el.entries[el.next] = evaluation
+	el.next = (el.next + 1) % evaluationLogSize
+}
+
+// slowest returns, from the slowest, at most limit of the recent evaluations.
+func (el *evaluationLog) slowest(limit int) []types.ExprEvaluation {
+	el.l.Lock()
+	evaluations := slices.Clone(el.entries)
+	el.l.Unlock()
+
+	slices.SortStableFunc(evaluations, func(a, b types.ExprEvaluation) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+
+	if limit >= 0 && limit < len(evaluations) {
+		evaluations = evaluations[:limit]
+	}
+
+	return evaluations
+}
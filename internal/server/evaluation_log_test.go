@@ -0,0 +1,46 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+)
+
+func TestEvaluationLogSlowest(t *testing.T) {
+	t.Parallel()
+
+	var el evaluationLog
+
+	// Fill the log twice, the first round being slower but overwritten by the second one.
+	for i := range 2 * evaluationLogSize {
+		el.add(types.ExprEvaluation{
+			Key:      "key",
+			Duration: time.Duration(2*evaluationLogSize-i) * time.Millisecond,
+		})
+	}
+
+	// Overwrites the oldest entry, which lasted evaluationLogSize ms.
+	el.add(types.ExprEvaluation{Key: "slowest", Duration: time.Hour})
+
+	slowest := el.slowest(3)
+	if len(slowest) != 3 {
+		t.Fatalf("Expected 3 evaluations, got %d", len(slowest))
+	}
+
+	expected := []time.Duration{time.Hour, (evaluationLogSize - 1) * time.Millisecond, (evaluationLogSize - 2) * time.Millisecond}
+
+	for i, evaluation := range slowest {
+		if evaluation.Duration != expected[i] {
+			t.Errorf("Evaluation %d: expected a duration of %s, got %s", i, expected[i], evaluation.Duration)
+		}
+	}
+
+	if slowest[0].Key != "slowest" {
+		t.Errorf("Expected the slowest evaluation to be the last one added, got %+v", slowest[0])
+	}
+
+	if all := el.slowest(-1); len(all) != evaluationLogSize {
+		t.Errorf("Expected the log to keep %d evaluations, got %d", evaluationLogSize, len(all))
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/s3"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+	"github.com/Maxi-Mega/s3-image-server-v2/utils"
+)
+
+const (
+	exportManifestName = "__manifest__.json"
+	// signedObjectsDirName holds, in the export archives, the objects downloaded from S3 for their signed URLs.
+	signedObjectsDirName = "__signed_url_objects__"
+)
+
+// exportManifest describes an image in its export archive.
+type exportManifest struct {
+	Summary            types.ImageSummary      `json:"summary"`
+	Localization       *types.Localization     `json:"localization"`
+	CachedFileLinks    map[string]string       `json:"cachedFileLinks"`
+	SignedURLs         map[string]string       `json:"signedURLs"`
+	ExternalViewerURLs map[string]string       `json:"externalViewerURLs"`
+	TargetFiles        []string                `json:"targetFiles"`
+	EvaluationErrors   []types.EvaluationError `json:"evaluationErrors"`
+	// Files maps the paths of the archive to the S3 keys of the objects they hold.
+	Files map[string]string `json:"files"`
+	// ExportErrors lists the files which couldn't be added to the archive.
+	ExportErrors []string `json:"exportErrors"`
+}
+
+// imageExport is the snapshot of an image taken to write its archive without holding the lock of its bucket.
+type imageExport struct {
+	// dir is the one of the image in the archive, also the prefix of its cache keys.
+	dir      string
+	bucket   string
+	manifest exportManifest
+	// cachedFiles maps the cache keys of the files of the image to their S3 key.
+	cachedFiles map[string]string
+	// signedObjects maps the paths of the archive to the S3 keys of the objects to download.
+	signedObjects map[string]string
+	s3Client      s3.Client
+}
+
+func (c *cache) ExportImages(ctx context.Context, images []types.ImageRef, fetchSignedObjects bool, w io.Writer) error {
+	exports := make([]imageExport, 0, len(images))
+	seen := make(map[types.ImageRef]bool, len(images))
+
+	for _, ref := range images {
+		if seen[ref] {
+			continue
+		}
+
+		seen[ref] = true
+
+		if maxImages := c.cacheCfg.Export.MaxImages; maxImages > 0 && len(seen) > maxImages {
+			return fmt.Errorf("%w: more than %d images", types.ErrExportTooLarge, maxImages)
+		}
+
+		export, err := c.imageExport(ctx, ref, fetchSignedObjects)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", ref.Bucket, ref.Key, err)
+		}
+
+		exports = append(exports, export)
+	}
+
+	zipWriter := zip.NewWriter(w)
+
+	for _, export := range exports {
+		err := c.writeImageExport(ctx, zipWriter, export)
+		if err != nil {
+			return fmt.Errorf("exporting %q: %w", export.dir, err)
+		}
+	}
+
+	return zipWriter.Close() //nolint:wrapcheck
+}
+
+// imageExport lists the files to export of the given image, and builds its manifest.
+func (c *cache) imageExport(ctx context.Context, ref types.ImageRef, fetchSignedObjects bool) (imageExport, error) {
+	bucket, ok := c.bucket(ref.Bucket)
+	if !ok {
+		return imageExport{}, types.ErrImageNotFound
+	}
+
+	bucket.l.RLock()
+	defer bucket.l.RUnlock()
+
+	img, ok := bucket.images[ref.Key]
+	if !ok {
+		return imageExport{}, types.ErrImageNotFound
+	}
+
+	details := c.imageDetails(ctx, ref.Key, img)
+	export := imageExport{
+		dir:    path.Join(img.bucket, img.name),
+		bucket: img.bucket,
+		manifest: exportManifest{
+			Summary:            details.ImageSummary,
+			Localization:       details.Localization,
+			CachedFileLinks:    details.CachedFileLinks,
+			SignedURLs:         details.SignedURLs,
+			ExternalViewerURLs: details.ExternalViewerURLs,
+			TargetFiles:        details.TargetFiles,
+			EvaluationErrors:   details.EvaluationErrors,
+			Files:              make(map[string]string),
+			ExportErrors:       make([]string, 0),
+		},
+		cachedFiles:   make(map[string]string),
+		signedObjects: make(map[string]string),
+		s3Client:      bucket.s3Client,
+	}
+
+	if img.previewCacheKey != "" {
+		export.cachedFiles[img.previewCacheKey] = img.s3Key
+	}
+
+	for s3Key, target := range img.targets {
+		export.cachedFiles[target.value] = s3Key
+	}
+
+	inputFiles := slices.Collect(maps.Values(img.dynamicInputFiles))
+	for _, files := range img.multiDynamicInputFiles {
+		inputFiles = slices.AppendSeq(inputFiles, maps.Values(files))
+	}
+
+	for _, file := range inputFiles {
+		if file.value.CacheKey != "" {
+			export.cachedFiles[file.value.CacheKey] = file.value.S3Path
+		}
+	}
+
+	for s3Key, link := range img.linksFromCache {
+		export.cachedFiles[link.value] = s3Key
+	}
+
+	if fetchSignedObjects {
+		for s3Key, signedURL := range img.signedURLs {
+			if maxSize := c.cacheCfg.Export.MaxSignedObjectSize; maxSize > 0 && signedURL.value.objectSize > maxSize {
+				return imageExport{}, fmt.Errorf("%w: the object %q has %d bytes, the limit being %d", types.ErrExportTooLarge, s3Key, signedURL.value.objectSize, maxSize)
+			}
+
+			archivePath := path.Join(export.dir, signedObjectsDirName, utils.FormatDirName(strings.TrimPrefix(s3Key, img.baseDir)))
+			export.signedObjects[archivePath] = s3Key
+		}
+	}
+
+	return export, nil
+}
+
+// writeImageExport adds the files of the given image to the archive, then its manifest.
+func (c *cache) writeImageExport(ctx context.Context, zipWriter *zip.Writer, export imageExport) error {
+	for _, cacheKey := range slices.Sorted(maps.Keys(export.cachedFiles)) {
+		archivePath := filepath.ToSlash(cacheKey)
+
+		err := addFileToZip(zipWriter, archivePath, filepath.Join(c.cacheCfg.CacheDir, cacheKey))
+		if err != nil {
+			// The file may have been removed from the cache since the snapshot.
+			if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+
+			export.manifest.ExportErrors = append(export.manifest.ExportErrors, fmt.Sprintf("%s: %v", archivePath, err))
+
+			continue
+		}
+
+		export.manifest.Files[archivePath] = export.cachedFiles[cacheKey]
+	}
+
+	if len(export.signedObjects) > 0 {
+		tempDir, err := os.MkdirTemp("", "export-*")
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		defer os.RemoveAll(tempDir)
+
+		for _, archivePath := range slices.Sorted(maps.Keys(export.signedObjects)) {
+			s3Key := export.signedObjects[archivePath]
+			tempPath := filepath.Join(tempDir, path.Base(archivePath))
+
+			err = export.s3Client.DownloadObject(ctx, export.bucket, s3Key, tempPath)
+			if err == nil {
+				// The object may have grown since it was listed.
+				err = c.checkSignedObjectSize(tempPath)
+				if err == nil {
+					err = addFileToZip(zipWriter, archivePath, tempPath)
+				}
+
+				_ = os.Remove(tempPath)
+			}
+
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err() //nolint:wrapcheck
+				}
+
+				logger.Warnf("Failed to export the object %q of bucket %q: %v", s3Key, export.bucket, err)
+
+				export.manifest.ExportErrors = append(export.manifest.ExportErrors, fmt.Sprintf("%s: %v", archivePath, err))
+
+				continue
+			}
+
+			export.manifest.Files[archivePath] = s3Key
+		}
+	}
+
+	manifest, err := json.MarshalIndent(export.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	f, err := zipWriter.CreateHeader(&zip.FileHeader{Name: path.Join(export.dir, exportManifestName), Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	_, err = f.Write(manifest)
+
+	return err //nolint:wrapcheck
+}
+
+// checkSignedObjectSize returns an [types.ErrExportTooLarge] error if the downloaded object
+// at the given path is over the size limit of the signed objects.
+func (c *cache) checkSignedObjectSize(filePath string) error {
+	maxSize := c.cacheCfg.Export.MaxSignedObjectSize
+	if maxSize <= 0 {
+		return nil
+	}
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if stat.Size() > maxSize {
+		return fmt.Errorf("%w: the object has %d bytes, the limit being %d", types.ErrExportTooLarge, stat.Size(), maxSize)
+	}
+
+	return nil
+}
+
+// addFileToZip copies the file at the given path to the archive, keeping its modification time.
+func addFileToZip(zipWriter *zip.Writer, archivePath, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	header, err := zip.FileInfoHeader(stat)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	header.Name = archivePath
+	header.Method = zip.Deflate
+
+	w, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	_, err = io.Copy(w, f)
+
+	return err //nolint:wrapcheck
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCacheExportImages(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	files := map[string]string{
+		"bkt/products@1/preview.jpg":                          "preview",
+		"bkt/products@1/__targets__/targets.geojson":          `{"type": "FeatureCollection"}`,
+		"bkt/products@1/__dynamic_input_files__/product.json": `{"id": 1}`,
+	}
+
+	for filePath, content := range files {
+		fullPath := filepath.Join(cacheDir, filePath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(fullPath, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s3Client := S3ClientMock{
+		DownloadObjectFn: func(_ context.Context, bucket, objectKey, destPath string) error {
+			if objectKey != "products/1/full/product.tif" {
+				return errors.New("access denied")
+			}
+
+			return os.WriteFile(destPath, []byte(bucket+"/"+objectKey), 0o600)
+		},
+	}
+
+	dynamicData := config.DynamicData{}
+	exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+
+	bucket := newBucketCache(s3Client, exprMan, "bkt", filepath.Join(cacheDir, "bkt"), config.Config{})
+	bucket.images["products/1/"] = image{
+		name: "products@1", baseDir: "products/1/", bucket: "bkt", s3Key: "products/1/preview.jpg",
+		imgGroup: imgGroup, imgType: imgType,
+		previewCacheKey: "bkt/products@1/preview.jpg",
+		targets: map[string]valueWithLastUpdate[string]{
+			"products/1/targets.geojson": {value: "bkt/products@1/__targets__/targets.geojson"},
+			"products/1/gone.geojson":    {value: "bkt/products@1/__targets__/gone.geojson"},
+		},
+		dynamicInputFiles: map[string]valueWithLastUpdate[types.DynamicInputFile]{
+			"product": {value: types.DynamicInputFile{S3Path: "products/1/product.json", CacheKey: "bkt/products@1/__dynamic_input_files__/product.json"}},
+			"full":    {value: types.DynamicInputFile{S3Path: "products/1/full/product.tif"}},
+		},
+		linksFromCache: map[string]valueWithLastUpdate[string]{
+			"products/1/product.json": {value: "bkt/products@1/__dynamic_input_files__/product.json"},
+		},
+		signedURLs: map[string]valueWithLastUpdate[signedURL]{
+			"products/1/full/product.tif": {value: signedURL{value: "https://s3/bkt/products/1/full/product.tif?signature", objectSize: 20}},
+			"products/1/denied.tif":       {value: signedURL{value: "https://s3/bkt/products/1/denied.tif?signature"}},
+		},
+	}
+
+	c := &cache{
+		cacheCfg:    config.Cache{CacheDir: cacheDir},
+		buckets:     map[string]*bucketCache{"bkt": bucket},
+		exprManager: exprMan,
+	}
+
+	export := func(images []types.ImageRef, fetchSignedObjects bool) (map[string]string, exportManifest) {
+		t.Helper()
+
+		var buf bytes.Buffer
+
+		if err := c.ExportImages(t.Context(), images, fetchSignedObjects, &buf); err != nil {
+			t.Fatal("Failed to export:", err)
+		}
+
+		zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal("Invalid archive:", err)
+		}
+
+		entries := make(map[string]string, len(zipReader.File))
+
+		for _, entry := range zipReader.File {
+			f, err := entry.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := io.ReadAll(f)
+			_ = f.Close()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries[entry.Name] = string(content)
+		}
+
+		var manifest exportManifest
+		if err = json.Unmarshal([]byte(entries["bkt/products@1/"+exportManifestName]), &manifest); err != nil {
+			t.Fatal("Invalid manifest:", err)
+		}
+
+		delete(entries, "bkt/products@1/"+exportManifestName)
+
+		return entries, manifest
+	}
+
+	ref := types.ImageRef{Bucket: "bkt", Key: "products/1/"}
+
+	entries, manifest := export([]types.ImageRef{ref, ref}, true)
+
+	expectedEntries := map[string]string{"bkt/products@1/__signed_url_objects__/full@product.tif": "bkt/products/1/full/product.tif"}
+	for filePath, content := range files {
+		expectedEntries[filePath] = content
+	}
+
+	if diff := cmp.Diff(expectedEntries, entries); diff != "" {
+		t.Errorf("Unexpected entries (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(map[string]string{
+		"bkt/products@1/preview.jpg":                             "products/1/preview.jpg",
+		"bkt/products@1/__targets__/targets.geojson":             "products/1/targets.geojson",
+		"bkt/products@1/__dynamic_input_files__/product.json":    "products/1/product.json",
+		"bkt/products@1/__signed_url_objects__/full@product.tif": "products/1/full/product.tif",
+	}, manifest.Files); diff != "" {
+		t.Errorf("Unexpected manifest files (-want +got):\n%s", diff)
+	}
+
+	if len(manifest.ExportErrors) != 2 ||
+		!slices.ContainsFunc(manifest.ExportErrors, func(e string) bool { return strings.HasPrefix(e, "bkt/products@1/__targets__/gone.geojson:") }) {
+		t.Errorf("Expected the missing target and the denied object as errors, got %q", manifest.ExportErrors)
+	}
+
+	if manifest.Summary.Key != "products/1/" || manifest.SignedURLs["products/1/denied.tif"] == "" {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+
+	// The signed objects are only downloaded on demand.
+	entries, _ = export([]types.ImageRef{ref}, false)
+	if _, found := entries["bkt/products@1/__signed_url_objects__/full@product.tif"]; found || len(entries) != len(files) {
+		t.Errorf("Expected only the cached files, got %v", slices.Sorted(maps.Keys(entries)))
+	}
+
+	var buf bytes.Buffer
+
+	err := c.ExportImages(t.Context(), []types.ImageRef{ref, {Bucket: "bkt", Key: "products/2/"}}, false, &buf)
+	if !errors.Is(err, types.ErrImageNotFound) || buf.Len() != 0 {
+		t.Errorf("Expected nothing written and %v, got %d bytes and %v", types.ErrImageNotFound, buf.Len(), err)
+	}
+
+	// The duplicates don't count in the limit.
+	c.cacheCfg.Export = config.Export{MaxImages: 1}
+	export([]types.ImageRef{ref, ref}, false)
+
+	buf.Reset()
+
+	err = c.ExportImages(t.Context(), []types.ImageRef{ref, {Bucket: "bkt", Key: "products/2/"}}, false, &buf)
+	if !errors.Is(err, types.ErrExportTooLarge) || buf.Len() != 0 {
+		t.Errorf("Expected nothing written and %v, got %d bytes and %v", types.ErrExportTooLarge, buf.Len(), err)
+	}
+
+	// The object listed with 20 bytes has 31 bytes once downloaded.
+	c.cacheCfg.Export = config.Export{MaxSignedObjectSize: 25}
+	entries, manifest = export([]types.ImageRef{ref}, true)
+
+	if _, found := entries["bkt/products@1/__signed_url_objects__/full@product.tif"]; found ||
+		!slices.ContainsFunc(manifest.ExportErrors, func(e string) bool { return strings.Contains(e, types.ErrExportTooLarge.Error()) }) {
+		t.Errorf("Expected the grown object as an error, got %q", manifest.ExportErrors)
+	}
+
+	c.cacheCfg.Export = config.Export{MaxSignedObjectSize: 10}
+
+	buf.Reset()
+
+	err = c.ExportImages(t.Context(), []types.ImageRef{ref}, true, &buf)
+	if !errors.Is(err, types.ErrExportTooLarge) || buf.Len() != 0 {
+		t.Errorf("Expected nothing written and %v, got %d bytes and %v", types.ErrExportTooLarge, buf.Len(), err)
+	}
+
+	// The size of the signed objects isn't checked if they aren't fetched.
+	export([]types.ImageRef{ref}, false)
+}
@@ -7,18 +7,24 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"maps"
+	"os"
 	"path/filepath"
+	"reflect"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/gazetteer"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/observability"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/s3"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
 
-	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/vm"
 	"github.com/go-viper/mapstructure/v2"
 )
@@ -30,6 +36,19 @@ var (
 
 const exprCacheTTL = 10 * time.Minute
 
+// decodedExprs are the expressions whose output is decoded before being cached.
+var decodedExprs = []string{types.ExprGeonames, types.ExprLocalization, types.ExprProductInfo} //nolint: gochecknoglobals
+
+// rawOutputCacheName returns the name the raw output of the given expression is cached under for the dynamic filters,
+// which differs from the expression name for the decodedExprs.
+func rawOutputCacheName(exprName string) string {
+	if slices.Contains(decodedExprs, exprName) {
+		return exprName + "/raw"
+	}
+
+	return exprName
+}
+
 const mapstructureJSONTagName = "json"
 
 type exprCacheKey struct {
@@ -45,47 +64,318 @@ type exprCacheEntry struct {
 }
 
 type expressionManager struct {
-	cacheDir   string
-	dynFilters map[string]string
+	cacheDir string
+	// cfgLock guards the fields below, which are replaced when the configuration is reloaded.
+	cfgLock    sync.RWMutex
+	dynFilters map[string]map[string][]config.DynamicFilter
 	// map[img group][img type][expr name] -> expr
 	exprs map[string]map[string]map[string]*vm.Program
 	// map[img group][img type] -> selectors
 	fileSelectors map[string]map[string][]string
-	l             sync.Mutex
-	cacheSums     map[exprCacheKey]exprCacheEntry
+	// map[img group][img type][selector] -> XML namespaces
+	namespaces map[string]map[string]map[string]map[string]string
+	limits     types.ExprLimits
+	// generation is incremented on each configuration load,
+	// so that the results of the evaluations started before it aren't cached.
+	generation uint64
+	// gazetteerSrc is what the gazetteer was loaded from, nil until one is loaded.
+	gazetteerSrc *gazetteerSource
+	gazetteer    *gazetteer.Gazetteer
+	gatherer     *observability.Metrics
+	evaluations  evaluationLog
+	l            sync.Mutex
+	cacheSums    map[exprCacheKey]exprCacheEntry
+}
+
+// exprError is the failure of an expression whose name isn't known by the caller.
+type exprError struct {
+	exprName string
+	err      error
+}
+
+func (e exprError) Error() string {
+	return e.err.Error()
+}
+
+func (e exprError) Unwrap() error {
+	return e.err
+}
+
+// gazetteerSource is the configuration a gazetteer was loaded from, and the state of its dump files at that time.
+type gazetteerSource struct {
+	cfg   config.Gazetteer
+	files map[string]fileStamp
+}
+
+type fileStamp struct {
+	size    int64
+	modTime int64
 }
 
 type envFilesPrecomputed struct {
-	checksum string
-	files    map[string]types.DynamicInputFile
+	checksum  string
+	files     map[string]types.DynamicInputFile
+	fileLists map[string][]types.DynamicInputFile
 }
 
 func newExpressionManager(cfg config.Config) *expressionManager {
-	dynamicFilters := make(map[string]string, len(cfg.Products.DynamicFilters))
+	exprMan := &expressionManager{
+		cacheDir:  cfg.Cache.CacheDir,
+		cacheSums: make(map[exprCacheKey]exprCacheEntry),
+	}
+
+	exprMan.loadConfig(cfg)
+
+	return exprMan
+}
+
+func (exprMan *expressionManager) loadConfig(cfg config.Config) {
 	exprs := make(map[string]map[string]map[string]*vm.Program)
 	selectors := make(map[string]map[string][]string)
-
-	for _, filter := range cfg.Products.DynamicFilters {
-		dynamicFilters[filter.Name] = filter.Expression
-	}
+	dynamicFilters := make(map[string]map[string][]config.DynamicFilter)
+	namespaces := make(map[string]map[string]map[string]map[string]string)
 
 	for _, group := range cfg.Products.ImageGroups {
 		exprs[group.GroupName] = make(map[string]map[string]*vm.Program)
 		selectors[group.GroupName] = make(map[string][]string)
+		dynamicFilters[group.GroupName] = make(map[string][]config.DynamicFilter)
+		namespaces[group.GroupName] = make(map[string]map[string]map[string]string)
 
 		for _, imgType := range group.Types {
 			exprs[group.GroupName][imgType.Name] = maps.Clone(imgType.DynamicData.ExpressionsPrograms)
 			selectors[group.GroupName][imgType.Name] = slices.Collect(maps.Keys(imgType.DynamicData.FileSelectors))
+			dynamicFilters[group.GroupName][imgType.Name] = slices.Clone(imgType.DynamicFilters)
+			namespaces[group.GroupName][imgType.Name] = make(map[string]map[string]string)
+
+			for name, selector := range imgType.DynamicData.FileSelectors {
+				if len(selector.Namespaces) > 0 {
+					namespaces[group.GroupName][imgType.Name][name] = maps.Clone(selector.Namespaces)
+				}
+			}
+		}
+	}
+
+	geocoder, gazetteerSrc := exprMan.loadGazetteer(cfg.Products.Gazetteer)
+
+	exprMan.cfgLock.Lock()
+	defer exprMan.cfgLock.Unlock()
+
+	exprMan.generation++
+	exprMan.gazetteer, exprMan.gazetteerSrc = geocoder, gazetteerSrc
+	exprMan.dynFilters = dynamicFilters
+	exprMan.exprs = exprs
+	exprMan.fileSelectors = selectors
+	exprMan.namespaces = namespaces
+	exprMan.limits = types.ExprLimits{
+		Timeout:      cfg.Products.ExpressionLimits.Timeout,
+		MemoryBudget: cfg.Products.ExpressionLimits.MemoryBudget,
+		MaxFileSize:  cfg.Products.ExpressionLimits.MaxFileSize,
+	}
+}
+
+// loadGazetteer returns the gazetteer of the given configuration,
+// only reading the dump files when it or the files themselves changed.
+// If they can't be read, the previous gazetteer is kept.
+func (exprMan *expressionManager) loadGazetteer(cfg config.Gazetteer) (*gazetteer.Gazetteer, *gazetteerSource) {
+	exprMan.cfgLock.RLock()
+	previous, previousSrc := exprMan.gazetteer, exprMan.gazetteerSrc
+	exprMan.cfgLock.RUnlock()
+
+	src := &gazetteerSource{cfg: cfg, files: gazetteerFileStamps(cfg)}
+
+	if previousSrc != nil && previousSrc.cfg == cfg && maps.Equal(previousSrc.files, src.files) {
+		return previous, previousSrc
+	}
+
+	if cfg.CitiesFile == "" {
+		return nil, src
+	}
+
+	t0 := time.Now()
+
+	geocoder, err := gazetteer.Load(gazetteer.Options{
+		CitiesFile:           cfg.CitiesFile,
+		Admin1CodesFile:      cfg.Admin1CodesFile,
+		Admin2CodesFile:      cfg.Admin2CodesFile,
+		CountryInfoFile:      cfg.CountryInfoFile,
+		MaxDistance:          cfg.MaxDistance,
+		VillageMaxPopulation: cfg.VillageMaxPopulation,
+	})
+	if err != nil {
+		logger.Errorf("Failed to load the gazetteer: %v", err)
+
+		return previous, previousSrc
+	}
+
+	logger.Infof("Loaded %d places in the gazetteer in %s", geocoder.Len(), time.Since(t0))
+
+	return geocoder, src
+}
+
+// gazetteerFileStamps returns the size and modification time of the configured dump files that exist.
+func gazetteerFileStamps(cfg config.Gazetteer) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+
+	for _, file := range []string{cfg.CitiesFile, cfg.Admin1CodesFile, cfg.Admin2CodesFile, cfg.CountryInfoFile} {
+		if file == "" {
+			continue
 		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		stamps[file] = fileStamp{size: info.Size(), modTime: info.ModTime().UnixNano()}
 	}
 
-	return &expressionManager{
-		cacheDir:      cfg.Cache.CacheDir,
-		dynFilters:    dynamicFilters,
-		exprs:         exprs,
-		fileSelectors: selectors,
-		cacheSums:     make(map[exprCacheKey]exprCacheEntry),
+	return stamps
+}
+
+func (exprMan *expressionManager) reverseGeocoder() types.ReverseGeocoder {
+	exprMan.cfgLock.RLock()
+	defer exprMan.cfgLock.RUnlock()
+
+	// A nil gazetteer must give a nil interface, for _reverseGeocode to report that none is configured.
+	if exprMan.gazetteer == nil {
+		return nil
 	}
+
+	return exprMan.gazetteer
+}
+
+// reload swaps the expressions with the ones of the given configuration,
+// and invalidates all the cached results.
+// The evaluations still running with the previous expressions won't cache their results,
+// since their generation no longer matches.
+func (exprMan *expressionManager) reload(cfg config.Config) {
+	exprMan.loadConfig(cfg)
+
+	exprMan.l.Lock()
+	defer exprMan.l.Unlock()
+
+	exprMan.cacheSums = make(map[exprCacheKey]exprCacheEntry)
+}
+
+// currentGeneration returns the generation of the loaded configuration.
+// It must be read before the programs of an evaluation, and given back when caching its result.
+func (exprMan *expressionManager) currentGeneration() uint64 {
+	exprMan.cfgLock.RLock()
+	defer exprMan.cfgLock.RUnlock()
+
+	return exprMan.generation
+}
+
+func (exprMan *expressionManager) programs(imgGroup, imgType string) map[string]*vm.Program {
+	exprMan.cfgLock.RLock()
+	defer exprMan.cfgLock.RUnlock()
+
+	return exprMan.exprs[imgGroup][imgType]
+}
+
+func (exprMan *expressionManager) selectors(imgGroup, imgType string) []string {
+	exprMan.cfgLock.RLock()
+	defer exprMan.cfgLock.RUnlock()
+
+	return exprMan.fileSelectors[imgGroup][imgType]
+}
+
+func (exprMan *expressionManager) xmlNamespaces(imgGroup, imgType string) map[string]map[string]string {
+	exprMan.cfgLock.RLock()
+	defer exprMan.cfgLock.RUnlock()
+
+	return exprMan.namespaces[imgGroup][imgType]
+}
+
+func (exprMan *expressionManager) dynamicFilterDefs(imgGroup, imgType string) []config.DynamicFilter {
+	exprMan.cfgLock.RLock()
+	defer exprMan.cfgLock.RUnlock()
+
+	return exprMan.dynFilters[imgGroup][imgType]
+}
+
+// scopedFilterDefs returns the dynamic filters of the types of the given group and of the given type,
+// any group or type matching when empty. A filter shared by several types is only returned once,
+// the filters having the same name but a different type being kept apart.
+func (exprMan *expressionManager) scopedFilterDefs(imgGroup, imgType string) []config.DynamicFilter {
+	exprMan.cfgLock.RLock()
+	defer exprMan.cfgLock.RUnlock()
+
+	var filters []config.DynamicFilter
+
+	for _, group := range slices.Sorted(maps.Keys(exprMan.dynFilters)) {
+		for _, typ := range slices.Sorted(maps.Keys(exprMan.dynFilters[group])) {
+			if (imgGroup != "" && group != imgGroup) || (imgType != "" && typ != imgType) {
+				continue
+			}
+
+			for _, filter := range exprMan.dynFilters[group][typ] {
+				if !slices.ContainsFunc(filters, func(f config.DynamicFilter) bool { return f.Name == filter.Name && f.Type == filter.Type }) {
+					filters = append(filters, filter)
+				}
+			}
+		}
+	}
+
+	return filters
+}
+
+func (exprMan *expressionManager) exprLimits() types.ExprLimits {
+	exprMan.cfgLock.RLock()
+	defer exprMan.cfgLock.RUnlock()
+
+	return exprMan.limits
+}
+
+// run evaluates the given expression of the given image within the configured limits.
+// Its duration is measured and recorded in the evaluation log, and its failures are counted by the limit they exceeded.
+func (exprMan *expressionManager) run(img image, exprName string, prgm *vm.Program, env types.ExprEnv) (any, error) {
+	start := time.Now()
+	output, err := types.RunExpr(prgm, env)
+	duration := time.Since(start)
+
+	evaluation := types.ExprEvaluation{
+		Time:       start,
+		Group:      img.imgGroup,
+		Type:       img.imgType,
+		Expression: exprName,
+		Bucket:     img.bucket,
+		Key:        img.s3Key,
+		Duration:   duration,
+	}
+
+	if err != nil {
+		evaluation.Error = err.Error()
+	}
+
+	exprMan.evaluations.add(evaluation)
+
+	if exprMan.gatherer != nil {
+		exprMan.gatherer.ExprDuration.WithLabelValues(img.imgGroup, img.imgType, exprName).Observe(duration.Seconds())
+
+		if err != nil {
+			exprMan.gatherer.ExprErrorsCounter.WithLabelValues(img.imgGroup, img.imgType, exprName, types.ExprErrorReason(err)).Inc()
+		}
+	}
+
+	return output, err
+}
+
+// cached returns the cached result of the given expression of the given image, if its files checksum still matches,
+// and counts the cache hits and misses.
+func (exprMan *expressionManager) cached(img image, exprName string, sum string) (any, bool) {
+	value, ok := exprMan.getCache(img.bucket, img.s3Key, exprName, sum)
+
+	if exprMan.gatherer != nil {
+		result := "miss"
+		if ok {
+			result = "hit"
+		}
+
+		exprMan.gatherer.ExprCacheCounter.WithLabelValues(img.imgGroup, img.imgType, exprName, result).Inc()
+	}
+
+	return value, ok
 }
 
 func (exprMan *expressionManager) getCache(imgBucket, imgKey, exprName string, sum string) (any, bool) {
@@ -100,10 +390,17 @@ func (exprMan *expressionManager) getCache(imgBucket, imgKey, exprName string, s
 	return nil, false
 }
 
-func (exprMan *expressionManager) updateCache(imgBucket, imgKey, exprName string, sum string, value any) {
+// updateCache caches the result of the given expression, unless it was evaluated
+// with the programs of a configuration that has since been reloaded.
+func (exprMan *expressionManager) updateCache(generation uint64, imgBucket, imgKey, exprName string, sum string, value any) {
 	exprMan.l.Lock()
 	defer exprMan.l.Unlock()
 
+	// The generation is incremented before the cache is cleared, so a stale result is either skipped here or cleared by the reload.
+	if generation != exprMan.currentGeneration() {
+		return
+	}
+
 	exprMan.cacheSums[exprCacheKey{imgBucket, imgKey, exprName}] = exprCacheEntry{
 		sum:   sum,
 		ts:    time.Now(),
@@ -112,7 +409,10 @@ func (exprMan *expressionManager) updateCache(imgBucket, imgKey, exprName string
 }
 
 func (exprMan *expressionManager) productBasePath(ctx context.Context, imgGroup, imgType string, s3event s3.Event) (string, error) {
-	pbpExpr, found := exprMan.exprs[imgGroup][imgType][types.ExprProductBasePath]
+	generation := exprMan.currentGeneration()
+	programs := exprMan.programs(imgGroup, imgType)
+
+	pbpExpr, found := programs[types.ExprProductBasePath]
 	if !found {
 		return "", fmt.Errorf("%w %q", errMissingExpression, types.ExprProductBasePath)
 	}
@@ -126,15 +426,19 @@ func (exprMan *expressionManager) productBasePath(ctx context.Context, imgGroup,
 				Date:     s3event.ObjectLastModified,
 			},
 		},
-		Exprs: exprMan.exprs[imgGroup][imgType],
+		Exprs:    programs,
+		Geocoder: exprMan.reverseGeocoder(),
+		Limits:   exprMan.exprLimits(),
 	}
-	selectorsSum := dynamicFilesChecksum(env.Files)
+	selectorsSum := dynamicFilesChecksum(env.Files, nil)
+
+	img := image{bucket: s3event.Bucket, s3Key: s3event.ObjectKey, imgGroup: imgGroup, imgType: imgType}
 
-	if value, ok := exprMan.getCache(s3event.Bucket, s3event.ObjectKey, types.ExprProductBasePath, selectorsSum); ok {
+	if value, ok := exprMan.cached(img, types.ExprProductBasePath, selectorsSum); ok {
 		return value.(string), nil //nolint: forcetypeassert
 	}
 
-	output, err := expr.Run(pbpExpr, env)
+	output, err := exprMan.run(img, types.ExprProductBasePath, pbpExpr, env)
 	if err != nil {
 		return "", fmt.Errorf("expr: %w", err)
 	}
@@ -144,37 +448,25 @@ func (exprMan *expressionManager) productBasePath(ctx context.Context, imgGroup,
 		return "", fmt.Errorf("%w: want string, got %T", errUnexpectedOutputType, output)
 	}
 
-	exprMan.updateCache(s3event.Bucket, s3event.ObjectKey, types.ExprProductBasePath, selectorsSum, basePath)
+	exprMan.updateCache(generation, s3event.Bucket, s3event.ObjectKey, types.ExprProductBasePath, selectorsSum, basePath)
 
 	return basePath, nil
 }
 
 func (exprMan *expressionManager) imageGeonames(ctx context.Context, img image, precomputedFiles *envFilesPrecomputed) (*types.Geonames, error) {
-	geoExpr, found := exprMan.exprs[img.imgGroup][img.imgType][types.ExprGeonames]
+	generation := exprMan.currentGeneration()
+	geoExpr, found := exprMan.programs(img.imgGroup, img.imgType)[types.ExprGeonames]
 	if !found {
 		return nil, nil //nolint: nilnil
 	}
 
-	var selectorsSum string
-
-	env := types.ExprEnv{
-		Ctx:   ctx,
-		Exprs: exprMan.exprs[img.imgGroup][img.imgType],
-	}
-
-	if precomputedFiles != nil {
-		env.Files = precomputedFiles.files
-		selectorsSum = precomputedFiles.checksum
-	} else {
-		env.Files = exprMan.valueMap2FilesMap(img)
-		selectorsSum = dynamicFilesChecksum(env.Files)
-	}
+	env, selectorsSum := exprMan.exprEnv(ctx, img, precomputedFiles)
 
-	if value, ok := exprMan.getCache(img.bucket, img.s3Key, types.ExprGeonames, selectorsSum); ok {
+	if value, ok := exprMan.cached(img, types.ExprGeonames, selectorsSum); ok {
 		return value.(*types.Geonames), nil //nolint: forcetypeassert
 	}
 
-	output, err := expr.Run(geoExpr, env)
+	output, err := exprMan.run(img, types.ExprGeonames, geoExpr, env)
 	if err != nil {
 		return nil, fmt.Errorf("expr: %w", err)
 	}
@@ -202,29 +494,25 @@ func (exprMan *expressionManager) imageGeonames(ctx context.Context, img image,
 		return nil, err //nolint: wrapcheck
 	}
 
-	exprMan.updateCache(img.bucket, img.s3Key, types.ExprGeonames, selectorsSum, &geonames)
+	exprMan.updateCache(generation, img.bucket, img.s3Key, types.ExprGeonames, selectorsSum, &geonames)
 
 	return &geonames, nil
 }
 
-func (exprMan *expressionManager) imageLocalization(ctx context.Context, img image) (*types.Localization, error) {
-	locExpr, found := exprMan.exprs[img.imgGroup][img.imgType][types.ExprLocalization]
+func (exprMan *expressionManager) imageLocalization(ctx context.Context, img image, precomputedFiles *envFilesPrecomputed) (*types.Localization, error) {
+	generation := exprMan.currentGeneration()
+	locExpr, found := exprMan.programs(img.imgGroup, img.imgType)[types.ExprLocalization]
 	if !found {
 		return nil, nil //nolint: nilnil
 	}
 
-	env := types.ExprEnv{
-		Ctx:   ctx,
-		Files: exprMan.valueMap2FilesMap(img),
-		Exprs: exprMan.exprs[img.imgGroup][img.imgType],
-	}
-	selectorsSum := dynamicFilesChecksum(env.Files)
+	env, selectorsSum := exprMan.exprEnv(ctx, img, precomputedFiles)
 
-	if value, ok := exprMan.getCache(img.bucket, img.s3Key, types.ExprLocalization, selectorsSum); ok {
+	if value, ok := exprMan.cached(img, types.ExprLocalization, selectorsSum); ok {
 		return value.(*types.Localization), nil //nolint: forcetypeassert
 	}
 
-	output, err := expr.Run(locExpr, env)
+	output, err := exprMan.run(img, types.ExprLocalization, locExpr, env)
 	if err != nil {
 		return nil, fmt.Errorf("expr: %w", err)
 	}
@@ -240,8 +528,9 @@ func (exprMan *expressionManager) imageLocalization(ctx context.Context, img ima
 	}
 
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-		Result:  &localization,
-		TagName: mapstructureJSONTagName,
+		DecodeHook: decodeGeometryHook,
+		Result:     &localization,
+		TagName:    mapstructureJSONTagName,
 	})
 	if err != nil {
 		return nil, err //nolint: wrapcheck
@@ -252,37 +541,44 @@ func (exprMan *expressionManager) imageLocalization(ctx context.Context, img ima
 		return nil, err //nolint: wrapcheck
 	}
 
-	exprMan.updateCache(img.bucket, img.s3Key, types.ExprLocalization, selectorsSum, &localization)
+	err = localization.ToWGS84()
+	if err != nil {
+		return nil, fmt.Errorf("reprojecting localization: %w", err)
+	}
+
+	exprMan.updateCache(generation, img.bucket, img.s3Key, types.ExprLocalization, selectorsSum, &localization)
 
 	return &localization, nil
 }
 
-func (exprMan *expressionManager) productInfo(ctx context.Context, img image, precomputedFiles *envFilesPrecomputed) (*types.ProductInformation, error) {
-	locExpr, found := exprMan.exprs[img.imgGroup][img.imgType][types.ExprProductInfo]
-	if !found {
-		return nil, nil //nolint: nilnil
+// decodeGeometryHook decodes the GeoJSON objects set to [types.Geometry] fields.
+func decodeGeometryHook(_ reflect.Type, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeFor[types.Geometry]() || data == nil {
+		return data, nil
 	}
 
-	var selectorsSum string
-
-	env := types.ExprEnv{
-		Ctx:   ctx,
-		Exprs: exprMan.exprs[img.imgGroup][img.imgType],
+	geometry, err := types.ParseGeometry(data)
+	if err != nil {
+		return nil, err //nolint: wrapcheck
 	}
 
-	if precomputedFiles != nil {
-		env.Files = precomputedFiles.files
-		selectorsSum = precomputedFiles.checksum
-	} else {
-		env.Files = exprMan.valueMap2FilesMap(img)
-		selectorsSum = dynamicFilesChecksum(env.Files)
+	return *geometry, nil
+}
+
+func (exprMan *expressionManager) productInfo(ctx context.Context, img image, precomputedFiles *envFilesPrecomputed) (*types.ProductInformation, error) {
+	generation := exprMan.currentGeneration()
+	locExpr, found := exprMan.programs(img.imgGroup, img.imgType)[types.ExprProductInfo]
+	if !found {
+		return nil, nil //nolint: nilnil
 	}
 
-	if value, ok := exprMan.getCache(img.bucket, img.s3Key, types.ExprProductInfo, selectorsSum); ok {
+	env, selectorsSum := exprMan.exprEnv(ctx, img, precomputedFiles)
+
+	if value, ok := exprMan.cached(img, types.ExprProductInfo, selectorsSum); ok {
 		return value.(*types.ProductInformation), nil //nolint: forcetypeassert
 	}
 
-	output, err := expr.Run(locExpr, env)
+	output, err := exprMan.run(img, types.ExprProductInfo, locExpr, env)
 	if err != nil {
 		return nil, fmt.Errorf("expr: %w", err)
 	}
@@ -306,84 +602,75 @@ func (exprMan *expressionManager) productInfo(ctx context.Context, img image, pr
 		return nil, err //nolint: wrapcheck
 	}
 
-	exprMan.updateCache(img.bucket, img.s3Key, types.ExprProductInfo, selectorsSum, &productInformation)
+	exprMan.updateCache(generation, img.bucket, img.s3Key, types.ExprProductInfo, selectorsSum, &productInformation)
 
 	return &productInformation, nil
 }
 
-func (exprMan *expressionManager) dynamicFilters(ctx context.Context, img image, precomputedFiles *envFilesPrecomputed) (map[string]string, error) {
-	dynFilters := make(map[string]string, len(exprMan.dynFilters))
+// dynamicFilters returns the values of the dynamic filters of the given image.
+// The filters whose expression fails or gives a value of the wrong type are left out, with an error each.
+// The string filters whose value had to be converted are kept, with an error too.
+func (exprMan *expressionManager) dynamicFilters(ctx context.Context, img image, precomputedFiles *envFilesPrecomputed) (map[string]any, []error) {
+	generation := exprMan.currentGeneration()
+	filters := exprMan.dynamicFilterDefs(img.imgGroup, img.imgType)
+	dynFilters := make(map[string]any, len(filters))
 
-	var selectorsSum string
+	var errs []error
 
-	env := types.ExprEnv{
-		Ctx:   ctx,
-		Exprs: exprMan.exprs[img.imgGroup][img.imgType],
-	}
-
-	if precomputedFiles != nil {
-		env.Files = precomputedFiles.files
-		selectorsSum = precomputedFiles.checksum
-	} else {
-		env.Files = exprMan.valueMap2FilesMap(img)
-		selectorsSum = dynamicFilesChecksum(env.Files)
-	}
+	env, selectorsSum := exprMan.exprEnv(ctx, img, precomputedFiles)
 
-	for name, exprName := range exprMan.dynFilters {
-		if value, ok := exprMan.getCache(img.bucket, img.s3Key, exprName, selectorsSum); ok {
-			valueStr, ok := value.(string)
-			if ok {
-				dynFilters[name] = valueStr
-			} else {
-				logger.Warnf("filter %q: expected a string result, got %T", name, value)
+	for _, filter := range filters {
+		cacheName := rawOutputCacheName(filter.Expression)
 
-				dynFilters[name] = fmt.Sprint(value)
+		output, ok := exprMan.cached(img, cacheName, selectorsSum)
+		if !ok {
+			prgm, found := exprMan.programs(img.imgGroup, img.imgType)[filter.Expression]
+			if !found {
+				continue
 			}
 
-			continue
-		}
+			var err error
 
-		prgm, ok := exprMan.exprs[img.imgGroup][img.imgType][exprName]
-		if !ok {
-			continue
-		}
+			output, err = exprMan.run(img, filter.Expression, prgm, env)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("filter %q: %w", filter.Name, exprError{exprName: filter.Expression, err: err}))
 
-		output, err := expr.Run(prgm, env)
-		if err != nil {
-			return nil, fmt.Errorf("filter %q: %w", name, err)
+				continue
+			}
+
+			// The raw output is cached, since the same expression may back filters of different types.
+			exprMan.updateCache(generation, img.bucket, img.s3Key, cacheName, selectorsSum, output)
 		}
 
-		dynFilters[name], ok = output.(string)
-		if !ok {
-			logger.Warnf("filter %q: expected a string result, got %T", name, output)
+		value, err := filterValue(filter, output)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("filter %q: %w", filter.Name, exprError{exprName: filter.Expression, err: err}))
 
-			dynFilters[name] = fmt.Sprint(output)
+			if !errors.Is(err, errConvertedFilterValue) {
+				continue
+			}
 		}
 
-		// Don't update the cache, since we don't decode the output to the right type.
+		dynFilters[filter.Name] = value
 	}
 
-	return dynFilters, nil
+	return dynFilters, errs
 }
 
 func (exprMan *expressionManager) signedURLParams(ctx context.Context, img image, paramsExprName string) (map[string]any, error) {
-	paramsExpr, found := exprMan.exprs[img.imgGroup][img.imgType][paramsExprName]
+	generation := exprMan.currentGeneration()
+	paramsExpr, found := exprMan.programs(img.imgGroup, img.imgType)[paramsExprName]
 	if !found {
 		return nil, fmt.Errorf("%w %q", errMissingExpression, paramsExprName)
 	}
 
-	env := types.ExprEnv{
-		Ctx:   ctx,
-		Files: exprMan.valueMap2FilesMap(img),
-		Exprs: exprMan.exprs[img.imgGroup][img.imgType],
-	}
-	selectorsSum := dynamicFilesChecksum(env.Files)
+	env, selectorsSum := exprMan.exprEnv(ctx, img, nil)
 
-	if value, ok := exprMan.getCache(img.bucket, img.s3Key, paramsExprName, selectorsSum); ok {
+	if value, ok := exprMan.cached(img, paramsExprName, selectorsSum); ok {
 		return value.(map[string]any), nil //nolint: forcetypeassert
 	}
 
-	output, err := expr.Run(paramsExpr, env)
+	output, err := exprMan.run(img, paramsExprName, paramsExpr, env)
 	if err != nil {
 		return nil, fmt.Errorf("expr: %w", err)
 	}
@@ -393,29 +680,25 @@ func (exprMan *expressionManager) signedURLParams(ctx context.Context, img image
 		return nil, fmt.Errorf("%w: want map[string]any, got %T", errUnexpectedOutputType, output)
 	}
 
-	exprMan.updateCache(img.bucket, img.s3Key, paramsExprName, selectorsSum, outputMap)
+	exprMan.updateCache(generation, img.bucket, img.s3Key, paramsExprName, selectorsSum, outputMap)
 
 	return outputMap, nil
 }
 
 func (exprMan *expressionManager) externalViewerURL(ctx context.Context, img image, viewerExprName string) (string, error) {
-	viewerURLExpr, found := exprMan.exprs[img.imgGroup][img.imgType][viewerExprName]
+	generation := exprMan.currentGeneration()
+	viewerURLExpr, found := exprMan.programs(img.imgGroup, img.imgType)[viewerExprName]
 	if !found {
 		return "", fmt.Errorf("%w %q", errMissingExpression, viewerExprName)
 	}
 
-	env := types.ExprEnv{
-		Ctx:   ctx,
-		Files: exprMan.valueMap2FilesMap(img),
-		Exprs: exprMan.exprs[img.imgGroup][img.imgType],
-	}
-	selectorsSum := dynamicFilesChecksum(env.Files)
+	env, selectorsSum := exprMan.exprEnv(ctx, img, nil)
 
-	if value, ok := exprMan.getCache(img.bucket, img.s3Key, viewerExprName, selectorsSum); ok {
+	if value, ok := exprMan.cached(img, viewerExprName, selectorsSum); ok {
 		return value.(string), nil //nolint: forcetypeassert
 	}
 
-	output, err := expr.Run(viewerURLExpr, env)
+	output, err := exprMan.run(img, viewerExprName, viewerURLExpr, env)
 	if err != nil {
 		return "", fmt.Errorf("expr: %w", err)
 	}
@@ -425,29 +708,25 @@ func (exprMan *expressionManager) externalViewerURL(ctx context.Context, img ima
 		return "", fmt.Errorf("%w: want string, got %T", errUnexpectedOutputType, output)
 	}
 
-	exprMan.updateCache(img.bucket, img.s3Key, viewerExprName, selectorsSum, outputURL)
+	exprMan.updateCache(generation, img.bucket, img.s3Key, viewerExprName, selectorsSum, outputURL)
 
 	return outputURL, nil
 }
 
 func (exprMan *expressionManager) promLabels(ctx context.Context, img image) (map[string]any, error) {
-	labelsExpr, found := exprMan.exprs[img.imgGroup][img.imgType][types.ExprProductLabels]
+	generation := exprMan.currentGeneration()
+	labelsExpr, found := exprMan.programs(img.imgGroup, img.imgType)[types.ExprProductLabels]
 	if !found {
 		return nil, nil //nolint: nilnil
 	}
 
-	env := types.ExprEnv{
-		Ctx:   ctx,
-		Files: exprMan.valueMap2FilesMap(img),
-		Exprs: exprMan.exprs[img.imgGroup][img.imgType],
-	}
-	selectorsSum := dynamicFilesChecksum(env.Files)
+	env, selectorsSum := exprMan.exprEnv(ctx, img, nil)
 
-	if value, ok := exprMan.getCache(img.bucket, img.s3Key, types.ExprProductLabels, selectorsSum); ok {
+	if value, ok := exprMan.cached(img, types.ExprProductLabels, selectorsSum); ok {
 		return value.(map[string]any), nil //nolint: forcetypeassert
 	}
 
-	output, err := expr.Run(labelsExpr, env)
+	output, err := exprMan.run(img, types.ExprProductLabels, labelsExpr, env)
 	if err != nil {
 		return nil, fmt.Errorf("expr: %w", err)
 	}
@@ -457,21 +736,42 @@ func (exprMan *expressionManager) promLabels(ctx context.Context, img image) (ma
 		return nil, fmt.Errorf("%w: want map[string]any, got %T", errUnexpectedOutputType, output)
 	}
 
-	exprMan.updateCache(img.bucket, img.s3Key, types.ExprProductLabels, selectorsSum, outputMap)
+	exprMan.updateCache(generation, img.bucket, img.s3Key, types.ExprProductLabels, selectorsSum, outputMap)
 
 	return outputMap, nil
 }
 
 func (exprMan *expressionManager) precomputeDynamicFiles(img image) envFilesPrecomputed {
 	files := exprMan.valueMap2FilesMap(img)
-	checksum := dynamicFilesChecksum(files)
+	fileLists := exprMan.valueMap2FileListsMap(img)
+	checksum := dynamicFilesChecksum(files, fileLists)
 
 	return envFilesPrecomputed{
-		checksum: checksum,
-		files:    files,
+		checksum:  checksum,
+		files:     files,
+		fileLists: fileLists,
 	}
 }
 
+// exprEnv returns the evaluation environment of the given image along with the checksum of its files.
+// The precomputed files are used if given, otherwise they are computed on the fly.
+func (exprMan *expressionManager) exprEnv(ctx context.Context, img image, precomputedFiles *envFilesPrecomputed) (types.ExprEnv, string) {
+	if precomputedFiles == nil {
+		files := exprMan.precomputeDynamicFiles(img)
+		precomputedFiles = &files
+	}
+
+	return types.ExprEnv{
+		Ctx:        ctx,
+		Files:      precomputedFiles.files,
+		FileLists:  precomputedFiles.fileLists,
+		Exprs:      exprMan.programs(img.imgGroup, img.imgType),
+		Namespaces: exprMan.xmlNamespaces(img.imgGroup, img.imgType),
+		Geocoder:   exprMan.reverseGeocoder(),
+		Limits:     exprMan.exprLimits(),
+	}, precomputedFiles.checksum
+}
+
 func (exprMan *expressionManager) valueMap2FilesMap(img image) map[string]types.DynamicInputFile {
 	result := make(map[string]types.DynamicInputFile, len(img.dynamicInputFiles)+1)
 
@@ -491,7 +791,14 @@ func (exprMan *expressionManager) valueMap2FilesMap(img image) map[string]types.
 		result[key] = v
 	}
 
-	for _, sel := range exprMan.fileSelectors[img.imgGroup][img.imgType] {
+	// Selectors matching multiple objects expose their first file to the single-file functions.
+	for key, files := range exprMan.valueMap2FileListsMap(img) {
+		if len(files) > 0 {
+			result[key] = files[0]
+		}
+	}
+
+	for _, sel := range exprMan.selectors(img.imgGroup, img.imgType) {
 		if _, exists := result[sel]; !exists {
 			result[sel] = types.DynamicInputFile{}
 		}
@@ -500,30 +807,193 @@ func (exprMan *expressionManager) valueMap2FilesMap(img image) map[string]types.
 	return result
 }
 
-func dynamicFilesChecksum(selectors map[string]types.DynamicInputFile) string {
-	keys := slices.Sorted(maps.Keys(selectors))
+func (exprMan *expressionManager) valueMap2FileListsMap(img image) map[string][]types.DynamicInputFile {
+	result := make(map[string][]types.DynamicInputFile, len(img.multiDynamicInputFiles))
 
-	h := sha256.New()
+	for key, values := range img.multiDynamicInputFiles {
+		files := make([]types.DynamicInputFile, 0, len(values))
 
-	for _, k := range keys {
-		v := selectors[k]
+		for _, value := range values {
+			v := value.value
+			if v.CacheKey != "" {
+				v.CacheKey = filepath.Join(exprMan.cacheDir, v.CacheKey)
+			}
 
-		// Drop monotonic clock and normalize zone so equal times hash equal.
-		t := v.Date.Round(0).UTC()
+			files = append(files, v)
+		}
 
-		h.Write([]byte(k))
-		h.Write([]byte{0})
-		h.Write([]byte(v.S3Bucket))
-		h.Write([]byte{0})
-		h.Write([]byte(v.S3Path))
-		h.Write([]byte{0})
+		slices.SortFunc(files, func(a, b types.DynamicInputFile) int {
+			return strings.Compare(a.S3Path, b.S3Path)
+		})
 
-		var buf [8]byte
-		binary.BigEndian.PutUint64(buf[:], uint64(t.UnixNano()))
-		h.Write(buf[:])
+		result[key] = files
+	}
+
+	return result
+}
 
-		h.Write([]byte{0xFF}) // entry delimiter
+func dynamicFilesChecksum(selectors map[string]types.DynamicInputFile, selectorLists map[string][]types.DynamicInputFile) string {
+	h := sha256.New()
+
+	for _, k := range slices.Sorted(maps.Keys(selectors)) {
+		writeDynamicFileChecksum(h, k, selectors[k])
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(selectorLists)) {
+		for _, v := range selectorLists[k] {
+			writeDynamicFileChecksum(h, k, v)
+		}
 	}
 
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+func writeDynamicFileChecksum(h hash.Hash, key string, file types.DynamicInputFile) {
+	// Drop monotonic clock and normalize zone so equal times hash equal.
+	t := file.Date.Round(0).UTC()
+
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(file.S3Bucket))
+	h.Write([]byte{0})
+	h.Write([]byte(file.S3Path))
+	h.Write([]byte{0})
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(t.UnixNano()))
+	h.Write(buf[:])
+
+	h.Write([]byte{0xFF}) // entry delimiter
+}
+
+// evaluationError describes the failure of the given expression of the given image.
+// If the error comes from an expression whose name is carried by the error, it is reported instead.
+func (exprMan *expressionManager) evaluationError(img image, exprName string, err error) types.EvaluationError {
+	var namedErr exprError
+	if errors.As(err, &namedErr) {
+		exprName = namedErr.exprName
+	}
+
+	return types.EvaluationError{
+		Expression:    exprName,
+		Message:       err.Error(),
+		FileSelectors: exprMan.referencedSelectors(img.imgGroup, img.imgType, exprName),
+	}
+}
+
+// referencedSelectors returns the sorted file selectors referenced by the given expression,
+// and by the expressions it calls.
+func (exprMan *expressionManager) referencedSelectors(imgGroup, imgType, exprName string) []string {
+	programs := exprMan.programs(imgGroup, imgType)
+	collector := stringCollector{values: make(map[string]bool), calls: make(map[string]bool)}
+	visited := make(map[string]bool)
+	queue := []string{exprName}
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		prgm, found := programs[name]
+		if visited[name] || !found {
+			continue
+		}
+
+		visited[name] = true
+		node := prgm.Node()
+		ast.Walk(&node, &collector)
+
+		for called := range collector.calls {
+			if !visited[called] {
+				queue = append(queue, called)
+			}
+		}
+	}
+
+	selectors := make([]string, 0)
+
+	for _, selector := range exprMan.selectors(imgGroup, imgType) {
+		if collector.values[selector] {
+			selectors = append(selectors, selector)
+		}
+	}
+
+	slices.Sort(selectors)
+
+	return selectors
+}
+
+// stringCollector collects the string literals of an expression,
+// which include the file selectors given to the functions and the Files members,
+// along with the names of the expressions statically given to _call.
+type stringCollector struct {
+	values map[string]bool
+	calls  map[string]bool
+}
+
+func (sc *stringCollector) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.StringNode:
+		sc.values[n.Value] = true
+	case *ast.CallNode:
+		callee, ok := n.Callee.(*ast.IdentifierNode)
+		if !ok || callee.Value != "_call" || len(n.Arguments) == 0 {
+			return
+		}
+
+		if name, ok := n.Arguments[0].(*ast.StringNode); ok {
+			sc.calls[name.Value] = true
+		}
+	}
+}
+
+// debug evaluates all the expressions of the given image, bypassing the cache.
+// The precomputed files are used if given, otherwise they are computed from the image.
+func (exprMan *expressionManager) debug(ctx context.Context, img image, precomputedFiles *envFilesPrecomputed) types.ImageDebug {
+	env, _ := exprMan.exprEnv(ctx, img, precomputedFiles)
+	programs := exprMan.programs(img.imgGroup, img.imgType)
+
+	result := types.ImageDebug{
+		Bucket:      img.bucket,
+		Key:         img.s3Key,
+		Group:       img.imgGroup,
+		Type:        img.imgType,
+		Files:       make(map[string]any, len(env.Files)+len(env.FileLists)),
+		Expressions: make([]types.ExprDebug, 0, len(programs)),
+	}
+
+	for selector, file := range env.Files {
+		if file.S3Path != "" {
+			result.Files[selector] = file.S3Path
+		}
+	}
+
+	for selector, files := range env.FileLists {
+		keys := make([]string, len(files))
+
+		for i, file := range files {
+			keys[i] = file.S3Path
+		}
+
+		result.Files[selector] = keys
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(programs)) {
+		start := time.Now()
+		output, err := types.RunExpr(programs[name], env)
+
+		exprDebug := types.ExprDebug{
+			Expression:    name,
+			Output:        output,
+			DurationMs:    float64(time.Since(start).Microseconds()) / 1000,
+			FileSelectors: exprMan.referencedSelectors(img.imgGroup, img.imgType, name),
+		}
+
+		if err != nil {
+			exprDebug.Error = err.Error()
+		}
+
+		result.Expressions = append(result.Expressions, exprDebug)
+	}
+
+	return result
+}
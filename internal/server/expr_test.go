@@ -2,15 +2,23 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/observability"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/s3"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -215,3 +223,673 @@ func TestExprExternalViewerURLUnexpectedOutputType(t *testing.T) {
 		t.Fatalf("Unexpected error: want %q, got %q", "unexpected output type: want string, got int", err.Error())
 	}
 }
+
+func TestExprProductInfoMultipleFiles(t *testing.T) {
+	t.Parallel()
+
+	objectLastModified := time.Date(2026, 6, 7, 12, 0, 0, 0, time.UTC)
+	dynamicData := config.DynamicData{
+		FileSelectors: map[string]config.FileSelector{
+			"bands": {
+				Regex:    `B\d+\.tif$`,
+				Kind:     config.FileSelectorKindCached,
+				Multiple: true,
+			},
+		},
+		Expressions: map[string]string{
+			types.ExprProductInfo: `{"title": _s3Key("bands"), "entries": _s3Keys("bands")}`,
+		},
+	}
+	exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+	img := image{
+		lastModified:    objectLastModified,
+		bucket:          "bucket",
+		s3Key:           "products/1/preview.jpg",
+		imgGroup:        imgGroup,
+		imgType:         imgType,
+		previewCacheKey: "products/1/preview.jpg",
+	}
+
+	for _, band := range []string{"B02", "B01"} {
+		img.setMultiDynamicInputFile("bands", "products/1/"+band+".tif", valueWithLastUpdate[types.DynamicInputFile]{
+			value: types.DynamicInputFile{
+				S3Bucket: "bucket",
+				S3Path:   "products/1/" + band + ".tif",
+				CacheKey: "bucket/products/1/" + band + ".tif",
+				Date:     objectLastModified,
+			},
+			lastUpdate: objectLastModified,
+		})
+	}
+
+	productInfo, err := exprMan.productInfo(t.Context(), img, nil)
+	if err != nil {
+		t.Fatal("Failed to evaluate product info:", err)
+	}
+
+	expected := types.ProductInformation{
+		Title:   "products/1/B01.tif",
+		Entries: []string{"products/1/B01.tif", "products/1/B02.tif"},
+	}
+
+	if diff := cmp.Diff(expected, *productInfo); diff != "" {
+		t.Fatalf("Unexpected product info (-want +got):\n%s", diff)
+	}
+
+	img.setMultiDynamicInputFile("bands", "products/1/B03.tif", valueWithLastUpdate[types.DynamicInputFile]{
+		value: types.DynamicInputFile{
+			S3Bucket: "bucket",
+			S3Path:   "products/1/B03.tif",
+			Date:     objectLastModified,
+		},
+		lastUpdate: objectLastModified,
+	})
+
+	productInfo, err = exprMan.productInfo(t.Context(), img, nil)
+	if err != nil {
+		t.Fatal("Failed to evaluate product info:", err)
+	}
+
+	if len(productInfo.Entries) != 3 {
+		t.Fatalf("Expected the new file to invalidate the cached value, got entries %q", productInfo.Entries)
+	}
+}
+
+func TestExprProductInfoNamespacedXML(t *testing.T) {
+	t.Parallel()
+
+	dynamicData := config.DynamicData{
+		FileSelectors: map[string]config.FileSelector{
+			"manifest": {
+				Regex:      `manifest\.safe$`,
+				Kind:       config.FileSelectorKindCached,
+				Namespaces: map[string]string{"safe": "http://www.esa.int/safe/sentinel/1.1"},
+			},
+		},
+		Expressions: map[string]string{
+			types.ExprProductInfo: `{"title": _xpath("manifest", "//safe:platform/safe:familyName"), "entries": _xpathAll("manifest", "//safe:band/@id")}`,
+		},
+	}
+	manifest := `<xfdu:XFDU xmlns:xfdu="urn:ccsds:schema:xfdu:1" xmlns:s="http://www.esa.int/safe/sentinel/1.1">
+	<s:platform><s:familyName>SENTINEL-2</s:familyName></s:platform>
+	<s:band id="B02"/><s:band id="B03"/>
+</xfdu:XFDU>`
+	exprMan := setupExprManTest(t, &dynamicData, nil, map[string]string{"bucket/products/1/manifest.safe": manifest})
+	img := image{
+		bucket:          "bucket",
+		s3Key:           "products/1/preview.jpg",
+		imgGroup:        imgGroup,
+		imgType:         imgType,
+		previewCacheKey: "products/1/preview.jpg",
+		dynamicInputFiles: map[string]valueWithLastUpdate[types.DynamicInputFile]{
+			"manifest": {value: types.DynamicInputFile{
+				S3Bucket: "bucket",
+				S3Path:   "products/1/manifest.safe",
+				CacheKey: "bucket/products/1/manifest.safe",
+			}},
+		},
+	}
+
+	productInfo, err := exprMan.productInfo(t.Context(), img, nil)
+	if err != nil {
+		t.Fatal("Failed to evaluate product info:", err)
+	}
+
+	expected := types.ProductInformation{
+		Title:   "SENTINEL-2",
+		Entries: []string{"B02", "B03"},
+	}
+
+	if diff := cmp.Diff(expected, *productInfo); diff != "" {
+		t.Fatalf("Unexpected product info (-want +got):\n%s", diff)
+	}
+}
+
+func TestExprMetrics(t *testing.T) {
+	t.Parallel()
+
+	dynamicData := config.DynamicData{
+		FileSelectors: map[string]config.FileSelector{
+			"info": {Regex: `info\.json$`, Kind: config.FileSelectorKindCached},
+		},
+		Expressions: map[string]string{
+			types.ExprProductInfo: "_loadJSON('info')",
+		},
+	}
+	files := map[string]string{
+		"prod/1/info.json": `{"title": "Product 1"}`,
+	}
+	exprMan := setupExprManTest(t, &dynamicData, map[string]string{}, files)
+	exprMan.limits = types.ExprLimits{MaxFileSize: 10}
+
+	labels := []string{"group", "type", "expression"}
+	registry := prometheus.NewPedanticRegistry()
+	exprMan.gatherer = &observability.Metrics{
+		ExprErrorsCounter: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "errors", Help: "test counter"}, append(labels, "reason")),
+		ExprDuration:      prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration", Help: "test histogram"}, labels),
+		ExprCacheCounter:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "cache", Help: "test counter"}, append(labels, "result")),
+	}
+	registry.MustRegister(exprMan.gatherer.ExprErrorsCounter, exprMan.gatherer.ExprDuration, exprMan.gatherer.ExprCacheCounter)
+
+	img := image{
+		bucket:   "prod",
+		s3Key:    "1/preview.jpg",
+		imgGroup: imgGroup,
+		imgType:  imgType,
+		dynamicInputFiles: map[string]valueWithLastUpdate[types.DynamicInputFile]{
+			"info": {value: types.DynamicInputFile{S3Bucket: "prod", S3Path: "1/info.json", CacheKey: "prod/1/info.json"}},
+		},
+	}
+
+	_, err := exprMan.productInfo(t.Context(), img, nil)
+	if !errors.Is(err, types.ErrExprFileTooLarge) {
+		t.Fatalf("Expected error %q, got %v.", types.ErrExprFileTooLarge, err)
+	}
+
+	exprMan.limits = types.ExprLimits{}
+
+	for i := range 2 { // the 2nd call hits the cache
+		_, err = exprMan.productInfo(t.Context(), img, nil)
+		if err != nil {
+			t.Fatalf("[call %d] Unexpected error: %v", i+1, err)
+		}
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]float64)
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "reason" || label.GetName() == "result" {
+					name += "/" + label.GetValue()
+				}
+			}
+
+			got[name] = metric.GetCounter().GetValue() + float64(metric.GetHistogram().GetSampleCount())
+		}
+	}
+
+	expected := map[string]float64{
+		"errors/file_size": 1,
+		"duration":         2,
+		"cache/miss":       2,
+		"cache/hit":        1,
+	}
+
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("Unexpected metrics (-want +got):\n%s", diff)
+	}
+
+	evaluations := exprMan.evaluations.slowest(-1)
+	if len(evaluations) != 2 {
+		t.Fatalf("Expected 2 logged evaluations, got %d", len(evaluations))
+	}
+
+	for _, evaluation := range evaluations {
+		if evaluation.Expression != types.ExprProductInfo || evaluation.Key != img.s3Key || evaluation.Group != imgGroup || evaluation.Type != imgType {
+			t.Fatalf("Unexpected evaluation %+v", evaluation)
+		}
+	}
+}
+
+func TestExprDebug(t *testing.T) {
+	t.Parallel()
+
+	dynamicData := config.DynamicData{
+		FileSelectors: map[string]config.FileSelector{
+			"info":    {Regex: `info\.json$`, Kind: config.FileSelectorKindCached},
+			"missing": {Regex: `missing\.json$`, Kind: config.FileSelectorKindCached},
+		},
+		Expressions: map[string]string{
+			"title":  "_loadJSON('info').title",
+			"label":  "'Product: ' + _call('title')",
+			"broken": "_loadJSON('missing').title",
+		},
+	}
+	files := map[string]string{
+		"prod/1/info.json": `{"title": "Product 1"}`,
+	}
+	exprMan := setupExprManTest(t, &dynamicData, map[string]string{}, files)
+
+	img := image{
+		bucket:   "prod",
+		s3Key:    "1/preview.jpg",
+		imgGroup: imgGroup,
+		imgType:  imgType,
+		dynamicInputFiles: map[string]valueWithLastUpdate[types.DynamicInputFile]{
+			"info": {value: types.DynamicInputFile{S3Bucket: "prod", S3Path: "1/info.json", CacheKey: "prod/1/info.json"}},
+		},
+	}
+
+	imgDebug := exprMan.debug(t.Context(), img, nil)
+
+	if diff := cmp.Diff(map[string]any{"info": "1/info.json", types.ObjectPreview: "1/preview.jpg"}, imgDebug.Files); diff != "" {
+		t.Errorf("Unexpected files (-want +got):\n%s", diff)
+	}
+
+	got := make(map[string]types.ExprDebug, len(imgDebug.Expressions))
+
+	for _, exprDebug := range imgDebug.Expressions {
+		if exprDebug.DurationMs < 0 {
+			t.Errorf("Expected a positive duration for expression %q, got %f", exprDebug.Expression, exprDebug.DurationMs)
+		}
+
+		exprDebug.DurationMs = 0
+		got[exprDebug.Expression] = exprDebug
+	}
+
+	if got["broken"].Error == "" {
+		t.Errorf("Expected an error for expression %q, got none", "broken")
+	}
+
+	expected := map[string]types.ExprDebug{
+		"title":  {Expression: "title", Output: "Product 1", FileSelectors: []string{"info"}},
+		"label":  {Expression: "label", Output: "Product: Product 1", FileSelectors: []string{"info"}},
+		"broken": {Expression: "broken", Error: got["broken"].Error, FileSelectors: []string{"missing"}},
+	}
+
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("Unexpected expressions (-want +got):\n%s", diff)
+	}
+
+	filterErr := fmt.Errorf("filter %q: %w", "Label", exprError{exprName: "label", err: errors.New("boom")})
+
+	evaluationErr := exprMan.evaluationError(img, "", filterErr)
+	expectedErr := types.EvaluationError{
+		Expression:    "label",
+		Message:       `filter "Label": boom`,
+		FileSelectors: []string{"info"},
+	}
+
+	if diff := cmp.Diff(expectedErr, evaluationErr); diff != "" {
+		t.Fatalf("Unexpected evaluation error (-want +got):\n%s", diff)
+	}
+}
+
+func TestExprDynamicFilters(t *testing.T) {
+	t.Parallel()
+
+	dynamicData := config.DynamicData{
+		FileSelectors: map[string]config.FileSelector{
+			"missing": {Regex: `missing\.json$`, Kind: config.FileSelectorKindCached},
+		},
+		Expressions: map[string]string{
+			"cloudCover":  "12.5",
+			"satellite":   "'S2A'",
+			"broken":      "_loadJSON('missing').level",
+			"productInfo": `{"title": "S2A"}`,
+		},
+	}
+	exprMan := setupExprManTest(t, &dynamicData, map[string]string{}, nil)
+	exprMan.dynFilters = map[string]map[string][]config.DynamicFilter{
+		imgGroup: {imgType: {
+			{Name: "Cloud cover", Expression: "cloudCover", Type: config.DynamicFilterTypeNumber},
+			{Name: "Level", Expression: "broken", Type: config.DynamicFilterTypeNumber},
+			{Name: "Satellite count", Expression: "satellite", Type: config.DynamicFilterTypeNumber},
+			{Name: "Satellite", Expression: "satellite", Type: config.DynamicFilterTypeString},
+			{Name: "Info", Expression: "productInfo", Type: config.DynamicFilterTypeString},
+		}},
+	}
+
+	img := image{bucket: "prod", s3Key: "1/preview.jpg", imgGroup: imgGroup, imgType: imgType}
+
+	// The decoded product info is cached first, which must not change the value of the filter.
+	if _, err := exprMan.productInfo(t.Context(), img, nil); err != nil {
+		t.Fatal("Failed to evaluate the product info:", err)
+	}
+
+	// The second evaluation uses the cached outputs.
+	for range 2 {
+		values, errs := exprMan.dynamicFilters(t.Context(), img, nil)
+
+		expectedValues := map[string]any{"Cloud cover": 12.5, "Satellite": "S2A", "Info": "map[title:S2A]"}
+		if diff := cmp.Diff(expectedValues, values); diff != "" {
+			t.Errorf("Unexpected values (-want +got):\n%s", diff)
+		}
+
+		failed := make([]string, 0, len(errs))
+		for _, err := range errs {
+			failed = append(failed, exprMan.evaluationError(img, "", err).Expression)
+		}
+
+		if diff := cmp.Diff([]string{"broken", "satellite", "productInfo"}, failed); diff != "" {
+			t.Errorf("Unexpected failed expressions (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestExprLocalizationReprojection(t *testing.T) {
+	t.Parallel()
+
+	corners := func(ul, ur, lr, ll [2]float64) string {
+		return fmt.Sprintf(`{"upper-left": {"coordinates": {"lon": %v, "lat": %v}}, "upper-right": {"coordinates": {"lon": %v, "lat": %v}},
+			"lower-right": {"coordinates": {"lon": %v, "lat": %v}}, "lower-left": {"coordinates": {"lon": %v, "lat": %v}}}`,
+			ul[0], ul[1], ur[0], ur[1], lr[0], lr[1], ll[0], ll[1])
+	}
+
+	cases := []struct {
+		name        string
+		expression  string
+		expectedUL  [2]float64
+		expectedLR  [2]float64
+		expectedErr bool
+	}{
+		{
+			name:       "WGS 84 by default",
+			expression: `{"corner": ` + corners([2]float64{2, 49}, [2]float64{3, 49}, [2]float64{3, 48}, [2]float64{2, 48}) + `}`,
+			expectedUL: [2]float64{2, 49},
+			expectedLR: [2]float64{3, 48},
+		},
+		{
+			name: "UTM",
+			expression: `{"crs": "EPSG:32631", "corner": ` +
+				corners([2]float64{500000, 100000}, [2]float64{600000, 100000}, [2]float64{600000, 0}, [2]float64{500000, 0}) + `}`,
+			expectedUL: [2]float64{3, 0.9047},
+			expectedLR: [2]float64{3.8986, 0},
+		},
+		{
+			name:       "crossing the antimeridian",
+			expression: `{"crs": "CRS84", "corner": ` + corners([2]float64{179, 10}, [2]float64{-179, 10}, [2]float64{-179, 9}, [2]float64{179, 9}) + `}`,
+			expectedUL: [2]float64{179, 10},
+			expectedLR: [2]float64{181, 9},
+		},
+		{
+			name:        "unsupported reference system",
+			expression:  `{"crs": "EPSG:27700", "corner": ` + corners([2]float64{0, 0}, [2]float64{0, 0}, [2]float64{0, 0}, [2]float64{0, 0}) + `}`,
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dynamicData := config.DynamicData{
+				Expressions: map[string]string{types.ExprLocalization: tc.expression},
+			}
+			exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+			img := image{
+				bucket:   "bucket",
+				s3Key:    "products/1/preview.jpg",
+				imgGroup: imgGroup,
+				imgType:  imgType,
+			}
+
+			localization, err := exprMan.imageLocalization(t.Context(), img, nil)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatal("Expected an error for an unsupported reference system")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal("Failed to evaluate localization:", err)
+			}
+
+			if localization.CRS != types.LocalizationCRS {
+				t.Fatalf("Unexpected CRS %q", localization.CRS)
+			}
+
+			round := func(point types.Point) [2]float64 {
+				return [2]float64{
+					math.Round(point.Coordinates.Lon*1e4) / 1e4,
+					math.Round(point.Coordinates.Lat*1e4) / 1e4,
+				}
+			}
+
+			if ul := round(localization.Corner.UpperLeft); ul != tc.expectedUL {
+				t.Fatalf("Unexpected upper left corner %v, want %v", ul, tc.expectedUL)
+			}
+
+			if lr := round(localization.Corner.LowerRight); lr != tc.expectedLR {
+				t.Fatalf("Unexpected lower right corner %v, want %v", lr, tc.expectedLR)
+			}
+		})
+	}
+}
+
+func TestExprLocalizationGeometry(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		expression       string
+		expectedGeometry *types.Geometry
+		expectedCorner   [4][2]float64
+		expectedErr      error
+	}{
+		{
+			name: "polygon",
+			expression: `{"geometry": {"type": "Polygon", "coordinates": [
+				[[2, 48], [3, 48.5], [2.5, 49], [1.5, 48.8], [2, 48]],
+				[[2.2, 48.4], [2.4, 48.4], [2.4, 48.6], [2.2, 48.4]]
+			]}}`,
+			expectedGeometry: &types.Geometry{
+				Type: types.GeometryPolygon,
+				Polygons: [][][][2]float64{{
+					{{2, 48}, {3, 48.5}, {2.5, 49}, {1.5, 48.8}, {2, 48}},
+					{{2.2, 48.4}, {2.4, 48.4}, {2.4, 48.6}, {2.2, 48.4}},
+				}},
+			},
+			expectedCorner: [4][2]float64{{1.5, 49}, {3, 49}, {3, 48}, {1.5, 48}},
+		},
+		{
+			name: "multipolygon crossing the antimeridian",
+			expression: `{"crs": "EPSG:4326", "geometry": {"type": "MultiPolygon", "coordinates": [
+				[[[179, 10, 100], [180, 10, 100], [180, 9, 100], [179, 10, 100]]],
+				[[[-180, 10], [-179, 10], [-179, 9], [-180, 10]]]
+			]}}`,
+			expectedGeometry: &types.Geometry{
+				Type: types.GeometryMultiPolygon,
+				Polygons: [][][][2]float64{
+					{{{179, 10}, {180, 10}, {180, 9}, {179, 10}}},
+					{{{180, 10}, {181, 10}, {181, 9}, {180, 10}}},
+				},
+			},
+			expectedCorner: [4][2]float64{{179, 10}, {181, 10}, {181, 9}, {179, 9}},
+		},
+		{
+			name:        "unclosed ring",
+			expression:  `{"geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 1]]]}}`,
+			expectedErr: types.ErrInvalidGeometry,
+		},
+		{
+			name:        "unsupported type",
+			expression:  `{"geometry": {"type": "Point", "coordinates": [0, 0]}}`,
+			expectedErr: types.ErrInvalidGeometry,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dynamicData := config.DynamicData{
+				Expressions: map[string]string{types.ExprLocalization: tc.expression},
+			}
+			exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+			img := image{bucket: "bucket", s3Key: "products/1/preview.jpg", imgGroup: imgGroup, imgType: imgType}
+
+			localization, err := exprMan.imageLocalization(t.Context(), img, nil)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Unexpected error: want %v, got %v", tc.expectedErr, err)
+			}
+
+			if tc.expectedErr != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tc.expectedGeometry, localization.Geometry); diff != "" {
+				t.Fatalf("Unexpected geometry (-want +got):\n%s", diff)
+			}
+
+			corner := [4][2]float64{}
+
+			for i, point := range []types.Point{
+				localization.Corner.UpperLeft, localization.Corner.UpperRight, localization.Corner.LowerRight, localization.Corner.LowerLeft,
+			} {
+				corner[i] = [2]float64{point.Coordinates.Lon, point.Coordinates.Lat}
+			}
+
+			if corner != tc.expectedCorner {
+				t.Fatalf("Unexpected corners %v, want %v", corner, tc.expectedCorner)
+			}
+		})
+	}
+}
+
+func TestExprReverseGeocode(t *testing.T) {
+	t.Parallel()
+
+	dynamicData := config.DynamicData{
+		Expressions: map[string]string{
+			types.ExprGeonames: `_reverseGeocode({"geometry": {"type": "Polygon", "coordinates": [
+				[[2.3, 48.8], [2.4, 48.8], [2.4, 48.9], [2.3, 48.9], [2.3, 48.8]]
+			]}})`,
+		},
+	}
+	exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+	img := image{bucket: "bucket", s3Key: "products/1/preview.jpg", imgGroup: imgGroup, imgType: imgType}
+
+	_, err := exprMan.imageGeonames(t.Context(), img, nil)
+	if err == nil {
+		t.Fatal("Expected an error without gazetteer")
+	}
+
+	gazetteerDir := filepath.Join("..", "gazetteer", "testdata")
+	cfg := config.Config{Products: config.Products{
+		ImageGroups: []config.ImageGroup{{GroupName: imgGroup, Types: []config.ImageType{{Name: imgType, DynamicData: dynamicData}}}},
+		Gazetteer: config.Gazetteer{
+			CitiesFile:      filepath.Join(gazetteerDir, "cities.txt"),
+			Admin1CodesFile: filepath.Join(gazetteerDir, "admin1CodesASCII.txt"),
+			Admin2CodesFile: filepath.Join(gazetteerDir, "admin2Codes.txt"),
+			CountryInfoFile: filepath.Join(gazetteerDir, "countryInfo.txt"),
+		},
+	}}
+
+	exprMan.reload(cfg)
+
+	geonames, err := exprMan.imageGeonames(t.Context(), img, nil)
+	if err != nil {
+		t.Fatal("Failed to evaluate geonames:", err)
+	}
+
+	if topLevel := geonames.GetTopLevel(); topLevel != "France / Île-de-France / Paris / Paris" {
+		t.Fatalf("Unexpected top level %q", topLevel)
+	}
+
+	// A gazetteer that can't be read doesn't replace the previous one.
+	cfg.Products.Gazetteer.CitiesFile = filepath.Join(gazetteerDir, "missing.txt")
+	exprMan.reload(cfg)
+
+	if _, err = exprMan.imageGeonames(t.Context(), img, nil); err != nil {
+		t.Fatal("Failed to evaluate geonames with the previous gazetteer:", err)
+	}
+}
+
+func TestExprReverseGeocodeReloadsChangedFiles(t *testing.T) {
+	t.Parallel()
+
+	dynamicData := config.DynamicData{
+		Expressions: map[string]string{
+			types.ExprGeonames: `_reverseGeocode({"geometry": {"type": "Polygon", "coordinates": [
+				[[2.3, 48.8], [2.4, 48.8], [2.4, 48.9], [2.3, 48.9], [2.3, 48.8]]
+			]}})`,
+		},
+	}
+	exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+	img := image{bucket: "bucket", s3Key: "products/1/preview.jpg", imgGroup: imgGroup, imgType: imgType}
+
+	gazetteerDir := t.TempDir()
+
+	for _, name := range []string{"cities.txt", "admin1CodesASCII.txt", "admin2Codes.txt", "countryInfo.txt"} {
+		content, err := os.ReadFile(filepath.Join("..", "gazetteer", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = os.WriteFile(filepath.Join(gazetteerDir, name), content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.Config{Products: config.Products{
+		ImageGroups: []config.ImageGroup{{GroupName: imgGroup, Types: []config.ImageType{{Name: imgType, DynamicData: dynamicData}}}},
+		Gazetteer: config.Gazetteer{
+			CitiesFile:      filepath.Join(gazetteerDir, "cities.txt"),
+			Admin1CodesFile: filepath.Join(gazetteerDir, "admin1CodesASCII.txt"),
+			Admin2CodesFile: filepath.Join(gazetteerDir, "admin2Codes.txt"),
+			CountryInfoFile: filepath.Join(gazetteerDir, "countryInfo.txt"),
+		},
+	}}
+
+	exprMan.reload(cfg)
+
+	geonames, err := exprMan.imageGeonames(t.Context(), img, nil)
+	if err != nil {
+		t.Fatal("Failed to evaluate geonames:", err)
+	}
+
+	if topLevel := geonames.GetTopLevel(); topLevel != "France / Île-de-France / Paris / Paris" {
+		t.Fatalf("Unexpected top level %q", topLevel)
+	}
+
+	// The same configuration is reloaded, but the content of the cities file changed.
+	cities, err := os.ReadFile(cfg.Products.Gazetteer.CitiesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cities = []byte(strings.Replace(string(cities), "\tParis\tParis\t", "\tLutetia\tLutetia\t", 1))
+
+	if err = os.WriteFile(cfg.Products.Gazetteer.CitiesFile, cities, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	exprMan.reload(cfg)
+
+	geonames, err = exprMan.imageGeonames(t.Context(), img, nil)
+	if err != nil {
+		t.Fatal("Failed to evaluate geonames:", err)
+	}
+
+	if topLevel := geonames.GetTopLevel(); topLevel != "France / Île-de-France / Paris / Lutetia" {
+		t.Fatalf("Unexpected top level %q after the cities file changed", topLevel)
+	}
+}
+
+func TestExprCacheSkipsStaleGeneration(t *testing.T) {
+	t.Parallel()
+
+	dynamicData := config.DynamicData{
+		Expressions: map[string]string{
+			types.ExprProductBasePath: `"products/"`,
+		},
+	}
+	exprMan := setupExprManTest(t, &dynamicData, nil, nil)
+
+	generation := exprMan.currentGeneration()
+
+	// The configuration is reloaded while an evaluation is running with the previous programs.
+	exprMan.reload(config.Config{})
+	exprMan.updateCache(generation, "bucket", "key", types.ExprProductBasePath, "sum", "stale")
+
+	if value, ok := exprMan.getCache("bucket", "key", types.ExprProductBasePath, "sum"); ok {
+		t.Fatalf("Unexpected cached value %v from a previous generation", value)
+	}
+
+	exprMan.updateCache(exprMan.currentGeneration(), "bucket", "key", types.ExprProductBasePath, "sum", "fresh")
+
+	if value, ok := exprMan.getCache("bucket", "key", types.ExprProductBasePath, "sum"); !ok || value != "fresh" {
+		t.Fatalf("Unexpected cached value %v (found: %t), want %q", value, ok, "fresh")
+	}
+}
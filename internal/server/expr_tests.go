@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/s3"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// ExprTestResult is the outcome of an expression test.
+type ExprTestResult struct {
+	Test config.ExprTest
+	// Err is set when the test could not be run.
+	Err         error
+	Expressions []ExprTestOutcome
+}
+
+// ExprTestOutcome is the outcome of the evaluation of a single expression of a test.
+type ExprTestOutcome struct {
+	Name     string
+	Duration time.Duration
+	// Err is set when the evaluation failed.
+	Err error
+	// Diff is the difference between the expected and the actual outputs, empty when they match.
+	Diff string
+}
+
+// Passed reports whether all the expressions of the test produced the expected outputs.
+func (result ExprTestResult) Passed() bool {
+	if result.Err != nil {
+		return false
+	}
+
+	for _, outcome := range result.Expressions {
+		if outcome.Err != nil || outcome.Diff != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RunExprTests evaluates the expressions of the given tests against their fixtures,
+// the same way they are evaluated for the images found on S3.
+// Each test is run with a fresh expression cache, so the durations don't depend on the previous tests.
+func RunExprTests(ctx context.Context, cfg config.Config, tests []config.ExprTest) []ExprTestResult {
+	results := make([]ExprTestResult, len(tests))
+
+	for i, test := range tests {
+		results[i] = runExprTest(ctx, cfg, test)
+	}
+
+	return results
+}
+
+func runExprTest(ctx context.Context, cfg config.Config, test config.ExprTest) ExprTestResult {
+	result := ExprTestResult{Test: test}
+
+	img, err := testImage(cfg, test)
+	if err != nil {
+		result.Err = err
+
+		return result
+	}
+
+	exprMan := newExpressionManager(cfg)
+	exprMan.cacheDir = "" // the fixtures paths are already resolved
+
+	for _, name := range slices.Sorted(maps.Keys(test.Expected)) {
+		outcome := ExprTestOutcome{Name: name}
+
+		start := time.Now()
+		output, err := exprMan.evaluate(ctx, img, name)
+		outcome.Duration = time.Since(start)
+
+		if err != nil {
+			outcome.Err = err
+		} else {
+			outcome.Diff, outcome.Err = diffOutputs(test.Expected[name], output)
+		}
+
+		result.Expressions = append(result.Expressions, outcome)
+	}
+
+	return result
+}
+
+// testImage builds the image described by the given test, with its fixtures as cached files.
+func testImage(cfg config.Config, test config.ExprTest) (image, error) {
+	var (
+		group   config.ImageGroup
+		imgType config.ImageType
+		found   bool
+	)
+
+	for _, grp := range cfg.Products.ImageGroups {
+		for _, typ := range grp.Types {
+			if grp.GroupName == test.Group && typ.Name == test.Type {
+				group, imgType, found = grp, typ, true
+			}
+		}
+	}
+
+	if !found {
+		return image{}, fmt.Errorf("unknown image type %q/%q", test.Group, test.Type)
+	}
+
+	img := image{
+		lastModified:           test.LastModified,
+		bucket:                 group.Bucket,
+		s3Key:                  test.ObjectKey,
+		imgGroup:               test.Group,
+		imgType:                test.Type,
+		dynamicInputFiles:      make(map[string]valueWithLastUpdate[types.DynamicInputFile]),
+		multiDynamicInputFiles: make(map[string]map[string]valueWithLastUpdate[types.DynamicInputFile]),
+	}
+
+	for selector, files := range test.Files {
+		for _, file := range files {
+			if _, err := os.Stat(file.Path); err != nil {
+				return image{}, fmt.Errorf("fixture of selector %q: %w", selector, err)
+			}
+
+			if selector == types.ObjectPreview {
+				img.previewCacheKey = file.Path
+
+				continue
+			}
+
+			key := file.Key
+			if key == "" {
+				key = path.Join(path.Dir(test.ObjectKey), filepath.Base(file.Path))
+			}
+
+			inputFile := valueWithLastUpdate[types.DynamicInputFile]{
+				value: types.DynamicInputFile{
+					S3Bucket: group.Bucket,
+					S3Path:   key,
+					CacheKey: file.Path,
+					Date:     test.LastModified,
+				},
+				lastUpdate: test.LastModified,
+			}
+
+			if imgType.DynamicData.FileSelectors[selector].Multiple {
+				if img.multiDynamicInputFiles[selector] == nil {
+					img.multiDynamicInputFiles[selector] = make(map[string]valueWithLastUpdate[types.DynamicInputFile])
+				}
+
+				img.multiDynamicInputFiles[selector][key] = inputFile
+			} else if _, exists := img.dynamicInputFiles[selector]; !exists {
+				img.dynamicInputFiles[selector] = inputFile
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// evaluate runs the expression with the given name on the given image.
+// The expressions having a dedicated meaning are decoded as they are for the UI,
+// so that the decoding errors are reported as well.
+func (exprMan *expressionManager) evaluate(ctx context.Context, img image, name string) (any, error) {
+	switch name {
+	case types.ExprProductBasePath:
+		return exprMan.productBasePath(ctx, img.imgGroup, img.imgType, s3.Event{
+			Bucket:             img.bucket,
+			ObjectKey:          img.s3Key,
+			ObjectLastModified: img.lastModified,
+		})
+	case types.ExprGeonames:
+		geonames, err := exprMan.imageGeonames(ctx, img, nil)
+		if err != nil || geonames == nil {
+			return nil, err
+		}
+
+		return geonames.Objects, nil
+	case types.ExprLocalization:
+		localization, err := exprMan.imageLocalization(ctx, img, nil)
+		if err != nil || localization == nil {
+			return nil, err
+		}
+
+		return localization.Corner, nil
+	case types.ExprProductInfo:
+		productInfo, err := exprMan.productInfo(ctx, img, nil)
+		if err != nil || productInfo == nil {
+			return nil, err
+		}
+
+		return *productInfo, nil
+	case types.ExprProductLabels:
+		return exprMan.promLabels(ctx, img)
+	}
+
+	prgm, found := exprMan.programs(img.imgGroup, img.imgType)[name]
+	if !found {
+		return nil, fmt.Errorf("%w %q", errMissingExpression, name)
+	}
+
+	env, _ := exprMan.exprEnv(ctx, img, nil)
+
+	output, err := exprMan.run(img, name, prgm, env)
+	if err != nil {
+		return nil, fmt.Errorf("expr: %w", err)
+	}
+
+	return output, nil
+}
+
+// diffOutputs compares the expected and the actual outputs through their JSON representation,
+// so that the values written in YAML match the structures returned by the expressions.
+func diffOutputs(expected, actual any) (string, error) {
+	want, err := normalizeOutput(expected)
+	if err != nil {
+		return "", fmt.Errorf("invalid expected output: %w", err)
+	}
+
+	got, err := normalizeOutput(actual)
+	if err != nil {
+		return "", fmt.Errorf("invalid output: %w", err)
+	}
+
+	return cmp.Diff(want, got), nil
+}
+
+func normalizeOutput(value any) (any, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err //nolint: wrapcheck
+	}
+
+	var normalized any
+
+	err = json.Unmarshal(raw, &normalized)
+	if err != nil {
+		return nil, err //nolint: wrapcheck
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+)
+
+func TestRunExprTests(t *testing.T) {
+	t.Parallel()
+
+	fixturesDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(fixturesDir, "info.json"), []byte(`{"title": "Product 1", "entries": ["a", "b"]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynamicData := config.DynamicData{
+		FileSelectors: map[string]config.FileSelector{
+			types.ObjectPreview: {Regex: `preview\.jpg$`, Kind: config.FileSelectorKindCached},
+			"info":              {Regex: `info\.json$`, Kind: config.FileSelectorKindCached},
+			"bands":             {Regex: `\.tif$`, Kind: config.FileSelectorKindCached, Multiple: true},
+		},
+		Expressions: map[string]string{
+			types.ExprProductBasePath: "Files.preview.S3Path[:lastIndexOf(Files.preview.S3Path, '/')]",
+			types.ExprProductInfo:     "_loadJSON('info')",
+			"bandCount":               "len(FileLists.bands)",
+			"broken":                  "_loadJSON('missing').title",
+		},
+	}
+
+	err = config.ParseDynamicData(imgGroup, imgType, &dynamicData, nil)
+	if err != nil {
+		t.Fatal("Invalid dynamic data:", err)
+	}
+
+	cfg := config.Config{
+		Products: config.Products{
+			ImageGroups: []config.ImageGroup{
+				{
+					GroupName: imgGroup,
+					Bucket:    "bucket",
+					Types:     []config.ImageType{{Name: imgType, DynamicData: dynamicData}},
+				},
+			},
+		},
+	}
+	infoFixture := filepath.Join(fixturesDir, "info.json")
+	baseTest := config.ExprTest{
+		Group:        imgGroup,
+		Type:         imgType,
+		ObjectKey:    "products/1/preview.jpg",
+		LastModified: time.Date(2026, 6, 7, 12, 0, 0, 0, time.UTC),
+		Files: map[string][]config.TestFile{
+			"info":  {{Path: infoFixture}},
+			"bands": {{Path: infoFixture, Key: "products/1/b1.tif"}, {Path: infoFixture, Key: "products/1/b2.tif"}},
+		},
+	}
+
+	passing := baseTest
+	passing.Name = "passing"
+	passing.Expected = map[string]any{
+		types.ExprProductBasePath: "products/1",
+		types.ExprProductInfo:     map[string]any{"title": "Product 1", "subtitle": "", "entries": []any{"a", "b"}, "summary": ""},
+		"bandCount":               2,
+	}
+
+	mismatching := baseTest
+	mismatching.Name = "mismatching"
+	mismatching.Expected = map[string]any{
+		types.ExprProductBasePath: "products/2",
+		"broken":                  nil,
+	}
+
+	missingFixture := baseTest
+	missingFixture.Name = "missing fixture"
+	missingFixture.Files = map[string][]config.TestFile{"info": {{Path: filepath.Join(fixturesDir, "nope.json")}}}
+	missingFixture.Expected = map[string]any{types.ExprProductBasePath: "products/1"}
+
+	results := RunExprTests(t.Context(), cfg, []config.ExprTest{passing, mismatching, missingFixture})
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	if !results[0].Passed() {
+		t.Errorf("Expected test %q to pass, got %+v", passing.Name, results[0])
+	}
+
+	if results[1].Passed() || len(results[1].Expressions) != 2 {
+		t.Fatalf("Expected test %q to fail on 2 expressions, got %+v", mismatching.Name, results[1])
+	}
+
+	if outcome := results[1].Expressions[0]; outcome.Name != "broken" || outcome.Err == nil {
+		t.Errorf("Expected an evaluation error for expression %q, got %+v", "broken", outcome)
+	}
+
+	if outcome := results[1].Expressions[1]; outcome.Name != types.ExprProductBasePath || !strings.Contains(outcome.Diff, `"products/2"`) {
+		t.Errorf("Expected a diff for expression %q, got %+v", types.ExprProductBasePath, outcome)
+	}
+
+	if !errors.Is(results[2].Err, os.ErrNotExist) {
+		t.Errorf("Expected test %q to report a missing fixture, got %v", missingFixture.Name, results[2].Err)
+	}
+}
@@ -190,8 +190,8 @@ func TestDynamicFilesChecksum(t *testing.T) {
 		"preview": {S3Bucket: "bkt", S3Path: "a/preview.jpg", Date: t1},
 	}
 
-	sumA := dynamicFilesChecksum(a)
-	sumB := dynamicFilesChecksum(b)
+	sumA := dynamicFilesChecksum(a, nil)
+	sumB := dynamicFilesChecksum(b, nil)
 
 	if sumA != sumB {
 		t.Fatalf("expected stable checksum regardless of map order/time zone: %q vs %q", sumA, sumB)
@@ -199,7 +199,7 @@ func TestDynamicFilesChecksum(t *testing.T) {
 
 	b["meta"] = types.DynamicInputFile{S3Bucket: "bkt", S3Path: "a/meta-v2.json", Date: t1}
 
-	sumC := dynamicFilesChecksum(b)
+	sumC := dynamicFilesChecksum(b, nil)
 	if sumC == sumA {
 		t.Fatal("expected checksum to change when file content identity changes")
 	}
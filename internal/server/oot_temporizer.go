@@ -27,6 +27,7 @@ type objectTemporizer struct {
 	baseDirChan       chan string
 	temporizationChan chan s3Event
 	cache             *cache
+	cfgLock           sync.RWMutex
 	productsCfg       config.Products
 	unassignedObjects map[string][]oot
 	objectsLock       sync.Mutex
@@ -42,6 +43,20 @@ func newObjectTemporizer(baseDirChan chan string, ootChan chan s3Event, cache *c
 	}
 }
 
+func (op *objectTemporizer) products() config.Products {
+	op.cfgLock.RLock()
+	defer op.cfgLock.RUnlock()
+
+	return op.productsCfg
+}
+
+func (op *objectTemporizer) setProductsConfig(productsCfg config.Products) {
+	op.cfgLock.Lock()
+	defer op.cfgLock.Unlock()
+
+	op.productsCfg = productsCfg
+}
+
 func (op *objectTemporizer) goTemporize(ctx context.Context) {
 	go func() {
 		purgeTicker := time.NewTicker(ootPurgeInterval)
@@ -121,7 +136,7 @@ func (op *objectTemporizer) computeEvent(ootEvt s3Event, baseDir string) (s3Even
 		}
 
 		objKeyWithoutBaseDir := strings.TrimPrefix(ootEvt.ObjectKey, baseDir)
-		if op.productsCfg.TargetRelativeRgx.MatchString(objKeyWithoutBaseDir) {
+		if op.products().TargetRelativeRgx.MatchString(objKeyWithoutBaseDir) {
 			ootEvt.ObjectType = types.ObjectTarget
 		} else {
 			return s3Event{}, false
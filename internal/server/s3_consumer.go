@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
@@ -20,6 +21,10 @@ type s3Event struct {
 	baseDir  string
 	imgGroup config.ImageGroup
 	imgType  config.ImageType
+	// memberPath is the path of the member extracted from the object, relative to the dir of the archive members.
+	memberPath string
+	// convertedPreview tells whether the object is a TIFF preview which has been converted to PNG.
+	convertedPreview bool
 }
 
 func (evt s3Event) baseDirRelativePath() string {
@@ -29,25 +34,52 @@ func (evt s3Event) baseDirRelativePath() string {
 }
 
 type eventConsumer struct {
+	cfgLock              sync.RWMutex
 	productsCfg          config.Products
 	cacheRetentionPeriod time.Duration
 	cache                *cache
 	s3Chan               chan s3.Event
 	baseDirChan          chan string
 	temporizationChan    chan s3Event
+	temporizer           *objectTemporizer
+	// failingProductMatches holds the group and type names whose productMatch expression failed,
+	// which are only reported once until the configuration is reloaded.
+	failingProductMatches sync.Map
 }
 
 func newS3Consumer(cfg config.Config, cache *cache, s3Chan chan s3.Event) *eventConsumer {
+	baseDirChan := make(chan string, chanBuf)
+	temporizationChan := make(chan s3Event, chanBuf)
+
 	return &eventConsumer{
 		productsCfg:          cfg.Products,
 		cacheRetentionPeriod: cfg.Cache.RetentionPeriod,
 		cache:                cache,
 		s3Chan:               s3Chan,
-		baseDirChan:          make(chan string, chanBuf),
-		temporizationChan:    make(chan s3Event, chanBuf),
+		baseDirChan:          baseDirChan,
+		temporizationChan:    temporizationChan,
+		temporizer:           newObjectTemporizer(baseDirChan, temporizationChan, cache, cfg.Products),
 	}
 }
 
+func (consumer *eventConsumer) products() config.Products {
+	consumer.cfgLock.RLock()
+	defer consumer.cfgLock.RUnlock()
+
+	return consumer.productsCfg
+}
+
+// setProductsConfig replaces the products configuration used to dispatch the upcoming events.
+func (consumer *eventConsumer) setProductsConfig(productsCfg config.Products) {
+	consumer.cfgLock.Lock()
+	consumer.productsCfg = productsCfg
+	consumer.cfgLock.Unlock()
+
+	consumer.failingProductMatches.Clear()
+
+	consumer.temporizer.setProductsConfig(productsCfg)
+}
+
 func (consumer *eventConsumer) goConsumeEvents(ctx context.Context) {
 	go func() {
 		for ctx.Err() == nil {
@@ -66,12 +98,12 @@ func (consumer *eventConsumer) goConsumeEvents(ctx context.Context) {
 		}
 	}()
 
-	newObjectTemporizer(consumer.baseDirChan, consumer.temporizationChan, consumer.cache, consumer.productsCfg).goTemporize(ctx)
+	consumer.temporizer.goTemporize(ctx)
 }
 
 func (consumer *eventConsumer) processEvent(ctx context.Context, event s3.Event) {
 	if event.EventType == types.EventCreated {
-		if event.ObjectLastModified.Add(consumer.productsCfg.MaxObjectsAge).Before(time.Now()) ||
+		if event.ObjectLastModified.Add(consumer.products().MaxObjectsAge).Before(time.Now()) ||
 			time.Until(event.Time.Add(consumer.cacheRetentionPeriod)) < time.Second {
 			if event.ObjectType == types.ObjectPreview {
 				logger.Debugf("Ignoring image %s/%q because it is %s old", event.Bucket, event.ObjectKey, utils.FormatDuration(time.Since(event.ObjectLastModified)))
@@ -115,13 +147,23 @@ func (consumer *eventConsumer) processEvent(ctx context.Context, event s3.Event)
 }
 
 func (consumer *eventConsumer) getImageGroupType(bucket, objectKey string) (imgGroup config.ImageGroup, imgType config.ImageType, found bool) {
-	for _, imgGroup = range consumer.productsCfg.ImageGroups {
+	for _, imgGroup = range consumer.products().ImageGroups {
 		if bucket != imgGroup.Bucket {
 			continue
 		}
 
 		for _, imgType = range imgGroup.Types {
-			if strings.HasPrefix(objectKey, imgType.ProductPrefix) {
+			match, err := imgType.MatchesObject(bucket, objectKey)
+			if err != nil {
+				if _, reported := consumer.failingProductMatches.LoadOrStore([2]string{imgGroup.GroupName, imgType.Name}, true); !reported {
+					logger.Warnf("Failed to check whether %s/%q belongs to image type %q/%q, the next failures of this type won't be reported: %v",
+						bucket, objectKey, imgGroup.GroupName, imgType.Name, err)
+				}
+
+				continue
+			}
+
+			if match {
 				return imgGroup, imgType, true
 			}
 		}
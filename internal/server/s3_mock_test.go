@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/s3"
 )
 
@@ -14,6 +15,7 @@ type S3ClientMock struct {
 	PollOnceFn          func(ctx context.Context, bucket string, s3Chan chan s3.Event, timeout time.Duration) error
 	DownloadObjectFn    func(ctx context.Context, bucket, objectKey, destPath string) error
 	GenerateSignedURLFn func(ctx context.Context, bucket, objectKey string) (*url.URL, error)
+	UpdateProductsCfgFn func(productsCfg config.Products)
 }
 
 func (s3 S3ClientMock) BucketExists(ctx context.Context, bucket string) (bool, error) {
@@ -35,3 +37,9 @@ func (s3 S3ClientMock) DownloadObject(ctx context.Context, bucket, objectKey, de
 func (s3 S3ClientMock) GenerateSignedURL(ctx context.Context, bucket, objectKey string) (*url.URL, error) {
 	return s3.GenerateSignedURLFn(ctx, bucket, objectKey)
 }
+
+func (s3 S3ClientMock) UpdateProductsConfig(productsCfg config.Products) {
+	if s3.UpdateProductsCfgFn != nil {
+		s3.UpdateProductsCfgFn(productsCfg)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
@@ -20,14 +21,22 @@ var (
 )
 
 type Server struct {
+	// l guards cfg, buckets and bucketCancels, which change when the configuration is reloaded.
+	l        sync.RWMutex
 	cfg      config.Config
 	gatherer *observability.Metrics
 	buckets  []string
+	// map[bucket] -> function stopping the polling of / the subscription to the bucket
+	bucketCancels map[string]context.CancelFunc
 
 	s3Client s3.Client
 	s3Chan   chan s3.Event
-	outChan  chan types.OutEvent
-	cache    *cache
+	// s3ChanL is read-locked by the pollers while they send on s3Chan, which is closed under its write lock.
+	s3ChanL      sync.RWMutex
+	s3ChanClosed bool
+	outChan      chan types.OutEvent
+	cache        *cache
+	consumer     *eventConsumer
 }
 
 func New(cfg config.Config, gatherer *observability.Metrics) (*Server, error) {
@@ -36,6 +45,31 @@ func New(cfg config.Config, gatherer *observability.Metrics) (*Server, error) {
 		return nil, err //nolint:wrapcheck
 	}
 
+	buckets, err := bucketsOf(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	outEvents := make(chan types.OutEvent)
+
+	cache, err := newCache(cfg, s3Client, outEvents, gatherer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		cfg:           cfg,
+		gatherer:      gatherer,
+		buckets:       buckets,
+		bucketCancels: make(map[string]context.CancelFunc, len(buckets)),
+		s3Client:      s3Client,
+		s3Chan:        make(chan s3.Event),
+		outChan:       outEvents,
+		cache:         cache,
+	}, nil
+}
+
+func bucketsOf(cfg config.Config) ([]string, error) {
 	buckets := make([]string, 0)
 
 	for _, group := range cfg.Products.ImageGroups {
@@ -49,22 +83,7 @@ func New(cfg config.Config, gatherer *observability.Metrics) (*Server, error) {
 		}
 	}
 
-	outEvents := make(chan types.OutEvent)
-
-	cache, err := newCache(cfg, s3Client, outEvents, gatherer)
-	if err != nil {
-		return nil, err
-	}
-
-	return &Server{
-		cfg:      cfg,
-		gatherer: gatherer,
-		buckets:  buckets,
-		s3Client: s3Client,
-		s3Chan:   make(chan s3.Event),
-		outChan:  outEvents,
-		cache:    cache,
-	}, nil
+	return buckets, nil
 }
 
 func (srv *Server) Start(ctx context.Context) (types.Cache, chan types.OutEvent, error) {
@@ -79,7 +98,8 @@ func (srv *Server) Start(ctx context.Context) (types.Cache, chan types.OutEvent,
 		}
 	}
 
-	newS3Consumer(srv.cfg, srv.cache, srv.s3Chan).goConsumeEvents(ctx)
+	srv.consumer = newS3Consumer(srv.cfg, srv.cache, srv.s3Chan)
+	srv.consumer.goConsumeEvents(ctx)
 
 	var err error
 
@@ -104,43 +124,13 @@ func (srv *Server) Start(ctx context.Context) (types.Cache, chan types.OutEvent,
 }
 
 func (srv *Server) startPollingS3(ctx context.Context) error {
-	pollingPeriod := srv.cfg.S3.PollingPeriod
-
-	logger.Debugf("Starting to poll buckets with a period of %s", pollingPeriod)
+	logger.Debugf("Starting to poll buckets with a period of %s", srv.cfg.S3.PollingPeriod)
 
 	for _, bucket := range srv.buckets {
-		logger.Tracef("Starting to poll bucket %q", bucket)
-
-		err := srv.s3Client.PollOnce(ctx, bucket, srv.s3Chan, pollingPeriod)
+		err := srv.watchBucket(ctx, bucket)
 		if err != nil {
-			return err //nolint:wrapcheck
+			return err
 		}
-
-		time.AfterFunc(5*time.Second, func() { srv.cache.updateMetrics(ctx, bucket) })
-
-		go func(bucket string) {
-			for {
-				select {
-				case <-time.After(pollingPeriod):
-					t0 := time.Now()
-
-					err := srv.s3Client.PollOnce(ctx, bucket, srv.s3Chan, pollingPeriod)
-					if err != nil {
-						logger.Errorf("Failed to poll bucket %q: %v", bucket, err)
-					}
-
-					if total := time.Since(t0); total > pollingPeriod {
-						logger.Warnf("Polling bucket %q took longer than the polling period", bucket)
-					}
-
-					go srv.cache.updateMetrics(ctx, bucket)
-				case <-ctx.Done():
-					logger.Debugf("Context expired, stopping to poll bucket %q", bucket)
-
-					return
-				}
-			}
-		}(bucket)
 	}
 
 	return nil
@@ -148,30 +138,87 @@ func (srv *Server) startPollingS3(ctx context.Context) error {
 
 func (srv *Server) subscribeToS3(ctx context.Context) error {
 	for _, bucket := range srv.buckets {
-		err := srv.s3Client.SubscribeToBucket(ctx, bucket, srv.s3Chan)
-		if err != nil {
-			return err //nolint:wrapcheck
-		}
-
-		err = srv.s3Client.PollOnce(ctx, bucket, srv.s3Chan, time.Minute)
+		err := srv.watchBucket(ctx, bucket)
 		if err != nil {
-			return err //nolint:wrapcheck
+			return err
 		}
-
-		time.AfterFunc(5*time.Second, func() { srv.cache.updateMetrics(ctx, bucket) })
 	}
 
 	go func() {
 		for ctx.Err() == nil {
 			select {
 			case <-time.After(time.Minute):
-				for _, bucket := range srv.buckets {
+				for _, bucket := range srv.bucketNames() {
 					srv.cache.updateMetrics(ctx, bucket)
 				}
 			case <-ctx.Done():
 				logger.Debug("Context expired, closing event channel")
 
-				close(srv.s3Chan)
+				srv.closeS3Chan()
+
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// watchBucket starts to poll the given bucket, or subscribes to its notifications,
+// depending on the S3 mode. The caller must hold the server lock or be the only one accessing it.
+func (srv *Server) watchBucket(ctx context.Context, bucket string) error {
+	bucketCtx, cancel := context.WithCancel(ctx)
+
+	var err error
+
+	switch srv.cfg.S3.Mode {
+	case config.S3ModePolling:
+		err = srv.pollBucket(bucketCtx, bucket) //nolint:contextcheck
+	case config.S3ModeEvent:
+		err = srv.subscribeToBucket(bucketCtx, bucket) //nolint:contextcheck
+	}
+
+	if err != nil {
+		cancel()
+
+		return err
+	}
+
+	srv.bucketCancels[bucket] = cancel
+
+	return nil
+}
+
+func (srv *Server) pollBucket(ctx context.Context, bucket string) error {
+	pollingPeriod := srv.cfg.S3.PollingPeriod
+
+	logger.Tracef("Starting to poll bucket %q", bucket)
+
+	err := srv.pollOnce(ctx, bucket, pollingPeriod)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	time.AfterFunc(5*time.Second, func() { srv.cache.updateMetrics(ctx, bucket) })
+
+	go func() {
+		for {
+			select {
+			case <-time.After(pollingPeriod):
+				t0 := time.Now()
+
+				err := srv.pollOnce(ctx, bucket, pollingPeriod)
+				if err != nil {
+					logger.Errorf("Failed to poll bucket %q: %v", bucket, err)
+				}
+
+				if total := time.Since(t0); total > pollingPeriod {
+					logger.Warnf("Polling bucket %q took longer than the polling period", bucket)
+				}
+
+				go srv.cache.updateMetrics(ctx, bucket)
+			case <-ctx.Done():
+				logger.Debugf("Context expired, stopping to poll bucket %q", bucket)
 
 				return
 			}
@@ -181,9 +228,160 @@ func (srv *Server) subscribeToS3(ctx context.Context) error {
 	return nil
 }
 
+// pollOnce lists the objects of the given bucket into the event channel, unless it has been closed.
+func (srv *Server) pollOnce(ctx context.Context, bucket string, timeout time.Duration) error {
+	srv.s3ChanL.RLock()
+	defer srv.s3ChanL.RUnlock()
+
+	if srv.s3ChanClosed {
+		return nil
+	}
+
+	return srv.s3Client.PollOnce(ctx, bucket, srv.s3Chan, timeout) //nolint:wrapcheck
+}
+
+// closeS3Chan closes the event channel once the running pollers, whose context is done, have returned.
+func (srv *Server) closeS3Chan() {
+	srv.s3ChanL.Lock()
+	defer srv.s3ChanL.Unlock()
+
+	srv.s3ChanClosed = true
+
+	close(srv.s3Chan)
+}
+
+func (srv *Server) subscribeToBucket(ctx context.Context, bucket string) error {
+	err := srv.s3Client.SubscribeToBucket(ctx, bucket, srv.s3Chan)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	err = srv.pollOnce(ctx, bucket, time.Minute)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	time.AfterFunc(5*time.Second, func() { srv.cache.updateMetrics(ctx, bucket) })
+
+	return nil
+}
+
+func (srv *Server) bucketNames() []string {
+	srv.l.RLock()
+	defer srv.l.RUnlock()
+
+	return slices.Clone(srv.buckets)
+}
+
+func (srv *Server) config() config.Config {
+	srv.l.RLock()
+	defer srv.l.RUnlock()
+
+	return srv.cfg
+}
+
+// Reload applies the given configuration without restarting the server.
+// The sections that require a restart are kept from the current configuration.
+// Pollers and subscriptions are started for the new buckets and stopped for the removed ones,
+// and the images whose group or type has been removed are dropped from the cache.
+// On error, the current configuration is kept. The server must have been started beforehand.
+func (srv *Server) Reload(ctx context.Context, cfg config.Config) error {
+	srv.l.Lock()
+	defer srv.l.Unlock()
+
+	cfg = config.KeepRestartRequiredSections(srv.cfg, cfg)
+
+	buckets, err := bucketsOf(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range buckets {
+		if slices.Contains(srv.buckets, bucket) {
+			continue
+		}
+
+		ok, err := srv.s3Client.BucketExists(ctx, bucket)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if !ok {
+			return fmt.Errorf("%w %q", errBucketNotFound, bucket)
+		}
+	}
+
+	// The new buckets are watched before anything is changed, so that a failure leaves the current configuration as is.
+	// Their first objects may be received before the new configuration is applied, so they are polled again afterwards.
+	var newBuckets []string
+
+	stopNewBuckets := func() {
+		for _, bucket := range newBuckets {
+			srv.bucketCancels[bucket]()
+			delete(srv.bucketCancels, bucket)
+		}
+	}
+
+	for _, bucket := range buckets {
+		if slices.Contains(srv.buckets, bucket) {
+			continue
+		}
+
+		logger.Infof("Starting to watch bucket %q", bucket)
+
+		if err = srv.watchBucket(ctx, bucket); err != nil {
+			stopNewBuckets()
+
+			return fmt.Errorf("watching bucket %q: %w", bucket, err)
+		}
+
+		newBuckets = append(newBuckets, bucket)
+	}
+
+	err = srv.cache.reload(ctx, cfg, srv.s3Client)
+	if err != nil {
+		stopNewBuckets()
+
+		return err
+	}
+
+	srv.s3Client.UpdateProductsConfig(cfg.Products)
+	srv.consumer.setProductsConfig(cfg.Products)
+
+	for _, bucket := range srv.buckets {
+		if slices.Contains(buckets, bucket) {
+			continue
+		}
+
+		logger.Infof("Stopping to watch bucket %q", bucket)
+
+		if cancel, found := srv.bucketCancels[bucket]; found {
+			cancel()
+			delete(srv.bucketCancels, bucket)
+		}
+	}
+
+	srv.cfg = cfg
+	srv.buckets = buckets
+
+	// Objects of the kept buckets may now belong to new image types,
+	// and the ones of the new buckets may have been received with the previous configuration.
+	for _, bucket := range buckets {
+		go func() {
+			err := srv.pollOnce(ctx, bucket, time.Minute)
+			if err != nil {
+				logger.Errorf("Failed to poll bucket %q: %v", bucket, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
 type signedURLRegenerationRequest struct {
 	paramsExpr         string
 	objectLastModified time.Time
+	objectSize         int64
 	img                image
 }
 
@@ -198,8 +396,8 @@ func (srv *Server) runSignedURLRegenerationLoop(ctx context.Context) {
 			// map[bucket][image][s3Key] -> signedURLRegenerationRequest
 			urlsToRenew := make(map[string]map[string]map[string]signedURLRegenerationRequest)
 
-			for bucketName, cache := range srv.cache.buckets {
-				urlsToRenew[bucketName] = cache.findSignedURLsToRenew(deadline, s3.SignedURLLifetime)
+			for _, bucket := range srv.cache.bucketCaches() {
+				urlsToRenew[bucket.bucket] = bucket.findSignedURLsToRenew(deadline, s3.SignedURLLifetime)
 			}
 
 			newURLs, err := srv.regenerateSignedURLs(ctx, urlsToRenew)
@@ -229,7 +427,7 @@ func (srv *Server) applyRegeneratedSignedURLs(newURLs map[string]map[string]map[
 	var totalURLsCount int
 
 	for bucketName, images := range newURLs {
-		bucket, ok := srv.cache.buckets[bucketName]
+		bucket, ok := srv.cache.bucket(bucketName)
 		if !ok {
 			continue
 		}
@@ -275,6 +473,8 @@ func (srv *Server) regenerateSignedURLs(ctx context.Context, urlsToRenew map[str
 
 	var errs []error
 
+	cfg := srv.config()
+
 	for bucket, images := range urlsToRenew {
 		for imgName, s3Keys := range images {
 			for s3Key, regenReq := range s3Keys {
@@ -282,12 +482,13 @@ func (srv *Server) regenerateSignedURLs(ctx context.Context, urlsToRenew map[str
 					bucket:              bucket,
 					s3Key:               s3Key,
 					objLastModified:     regenReq.objectLastModified,
+					objSize:             regenReq.objectSize,
 					img:                 regenReq.img,
 					injectParams:        regenReq.paramsExpr != "",
 					paramsExpr:          regenReq.paramsExpr,
 					exprManager:         srv.cache.exprManager,
-					fullProductProtocol: srv.cfg.Products.FullProductProtocol,
-					fullProductRootURL:  srv.cfg.Products.FullProductRootURL,
+					fullProductProtocol: cfg.Products.FullProductProtocol,
+					fullProductRootURL:  cfg.Products.FullProductRootURL,
 				}
 
 				signURL, err := makeSignedURL(ctx, srv.s3Client, signedURLGenReq)
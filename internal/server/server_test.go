@@ -2,15 +2,23 @@ package server
 
 import (
 	"context"
+	"errors"
+	"maps"
 	"net/url"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/synctest"
 	"time"
 
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/observability"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/s3"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -321,3 +329,218 @@ func TestRunSignedURLRegenerationLoop(t *testing.T) {
 		synctest.Wait()
 	})
 }
+
+func TestServerReload(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		makeCfg := func(groups ...config.ImageGroup) config.Config {
+			return config.Config{
+				S3: config.S3{
+					Mode:          config.S3ModePolling,
+					PollingPeriod: time.Hour,
+				},
+				Cache: config.Cache{
+					CacheDir: filepath.Join(t.TempDir(), "cache"),
+				},
+				Products: config.Products{
+					ImageGroups: groups,
+				},
+			}
+		}
+
+		cfg := makeCfg(
+			config.ImageGroup{GroupName: "grp-a", Bucket: "bucket-a", Types: []config.ImageType{{Name: "typ-a"}, {Name: "typ-kept"}}},
+			config.ImageGroup{GroupName: "grp-b", Bucket: "bucket-b", Types: []config.ImageType{{Name: "typ-b"}}},
+		)
+		newCfg := makeCfg(
+			config.ImageGroup{GroupName: "grp-a", Bucket: "bucket-a", Types: []config.ImageType{{Name: "typ-kept"}}},
+			config.ImageGroup{GroupName: "grp-c", Bucket: "bucket-c", Types: []config.ImageType{{Name: "typ-c"}}},
+		)
+
+		var (
+			l               sync.Mutex
+			checkedBuckets  []string
+			polledBuckets   []string
+			updatedProducts config.Products
+		)
+
+		s3Client := S3ClientMock{
+			BucketExistsFn: func(_ context.Context, bucket string) (bool, error) {
+				l.Lock()
+				defer l.Unlock()
+
+				checkedBuckets = append(checkedBuckets, bucket)
+
+				return true, nil
+			},
+			PollOnceFn: func(_ context.Context, bucket string, _ chan s3.Event, _ time.Duration) error {
+				l.Lock()
+				defer l.Unlock()
+
+				polledBuckets = append(polledBuckets, bucket)
+
+				if bucket == "bucket-d" {
+					return errors.New("access denied")
+				}
+
+				return nil
+			},
+			UpdateProductsCfgFn: func(productsCfg config.Products) {
+				updatedProducts = productsCfg
+			},
+		}
+
+		cache, err := newCache(cfg, s3Client, make(chan types.OutEvent), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, imgType := range map[string]string{"img-dropped": "typ-a", "img-kept": "typ-kept"} {
+			cache.buckets["bucket-a"].images[name] = image{name: name, baseDir: name, bucket: "bucket-a", imgGroup: "grp-a", imgType: imgType}
+		}
+
+		srv := &Server{
+			cfg:           cfg,
+			buckets:       []string{"bucket-a", "bucket-b"},
+			bucketCancels: make(map[string]context.CancelFunc),
+			s3Client:      s3Client,
+			s3Chan:        make(chan s3.Event),
+			cache:         cache,
+		}
+		srv.consumer = newS3Consumer(cfg, cache, srv.s3Chan)
+
+		err = srv.startPollingS3(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		polledBuckets = nil
+
+		err = srv.Reload(ctx, newCfg)
+		if err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+
+		synctest.Wait()
+
+		if diff := cmp.Diff([]string{"bucket-c"}, checkedBuckets); diff != "" {
+			t.Errorf("unexpected checked buckets (-want +got):\n%s", diff)
+		}
+
+		slices.Sort(polledBuckets)
+
+		// The new bucket is polled again once the new configuration is applied.
+		if diff := cmp.Diff([]string{"bucket-a", "bucket-c", "bucket-c"}, polledBuckets); diff != "" {
+			t.Errorf("unexpected polled buckets (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff([]string{"bucket-a", "bucket-c"}, slices.Sorted(maps.Keys(srv.bucketCancels))); diff != "" {
+			t.Errorf("unexpected watched buckets (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff([]string{"bucket-a", "bucket-c"}, slices.Sorted(maps.Keys(cache.buckets))); diff != "" {
+			t.Errorf("unexpected cached buckets (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff([]string{"img-kept"}, slices.Collect(maps.Keys(cache.buckets["bucket-a"].images))); diff != "" {
+			t.Errorf("unexpected cached images (-want +got):\n%s", diff)
+		}
+
+		if len(updatedProducts.ImageGroups) != 2 || len(srv.consumer.products().ImageGroups) != 2 {
+			t.Error("expected the products configuration to be updated")
+		}
+
+		if srv.config().Cache.CacheDir != cfg.Cache.CacheDir {
+			t.Error("expected the cache dir to be kept from the initial configuration")
+		}
+
+		// A new bucket which can't be watched leaves the current configuration as is.
+		failingCfg := makeCfg(append(slices.Clone(newCfg.Products.ImageGroups),
+			config.ImageGroup{GroupName: "grp-d", Bucket: "bucket-d", Types: []config.ImageType{{Name: "typ-d"}}})...)
+
+		if err = srv.Reload(ctx, failingCfg); err == nil {
+			t.Fatal("expected the reload to fail")
+		}
+
+		synctest.Wait()
+
+		if diff := cmp.Diff([]string{"bucket-a", "bucket-c"}, srv.bucketNames()); diff != "" {
+			t.Errorf("unexpected buckets after a failed reload (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff([]string{"bucket-a", "bucket-c"}, slices.Sorted(maps.Keys(srv.bucketCancels))); diff != "" {
+			t.Errorf("unexpected watched buckets after a failed reload (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff([]string{"bucket-a", "bucket-c"}, slices.Sorted(maps.Keys(cache.buckets))); diff != "" {
+			t.Errorf("unexpected cached buckets after a failed reload (-want +got):\n%s", diff)
+		}
+
+		if len(srv.config().Products.ImageGroups) != 2 || len(srv.consumer.products().ImageGroups) != 2 {
+			t.Error("expected the products configuration to be kept")
+		}
+
+		cancel()
+		synctest.Wait()
+	})
+}
+
+func TestCloseS3Chan(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	var polls atomic.Int32
+
+	started := make(chan struct{})
+	s3Client := S3ClientMock{
+		// Like the actual client, the event isn't sent once the context is done.
+		PollOnceFn: func(ctx context.Context, bucket string, s3Chan chan s3.Event, _ time.Duration) error {
+			if polls.Add(1) == 1 {
+				close(started)
+			}
+
+			select {
+			case s3Chan <- s3.Event{Bucket: bucket}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+	srv := &Server{s3Client: s3Client, s3Chan: make(chan s3.Event)}
+
+	pollErr := make(chan error, 1)
+
+	go func() {
+		pollErr <- srv.pollOnce(ctx, "bkt", time.Minute)
+	}()
+
+	<-started
+
+	closed := make(chan struct{})
+
+	go func() {
+		srv.closeS3Chan()
+		close(closed)
+	}()
+
+	// The channel is only closed once the running poller has returned.
+	cancel()
+
+	<-closed
+
+	if err := <-pollErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the poller to be canceled, got %v", err)
+	}
+
+	// The pollers started afterwards don't send on the closed channel.
+	if err := srv.pollOnce(ctx, "bkt", time.Minute); err != nil || polls.Load() != 1 {
+		t.Errorf("Expected no poll once the channel is closed, got %d polls and %v", polls.Load(), err)
+	}
+}
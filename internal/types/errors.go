@@ -3,5 +3,14 @@ package types //nolint: revive,nolintlint
 import "errors"
 
 var (
-	ErrImageNotFound = errors.New("image not found")
+	ErrImageNotFound  = errors.New("image not found")
+	ErrNotDeepZoomed  = errors.New("not the tile pyramid of a preview")
+	ErrInvalidCrop    = errors.New("invalid crop")
+	ErrExportTooLarge = errors.New("export too large")
+
+	ErrExprTimeout          = errors.New("expression evaluation timed out")
+	ErrExprTooManyAbandoned = errors.New("too many timed out expression evaluations still running")
+	ErrExprMemoryBudget     = errors.New("expression exceeded its memory budget")
+	ErrExprCallDepth        = errors.New("maximum _call depth exceeded")
+	ErrExprFileTooLarge     = errors.New("file too large")
 )
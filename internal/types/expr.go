@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"maps"
+	"math"
 	"os"
 	"reflect"
 	"regexp"
@@ -15,11 +16,9 @@ import (
 
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
 
-	"github.com/antchfx/xmlquery"
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/vm"
-	"github.com/itchyny/gojq"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
@@ -34,6 +33,27 @@ const (
 
 const evalTimeout = 5 * time.Second
 
+// maxCallDepth is the maximum number of nested _call,
+// which stops the cycles that can't be detected when the expressions are parsed.
+const maxCallDepth = 32
+
+// maxAbandonedExprs is the maximum number of evaluations which timed out but are still running,
+// the VM not being interruptible, above which no more evaluations are started.
+const maxAbandonedExprs = 32
+
+// abandonedExprs counts the evaluations which timed out but are still running.
+var abandonedExprs atomic.Int64 //nolint: gochecknoglobals
+
+// ExprLimits bounds the resources an expression evaluation can use, a zero value disables the limit.
+type ExprLimits struct {
+	// Timeout is the maximum duration of an evaluation, including the expressions it calls.
+	Timeout time.Duration
+	// MemoryBudget is the maximum number of allocations made by the evaluation.
+	MemoryBudget uint
+	// MaxFileSize is the maximum size, in bytes, of the files read by the loader functions.
+	MaxFileSize int64
+}
+
 type DynamicInputFile struct {
 	S3Bucket string
 	S3Path   string
@@ -44,10 +64,67 @@ type DynamicInputFile struct {
 type ExprEnv struct {
 	Ctx   context.Context //nolint: containedctx // lives only the duration of the expression evaluation
 	Files map[string]DynamicInputFile
-	Exprs map[string]*vm.Program
+	// FileLists holds all the files matched by the selectors flagged as multiple, sorted by S3 path.
+	FileLists map[string][]DynamicInputFile
+	Exprs     map[string]*vm.Program
+	// Namespaces holds the XML namespaces declared by each file selector, as prefix -> URI.
+	Namespaces map[string]map[string]string
+	// Geocoder finds the places of the footprints given to _reverseGeocode, nil if no gazetteer is configured.
+	Geocoder  ReverseGeocoder
+	Limits    ExprLimits
+	callDepth int
 }
 
 var ExprFunctions = []expr.Option{ //nolint: gochecknoglobals
+	// Adds the given duration to the given date, which can be a date, a string or a Unix timestamp.
+	// The duration uses Golang syntax, extended with days (d) and weeks (w), e.g. "-1d12h".
+	expr.Function(
+		"_addDuration",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _addDuration(%v, ...) took %s", params[0], time.Since(t0))
+			}()
+
+			res, err := ExprAddDuration(params[0], params[1].(string)) //nolint: forcetypeassert // already validated
+
+			return res, wrapErr("_addDuration", err)
+		},
+		new(func(date any, duration string) (time.Time, error)),
+	),
+	// Returns the area, in km², of the given footprint (a localization or its corners).
+	expr.Function(
+		"_area",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _area(...) took %s", time.Since(t0))
+			}()
+
+			res, err := ExprArea(params[0])
+
+			return res, wrapErr("_area", err)
+		},
+		new(func(footprint any) (float64, error)),
+	),
+	// Returns the bounding box [minLon, minLat, maxLon, maxLat] of the given footprint (a localization or its corners).
+	expr.Function(
+		"_bbox",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _bbox(...) took %s", time.Since(t0))
+			}()
+
+			res, err := ExprBBox(params[0])
+
+			return res, wrapErr("_bbox", err)
+		},
+		new(func(footprint any) ([]float64, error)),
+	),
 	// Call another expression with the current context and returns its result.
 	expr.Function(
 		"_call",
@@ -65,6 +142,38 @@ var ExprFunctions = []expr.Option{ //nolint: gochecknoglobals
 		new(func(exprName string) (any, error)), // env param will be injected at compile time
 		new(func(exprName string, env ExprEnv) (any, error)),
 	),
+	// Returns the centroid {lon, lat} of the given footprint (a localization or its corners).
+	expr.Function(
+		"_centroid",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _centroid(...) took %s", time.Since(t0))
+			}()
+
+			res, err := ExprCentroid(params[0])
+
+			return res, wrapErr("_centroid", err)
+		},
+		new(func(footprint any) (map[string]any, error)),
+	),
+	// Returns the duration from the first date to the second one, in the given unit (ms, s, m, h, d or w).
+	expr.Function(
+		"_dateDiff",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _dateDiff(%v, ...) took %s", params[0], time.Since(t0))
+			}()
+
+			res, err := ExprDateDiff(params[0], params[1], params[2].(string)) //nolint: forcetypeassert // already validated
+
+			return res, wrapErr("_dateDiff", err)
+		},
+		new(func(from any, to any, unit string) (float64, error)),
+	),
 	// Returns whether a file matched by the given file selector has been cached.
 	expr.Function(
 		"_exist",
@@ -127,7 +236,101 @@ var ExprFunctions = []expr.Option{ //nolint: gochecknoglobals
 		new(func(fileSelector string, format string) (string, error)),
 		new(func(fileSelector string, format string, env ExprEnv) (string, error)),
 	),
+	// Returns all the files matched by the given file selector, sorted by S3 path.
+	// It is meant to be used with selectors matching multiple objects.
+	expr.Function(
+		"_files",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _files(%q) took %s", params[0], time.Since(t0))
+			}()
+
+			files, err := filesFromSelector(params[0], params[1])
+
+			return files, wrapErr("_files", err)
+		},
+		new(func(fileSelector string) ([]DynamicInputFile, error)),
+		new(func(fileSelector string, env ExprEnv) ([]DynamicInputFile, error)),
+	),
+	// Formats the given size in bytes with a binary unit, e.g. "1.5 MiB".
+	expr.Function(
+		"_formatBytes",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _formatBytes(%v) took %s", params[0], time.Since(t0))
+			}()
+
+			res, err := ExprFormatBytes(params[0])
+
+			return res, wrapErr("_formatBytes", err)
+		},
+		new(func(size any) (string, error)),
+	),
+	// Formats the given date, which can be a date, a string or a Unix timestamp, with the given layout (using Golang syntax).
+	// It optionally takes the time zone to convert the date to, e.g. "Europe/Paris".
+	expr.Function(
+		"_formatDate",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _formatDate(%v, ...) took %s", params[0], time.Since(t0))
+			}()
+
+			var timezone string
+
+			if len(params) == 3 {
+				timezone = params[2].(string) //nolint: forcetypeassert // already validated
+			}
+
+			res, err := ExprFormatDate(params[0], params[1].(string), timezone) //nolint: forcetypeassert // already validated
+
+			return res, wrapErr("_formatDate", err)
+		},
+		new(func(date any, layout string) (string, error)),
+		new(func(date any, layout string, timezone string) (string, error)),
+	),
+	// Formats the given number with the given count of decimals, grouping the thousands.
+	// It optionally takes the thousands separator, which defaults to a comma.
+	expr.Function(
+		"_formatNumber",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _formatNumber(%v, ...) took %s", params[0], time.Since(t0))
+			}()
+
+			separator := ","
+
+			if len(params) == 3 {
+				separator = params[2].(string) //nolint: forcetypeassert // already validated
+			}
+
+			res, err := ExprFormatNumber(params[0], params[1].(int), separator) //nolint: forcetypeassert // already validated
+
+			return res, wrapErr("_formatNumber", err)
+		},
+		new(func(number any, decimals int) (string, error)),
+		new(func(number any, decimals int, separator string) (string, error)),
+	),
+	// Computes the WGS 84 corners of the GeoTIFF file matched by the given file selector from its georeferencing tags,
+	// as an object shaped like a localization file. Images in geographic coordinates, Web Mercator and UTM are supported.
+	expr.Function(
+		"_geotiffFootprint",
+		func(params ...any) (any, error) {
+			return loadFile("_geotiffFootprint", params, ExprGeoTIFFFootprint)
+		},
+		new(func(fileSelector string) (any, error)),
+		new(func(fileSelector string, env ExprEnv) (any, error)),
+	),
 	// Returns the result of the given jq expression on the file matched by the given file selector.
+	// The file is decoded according to its extension (JSON by default, YAML, TOML, CSV, TSV or INI),
+	// or to the format given as third parameter: "json", "yaml", "toml", "csv", "tsv" or "ini".
 	expr.Function(
 		"_jq",
 		func(params ...any) (any, error) {
@@ -137,36 +340,121 @@ var ExprFunctions = []expr.Option{ //nolint: gochecknoglobals
 				logger.Tracef("[expr] _jq(%q, ...) took %s", params[1], time.Since(t0))
 			}()
 
-			file, err := fileFromSelector(params[1], params[3])
+			env := params[len(params)-1]
+
+			file, err := fileFromSelector(params[1], env)
+			if err != nil {
+				return nil, wrapErr("_jq", err)
+			}
+
+			err = checkFileSize(file.CacheKey, env.(ExprEnv).Limits.MaxFileSize) //nolint: forcetypeassert // already validated
 			if err != nil {
 				return nil, wrapErr("_jq", err)
 			}
 
-			res, err := ExprJQ(params[0].(context.Context), file.CacheKey, params[2].(string)) //nolint: forcetypeassert // already validated
+			format := FileFormat(file.CacheKey)
+
+			if len(params) == 5 {
+				format = params[3].(string) //nolint: forcetypeassert // already validated
+			}
+
+			res, err := ExprJQ(params[0].(context.Context), file.CacheKey, format, params[2].(string)) //nolint: forcetypeassert // already validated
 
 			return res, wrapErr("_jq", err)
 		},
 		new(func(ctx context.Context, fileSelector string, filter string) (any, error)),
+		new(func(ctx context.Context, fileSelector string, filter string, format string) (any, error)),
 		new(func(ctx context.Context, fileSelector string, filter string, env ExprEnv) (any, error)),
+		new(func(ctx context.Context, fileSelector string, filter string, format string, env ExprEnv) (any, error)),
 	),
-	// Loads the content of the file matched by the given file selector to a JSON object.
+	// Returns the result of the given jq expression on the given value, e.g. the output of a loader function.
 	expr.Function(
-		"_loadJSON",
+		"_jqValue",
 		func(params ...any) (any, error) {
 			t0 := time.Now()
 
 			defer func() {
-				logger.Tracef("[expr] _loadJSON(%q) took %s", params[0], time.Since(t0))
+				logger.Tracef("[expr] _jqValue(..., %q) took %s", params[2], time.Since(t0))
 			}()
 
-			file, err := fileFromSelector(params[0], params[1])
+			res, err := ExprJQValue(params[0].(context.Context), params[1], params[2].(string)) //nolint: forcetypeassert // already validated
+
+			return res, wrapErr("_jqValue", err)
+		},
+		new(func(ctx context.Context, value any, filter string) (any, error)),
+	),
+	// Loads the CSV file matched by the given file selector to a list of objects,
+	// mapping the names of the header row to the fields, as strings, of each row.
+	// The fields are separated by commas, or by the given separator.
+	expr.Function(
+		"_loadCSV",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _loadCSV(%q) took %s", params[0], time.Since(t0))
+			}()
+
+			env := params[len(params)-1]
+
+			file, err := fileFromSelector(params[0], env)
+			if err != nil {
+				return nil, wrapErr("_loadCSV", err)
+			}
+
+			err = checkFileSize(file.CacheKey, env.(ExprEnv).Limits.MaxFileSize) //nolint: forcetypeassert // already validated
 			if err != nil {
-				return nil, wrapErr("_loadJSON", err)
+				return nil, wrapErr("_loadCSV", err)
+			}
+
+			separator := ","
+
+			if len(params) == 3 {
+				separator = params[1].(string) //nolint: forcetypeassert // already validated
 			}
 
-			res, err := ExprLoadJSON(file.CacheKey)
+			res, err := ExprLoadCSV(file.CacheKey, separator)
 
-			return res, wrapErr("_loadJSON", err)
+			return res, wrapErr("_loadCSV", err)
+		},
+		new(func(fileSelector string) (any, error)),
+		new(func(fileSelector string, separator string) (any, error)),
+		new(func(fileSelector string, env ExprEnv) (any, error)),
+		new(func(fileSelector string, separator string, env ExprEnv) (any, error)),
+	),
+	// Loads the INI file matched by the given file selector to an object mapping each section to its keys,
+	// the keys defined before the first section being at the top level. The values are strings.
+	expr.Function(
+		"_loadINI",
+		func(params ...any) (any, error) {
+			return loadFile("_loadINI", params, ExprLoadINI)
+		},
+		new(func(fileSelector string) (any, error)),
+		new(func(fileSelector string, env ExprEnv) (any, error)),
+	),
+	// Loads the content of the file matched by the given file selector to a JSON object.
+	expr.Function(
+		"_loadJSON",
+		func(params ...any) (any, error) {
+			return loadFile("_loadJSON", params, ExprLoadJSON)
+		},
+		new(func(fileSelector string) (any, error)),
+		new(func(fileSelector string, env ExprEnv) (any, error)),
+	),
+	// Loads the TOML file matched by the given file selector to an object.
+	expr.Function(
+		"_loadTOML",
+		func(params ...any) (any, error) {
+			return loadFile("_loadTOML", params, ExprLoadTOML)
+		},
+		new(func(fileSelector string) (any, error)),
+		new(func(fileSelector string, env ExprEnv) (any, error)),
+	),
+	// Loads the first document of the YAML file matched by the given file selector.
+	expr.Function(
+		"_loadYAML",
+		func(params ...any) (any, error) {
+			return loadFile("_loadYAML", params, ExprLoadYAML)
 		},
 		new(func(fileSelector string) (any, error)),
 		new(func(fileSelector string, env ExprEnv) (any, error)),
@@ -185,6 +473,36 @@ var ExprFunctions = []expr.Option{ //nolint: gochecknoglobals
 		},
 		new(func(o1, o2 map[string]any) (map[string]any, error)),
 	),
+	// Parses the given string or Unix timestamp to a date.
+	// It optionally takes the layout of the string (using Golang syntax), the common layouts being tried otherwise,
+	// and the time zone of the dates which don't specify one, which defaults to UTC.
+	expr.Function(
+		"_parseDate",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _parseDate(%v, ...) took %s", params[0], time.Since(t0))
+			}()
+
+			var layout, timezone string
+
+			if len(params) > 1 {
+				layout = params[1].(string) //nolint: forcetypeassert // already validated
+			}
+
+			if len(params) > 2 {
+				timezone = params[2].(string) //nolint: forcetypeassert // already validated
+			}
+
+			res, err := ExprParseDate(params[0], layout, timezone)
+
+			return res, wrapErr("_parseDate", err)
+		},
+		new(func(value any) (time.Time, error)),
+		new(func(value any, layout string) (time.Time, error)),
+		new(func(value any, layout string, timezone string) (time.Time, error)),
+	),
 	// Replaces matches of the regex on str with the replacement string.
 	expr.Function(
 		"_replaceRegex",
@@ -201,6 +519,42 @@ var ExprFunctions = []expr.Option{ //nolint: gochecknoglobals
 		},
 		new(func(str string, regex string, replacement string) (string, error)),
 	),
+	// Returns the places located in the given footprint (a localization, with corners or a geometry, or its corners),
+	// found in the offline gazetteer, as the list of countries expected from the geonames expression.
+	// Without any place in the footprint, the nearest one to its center is returned, if close enough.
+	expr.Function(
+		"_reverseGeocode",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _reverseGeocode(...) took %s", time.Since(t0))
+			}()
+
+			res, err := ExprReverseGeocode(params[0], params[1].(ExprEnv).Geocoder) //nolint: forcetypeassert // already validated
+
+			return res, wrapErr("_reverseGeocode", err)
+		},
+		new(func(footprint any) (any, error)),
+		new(func(footprint any, env ExprEnv) (any, error)),
+	),
+	// Rounds the given number to the given count of decimals, between -15 and 15,
+	// the negative ones rounding to the tens, the hundreds, and so on.
+	expr.Function(
+		"_round",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _round(%v, ...) took %s", params[0], time.Since(t0))
+			}()
+
+			res, err := ExprRound(params[0], params[1].(int)) //nolint: forcetypeassert // already validated
+
+			return res, wrapErr("_round", err)
+		},
+		new(func(number any, decimals int) (float64, error)),
+	),
 	// Returns the S3 path of the file matched by the given file selector.
 	expr.Function(
 		"_s3Key",
@@ -221,6 +575,32 @@ var ExprFunctions = []expr.Option{ //nolint: gochecknoglobals
 		new(func(fileSelector string) (string, error)),
 		new(func(fileSelector string, env ExprEnv) (string, error)),
 	),
+	// Returns the S3 paths of all the files matched by the given file selector, sorted.
+	expr.Function(
+		"_s3Keys",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _s3Keys(%q) took %s", params[0], time.Since(t0))
+			}()
+
+			files, err := filesFromSelector(params[0], params[1])
+			if err != nil {
+				return []string{}, wrapErr("_s3Keys", err)
+			}
+
+			keys := make([]string, len(files))
+
+			for i, file := range files {
+				keys[i] = file.S3Path
+			}
+
+			return keys, nil
+		},
+		new(func(fileSelector string) ([]string, error)),
+		new(func(fileSelector string, env ExprEnv) ([]string, error)),
+	),
 	// Returns the S3 URI (s3://bucket/key) of the file matched by the given file selector.
 	expr.Function(
 		"_s3Uri",
@@ -255,24 +635,65 @@ var ExprFunctions = []expr.Option{ //nolint: gochecknoglobals
 		},
 		new(func(str string) (string, error)),
 	),
-	// Returns the result of the given xpath expression on the file matched by the given file selector.
+	// Converts the given coordinates, expressed in the given reference system, to a WGS 84 {lon, lat} object.
+	// The reference system is an EPSG code such as "EPSG:32631"; UTM zones, Web Mercator and Lambert 93 are supported.
 	expr.Function(
-		"_xpath",
+		"_toWGS84",
 		func(params ...any) (any, error) {
 			t0 := time.Now()
 
 			defer func() {
-				logger.Tracef("[expr] _xpath(%q, ...) took %s", params[0], time.Since(t0))
+				logger.Tracef("[expr] _toWGS84(%v, %v, %q) took %s", params[0], params[1], params[2], time.Since(t0))
 			}()
 
-			file, err := fileFromSelector(params[0], params[2])
-			if err != nil {
-				return nil, wrapErr("_xpath", err)
-			}
+			res, err := ExprToWGS84(params[0], params[1], params[2].(string)) //nolint: forcetypeassert // already validated
+
+			return res, wrapErr("_toWGS84", err)
+		},
+		new(func(x any, y any, crs string) (map[string]any, error)),
+	),
+	// Returns the WKT polygon of the given footprint (a localization or its corners).
+	expr.Function(
+		"_wkt",
+		func(params ...any) (any, error) {
+			t0 := time.Now()
+
+			defer func() {
+				logger.Tracef("[expr] _wkt(...) took %s", time.Since(t0))
+			}()
 
-			res, err := ExprXPath(file.CacheKey, params[1].(string)) //nolint: forcetypeassert // already validated
+			res, err := ExprWKT(params[0])
 
-			return res, wrapErr("_xpath", err)
+			return res, wrapErr("_wkt", err)
+		},
+		new(func(footprint any) (string, error)),
+	),
+	// Returns the text of the first node matched by the given xpath expression in the file matched by the given file selector,
+	// or nil if none matches. Expressions which don't select nodes, like count(//item), return their value.
+	// The prefixes are resolved with the namespaces declared by the file selector.
+	expr.Function(
+		"_xpath",
+		func(params ...any) (any, error) {
+			return xpathFile("_xpath", params, ExprXPath)
+		},
+		new(func(fileSelector string, xpath string) (any, error)),
+		new(func(fileSelector string, xpath string, env ExprEnv) (any, error)),
+	),
+	// Returns the texts of all the nodes matched by the given xpath expression in the file matched by the given file selector.
+	expr.Function(
+		"_xpathAll",
+		func(params ...any) (any, error) {
+			return xpathFile("_xpathAll", params, ExprXPathAll)
+		},
+		new(func(fileSelector string, xpath string) (any, error)),
+		new(func(fileSelector string, xpath string, env ExprEnv) (any, error)),
+	),
+	// Returns all the nodes matched by the given xpath expression in the file matched by the given file selector,
+	// as objects holding their name, namespace, attributes, text and child elements.
+	expr.Function(
+		"_xpathNodes",
+		func(params ...any) (any, error) {
+			return xpathFile("_xpathNodes", params, ExprXPathNodes)
 		},
 		new(func(fileSelector string, xpath string) (any, error)),
 		new(func(fileSelector string, xpath string, env ExprEnv) (any, error)),
@@ -298,19 +719,39 @@ var ExprTestingFunctions = []expr.Option{ //nolint: gochecknoglobals
 		},
 		new(func(ctx context.Context) (any, error)),
 	),
+	// Blocks until the evaluation is abandoned.
+	expr.Function(
+		"__testBlock__",
+		func(params ...any) (any, error) {
+			<-params[0].(context.Context).Done() //nolint: forcetypeassert // already validated
+
+			return nil, nil //nolint: nilnil
+		},
+		new(func(ctx context.Context) (any, error)),
+	),
 }
 
 type ExprEnvInjector struct{}
 
 var funcsWithEnv = map[string]bool{ //nolint: gochecknoglobals
-	"_call":     true,
-	"_exist":    true,
-	"_fileDate": true,
-	"_jq":       true,
-	"_loadJSON": true,
-	"_s3Key":    true,
-	"_s3Uri":    true,
-	"_xpath":    true,
+	"_call":             true,
+	"_exist":            true,
+	"_fileDate":         true,
+	"_files":            true,
+	"_geotiffFootprint": true,
+	"_jq":               true,
+	"_loadCSV":          true,
+	"_loadINI":          true,
+	"_loadJSON":         true,
+	"_loadTOML":         true,
+	"_loadYAML":         true,
+	"_reverseGeocode":   true,
+	"_s3Key":            true,
+	"_s3Keys":           true,
+	"_s3Uri":            true,
+	"_xpath":            true,
+	"_xpathAll":         true,
+	"_xpathNodes":       true,
 }
 
 func (ExprEnvInjector) Visit(node *ast.Node) {
@@ -345,6 +786,11 @@ func fileFromSelector(selParam, envParam any) (DynamicInputFile, error) {
 	selector := selParam.(string) //nolint: forcetypeassert // already validated
 	env := envParam.(ExprEnv)     //nolint: forcetypeassert // already validated
 
+	// Stop reading files once the evaluation has been abandoned.
+	if env.Ctx != nil && env.Ctx.Err() != nil {
+		return DynamicInputFile{}, fmt.Errorf("%w: %w", ErrExprTimeout, env.Ctx.Err())
+	}
+
 	file, found := env.Files[selector]
 	if found {
 		return file, nil
@@ -353,6 +799,77 @@ func fileFromSelector(selParam, envParam any) (DynamicInputFile, error) {
 	return DynamicInputFile{}, fmt.Errorf("unknown file selector %q", selParam)
 }
 
+// filesFromSelector returns the files of a multiple selector,
+// or a single-element list for a regular selector which matched an object.
+func filesFromSelector(selParam, envParam any) ([]DynamicInputFile, error) {
+	selector := selParam.(string) //nolint: forcetypeassert // already validated
+	env := envParam.(ExprEnv)     //nolint: forcetypeassert // already validated
+
+	if files, found := env.FileLists[selector]; found {
+		return files, nil
+	}
+
+	file, found := env.Files[selector]
+	if !found {
+		return nil, fmt.Errorf("unknown file selector %q", selParam)
+	}
+
+	if file.S3Path == "" {
+		return []DynamicInputFile{}, nil
+	}
+
+	return []DynamicInputFile{file}, nil
+}
+
+// loadFile loads the file matched by the file selector of the given parameters with the given loader.
+func loadFile(fn string, params []any, loader func(filePath string) (any, error)) (any, error) {
+	t0 := time.Now()
+
+	defer func() {
+		logger.Tracef("[expr] %s(%q) took %s", fn, params[0], time.Since(t0))
+	}()
+
+	file, err := fileFromSelector(params[0], params[1])
+	if err != nil {
+		return nil, wrapErr(fn, err)
+	}
+
+	err = checkFileSize(file.CacheKey, params[1].(ExprEnv).Limits.MaxFileSize) //nolint: forcetypeassert // already validated
+	if err != nil {
+		return nil, wrapErr(fn, err)
+	}
+
+	res, err := loader(file.CacheKey)
+
+	return res, wrapErr(fn, err)
+}
+
+// xpathFile runs the given xpath function on the file matched by the file selector of the given parameters,
+// with the namespaces declared by the selector.
+func xpathFile(fn string, params []any, xpathFn func(filePath, xpathExpression string, namespaces map[string]string) (any, error)) (any, error) {
+	t0 := time.Now()
+
+	defer func() {
+		logger.Tracef("[expr] %s(%q, ...) took %s", fn, params[0], time.Since(t0))
+	}()
+
+	file, err := fileFromSelector(params[0], params[2])
+	if err != nil {
+		return nil, wrapErr(fn, err)
+	}
+
+	env := params[2].(ExprEnv) //nolint: forcetypeassert // already validated
+
+	err = checkFileSize(file.CacheKey, env.Limits.MaxFileSize)
+	if err != nil {
+		return nil, wrapErr(fn, err)
+	}
+
+	res, err := xpathFn(file.CacheKey, params[1].(string), env.Namespaces[params[0].(string)]) //nolint: forcetypeassert // already validated
+
+	return res, wrapErr(fn, err)
+}
+
 func wrapErr(fn string, err error) error {
 	if err != nil {
 		return fmt.Errorf("%s: %w", fn, err)
@@ -361,84 +878,169 @@ func wrapErr(fn string, err error) error {
 	return nil
 }
 
-func ExprCall(exprName string, env ExprEnv) (any, error) {
-	prgm, found := env.Exprs[exprName]
-	if !found {
-		return nil, fmt.Errorf("_call: expr %q not found", exprName)
+// checkFileSize returns an error if the file at the given path is bigger than maxSize bytes.
+func checkFileSize(filePath string, maxSize int64) error {
+	if filePath == "" || maxSize <= 0 {
+		return nil
 	}
 
-	output, err := expr.Run(prgm, env)
+	stat, err := os.Stat(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("_call: expr %q: %w", exprName, err)
+		return nil //nolint: nilerr // reported when the file is read
 	}
 
-	return output, nil
+	if stat.Size() > maxSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrExprFileTooLarge, stat.Size(), maxSize)
+	}
+
+	return nil
 }
 
-func ExprExist(filePath string) (bool, error) {
-	if filePath == "" {
-		return false, nil
+// AbandonedExprs returns the number of evaluations which timed out but are still running.
+func AbandonedExprs() int64 {
+	return abandonedExprs.Load()
+}
+
+// RunExpr evaluates the given program within the limits of the given environment.
+// The evaluation is abandoned once its timeout is reached, and fails if it exceeds its memory budget.
+// An abandoned evaluation keeps running until its next file read, or its end if it reads none,
+// so the evaluations are refused while too many abandoned ones are still running.
+func RunExpr(program *vm.Program, env ExprEnv) (any, error) {
+	if env.Ctx == nil {
+		env.Ctx = context.Background()
 	}
 
-	stat, err := os.Stat(filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
+	machine := vm.VM{MemoryBudget: env.Limits.MemoryBudget}
+	if machine.MemoryBudget == 0 {
+		machine.MemoryBudget = math.MaxUint
+	}
+
+	// The nested evaluations are bounded by the timeout of the outermost one.
+	if env.Limits.Timeout <= 0 || env.callDepth > 0 {
+		output, err := machine.Run(program, env)
+
+		return output, exprRunError(err)
+	}
+
+	if count := abandonedExprs.Load(); count >= maxAbandonedExprs {
+		return nil, fmt.Errorf("%w (%d)", ErrExprTooManyAbandoned, count)
+	}
+
+	ctx, cancel := context.WithTimeout(env.Ctx, env.Limits.Timeout)
+	defer cancel()
+
+	env.Ctx = ctx
+
+	type result struct {
+		output any
+		err    error
+	}
+
+	const (
+		running int32 = iota
+		finished
+		abandoned
+	)
+
+	var state atomic.Int32
+
+	done := make(chan result, 1)
+
+	go func() {
+		output, err := machine.Run(program, env)
+		if !state.CompareAndSwap(running, finished) {
+			abandonedExprs.Add(-1)
 		}
 
-		return false, err //nolint: wrapcheck // wrapped by caller
+		done <- result{output, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.output, exprRunError(res.err)
+	case <-ctx.Done():
+		abandonedExprs.Add(1)
+
+		if !state.CompareAndSwap(running, abandoned) {
+			// The evaluation finished meanwhile, too late.
+			abandonedExprs.Add(-1)
+		}
+
+		return nil, fmt.Errorf("%w after %s", ErrExprTimeout, env.Limits.Timeout)
 	}
+}
 
-	if stat.Size() == 0 {
-		return false, nil
+func exprRunError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "memory budget exceeded") {
+		return fmt.Errorf("%w: %w", ErrExprMemoryBudget, err)
 	}
 
-	return true, nil
+	return err
 }
 
-func ExprJQ(ctx context.Context, filePath string, jqExpression string) (any, error) {
-	if filePath == "" {
-		return nil, nil //nolint: nilnil
+// ExprErrorReason returns the name of the limit exceeded by an evaluation which failed with the given error,
+// or "error" if it failed for another reason.
+func ExprErrorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrExprTimeout):
+		return "timeout"
+	case errors.Is(err, ErrExprTooManyAbandoned):
+		return "too_many_abandoned"
+	case errors.Is(err, ErrExprMemoryBudget):
+		return "memory_budget"
+	case errors.Is(err, ErrExprCallDepth):
+		return "call_depth"
+	case errors.Is(err, ErrExprFileTooLarge):
+		return "file_size"
+	default:
+		return "error"
 	}
+}
 
-	query, err := gojq.Parse(jqExpression)
-	if err != nil {
-		return nil, fmt.Errorf("parsing jq expression: %w", err)
+func ExprCall(exprName string, env ExprEnv) (any, error) {
+	prgm, found := env.Exprs[exprName]
+	if !found {
+		return nil, fmt.Errorf("_call: expr %q not found", exprName)
 	}
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err //nolint: wrapcheck // wrapped by caller
+	// Stop calling expressions once the evaluation has been abandoned.
+	if env.Ctx != nil && env.Ctx.Err() != nil {
+		return nil, fmt.Errorf("_call: expr %q: %w: %w", exprName, ErrExprTimeout, env.Ctx.Err())
 	}
 
-	defer file.Close()
+	if env.callDepth >= maxCallDepth {
+		return nil, fmt.Errorf("_call: expr %q: %w (%d)", exprName, ErrExprCallDepth, maxCallDepth)
+	}
 
-	var input any
+	env.callDepth++
 
-	err = json.NewDecoder(file).Decode(&input)
+	output, err := RunExpr(prgm, env)
 	if err != nil {
-		return nil, fmt.Errorf("json: %w", err)
+		return nil, fmt.Errorf("_call: expr %q: %w", exprName, err)
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, evalTimeout)
-	defer cancel()
-
-	iter := query.RunWithContext(ctx, input)
+	return output, nil
+}
 
-	v, ok := iter.Next()
-	if !ok {
-		return nil, nil //nolint: nilnil
+func ExprExist(filePath string) (bool, error) {
+	if filePath == "" {
+		return false, nil
 	}
 
-	if err, ok := v.(error); ok {
-		if haltErr := new(gojq.HaltError); errors.As(err, &haltErr) && haltErr.Value() == nil {
-			return nil, nil //nolint: nilnil
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
 		}
 
-		return nil, err
+		return false, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	if stat.Size() == 0 {
+		return false, nil
 	}
 
-	return v, nil
+	return true, nil
 }
 
 func ExprLoadJSON(filePath string) (any, error) {
@@ -486,29 +1088,3 @@ func ExprTitle(value string) string {
 	value = cases.Title(language.English).String(value)
 	return strings.ReplaceAll(value, "_", " ")
 }
-
-func ExprXPath(filePath string, xpathExpression string) (res any, err error) {
-	if filePath == "" {
-		return nil, nil //nolint: nilnil
-	}
-
-	f, err := os.Open(filePath)
-	if err != nil {
-		return nil, err //nolint: wrapcheck // wrapped by caller
-	}
-
-	defer f.Close()
-
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("%s", r)
-		}
-	}()
-
-	doc, err := xmlquery.Parse(f)
-	if err != nil {
-		return nil, err //nolint: wrapcheck // wrapped by caller
-	}
-
-	return xmlquery.FindOne(doc, xpathExpression).InnerText(), nil
-}
@@ -0,0 +1,192 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // the time zones are needed even where the system doesn't provide them
+)
+
+var (
+	errInvalidDate     = errors.New("invalid date")
+	errInvalidDuration = errors.New("invalid duration")
+	errUnknownUnit     = errors.New("unknown unit")
+)
+
+// dateLayouts are the layouts tried when parsing a date without an explicit layout.
+var dateLayouts = []string{ //nolint: gochecknoglobals
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04:05.999999999",
+	time.DateTime,
+	"20060102T150405Z0700",
+	"20060102T150405",
+	time.DateOnly,
+	"20060102",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// durationUnits are the units accepted by the durations, along with days and weeks.
+var durationUnits = map[string]time.Duration{ //nolint: gochecknoglobals
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+var durationPartRegexp = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?)(ns|us|µs|ms|s|m|h|d|w)`)
+
+// ExprParseDate parses the given value, either a date, a string or a Unix timestamp in seconds.
+// Strings are parsed with the given layout, or with the common layouts if empty,
+// in the given time zone when they don't specify one (UTC if empty).
+func ExprParseDate(value any, layout, timezone string) (time.Time, error) {
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		layouts := dateLayouts
+		if layout != "" {
+			layouts = []string{layout}
+		}
+
+		for _, l := range layouts {
+			date, err := time.ParseInLocation(l, strings.TrimSpace(v), loc)
+			if err == nil {
+				return date, nil
+			}
+		}
+
+		return time.Time{}, fmt.Errorf("%w %q", errInvalidDate, v)
+	}
+
+	seconds, err := toFloat(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w %v", errInvalidDate, value)
+	}
+
+	sec, frac := math.Modf(seconds)
+
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))).In(loc), nil
+}
+
+// ExprFormatDate formats the given date with the given layout, in the given time zone if not empty.
+func ExprFormatDate(value any, layout, timezone string) (string, error) {
+	date, err := ExprParseDate(value, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	if timezone != "" {
+		loc, err := loadLocation(timezone)
+		if err != nil {
+			return "", err
+		}
+
+		date = date.In(loc)
+	}
+
+	return date.Format(layout), nil
+}
+
+// ExprAddDuration adds the given duration, which may be negative, to the given date.
+func ExprAddDuration(value any, duration string) (time.Time, error) {
+	date, err := ExprParseDate(value, "", "")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	d, err := parseDuration(duration)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return date.Add(d), nil
+}
+
+// ExprDateDiff returns the duration from the first date to the second one, in the given unit.
+func ExprDateDiff(from, to any, unit string) (float64, error) {
+	fromDate, err := ExprParseDate(from, "", "")
+	if err != nil {
+		return 0, err
+	}
+
+	toDate, err := ExprParseDate(to, "", "")
+	if err != nil {
+		return 0, err
+	}
+
+	unitDuration, found := durationUnits[unit]
+	if !found {
+		return 0, fmt.Errorf("%w %q", errUnknownUnit, unit)
+	}
+
+	return float64(toDate.Sub(fromDate)) / float64(unitDuration), nil
+}
+
+// parseDuration parses a duration like [time.ParseDuration] does, also accepting days (d) and weeks (w).
+func parseDuration(value string) (time.Duration, error) {
+	str := strings.TrimSpace(value)
+	sign := time.Duration(1)
+
+	if rest, found := strings.CutPrefix(str, "-"); found {
+		str, sign = rest, -1
+	}
+
+	matches := durationPartRegexp.FindAllStringSubmatchIndex(str, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("%w %q", errInvalidDuration, value)
+	}
+
+	var (
+		total time.Duration
+		end   int
+	)
+
+	for _, match := range matches {
+		if match[0] != end {
+			return 0, fmt.Errorf("%w %q", errInvalidDuration, value)
+		}
+
+		amount, err := strconv.ParseFloat(str[match[2]:match[3]], 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w %q", errInvalidDuration, value)
+		}
+
+		total += time.Duration(amount * float64(durationUnits[str[match[4]:match[5]]]))
+		end = match[1]
+	}
+
+	if end != len(str) {
+		return 0, fmt.Errorf("%w %q", errInvalidDuration, value)
+	}
+
+	return sign * total, nil
+}
+
+func loadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	return loc, nil
+}
@@ -0,0 +1,81 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		input         string
+		expected      time.Duration
+		expectedError error
+	}{
+		{input: "90s", expected: 90 * time.Second},
+		{input: "1d12h", expected: 36 * time.Hour},
+		{input: "-2w", expected: -14 * 24 * time.Hour},
+		{input: "1.5h30m", expected: 2 * time.Hour},
+		{input: "250ms", expected: 250 * time.Millisecond},
+		{input: "", expectedError: errInvalidDuration},
+		{input: "1y", expectedError: errInvalidDuration},
+		{input: "1h 30m", expectedError: errInvalidDuration},
+		{input: "h", expectedError: errInvalidDuration},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			t.Parallel()
+
+			duration, err := parseDuration(tc.input)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedError, err)
+			}
+
+			if duration != tc.expected {
+				t.Fatalf("Expected %s, got %s", tc.expected, duration)
+			}
+		})
+	}
+}
+
+func TestExprParseDate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		value         any
+		layout        string
+		timezone      string
+		expected      time.Time
+		expectedError bool
+	}{
+		{name: "RFC 3339", value: "2026-02-26T11:34:00+01:00", expected: time.Date(2026, 2, 26, 10, 34, 0, 0, time.UTC)},
+		{name: "compact", value: "20260226T113400", expected: time.Date(2026, 2, 26, 11, 34, 0, 0, time.UTC)},
+		{name: "date only in time zone", value: "2026-02-26", timezone: "Asia/Tokyo", expected: time.Date(2026, 2, 25, 15, 0, 0, 0, time.UTC)},
+		{name: "custom layout", value: "26 Feb 2026", layout: "02 Jan 2006", expected: time.Date(2026, 2, 26, 0, 0, 0, 0, time.UTC)},
+		{name: "unix timestamp", value: 1772105640, expected: time.Date(2026, 2, 26, 11, 34, 0, 0, time.UTC)},
+		{name: "fractional unix timestamp", value: 1772105640.5, expected: time.Date(2026, 2, 26, 11, 34, 0, 5e8, time.UTC)},
+		{name: "date", value: time.Date(2026, 2, 26, 0, 0, 0, 0, time.UTC), expected: time.Date(2026, 2, 26, 0, 0, 0, 0, time.UTC)},
+		{name: "unknown layout", value: "26/02/2026", expectedError: true},
+		{name: "unknown time zone", value: "2026-02-26", timezone: "Nowhere/City", expectedError: true},
+		{name: "invalid value", value: []string{}, expectedError: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			date, err := ExprParseDate(tc.value, tc.layout, tc.timezone)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("Expected error: %t, got %v", tc.expectedError, err)
+			}
+
+			if !date.Equal(tc.expected) {
+				t.Fatalf("Expected %s, got %s", tc.expected, date)
+			}
+		})
+	}
+}
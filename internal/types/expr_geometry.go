@@ -0,0 +1,168 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/geo"
+)
+
+// earthRadius is the equatorial radius of the WGS 84 ellipsoid, in meters.
+const earthRadius = 6378137.0
+
+var errInvalidFootprint = errors.New("invalid footprint")
+
+// footprintRing returns the corners of the given localization, or of its corner object,
+// as a closed ring of [lon, lat] pairs going clockwise from the upper left corner.
+func footprintRing(value any) ([][2]float64, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidFootprint, err)
+	}
+
+	var localization struct {
+		Corner *LocalizationCorner `json:"corner"`
+		LocalizationCorner
+	}
+
+	err = json.Unmarshal(raw, &localization)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidFootprint, err)
+	}
+
+	corner := localization.LocalizationCorner
+	if localization.Corner != nil {
+		corner = *localization.Corner
+	}
+
+	if corner == (LocalizationCorner{}) {
+		return nil, fmt.Errorf("%w: no corners found", errInvalidFootprint)
+	}
+
+	ring := make([][2]float64, 0, 5)
+
+	for _, point := range []Point{corner.UpperLeft, corner.UpperRight, corner.LowerRight, corner.LowerLeft, corner.UpperLeft} {
+		ring = append(ring, [2]float64{point.Coordinates.Lon, point.Coordinates.Lat})
+	}
+
+	return ring, nil
+}
+
+// ExprBBox returns the bounding box of the given footprint, as [minLon, minLat, maxLon, maxLat].
+func ExprBBox(value any) ([]float64, error) {
+	ring, err := footprintRing(value)
+	if err != nil {
+		return nil, err
+	}
+
+	bbox := []float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+
+	for _, point := range ring {
+		bbox[0] = min(bbox[0], point[0])
+		bbox[1] = min(bbox[1], point[1])
+		bbox[2] = max(bbox[2], point[0])
+		bbox[3] = max(bbox[3], point[1])
+	}
+
+	return bbox, nil
+}
+
+// ExprCentroid returns the centroid of the given footprint, as a {lon, lat} map.
+func ExprCentroid(value any) (map[string]any, error) {
+	ring, err := footprintRing(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var area, lon, lat float64
+
+	for i := range len(ring) - 1 {
+		cross := ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+		area += cross
+		lon += (ring[i][0] + ring[i+1][0]) * cross
+		lat += (ring[i][1] + ring[i+1][1]) * cross
+	}
+
+	if area == 0 { // degenerated footprint, fall back to the mean of its corners
+		lon, lat = 0, 0
+
+		for _, point := range ring[:len(ring)-1] {
+			lon += point[0]
+			lat += point[1]
+		}
+
+		count := float64(len(ring) - 1)
+
+		return map[string]any{"lon": lon / count, "lat": lat / count}, nil
+	}
+
+	return map[string]any{"lon": lon / (3 * area), "lat": lat / (3 * area)}, nil
+}
+
+// ExprArea returns the area of the given footprint on the Earth surface, in square kilometers.
+func ExprArea(value any) (float64, error) {
+	ring, err := footprintRing(value)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+
+	for i := range len(ring) - 1 {
+		lon1, lat1 := toRadians(ring[i][0]), toRadians(ring[i][1])
+		lon2, lat2 := toRadians(ring[i+1][0]), toRadians(ring[i+1][1])
+		sum += (lon2 - lon1) * (2 + math.Sin(lat1) + math.Sin(lat2))
+	}
+
+	return math.Abs(sum*earthRadius*earthRadius/2) / 1e6, nil
+}
+
+// ExprWKT returns the WKT representation of the given footprint, as a polygon.
+func ExprWKT(value any) (string, error) {
+	ring, err := footprintRing(value)
+	if err != nil {
+		return "", err
+	}
+
+	points := make([]string, len(ring))
+
+	for i, point := range ring {
+		points[i] = strconv.FormatFloat(point[0], 'f', -1, 64) + " " + strconv.FormatFloat(point[1], 'f', -1, 64)
+	}
+
+	return "POLYGON ((" + strings.Join(points, ", ") + "))", nil
+}
+
+// ExprToWGS84 converts the given coordinates, expressed in the given reference system (e.g. "EPSG:32631"),
+// to a WGS 84 {lon, lat} map.
+func ExprToWGS84(x, y any, crs string) (map[string]any, error) {
+	xFloat, err := toFloat(x)
+	if err != nil {
+		return nil, err
+	}
+
+	yFloat, err := toFloat(y)
+	if err != nil {
+		return nil, err
+	}
+
+	epsg, err := geo.ParseCRS(crs)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	lon, lat, err := geo.ToWGS84(epsg, xFloat, yFloat)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	return map[string]any{"lon": lon, "lat": lat}, nil
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
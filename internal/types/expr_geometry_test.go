@@ -0,0 +1,54 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExprFootprintFunctions(t *testing.T) {
+	t.Parallel()
+
+	corner := LocalizationCorner{}
+	corner.UpperLeft.Coordinates.Lon, corner.UpperLeft.Coordinates.Lat = 2, 48
+	corner.UpperRight.Coordinates.Lon, corner.UpperRight.Coordinates.Lat = 4, 48
+	corner.LowerRight.Coordinates.Lon, corner.LowerRight.Coordinates.Lat = 4, 46
+	corner.LowerLeft.Coordinates.Lon, corner.LowerLeft.Coordinates.Lat = 2, 46
+
+	// The corners alone, as a struct, are accepted as well as a localization loaded from JSON.
+	for _, footprint := range []any{corner, map[string]any{"corner": corner}} {
+		bbox, err := ExprBBox(footprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff([]float64{2, 46, 4, 48}, bbox); diff != "" {
+			t.Errorf("Unexpected bbox (-want +got):\n%s", diff)
+		}
+
+		centroid, err := ExprCentroid(footprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(map[string]any{"lon": 3.0, "lat": 47.0}, centroid); diff != "" {
+			t.Errorf("Unexpected centroid (-want +got):\n%s", diff)
+		}
+
+		area, err := ExprArea(footprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// About 222 km from east to west by 222 km from north to south, shrunk by the latitude.
+		if area < 33000 || area > 34500 {
+			t.Errorf("Expected an area of about 33800 km², got %f", area)
+		}
+	}
+
+	_, err := ExprWKT(map[string]any{"title": "no footprint"})
+	if !errors.Is(err, errInvalidFootprint) {
+		t.Errorf("Expected error %q, got %v", errInvalidFootprint, err)
+	}
+}
@@ -0,0 +1,72 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var errNoGazetteer = errors.New("no gazetteer is configured")
+
+// ReverseGeocoder finds the places located in footprints.
+type ReverseGeocoder interface {
+	// ReverseGeocode returns the places located in the given polygons, given by their exterior rings of [lon, lat] positions.
+	ReverseGeocode(rings [][][2]float64) []GeonamesObject
+}
+
+// ExprReverseGeocode returns the places located in the given footprint, a localization (with corners or a geometry)
+// or its corners, as the list of countries expected from the geonames expression.
+func ExprReverseGeocode(value any, geocoder ReverseGeocoder) (any, error) {
+	if geocoder == nil {
+		return nil, errNoGazetteer
+	}
+
+	rings, err := footprintRings(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return toJSONValue(geocoder.ReverseGeocode(rings))
+}
+
+// footprintRings returns the exterior rings of the geometry of the given localization,
+// or the ring of its corners if it has no geometry.
+func footprintRings(value any) ([][][2]float64, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidFootprint, err)
+	}
+
+	var localization struct {
+		Geometry json.RawMessage `json:"geometry"`
+	}
+
+	// Localizations without geometry and corner objects fall back to the ring of the corners.
+	if json.Unmarshal(raw, &localization) == nil && len(localization.Geometry) > 0 && string(localization.Geometry) != "null" {
+		var geometryValue any
+
+		err = json.Unmarshal(localization.Geometry, &geometryValue)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidFootprint, err)
+		}
+
+		geometry, err := ParseGeometry(geometryValue)
+		if err != nil {
+			return nil, err
+		}
+
+		rings := make([][][2]float64, len(geometry.Polygons))
+		for i, polygon := range geometry.Polygons {
+			rings[i] = polygon[0]
+		}
+
+		return rings, nil
+	}
+
+	ring, err := footprintRing(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return [][][2]float64{ring}, nil
+}
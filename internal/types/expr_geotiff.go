@@ -0,0 +1,38 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/geo"
+)
+
+// ExprGeoTIFFFootprint returns the WGS 84 corners of the GeoTIFF file at the given path,
+// as an object shaped like a localization file, or nil if the path is empty.
+func ExprGeoTIFFFootprint(filePath string) (any, error) {
+	if filePath == "" {
+		return nil, nil //nolint: nilnil
+	}
+
+	geoTIFF, err := geo.ReadGeoTIFF(filePath)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	corners, err := geoTIFF.Corners()
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	var localization struct {
+		Corner LocalizationCorner `json:"corner"`
+	}
+
+	for i, point := range []*Point{
+		&localization.Corner.UpperLeft,
+		&localization.Corner.UpperRight,
+		&localization.Corner.LowerRight,
+		&localization.Corner.LowerLeft,
+	} {
+		point.Coordinates.Lon, point.Coordinates.Lat = corners[i][0], corners[i][1]
+	}
+
+	return toJSONValue(localization)
+}
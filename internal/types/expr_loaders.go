@@ -0,0 +1,285 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v4"
+	"gopkg.in/ini.v1"
+)
+
+// The formats of the files which can be loaded by the expressions.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+	FormatCSV  = "csv"
+	FormatTSV  = "tsv"
+	FormatINI  = "ini"
+)
+
+var (
+	errUnknownFormat    = errors.New("unknown file format")
+	errInvalidSeparator = errors.New("the separator must be a single character")
+)
+
+// fileFormats maps the file extensions to the format of their content.
+// The generic ones, like .txt or .cfg, are left to the JSON default, the INI files having to be read explicitly.
+var fileFormats = map[string]string{ //nolint: gochecknoglobals
+	".json": FormatJSON,
+	".yaml": FormatYAML,
+	".yml":  FormatYAML,
+	".toml": FormatTOML,
+	".csv":  FormatCSV,
+	".tsv":  FormatTSV,
+	".ini":  FormatINI,
+}
+
+// FileFormat returns the format of the file at the given path, based on its extension, JSON by default.
+func FileFormat(filePath string) string {
+	if format, found := fileFormats[strings.ToLower(path.Ext(filePath))]; found {
+		return format
+	}
+
+	return FormatJSON
+}
+
+// IsFileFormat reports whether the given format is one the files can be decoded from.
+func IsFileFormat(format string) bool {
+	switch format {
+	case FormatJSON, FormatYAML, FormatTOML, FormatCSV, FormatTSV, FormatINI:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExprLoadFile loads the content of the file at the given path, decoded from the given format.
+func ExprLoadFile(filePath, format string) (any, error) {
+	switch format {
+	case FormatJSON:
+		return ExprLoadJSON(filePath)
+	case FormatYAML:
+		return ExprLoadYAML(filePath)
+	case FormatTOML:
+		return ExprLoadTOML(filePath)
+	case FormatCSV:
+		return ExprLoadCSV(filePath, ",")
+	case FormatTSV:
+		return ExprLoadCSV(filePath, "\t")
+	case FormatINI:
+		return ExprLoadINI(filePath)
+	default:
+		return nil, fmt.Errorf("%w %q", errUnknownFormat, format)
+	}
+}
+
+// ExprLoadYAML loads the first document of the YAML file at the given path.
+func ExprLoadYAML(filePath string) (any, error) {
+	if filePath == "" {
+		return nil, nil //nolint: nilnil
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	var result any
+
+	err = yaml.Unmarshal(content, &result)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	return toJSONValue(result)
+}
+
+// ExprLoadTOML loads the TOML file at the given path.
+func ExprLoadTOML(filePath string) (any, error) {
+	if filePath == "" {
+		return nil, nil //nolint: nilnil
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	var result map[string]any
+
+	err = toml.Unmarshal(content, &result)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	return toJSONValue(result)
+}
+
+// ExprLoadCSV loads the CSV file at the given path, whose fields are separated by the given character,
+// as a list of objects mapping the names of the header row to the fields of each row.
+func ExprLoadCSV(filePath, separator string) (any, error) {
+	if filePath == "" {
+		return nil, nil //nolint: nilnil
+	}
+
+	sep, size := utf8.DecodeRuneInString(separator)
+	if size == 0 || size != len(separator) {
+		return nil, fmt.Errorf("%w: %q", errInvalidSeparator, separator)
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\ufeff"))))
+	reader.Comma = sep
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return []any{}, nil
+		}
+
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	rows := []any{}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		if err != nil {
+			return nil, err //nolint: wrapcheck // wrapped by caller
+		}
+
+		row := make(map[string]any, len(header))
+
+		for i, name := range header {
+			row[strings.TrimSpace(name)] = record[i]
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+// ExprLoadINI loads the INI file at the given path as an object mapping each section to its keys,
+// the keys defined before the first section being at the top level.
+func ExprLoadINI(filePath string) (any, error) {
+	if filePath == "" {
+		return nil, nil //nolint: nilnil
+	}
+
+	file, err := ini.LoadSources(ini.LoadOptions{AllowBooleanKeys: true}, filePath)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	result := make(map[string]any)
+
+	for _, section := range file.Sections() {
+		values := result
+
+		if section.Name() != ini.DefaultSection {
+			values = make(map[string]any, len(section.Keys()))
+			result[section.Name()] = values
+		}
+
+		for _, key := range section.Keys() {
+			values[key.Name()] = key.Value()
+		}
+	}
+
+	return result, nil
+}
+
+// ExprJQ returns the first result of the given jq expression on the file at the given path,
+// decoded from the given format.
+func ExprJQ(ctx context.Context, filePath, format, jqExpression string) (any, error) {
+	if filePath == "" {
+		return nil, nil //nolint: nilnil
+	}
+
+	query, err := gojq.Parse(jqExpression)
+	if err != nil {
+		return nil, fmt.Errorf("parsing jq expression: %w", err)
+	}
+
+	input, err := ExprLoadFile(filePath, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", format, err)
+	}
+
+	return runJQ(ctx, query, input)
+}
+
+// ExprJQValue returns the first result of the given jq expression on the given value,
+// typically the output of one of the loader functions.
+func ExprJQValue(ctx context.Context, value any, jqExpression string) (any, error) {
+	query, err := gojq.Parse(jqExpression)
+	if err != nil {
+		return nil, fmt.Errorf("parsing jq expression: %w", err)
+	}
+
+	input, err := toJSONValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return runJQ(ctx, query, input)
+}
+
+func runJQ(ctx context.Context, query *gojq.Query, input any) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, evalTimeout)
+	defer cancel()
+
+	iter := query.RunWithContext(ctx, input)
+
+	v, ok := iter.Next()
+	if !ok {
+		return nil, nil //nolint: nilnil
+	}
+
+	if err, ok := v.(error); ok {
+		if haltErr := new(gojq.HaltError); errors.As(err, &haltErr) && haltErr.Value() == nil {
+			return nil, nil //nolint: nilnil
+		}
+
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// toJSONValue converts the given value to the types produced by the JSON decoder,
+// so that all the formats give the same values and can be queried with jq.
+func toJSONValue(value any) (any, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	var result any
+
+	err = json.Unmarshal(raw, &result)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	return result, nil
+}
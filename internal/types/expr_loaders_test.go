@@ -0,0 +1,293 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFileFormat(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"product/metadata.json": FormatJSON,
+		"product/manifest.YAML": FormatYAML,
+		"product/manifest.yml":  FormatYAML,
+		"product/config.toml":   FormatTOML,
+		"product/bands.csv":     FormatCSV,
+		"product/bands.tsv":     FormatTSV,
+		"product/info.txt":      FormatJSON,
+		"product/info.cfg":      FormatJSON,
+		"product/info.ini":      FormatINI,
+		"product/metadata":      FormatJSON,
+		"product/metadata.dat":  FormatJSON,
+	}
+
+	for filePath, expected := range cases {
+		if format := FileFormat(filePath); format != expected {
+			t.Errorf("FileFormat(%q): want %q, got %q", filePath, expected, format)
+		}
+	}
+}
+
+func TestExprLoadFile(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		format      string
+		content     string
+		expected    any
+		expectedErr string
+	}{
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			content: `satellite: S2A
+date: 2026-02-26T11:34:00Z
+cloudCover: 12
+bands: [B02, B03]
+`,
+			expected: map[string]any{
+				"satellite":  "S2A",
+				"date":       "2026-02-26T11:34:00Z",
+				"cloudCover": 12.0,
+				"bands":      []any{"B02", "B03"},
+			},
+		},
+		{
+			name:        "invalid yaml",
+			format:      FormatYAML,
+			content:     "key: [value",
+			expectedErr: "did not find expected ',' or ']'",
+		},
+		{
+			name:   "toml",
+			format: FormatTOML,
+			content: `satellite = "S2A"
+date = 2026-02-26
+
+[processing]
+level = 2
+`,
+			expected: map[string]any{
+				"satellite":  "S2A",
+				"date":       "2026-02-26",
+				"processing": map[string]any{"level": 2.0},
+			},
+		},
+		{
+			name:        "invalid toml",
+			format:      FormatTOML,
+			content:     "key = ",
+			expectedErr: "toml: expected value, not end of input",
+		},
+		{
+			name:   "csv",
+			format: FormatCSV,
+			content: "\ufeffband, wavelength\n" +
+				"B02,490\n" +
+				"\"B03, green\",560\n",
+			expected: []any{
+				map[string]any{"band": "B02", "wavelength": "490"},
+				map[string]any{"band": "B03, green", "wavelength": "560"},
+			},
+		},
+		{
+			name:     "empty csv",
+			format:   FormatCSV,
+			content:  "",
+			expected: []any{},
+		},
+		{
+			name:        "csv with missing fields",
+			format:      FormatCSV,
+			content:     "a,b\n1\n",
+			expectedErr: "wrong number of fields",
+		},
+		{
+			name:     "tsv",
+			format:   FormatTSV,
+			content:  "band\twavelength\nB02\t490\n",
+			expected: []any{map[string]any{"band": "B02", "wavelength": "490"}},
+		},
+		{
+			name:   "ini",
+			format: FormatINI,
+			content: `satellite = S2A
+; comment
+[processing]
+level = 2
+baseline = "05.10"
+`,
+			expected: map[string]any{
+				"satellite":  "S2A",
+				"processing": map[string]any{"level": "2", "baseline": "05.10"},
+			},
+		},
+		{
+			name:        "unknown format",
+			format:      "xls",
+			content:     "",
+			expectedErr: `unknown file format "xls"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			inputFilePath := filepath.Join(t.TempDir(), "input")
+
+			err := os.WriteFile(inputFilePath, []byte(tc.content), 0600)
+			if err != nil {
+				t.Fatal("Can't create input file:", err)
+			}
+
+			result, err := ExprLoadFile(inputFilePath, tc.format)
+			if err != nil {
+				if tc.expectedErr == "" || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("Unexpected error: want it to contain %q, got %q", tc.expectedErr, err)
+				}
+
+				return
+			} else if tc.expectedErr != "" {
+				t.Fatalf("Expected error %q, got none", tc.expectedErr)
+			}
+
+			if diff := cmp.Diff(tc.expected, result); diff != "" {
+				t.Fatalf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExprLoadCSVSeparator(t *testing.T) {
+	t.Parallel()
+
+	inputFilePath := filepath.Join(t.TempDir(), "input.csv")
+
+	err := os.WriteFile(inputFilePath, []byte("a;b\n1;2\n"), 0600)
+	if err != nil {
+		t.Fatal("Can't create input file:", err)
+	}
+
+	result, err := ExprLoadCSV(inputFilePath, ";")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if diff := cmp.Diff([]any{map[string]any{"a": "1", "b": "2"}}, result); diff != "" {
+		t.Fatalf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	_, err = ExprLoadCSV(inputFilePath, ";;")
+	if err == nil || err.Error() != `the separator must be a single character: ";;"` {
+		t.Fatalf("Unexpected error for an invalid separator: %v", err)
+	}
+}
+
+func TestExprJQValue(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		value       any
+		jqExpr      string
+		expected    any
+		expectedErr string
+	}{
+		{
+			name:     "csv rows",
+			value:    []any{map[string]any{"band": "B02"}, map[string]any{"band": "B03"}},
+			jqExpr:   "map(.band)",
+			expected: []any{"B02", "B03"},
+		},
+		{
+			name:     "go values",
+			value:    map[string]int{"a": 1},
+			jqExpr:   ".a + 1",
+			expected: 2.0,
+		},
+		{
+			name:     "nil value",
+			value:    nil,
+			jqExpr:   ".foo",
+			expected: nil,
+		},
+		{
+			name:        "invalid jq expression",
+			value:       map[string]any{},
+			jqExpr:      ".[",
+			expectedErr: "parsing jq expression: unexpected EOF",
+		},
+		{
+			name:        "unsupported value",
+			value:       func() {},
+			jqExpr:      ".",
+			expectedErr: "json: unsupported type: func()",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := ExprJQValue(t.Context(), tc.value, tc.jqExpr)
+			if err != nil {
+				if err.Error() != tc.expectedErr {
+					t.Fatalf("Unexpected error: want %q, got %q", tc.expectedErr, err)
+				}
+
+				return
+			} else if tc.expectedErr != "" {
+				t.Fatalf("Expected error %q, got none", tc.expectedErr)
+			}
+
+			if diff := cmp.Diff(tc.expected, result); diff != "" {
+				t.Fatalf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// The files with a generic extension are read as JSON by _jq, as before the other formats were supported.
+func TestExprJQFormat(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	jsonTxt := filepath.Join(dir, "metadata.txt")
+	iniTxt := filepath.Join(dir, "info.txt")
+
+	if err := os.WriteFile(jsonTxt, []byte(`{"satellite": "S2A"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(iniTxt, []byte("satellite = S2B\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := ExprEnv{
+		Ctx:   t.Context(),
+		Files: map[string]DynamicInputFile{"json": {CacheKey: jsonTxt}, "ini": {CacheKey: iniTxt}},
+	}
+
+	cases := map[string]string{
+		`_jq("json", ".satellite")`:       "S2A",
+		`_jq("ini", ".satellite", "ini")`: "S2B",
+	}
+
+	for rawExpr, expected := range cases {
+		result, err := RunExpr(compileTypesExpr(t, rawExpr), env)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", rawExpr, err)
+		}
+
+		if result != expected {
+			t.Errorf("%s: want %q, got %v", rawExpr, expected, result)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxRoundDecimals bounds the count of decimals to round to, a float64 holding about 15 significant digits.
+const maxRoundDecimals = 15
+
+var (
+	errNotANumber      = errors.New("not a number")
+	errInvalidDecimals = errors.New("invalid count of decimals")
+)
+
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"} //nolint: gochecknoglobals
+
+// ExprFormatNumber formats the given number with the given count of decimals,
+// grouping the digits of its integer part by thousands with the given separator.
+func ExprFormatNumber(value any, decimals int, separator string) (string, error) {
+	number, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+
+	formatted := strconv.FormatFloat(number, 'f', max(decimals, 0), 64)
+	formatted, negative := strings.CutPrefix(formatted, "-")
+	intPart, decPart, hasDecimals := strings.Cut(formatted, ".")
+
+	var sb strings.Builder
+
+	if negative {
+		sb.WriteByte('-')
+	}
+
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteString(separator)
+		}
+
+		sb.WriteRune(digit)
+	}
+
+	if hasDecimals {
+		sb.WriteByte('.')
+		sb.WriteString(decPart)
+	}
+
+	return sb.String(), nil
+}
+
+// ExprFormatBytes formats the given size, in bytes, with the binary unit making it the most readable.
+func ExprFormatBytes(value any) (string, error) {
+	size, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+
+	unit := 0
+
+	for math.Abs(size) >= 1024 && unit < len(byteUnits)-1 {
+		size /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", int64(size), byteUnits[unit]), nil
+	}
+
+	return fmt.Sprintf("%.1f %s", size, byteUnits[unit]), nil
+}
+
+// ExprRound rounds the given number to the given count of decimals, between -15 and 15,
+// the negative ones rounding to the tens, the hundreds, and so on.
+func ExprRound(value any, decimals int) (float64, error) {
+	number, err := toFloat(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if decimals < -maxRoundDecimals || decimals > maxRoundDecimals {
+		return 0, fmt.Errorf("%w: %d, expected between %d and %d", errInvalidDecimals, decimals, -maxRoundDecimals, maxRoundDecimals)
+	}
+
+	factor := math.Pow10(decimals)
+
+	scaled := number * factor
+	if math.IsInf(scaled, 0) {
+		// Such a large number has no decimals to round.
+		return number, nil
+	}
+
+	return math.Round(scaled) / factor, nil
+}
+
+// toFloat converts the given number, or string holding a number, to a float.
+func toFloat(value any) (float64, error) {
+	v := reflect.ValueOf(value)
+
+	switch v.Kind() { //nolint: exhaustive
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", errNotANumber, v.String())
+		}
+
+		return number, nil
+	default:
+		return 0, fmt.Errorf("%w: %v", errNotANumber, value)
+	}
+}
@@ -0,0 +1,94 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestExprFormatNumber(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		value     any
+		decimals  int
+		separator string
+		expected  string
+	}{
+		{value: 1234567.891, decimals: 2, separator: ",", expected: "1,234,567.89"},
+		{value: -1234.5, decimals: 0, separator: " ", expected: "-1 234"},
+		{value: 999, decimals: 1, separator: ",", expected: "999.0"},
+		{value: "42000", decimals: 0, separator: ".", expected: "42.000"},
+		{value: 0.125, decimals: -1, separator: ",", expected: "0"},
+	}
+
+	for _, tc := range cases {
+		formatted, err := ExprFormatNumber(tc.value, tc.decimals, tc.separator)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.value, err)
+		}
+
+		if formatted != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.value, tc.expected, formatted)
+		}
+	}
+
+	if _, err := ExprFormatNumber("many", 0, ","); err == nil {
+		t.Error("Expected an error for a non-numeric value, got none")
+	}
+}
+
+func TestExprFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	cases := map[any]string{
+		512:             "512 B",
+		1024:            "1.0 KiB",
+		uint64(1 << 40): "1.0 TiB",
+		"3221225472":    "3.0 GiB",
+	}
+
+	for size, expected := range cases {
+		formatted, err := ExprFormatBytes(size)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", size, err)
+		}
+
+		if formatted != expected {
+			t.Errorf("%v: expected %q, got %q", size, expected, formatted)
+		}
+	}
+}
+
+func TestExprRound(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		value    any
+		decimals int
+		expected float64
+	}{
+		{value: 3.14159, decimals: 2, expected: 3.14},
+		{value: "2.5", decimals: 0, expected: 3},
+		{value: 1234, decimals: -2, expected: 1200},
+		{value: -0.000123456, decimals: 15, expected: -0.000123456},
+		{value: math.MaxFloat64, decimals: 2, expected: math.MaxFloat64},
+	}
+
+	for _, tc := range cases {
+		rounded, err := ExprRound(tc.value, tc.decimals)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.value, err)
+		}
+
+		if rounded != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.value, tc.expected, rounded)
+		}
+	}
+
+	for _, decimals := range []int{-16, 16, 400, -400} {
+		if _, err := ExprRound(1.5, decimals); !errors.Is(err, errInvalidDecimals) {
+			t.Errorf("%d decimals: expected an invalid decimals error, got %v", decimals, err)
+		}
+	}
+}
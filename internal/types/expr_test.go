@@ -2,11 +2,13 @@ package types //nolint: revive,nolintlint
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
@@ -78,7 +80,7 @@ func TestExprExist(t *testing.T) {
 func TestExprJQ(t *testing.T) {
 	t.Parallel()
 
-	result, err := ExprJQ(t.Context(), "", ".")
+	result, err := ExprJQ(t.Context(), "", FormatJSON, ".")
 	if err != nil {
 		t.Fatal("Unexpected error:", err)
 	}
@@ -161,7 +163,7 @@ func TestExprJQ(t *testing.T) {
 				t.Fatal("Can't create JSON input file:", err)
 			}
 
-			result, err := ExprJQ(t.Context(), inputFilePath, tc.jqExpr)
+			result, err := ExprJQ(t.Context(), inputFilePath, FormatJSON, tc.jqExpr)
 			if err != nil {
 				if err.Error() != tc.expectedErr {
 					t.Fatalf("Unexpected error: want %q, got %q", tc.expectedErr, err)
@@ -416,7 +418,7 @@ func TestExprTitle(t *testing.T) {
 func TestExprXPath(t *testing.T) {
 	t.Parallel()
 
-	result, err := ExprXPath("", "//node")
+	result, err := ExprXPath("", "//node", nil)
 	if err != nil {
 		t.Fatal("Unexpected error:", err)
 	}
@@ -448,7 +450,7 @@ func TestExprXPath(t *testing.T) {
 			name:        "invalid xpath expression",
 			xmlInput:    `<foo>bar</foo>`,
 			xpathExpr:   "@",
-			expectedErr: "expression must evaluate to a node-set",
+			expectedErr: "parsing xpath expression: expression must evaluate to a node-set",
 		},
 		{
 			name:      "string from object",
@@ -463,10 +465,28 @@ func TestExprXPath(t *testing.T) {
 			expected:  "a",
 		},
 		{
-			name:        "valid xpath with no match",
-			xmlInput:    `<foo>bar</foo>`,
-			xpathExpr:   "missing",
-			expectedErr: "runtime error: invalid memory address or nil pointer dereference",
+			name:      "valid xpath with no match",
+			xmlInput:  `<foo>bar</foo>`,
+			xpathExpr: "missing",
+			expected:  nil,
+		},
+		{
+			name:      "attribute",
+			xmlInput:  `<foo id="42">bar</foo>`,
+			xpathExpr: "foo/@id",
+			expected:  "42",
+		},
+		{
+			name:      "number",
+			xmlInput:  `<list><item>a</item><item>b</item></list>`,
+			xpathExpr: "count(//item)",
+			expected:  2.0,
+		},
+		{
+			name:      "boolean",
+			xmlInput:  `<list><item>a</item><item>b</item></list>`,
+			xpathExpr: "boolean(//item[. = 'b'])",
+			expected:  true,
 		},
 	}
 
@@ -481,7 +501,7 @@ func TestExprXPath(t *testing.T) {
 				t.Fatal("Can't create XML input file:", err)
 			}
 
-			result, err := ExprXPath(inputFilePath, tc.xpathExpr)
+			result, err := ExprXPath(inputFilePath, tc.xpathExpr, nil)
 			if err != nil {
 				if err.Error() != tc.expectedErr {
 					t.Fatalf("Unexpected error: want %q, got %q", tc.expectedErr, err)
@@ -612,3 +632,156 @@ func compileTypesExpr(t *testing.T, rawExpr string) *vm.Program {
 
 	return prgm
 }
+
+func TestRunExpr(t *testing.T) {
+	t.Parallel()
+
+	jsonFile := filepath.Join(t.TempDir(), "file.json")
+
+	err := os.WriteFile(jsonFile, []byte(`{"key": "value"}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := append(
+		[]expr.Option{
+			expr.Env(ExprEnv{}),
+			expr.WithContext("Ctx"),
+			expr.Patch(ExprEnvInjector{}),
+		},
+		ExprFunctions...,
+	)
+	options = append(options, ExprTestingFunctions...)
+
+	compile := func(rawExpr string) *vm.Program {
+		prgm, err := expr.Compile(rawExpr, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return prgm
+	}
+
+	cases := []struct {
+		name          string
+		expression    string
+		limits        ExprLimits
+		expected      any
+		expectedError error
+	}{
+		{
+			name:       "within limits",
+			expression: `_loadJSON("json").key`,
+			limits:     ExprLimits{Timeout: time.Second, MemoryBudget: 1000, MaxFileSize: 100},
+			expected:   "value",
+		},
+		{
+			name:          "timeout",
+			expression:    `__testBlock__()`,
+			limits:        ExprLimits{Timeout: 10 * time.Millisecond},
+			expectedError: ErrExprTimeout,
+		},
+		{
+			name:          "memory budget",
+			expression:    `map(1..1000, # * 2)`,
+			limits:        ExprLimits{MemoryBudget: 100},
+			expectedError: ErrExprMemoryBudget,
+		},
+		{
+			name:          "file size",
+			expression:    `_loadJSON("json")`,
+			limits:        ExprLimits{MaxFileSize: 5},
+			expectedError: ErrExprFileTooLarge,
+		},
+		{
+			name:          "call depth",
+			expression:    `_call("recursive")`,
+			limits:        ExprLimits{Timeout: time.Second},
+			expectedError: ErrExprCallDepth,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			env := ExprEnv{
+				Ctx:    t.Context(),
+				Files:  map[string]DynamicInputFile{"json": {CacheKey: jsonFile}},
+				Exprs:  map[string]*vm.Program{"recursive": compile(`_call("recur" + "sive")`)},
+				Limits: tc.limits,
+			}
+
+			result, err := RunExpr(compile(tc.expression), env)
+			if tc.expectedError != nil {
+				if !errors.Is(err, tc.expectedError) {
+					t.Fatalf("Expected error %q, got %v.", tc.expectedError, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal("Unexpected error:", err)
+			}
+
+			if diff := cmp.Diff(tc.expected, result); diff != "" {
+				t.Fatalf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// Not parallel, as it fills the shared count of abandoned evaluations.
+func TestRunExprAbandoned(t *testing.T) { //nolint: paralleltest
+	release := make(chan struct{})
+
+	blocking, err := expr.Compile(`block()`, expr.Function(
+		"block",
+		func(...any) (any, error) {
+			<-release
+
+			return nil, nil //nolint: nilnil
+		},
+		new(func() (any, error)),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quick, err := expr.Compile(`1 + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := ExprEnv{Ctx: t.Context(), Limits: ExprLimits{Timeout: time.Millisecond}}
+
+	for range maxAbandonedExprs {
+		if _, err = RunExpr(blocking, env); !errors.Is(err, ErrExprTimeout) {
+			t.Fatalf("Expected error %q, got %v.", ErrExprTimeout, err)
+		}
+	}
+
+	if abandoned := AbandonedExprs(); abandoned != maxAbandonedExprs {
+		t.Fatalf("Expected %d abandoned evaluations, got %d.", maxAbandonedExprs, abandoned)
+	}
+
+	if _, err = RunExpr(quick, env); !errors.Is(err, ErrExprTooManyAbandoned) {
+		t.Fatalf("Expected error %q, got %v.", ErrExprTooManyAbandoned, err)
+	}
+
+	close(release)
+
+	for deadline := time.Now().Add(5 * time.Second); AbandonedExprs() != 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the abandoned evaluations to end, %d still running.", AbandonedExprs())
+		}
+	}
+
+	env.Limits.Timeout = time.Second
+
+	result, err := RunExpr(quick, env)
+	if err != nil || result != 2 {
+		t.Fatalf("Expected 2, got %v, %v.", result, err)
+	}
+}
@@ -0,0 +1,142 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+)
+
+var errNotANodeSet = errors.New("the xpath expression doesn't select nodes")
+
+// ExprXPath returns the text of the first node matched by the given XPath expression in the XML file at the given path,
+// or nil if none matches. Expressions which don't select nodes return their value, e.g. a number for count(//item).
+// The prefixes of the expression are resolved with the given namespaces.
+func ExprXPath(filePath, xpathExpression string, namespaces map[string]string) (any, error) {
+	if filePath == "" {
+		return nil, nil //nolint: nilnil
+	}
+
+	return evaluateXPath(filePath, xpathExpression, namespaces, func(result any) (any, error) {
+		iter, ok := result.(*xpath.NodeIterator)
+		if !ok {
+			return result, nil
+		}
+
+		if !iter.MoveNext() {
+			return nil, nil //nolint: nilnil
+		}
+
+		return iter.Current().Value(), nil
+	})
+}
+
+// ExprXPathAll returns the texts of all the nodes matched by the given XPath expression in the XML file at the given path.
+func ExprXPathAll(filePath, xpathExpression string, namespaces map[string]string) (any, error) {
+	return collectXPathNodes(filePath, xpathExpression, namespaces, func(nav *xmlquery.NodeNavigator) any {
+		return nav.Value()
+	})
+}
+
+// ExprXPathNodes returns all the nodes matched by the given XPath expression in the XML file at the given path,
+// as objects holding their name, namespace, attributes, text and child elements.
+func ExprXPathNodes(filePath, xpathExpression string, namespaces map[string]string) (any, error) {
+	return collectXPathNodes(filePath, xpathExpression, namespaces, func(nav *xmlquery.NodeNavigator) any {
+		if nav.NodeType() == xpath.AttributeNode {
+			return xmlNodeObject(nav.LocalName(), nav.NamespaceURL(), nav.Value(), map[string]any{}, []any{})
+		}
+
+		return xmlElementObject(nav.Current())
+	})
+}
+
+func collectXPathNodes(filePath, xpathExpression string, namespaces map[string]string, convert func(nav *xmlquery.NodeNavigator) any) (any, error) {
+	if filePath == "" {
+		return nil, nil //nolint: nilnil
+	}
+
+	return evaluateXPath(filePath, xpathExpression, namespaces, func(result any) (any, error) {
+		iter, ok := result.(*xpath.NodeIterator)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", errNotANodeSet, xpathExpression)
+		}
+
+		values := []any{}
+
+		for iter.MoveNext() {
+			values = append(values, convert(iter.Current().(*xmlquery.NodeNavigator))) //nolint: forcetypeassert // always the case with xmlquery
+		}
+
+		return values, nil
+	})
+}
+
+// evaluateXPath evaluates the given XPath expression on the XML file at the given path,
+// and passes its result, either a node iterator or the value of the expression, to the given function.
+func evaluateXPath(filePath, xpathExpression string, namespaces map[string]string, handle func(result any) (any, error)) (res any, err error) {
+	expression, err := xpath.CompileWithNS(xpathExpression, namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("parsing xpath expression: %w", err)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	defer f.Close()
+
+	doc, err := xmlquery.Parse(f)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	// The XPath functions panic when given invalid arguments, possibly while iterating over the nodes.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+
+	return handle(expression.Evaluate(xmlquery.CreateXPathNavigator(doc)))
+}
+
+func xmlElementObject(node *xmlquery.Node) map[string]any {
+	attributes := make(map[string]any, len(node.Attr))
+
+	for _, attr := range node.Attr {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue // namespace declarations
+		}
+
+		attributes[attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+
+	children := []any{}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		switch child.Type { //nolint: exhaustive
+		case xmlquery.TextNode, xmlquery.CharDataNode:
+			text.WriteString(child.Data)
+		case xmlquery.ElementNode:
+			children = append(children, xmlElementObject(child))
+		}
+	}
+
+	return xmlNodeObject(node.Data, node.NamespaceURI, strings.TrimSpace(text.String()), attributes, children)
+}
+
+func xmlNodeObject(name, namespace, text string, attributes map[string]any, children []any) map[string]any {
+	return map[string]any{
+		"name":       name,
+		"namespace":  namespace,
+		"text":       text,
+		"attributes": attributes,
+		"children":   children,
+	}
+}
@@ -0,0 +1,131 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const isoMetadata = `<gmd:MD_Metadata xmlns:gmd="http://www.isotc211.org/2005/gmd" xmlns:gco="http://www.isotc211.org/2005/gco">
+	<gmd:fileIdentifier><gco:CharacterString>S2A_20260226</gco:CharacterString></gmd:fileIdentifier>
+	<gmd:keyword lang="en"><gco:CharacterString>optical</gco:CharacterString></gmd:keyword>
+	<gmd:keyword lang="fr"><gco:CharacterString>optique</gco:CharacterString></gmd:keyword>
+</gmd:MD_Metadata>`
+
+func TestExprXPathFunctions(t *testing.T) {
+	t.Parallel()
+
+	inputFilePath := filepath.Join(t.TempDir(), "metadata.xml")
+
+	err := os.WriteFile(inputFilePath, []byte(isoMetadata), 0600)
+	if err != nil {
+		t.Fatal("Can't create XML input file:", err)
+	}
+
+	namespaces := map[string]string{
+		"md":  "http://www.isotc211.org/2005/gmd",
+		"gco": "http://www.isotc211.org/2005/gco",
+	}
+
+	keyword := func(lang, text string) map[string]any {
+		return map[string]any{
+			"name":       "keyword",
+			"namespace":  "http://www.isotc211.org/2005/gmd",
+			"text":       "",
+			"attributes": map[string]any{"lang": lang},
+			"children": []any{map[string]any{
+				"name":       "CharacterString",
+				"namespace":  "http://www.isotc211.org/2005/gco",
+				"text":       text,
+				"attributes": map[string]any{},
+				"children":   []any{},
+			}},
+		}
+	}
+
+	cases := []struct {
+		name        string
+		xpathFn     func(filePath, xpathExpression string, namespaces map[string]string) (any, error)
+		xpathExpr   string
+		expected    any
+		expectedErr string
+	}{
+		{
+			name:      "first match with a declared prefix",
+			xpathFn:   ExprXPath,
+			xpathExpr: "//md:fileIdentifier/gco:CharacterString",
+			expected:  "S2A_20260226",
+		},
+		{
+			name:      "all matches",
+			xpathFn:   ExprXPathAll,
+			xpathExpr: "//md:keyword/gco:CharacterString",
+			expected:  []any{"optical", "optique"},
+		},
+		{
+			name:      "all attributes",
+			xpathFn:   ExprXPathAll,
+			xpathExpr: "//md:keyword/@lang",
+			expected:  []any{"en", "fr"},
+		},
+		{
+			name:      "no match",
+			xpathFn:   ExprXPathAll,
+			xpathExpr: "//md:missing",
+			expected:  []any{},
+		},
+		{
+			name:        "not a node set",
+			xpathFn:     ExprXPathAll,
+			xpathExpr:   "count(//md:keyword)",
+			expectedErr: `the xpath expression doesn't select nodes: "count(//md:keyword)"`,
+		},
+		{
+			name:      "nodes",
+			xpathFn:   ExprXPathNodes,
+			xpathExpr: "//md:keyword",
+			expected:  []any{keyword("en", "optical"), keyword("fr", "optique")},
+		},
+		{
+			name:      "attribute nodes",
+			xpathFn:   ExprXPathNodes,
+			xpathExpr: "//md:keyword[1]/@lang",
+			expected: []any{map[string]any{
+				"name":       "lang",
+				"namespace":  "",
+				"text":       "en",
+				"attributes": map[string]any{},
+				"children":   []any{},
+			}},
+		},
+		{
+			name:        "undeclared prefix",
+			xpathFn:     ExprXPath,
+			xpathExpr:   "//unknown:keyword",
+			expectedErr: "parsing xpath expression: prefix unknown not defined.",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := tc.xpathFn(inputFilePath, tc.xpathExpr, namespaces)
+			if err != nil {
+				if err.Error() != tc.expectedErr {
+					t.Fatalf("Unexpected error: want %q, got %q", tc.expectedErr, err)
+				}
+
+				return
+			} else if tc.expectedErr != "" {
+				t.Fatalf("Expected error %q, got none", tc.expectedErr)
+			}
+
+			if diff := cmp.Diff(tc.expected, result); diff != "" {
+				t.Fatalf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
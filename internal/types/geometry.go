@@ -0,0 +1,177 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/geo"
+)
+
+// GeoJSON geometry types supported as localization footprints.
+const (
+	GeometryPolygon      = "Polygon"
+	GeometryMultiPolygon = "MultiPolygon"
+)
+
+var ErrInvalidGeometry = errors.New("invalid geometry")
+
+// Geometry is a GeoJSON Polygon or MultiPolygon.
+type Geometry struct {
+	Type string
+	// Polygons holds the linear rings of each polygon, the first one being its exterior ring.
+	// A Polygon has a single polygon.
+	Polygons [][][][2]float64
+}
+
+// ParseGeometry decodes the given GeoJSON Polygon or MultiPolygon object, and checks that its rings are closed.
+// The altitudes of the positions are dropped.
+func ParseGeometry(value any) (*Geometry, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidGeometry, err)
+	}
+
+	var geoJSON struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+
+	err = json.Unmarshal(raw, &geoJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidGeometry, err)
+	}
+
+	var polygons [][][][]float64
+
+	switch geoJSON.Type {
+	case GeometryPolygon:
+		var polygon [][][]float64
+
+		err = json.Unmarshal(geoJSON.Coordinates, &polygon)
+		polygons = [][][][]float64{polygon}
+	case GeometryMultiPolygon:
+		err = json.Unmarshal(geoJSON.Coordinates, &polygons)
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q, expected %s or %s", ErrInvalidGeometry, geoJSON.Type, GeometryPolygon, GeometryMultiPolygon)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: coordinates: %w", ErrInvalidGeometry, err)
+	}
+
+	if len(polygons) == 0 {
+		return nil, fmt.Errorf("%w: no polygons", ErrInvalidGeometry)
+	}
+
+	geometry := &Geometry{Type: geoJSON.Type, Polygons: make([][][][2]float64, len(polygons))}
+
+	for p, polygon := range polygons {
+		if len(polygon) == 0 {
+			return nil, fmt.Errorf("%w: polygon %d has no rings", ErrInvalidGeometry, p)
+		}
+
+		geometry.Polygons[p] = make([][][2]float64, len(polygon))
+
+		for r, ring := range polygon {
+			// A closed ring is made of at least 4 positions, the last one being the first one.
+			if len(ring) < 4 {
+				return nil, fmt.Errorf("%w: ring %d of polygon %d has %d positions, at least 4 are expected", ErrInvalidGeometry, r, p, len(ring))
+			}
+
+			positions := make([][2]float64, len(ring))
+
+			for i, position := range ring {
+				if len(position) < 2 || math.IsNaN(position[0]) || math.IsInf(position[0], 0) || math.IsNaN(position[1]) || math.IsInf(position[1], 0) {
+					return nil, fmt.Errorf("%w: invalid position %v in ring %d of polygon %d", ErrInvalidGeometry, position, r, p)
+				}
+
+				positions[i] = [2]float64{position[0], position[1]}
+			}
+
+			if positions[0] != positions[len(positions)-1] {
+				return nil, fmt.Errorf("%w: ring %d of polygon %d is not closed", ErrInvalidGeometry, r, p)
+			}
+
+			geometry.Polygons[p][r] = positions
+		}
+	}
+
+	return geometry, nil
+}
+
+// MarshalJSON encodes the geometry as a GeoJSON object.
+func (g Geometry) MarshalJSON() ([]byte, error) {
+	var coordinates any = g.Polygons
+
+	if g.Type == GeometryPolygon && len(g.Polygons) > 0 {
+		coordinates = g.Polygons[0]
+	}
+
+	return json.Marshal(map[string]any{ //nolint: wrapcheck
+		"type":        g.Type,
+		"coordinates": coordinates,
+	})
+}
+
+// toWGS84 reprojects the positions of the geometry from the reference system with the given EPSG code to WGS 84,
+// normalizing their longitudes so that geometries crossing the antimeridian stay continuous.
+func (g *Geometry) toWGS84(epsg int) error {
+	var lons []float64
+
+	for _, polygon := range g.Polygons {
+		for _, ring := range polygon {
+			for i, position := range ring {
+				lon, lat, err := geo.ToWGS84(epsg, position[0], position[1])
+				if err != nil {
+					return err //nolint: wrapcheck // wrapped by caller
+				}
+
+				ring[i] = [2]float64{lon, lat}
+				lons = append(lons, lon)
+			}
+		}
+	}
+
+	geo.NormalizeAntimeridian(lons)
+
+	for _, polygon := range g.Polygons {
+		for _, ring := range polygon {
+			for i := range ring {
+				ring[i][0], lons = lons[0], lons[1:]
+			}
+		}
+	}
+
+	return nil
+}
+
+// corners returns the corners of the bounding box of the geometry.
+func (g *Geometry) corners() LocalizationCorner {
+	minLon, minLat, maxLon, maxLat := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+
+	for _, polygon := range g.Polygons {
+		for _, ring := range polygon {
+			for _, position := range ring {
+				minLon, maxLon = min(minLon, position[0]), max(maxLon, position[0])
+				minLat, maxLat = min(minLat, position[1]), max(maxLat, position[1])
+			}
+		}
+	}
+
+	point := func(lon, lat float64) Point {
+		var p Point
+
+		p.Coordinates.Lon, p.Coordinates.Lat = lon, lat
+
+		return p
+	}
+
+	return LocalizationCorner{
+		UpperLeft:  point(minLon, maxLat),
+		UpperRight: point(maxLon, maxLat),
+		LowerLeft:  point(minLon, minLat),
+		LowerRight: point(maxLon, minLat),
+	}
+}
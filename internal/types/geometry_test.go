@@ -0,0 +1,86 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseGeometry(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		geoJSON      string
+		expectedJSON string
+		expectedErr  error
+	}{
+		{
+			name:         "polygon",
+			geoJSON:      `{"type": "Polygon", "coordinates": [[[0, 0, 12], [1, 0, 12], [1, 1, 12], [0, 0, 12]]]}`,
+			expectedJSON: `{"coordinates":[[[0,0],[1,0],[1,1],[0,0]]],"type":"Polygon"}`,
+		},
+		{
+			name:         "multipolygon",
+			geoJSON:      `{"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 0]]], [[[5, 5], [6, 5], [6, 6], [5, 5]]]]}`,
+			expectedJSON: `{"coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,5]]]],"type":"MultiPolygon"}`,
+		},
+		{
+			name:        "too few positions",
+			geoJSON:     `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [0, 0]]]}`,
+			expectedErr: ErrInvalidGeometry,
+		},
+		{
+			name:        "position without latitude",
+			geoJSON:     `{"type": "Polygon", "coordinates": [[[0], [1, 0], [1, 1], [0]]]}`,
+			expectedErr: ErrInvalidGeometry,
+		},
+		{
+			name:        "polygon without rings",
+			geoJSON:     `{"type": "MultiPolygon", "coordinates": [[]]}`,
+			expectedErr: ErrInvalidGeometry,
+		},
+		{
+			name:        "invalid coordinates",
+			geoJSON:     `{"type": "Polygon", "coordinates": "0 0, 1 0, 1 1, 0 0"}`,
+			expectedErr: ErrInvalidGeometry,
+		},
+		{
+			name:        "line",
+			geoJSON:     `{"type": "LineString", "coordinates": [[0, 0], [1, 1]]}`,
+			expectedErr: ErrInvalidGeometry,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var value any
+
+			if err := json.Unmarshal([]byte(tc.geoJSON), &value); err != nil {
+				t.Fatal(err)
+			}
+
+			geometry, err := ParseGeometry(value)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("unexpected error: want %v, got %v", tc.expectedErr, err)
+			}
+
+			if tc.expectedErr != nil {
+				return
+			}
+
+			encoded, err := json.Marshal(geometry)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.expectedJSON, string(encoded)); diff != "" {
+				t.Errorf("unexpected GeoJSON (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
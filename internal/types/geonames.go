@@ -5,20 +5,25 @@ import (
 	"strings"
 )
 
+// GeonamesObject is a country, holding the states, counties and places a product covers.
 type GeonamesObject struct {
-	Name   string `json:"name"`
-	States []struct {
-		Name     string `json:"name"`
-		Counties []struct {
-			Name   string `json:"name"`
-			Cities []struct {
-				Name string `json:"name"`
-			} `json:"cities"`
-			Villages []struct {
-				Name string `json:"name"`
-			} `json:"villages"`
-		} `json:"counties"`
-	} `json:"states"`
+	Name   string          `json:"name"`
+	States []GeonamesState `json:"states"`
+}
+
+type GeonamesState struct {
+	Name     string           `json:"name"`
+	Counties []GeonamesCounty `json:"counties"`
+}
+
+type GeonamesCounty struct {
+	Name     string          `json:"name"`
+	Cities   []GeonamesPlace `json:"cities"`
+	Villages []GeonamesPlace `json:"villages"`
+}
+
+type GeonamesPlace struct {
+	Name string `json:"name"`
 }
 
 type Geonames struct {
@@ -1,5 +1,19 @@
 package types //nolint: revive,nolintlint
 
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/geo"
+)
+
+// LocalizationCRS is the reference system of the localizations served to the frontend.
+const LocalizationCRS = "EPSG:4326"
+
+// pixelEpsilon is the fraction of pixel under which the pixel coordinates are rounded to the nearest one.
+const pixelEpsilon = 1e-6
+
 type Point struct {
 	Coordinates struct {
 		Lon float64 `json:"lon"`
@@ -18,4 +32,116 @@ type Localization struct {
 	CachedObject
 
 	Corner LocalizationCorner `json:"corner" mapstructure:"corner"`
+	// CRS is the reference system of the corners, e.g. "EPSG:32631", WGS 84 if empty.
+	// For projected systems, the lon and lat coordinates hold the easting and the northing.
+	CRS string `json:"crs" mapstructure:"crs"`
+	// Geometry is the exact footprint of the product, for those the four corners don't describe well
+	// (swaths, multi-part acquisitions...). The corners are then the ones of its bounding box.
+	Geometry *Geometry `json:"geometry,omitempty" mapstructure:"geometry"`
+}
+
+// ToWGS84 reprojects the corners, or the geometry, of the localization to WGS 84, and normalizes their longitudes
+// so that footprints crossing the antimeridian stay continuous. The corners of a localization with a geometry
+// are replaced by the ones of its bounding box.
+func (l *Localization) ToWGS84() error {
+	epsg, err := geo.ParseCRS(l.CRS)
+	if err != nil {
+		return err //nolint: wrapcheck // wrapped by caller
+	}
+
+	if l.Geometry != nil {
+		err = l.Geometry.toWGS84(epsg)
+		if err != nil {
+			return err
+		}
+
+		l.Corner = l.Geometry.corners()
+		l.CRS = LocalizationCRS
+
+		return nil
+	}
+
+	points := []*Point{&l.Corner.UpperLeft, &l.Corner.UpperRight, &l.Corner.LowerRight, &l.Corner.LowerLeft}
+	lons := make([]float64, len(points))
+
+	for i, point := range points {
+		lons[i], point.Coordinates.Lat, err = geo.ToWGS84(epsg, point.Coordinates.Lon, point.Coordinates.Lat)
+		if err != nil {
+			return err //nolint: wrapcheck // wrapped by caller
+		}
+	}
+
+	geo.NormalizeAntimeridian(lons)
+
+	for i, point := range points {
+		point.Coordinates.Lon = lons[i]
+	}
+
+	l.CRS = LocalizationCRS
+
+	return nil
+}
+
+// Footprint returns the geometry of the localization, or the polygon of its corners if it has none.
+func (l *Localization) Footprint() Geometry {
+	if l.Geometry != nil {
+		return *l.Geometry
+	}
+
+	ring := make([][2]float64, 0, 5)
+
+	for _, point := range []Point{l.Corner.UpperLeft, l.Corner.UpperRight, l.Corner.LowerRight, l.Corner.LowerLeft, l.Corner.UpperLeft} {
+		ring = append(ring, [2]float64{point.Coordinates.Lon, point.Coordinates.Lat})
+	}
+
+	return Geometry{Type: GeometryPolygon, Polygons: [][][][2]float64{{ring}}}
+}
+
+// PixelWindow returns the region of an image of the given size covered by the given bounding box,
+// [min lon, min lat, max lon, max lat], clipped to the image. The corners of the localization are mapped
+// to the ones of the image through a projective transform, which also handles the rotated and skewed footprints.
+func (l *Localization) PixelWindow(bbox [4]float64, width, height int) (image.Rectangle, error) {
+	corners := [4][2]float64{}
+	centerLon := 0.
+
+	for i, point := range []Point{l.Corner.UpperLeft, l.Corner.UpperRight, l.Corner.LowerRight, l.Corner.LowerLeft} {
+		corners[i] = [2]float64{point.Coordinates.Lon, point.Coordinates.Lat}
+		centerLon += point.Coordinates.Lon / 4
+	}
+
+	w, h := float64(width), float64(height)
+
+	toPixels, err := geo.NewHomography(corners, [4][2]float64{{0, 0}, {w, 0}, {w, h}, {0, h}})
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("%w: localization: %w", ErrInvalidCrop, err)
+	}
+
+	// The longitudes of the footprints crossing the antimeridian may go beyond 180°,
+	// the bounding box is moved next to the footprint.
+	shift := 360 * math.Round((centerLon-(bbox[0]+bbox[2])/2)/360)
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+
+	for _, lon := range []float64{bbox[0], bbox[2]} {
+		for _, lat := range []float64{bbox[1], bbox[3]} {
+			x, y := toPixels.Apply(lon+shift, lat)
+			if math.IsNaN(x) || math.IsNaN(y) {
+				return image.Rectangle{}, fmt.Errorf("%w: the bounding box can't be projected on the image", ErrInvalidCrop)
+			}
+
+			minX, maxX = min(minX, x), max(maxX, x)
+			minY, maxY = min(minY, y), max(maxY, y)
+		}
+	}
+
+	// Not built with image.Rect, which would swap the bounds of a box outside of the image.
+	// The rounding errors of the transform are ignored rather than growing the window by a pixel.
+	window := image.Rectangle{
+		Min: image.Pt(int(math.Floor(max(minX, 0)+pixelEpsilon)), int(math.Floor(max(minY, 0)+pixelEpsilon))),
+		Max: image.Pt(int(math.Ceil(min(maxX, w)-pixelEpsilon)), int(math.Ceil(min(maxY, h)-pixelEpsilon))),
+	}
+	if window.Empty() {
+		return image.Rectangle{}, fmt.Errorf("%w: the bounding box is outside of the image", ErrInvalidCrop)
+	}
+
+	return window, nil
 }
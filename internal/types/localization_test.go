@@ -0,0 +1,89 @@
+package types //nolint: revive,nolintlint
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestLocalizationPixelWindow(t *testing.T) {
+	t.Parallel()
+
+	localization := func(corners [4][2]float64) Localization {
+		var l Localization
+
+		for i, point := range []*Point{&l.Corner.UpperLeft, &l.Corner.UpperRight, &l.Corner.LowerRight, &l.Corner.LowerLeft} {
+			point.Coordinates.Lon, point.Coordinates.Lat = corners[i][0], corners[i][1]
+		}
+
+		return l
+	}
+
+	northUp := localization([4][2]float64{{2, 49}, {4, 49}, {4, 48}, {2, 48}})
+
+	cases := []struct {
+		name           string
+		localization   Localization
+		bbox           [4]float64
+		expectedWindow image.Rectangle
+		expectedErr    error
+	}{
+		{
+			name:           "inside",
+			localization:   northUp,
+			bbox:           [4]float64{2.5, 48.25, 3, 48.5},
+			expectedWindow: image.Rect(250, 250, 500, 375),
+		},
+		{
+			name:           "rounded outwards",
+			localization:   northUp,
+			bbox:           [4]float64{2.5005, 48.2505, 2.9995, 48.4995},
+			expectedWindow: image.Rect(250, 250, 500, 375),
+		},
+		{
+			name:           "clipped",
+			localization:   northUp,
+			bbox:           [4]float64{3.5, 47, 5, 48.5},
+			expectedWindow: image.Rect(750, 250, 1000, 500),
+		},
+		{
+			name:         "outside",
+			localization: northUp,
+			bbox:         [4]float64{5, 48, 6, 49},
+			expectedErr:  ErrInvalidCrop,
+		},
+		{
+			name:           "rotated",
+			localization:   localization([4][2]float64{{0, 1}, {1, 2}, {2, 1}, {1, 0}}),
+			bbox:           [4]float64{0.9, 0.9, 1.1, 1.1},
+			expectedWindow: image.Rect(400, 200, 600, 300),
+		},
+		{
+			name:           "across the antimeridian",
+			localization:   localization([4][2]float64{{179, 1}, {181, 1}, {181, 0}, {179, 0}}),
+			bbox:           [4]float64{-179.5, 0, -179, 0.5},
+			expectedWindow: image.Rect(750, 250, 1000, 500),
+		},
+		{
+			name:         "aligned corners",
+			localization: localization([4][2]float64{{0, 0}, {1, 1}, {2, 2}, {0, 1}}),
+			bbox:         [4]float64{0, 0, 1, 1},
+			expectedErr:  ErrInvalidCrop,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			window, err := tc.localization.PixelWindow(tc.bbox, 1000, 500)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+
+			if window != tc.expectedWindow {
+				t.Errorf("Expected window %v, got %v", tc.expectedWindow, window)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	"io"
 	"time"
 )
 
@@ -32,10 +34,96 @@ type ImageSummary struct {
 	Type           string              `json:"type"`
 	Geonames       *Geonames           `json:"geonames"`
 	ProductInfo    *ProductInformation `json:"productInfo"`
-	DynamicFilters map[string]string   `json:"dynamicFilters"`
+	DynamicFilters map[string]any      `json:"dynamicFilters"`
 	// Contains the cache key to the image preview.
-	CachedObject CachedObject `json:"cachedObject"`
-	Size         ImageSize    `json:"size"`
+	CachedObject     CachedObject      `json:"cachedObject"`
+	Size             ImageSize         `json:"size"`
+	EvaluationErrors []EvaluationError `json:"evaluationErrors"`
+	// DeepZoomManifest is the path of the DZI manifest of the preview tile pyramid, under /api/deepzoom.
+	// It is only set for the previews large enough to be tiled.
+	DeepZoomManifest string `json:"deepZoomManifest"`
+}
+
+// EvaluationError describes the failure of an expression evaluation.
+type EvaluationError struct {
+	Expression string `json:"expression"`
+	Message    string `json:"message"`
+	// FileSelectors are the file selectors referenced by the expression, and by the ones it calls.
+	FileSelectors []string `json:"fileSelectors"`
+}
+
+// SearchResult is an image matching a search query.
+type SearchResult struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// Score is the relevance of the match, higher being better.
+	Score float64 `json:"score"`
+}
+
+// FootprintCluster is a group of image footprints close to each other at a given zoom level,
+// or a single footprint, which then comes with its image.
+type FootprintCluster struct {
+	// Lon and Lat locate the center of the cluster.
+	Lon   float64 `json:"lon"`
+	Lat   float64 `json:"lat"`
+	Count int     `json:"count"`
+	// BBox is the bounding box of the footprints of the cluster, as [min lon, min lat, max lon, max lat].
+	BBox   []float64      `json:"bbox"`
+	Counts []ClusterCount `json:"counts"`
+	Image  *ClusterImage  `json:"image"`
+}
+
+// ClusterCount is the number of images of a group and type in a cluster.
+type ClusterCount struct {
+	Group string `json:"group"`
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+// ClusterImage is the image of a cluster holding a single footprint.
+type ClusterImage struct {
+	Bucket    string   `json:"bucket"`
+	Key       string   `json:"key"`
+	Footprint Geometry `json:"footprint"`
+}
+
+// ImageRef identifies a cached image by its bucket and key.
+type ImageRef struct {
+	Bucket string
+	Key    string
+}
+
+// Formats of the cropped images.
+const (
+	CropFormatPNG  = "png"
+	CropFormatJPEG = "jpeg"
+)
+
+// CropRequest describes the region of a cached image to extract.
+type CropRequest struct {
+	// Window is the region in pixels, ignored when BBox is set.
+	Window image.Rectangle
+	// BBox is the region as geographic coordinates, [min lon, min lat, max lon, max lat].
+	BBox *[4]float64
+	// MaxSize bounds the width and height of the result, which is downscaled to fit. Zero keeps the full resolution.
+	MaxSize int
+	// Format is the one of the result, CropFormatPNG or CropFormatJPEG, that of the image if empty.
+	Format string
+}
+
+// DynamicFilterDomain describes the values taken by a dynamic filter across the cached images.
+type DynamicFilterDomain struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	UIHint string `json:"uiHint"`
+	// Values are the distinct values of the string and boolean filters, sorted,
+	// and the declared values of the enum filters.
+	Values []any `json:"values"`
+	// Min and Max bound the values of the number and date filters, nil when no image has a value.
+	Min any `json:"min"`
+	Max any `json:"max"`
+	// Count is the number of images having a value.
+	Count int `json:"count"`
 }
 
 type Image struct {
@@ -49,6 +137,28 @@ type Image struct {
 	ExternalViewerURLs map[string]string
 	// TargetFiles is a slice of cache keys
 	TargetFiles []string
+	// EvaluationErrors holds the errors of the image summary, along with the ones of the image details.
+	EvaluationErrors []EvaluationError
+}
+
+// ImageDebug holds the raw results of all the expressions of an image, for debugging purposes.
+type ImageDebug struct {
+	Bucket string
+	Key    string
+	Group  string
+	Type   string
+	// Files is a map[file selector] -> S3 key, or list of S3 keys for the selectors matching multiple objects
+	Files       map[string]any
+	Expressions []ExprDebug
+}
+
+// ExprDebug is the raw result of an expression evaluation, bypassing the cache.
+type ExprDebug struct {
+	Expression    string
+	Output        any
+	Error         string
+	DurationMs    float64
+	FileSelectors []string
 }
 
 type ObjectType string
@@ -65,11 +175,46 @@ const (
 // AllImageSummaries is a map[group] -> map[type] -> images.
 type AllImageSummaries map[string]map[string][]ImageSummary
 
+// ExprEvaluation describes an evaluation of an expression, which didn't hit the cache.
+type ExprEvaluation struct {
+	Time       time.Time     `json:"time"`
+	Group      string        `json:"group"`
+	Type       string        `json:"type"`
+	Expression string        `json:"expression"`
+	Bucket     string        `json:"bucket"`
+	Key        string        `json:"key"`
+	Duration   time.Duration `json:"durationNs"`
+	Error      string        `json:"error,omitempty"`
+}
+
 type Cache interface {
 	GetAllImages(ctx context.Context, start, end time.Time) AllImageSummaries
 	GetImage(ctx context.Context, bucket, name string) (Image, error)
 	GetCachedObject(cacheKey string) ([]byte, error)
+	// GetDeepZoomObject returns the DZI manifest or tile at the given path, generating the tile pyramid
+	// of the preview it belongs to if it is missing or outdated.
+	GetDeepZoomObject(path string) ([]byte, error)
 	DumpImages() map[string][]string
+	// SlowEvaluations returns, from the slowest, at most limit of the recent expression evaluations.
+	SlowEvaluations(limit int) []ExprEvaluation
+	// DebugImage evaluates all the expressions of the given image.
+	DebugImage(ctx context.Context, bucket, name string) (ImageDebug, error)
+	// DynamicFilterDomains returns the domains of the dynamic filters of the given group and type,
+	// computed from the cached images. Empty group or type match all of them.
+	DynamicFilterDomains(ctx context.Context, group, typ string) []DynamicFilterDomain
+	// Search returns the images whose place names or product information match the given query, from the most relevant.
+	// At most limit images are returned, all of them if limit isn't positive.
+	Search(query string, limit int) []SearchResult
+	// FootprintClusters returns the clusters of the footprints whose center is in the given bounding box,
+	// [min lon, min lat, max lon, max lat], at the given zoom level. Empty group or type match all of them.
+	FootprintClusters(bbox [4]float64, zoom int, group, typ string) []FootprintCluster
+	// CropImage returns the given region of the cached image with the given key, encoded as PNG or JPEG.
+	// Geographic regions require the key to be the one of the preview of a localized image.
+	CropImage(ctx context.Context, cacheKey string, req CropRequest) ([]byte, error)
+	// ExportImages writes to w a zip archive of the cached files of the given images, each with a JSON manifest
+	// of what the server knows about it. The objects only reachable by signed URL are downloaded from S3 into
+	// the archive if fetchSignedObjects is set. Nothing is written if one of the images isn't found.
+	ExportImages(ctx context.Context, images []ImageRef, fetchSignedObjects bool, w io.Writer) error
 }
 
 type EventType string
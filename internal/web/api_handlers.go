@@ -3,11 +3,19 @@ package web
 import (
 	"errors"
 	"fmt"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+	"github.com/Maxi-Mega/s3-image-server-v2/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,8 +24,18 @@ var (
 	errNoCacheKey      = errors.New("no cache key provided")
 	errInvalidCacheKey = errors.New("invalid cache key")
 	errUnexpected      = errors.New("an unexpected error occurred - check the server logs for more information")
+	errInvalidLimit    = errors.New("invalid limit")
+	errNoCropRegion    = errors.New("either a window or a bbox must be provided")
+	errInvalidWindow   = errors.New("invalid window, expected x,y,width,height")
+	errInvalidBBox     = errors.New("invalid bbox, expected minLon,minLat,maxLon,maxLat")
+	errInvalidMaxSize  = errors.New("invalid max size")
+	errInvalidFormat   = errors.New("invalid format, expected png or jpeg")
+	errNoImages        = errors.New("no image provided")
+	errInvalidImage    = errors.New("invalid image, expected bucket/key")
 )
 
+const defaultSlowEvaluationsLimit = 20
+
 type StaticInfo struct {
 	SoftwareVersion        string `json:"softwareVersion"`
 	WindowTitle            string `json:"windowTitle"`
@@ -28,18 +46,25 @@ type StaticInfo struct {
 	MaxImagesDisplayCount  int    `json:"maxImagesDisplayCount"`
 	PMTilesURL             string `json:"pmtilesURL"`
 	PMTilesStyleURL        string `json:"pmtilesStyleURL"`
+	MapTilesType           string `json:"mapTilesType"` // pmtiles, or vector or raster for XYZ tiles
 	ImageGroups            []struct {
 		GroupName string `json:"name"`
 		Bucket    string `json:"bucket"`
 		Types     []struct {
 			Name        string `json:"name"`
 			DisplayName string `json:"displayName"`
+			// DynamicFilters are the names of the filters applying to the type.
+			DynamicFilters []string `json:"dynamicFilters" mapstructure:"-"`
 		} `json:"types"`
 	} `json:"imageGroups"`
+	// DynamicFilters are the names of the filters applying to at least one type.
 	DynamicFilters []string `json:"dynamicFilters"`
 }
 
 func (srv *Server) infoHandler(c *gin.Context) {
+	srv.infoLock.RLock()
+	defer srv.infoLock.RUnlock()
+
 	c.JSON(http.StatusOK, srv.staticInfo)
 }
 
@@ -71,3 +96,229 @@ func (srv *Server) cacheHandler(c *gin.Context) {
 
 	c.Data(http.StatusOK, detectContentType(cacheKey, objectData), objectData)
 }
+
+// deepZoomHandler serves the DZI manifests and tiles of the large previews, generating them on the first request.
+func (srv *Server) deepZoomHandler(c *gin.Context) {
+	path := strings.Trim(c.Param("path"), "/")
+	if path == "" || strings.Contains(path, "..") {
+		c.AbortWithStatusJSON(http.StatusBadRequest, Error{errInvalidCacheKey})
+
+		return
+	}
+
+	data, err := srv.cache.GetDeepZoomObject(path)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, types.ErrNotDeepZoomed) {
+			c.AbortWithStatusJSON(http.StatusNotFound, Error{fmt.Errorf("deep zoom object %q not found", path)})
+		} else {
+			logger.Warnf("Unexpected error while serving deep zoom object %q: %v", path, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, Error{errUnexpected})
+		}
+
+		return
+	}
+
+	c.Data(http.StatusOK, detectContentType(path, data), data)
+}
+
+// cropHandler serves a region of a cached image, given as a pixel window or as a geographic bounding box.
+func (srv *Server) cropHandler(c *gin.Context) {
+	cacheKey := strings.Trim(c.Param("cache_key"), "/")
+	if cacheKey == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, Error{errNoCacheKey})
+
+		return
+	}
+
+	if strings.Contains(cacheKey, "..") {
+		c.AbortWithStatusJSON(http.StatusBadRequest, Error{errInvalidCacheKey})
+
+		return
+	}
+
+	req, err := parseCropRequest(c.Request.URL.Query())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, Error{err})
+
+		return
+	}
+
+	data, err := srv.cache.CropImage(c.Request.Context(), cacheKey, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, types.ErrInvalidCrop):
+			c.AbortWithStatusJSON(http.StatusBadRequest, Error{err})
+		case errors.Is(err, utils.ErrImageTooLarge):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, Error{err})
+		case errors.Is(err, syscall.ENOENT) || errors.Is(err, types.ErrImageNotFound):
+			c.AbortWithStatusJSON(http.StatusNotFound, Error{fmt.Errorf("cache key %q not found", cacheKey)})
+		default:
+			logger.Warnf("Unexpected error while cropping cache object with key %q: %v", cacheKey, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, Error{errUnexpected})
+		}
+
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+
+	if _, download := c.GetQuery("download"); download {
+		ext := ".jpg"
+		if contentType == "image/png" {
+			ext = ".png"
+		}
+
+		name := strings.TrimSuffix(path.Base(cacheKey), path.Ext(cacheKey)) + "_crop" + ext
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// parseCropRequest reads the region, the max size and the format of a crop from the given query parameters.
+func parseCropRequest(query url.Values) (types.CropRequest, error) {
+	var req types.CropRequest
+
+	rawWindow, rawBBox := query.Get("window"), query.Get("bbox")
+
+	switch {
+	case rawWindow != "" && rawBBox != "", rawWindow == "" && rawBBox == "":
+		return types.CropRequest{}, errNoCropRegion
+	case rawWindow != "":
+		window, ok := parseList(rawWindow, strconv.Atoi)
+		if !ok || window[2] <= 0 || window[3] <= 0 {
+			return types.CropRequest{}, fmt.Errorf("%w: %q", errInvalidWindow, rawWindow)
+		}
+
+		req.Window.Min.X, req.Window.Min.Y = window[0], window[1]
+		req.Window.Max.X, req.Window.Max.Y = window[0]+window[2], window[1]+window[3]
+	default:
+		bbox, ok := parseList(rawBBox, func(s string) (float64, error) { return strconv.ParseFloat(s, 64) })
+		if !ok || slices.ContainsFunc(bbox[:], func(v float64) bool { return math.IsNaN(v) || math.IsInf(v, 0) }) || bbox[1] > bbox[3] {
+			return types.CropRequest{}, fmt.Errorf("%w: %q", errInvalidBBox, rawBBox)
+		}
+
+		// A min longitude greater than the max one describes a box crossing the antimeridian.
+		if bbox[0] > bbox[2] {
+			bbox[2] += 360
+		}
+
+		req.BBox = &bbox
+	}
+
+	if rawMaxSize := query.Get("maxSize"); rawMaxSize != "" {
+		var err error
+
+		req.MaxSize, err = strconv.Atoi(rawMaxSize)
+		if err != nil || req.MaxSize < 0 {
+			return types.CropRequest{}, fmt.Errorf("%w %q", errInvalidMaxSize, rawMaxSize)
+		}
+	}
+
+	switch format := strings.ToLower(query.Get("format")); format {
+	case "", types.CropFormatPNG, types.CropFormatJPEG:
+		req.Format = format
+	case "jpg":
+		req.Format = types.CropFormatJPEG
+	default:
+		return types.CropRequest{}, fmt.Errorf("%w: %q", errInvalidFormat, format)
+	}
+
+	return req, nil
+}
+
+// parseList parses the four comma-separated values of the given string.
+func parseList[T any](raw string, parse func(string) (T, error)) ([4]T, bool) {
+	var values [4]T
+
+	parts := strings.Split(raw, ",")
+	if len(parts) != len(values) {
+		return values, false
+	}
+
+	for i, part := range parts {
+		var err error
+
+		values[i], err = parse(strings.TrimSpace(part))
+		if err != nil {
+			return values, false
+		}
+	}
+
+	return values, true
+}
+
+// exportHandler streams a zip archive of the cached files of the given images, along with a manifest of each of them.
+func (srv *Server) exportHandler(c *gin.Context) {
+	rawImages := c.QueryArray("image")
+	if len(rawImages) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, Error{errNoImages})
+
+		return
+	}
+
+	images := make([]types.ImageRef, 0, len(rawImages))
+
+	for _, rawImage := range rawImages {
+		bucket, key, found := strings.Cut(rawImage, "/")
+		if !found || bucket == "" || key == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, Error{fmt.Errorf("%w: %q", errInvalidImage, rawImage)})
+
+			return
+		}
+
+		images = append(images, types.ImageRef{Bucket: bucket, Key: key})
+	}
+
+	filename := "export.zip"
+	if len(images) == 1 {
+		filename = utils.FormatDirName(images[0].Key) + ".zip"
+	}
+
+	// The headers are only sent with the first bytes of the archive, after all the images have been found.
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	_, fetchSignedObjects := c.GetQuery("fetchSignedObjects")
+
+	err := srv.cache.ExportImages(c.Request.Context(), images, fetchSignedObjects, c.Writer)
+	if err == nil {
+		return
+	}
+
+	if c.Writer.Written() {
+		logger.Warnf("Export of %q interrupted: %v", rawImages, err)
+
+		return
+	}
+
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Content-Disposition")
+
+	switch {
+	case errors.Is(err, types.ErrImageNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, Error{err})
+	case errors.Is(err, types.ErrExportTooLarge):
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, Error{err})
+	default:
+		logger.Warnf("Unexpected error while exporting %q: %v", rawImages, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, Error{errUnexpected})
+	}
+}
+
+func (srv *Server) slowExpressionsHandler(c *gin.Context) {
+	limit := defaultSlowEvaluationsLimit
+
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		var err error
+
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, Error{fmt.Errorf("%w %q", errInvalidLimit, rawLimit)})
+
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, srv.cache.SlowEvaluations(limit))
+}
@@ -0,0 +1,61 @@
+package web
+
+import (
+	"errors"
+	"image"
+	"net/url"
+	"testing"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCropRequest(t *testing.T) {
+	t.Parallel()
+
+	bbox := func(minLon, minLat, maxLon, maxLat float64) *[4]float64 {
+		return &[4]float64{minLon, minLat, maxLon, maxLat}
+	}
+
+	cases := []struct {
+		query       string
+		expectedReq types.CropRequest
+		expectedErr error
+	}{
+		{query: "window=10,20,300,200", expectedReq: types.CropRequest{Window: image.Rect(10, 20, 310, 220)}},
+		{
+			query:       "window=-10, 20, 300, 200&maxSize=100&format=JPG",
+			expectedReq: types.CropRequest{Window: image.Rect(-10, 20, 290, 220), MaxSize: 100, Format: types.CropFormatJPEG},
+		},
+		{query: "bbox=2.1,48.5,2.5,48.9&format=png", expectedReq: types.CropRequest{BBox: bbox(2.1, 48.5, 2.5, 48.9), Format: types.CropFormatPNG}},
+		{query: "bbox=179.5,-1,-179.5,1", expectedReq: types.CropRequest{BBox: bbox(179.5, -1, 180.5, 1)}},
+		{query: "", expectedErr: errNoCropRegion},
+		{query: "window=0,0,1,1&bbox=0,0,1,1", expectedErr: errNoCropRegion},
+		{query: "window=0,0,1", expectedErr: errInvalidWindow},
+		{query: "window=0,0,0,1", expectedErr: errInvalidWindow},
+		{query: "window=0,0,a,1", expectedErr: errInvalidWindow},
+		{query: "bbox=0,1,1,0", expectedErr: errInvalidBBox},
+		{query: "bbox=0,0,NaN,1", expectedErr: errInvalidBBox},
+		{query: "window=0,0,1,1&maxSize=-1", expectedErr: errInvalidMaxSize},
+		{query: "window=0,0,1,1&format=gif", expectedErr: errInvalidFormat},
+	}
+
+	for _, tc := range cases {
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := parseCropRequest(query)
+		if !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%q: expected error %v, got %v", tc.query, tc.expectedErr, err)
+
+			continue
+		}
+
+		if diff := cmp.Diff(tc.expectedReq, req); diff != "" {
+			t.Errorf("%q: unexpected request (-want +got):\n%s", tc.query, diff)
+		}
+	}
+}
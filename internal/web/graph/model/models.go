@@ -6,7 +6,16 @@ type FileSelector struct {
 	Link  bool   `json:"link"`
 }
 
+type DynamicFilter struct {
+	Name       string   `json:"name"`
+	Expression string   `json:"expression"`
+	Type       string   `json:"type"`
+	UIHint     string   `json:"uiHint"`
+	Values     []string `json:"values"`
+}
+
 type DynamicData struct {
-	FileSelectors map[string]FileSelector `json:"fileSelectors"`
-	Expressions   map[string]string       `json:"expressions"`
+	FileSelectors  map[string]FileSelector `json:"fileSelectors"`
+	Expressions    map[string]string       `json:"expressions"`
+	DynamicFilters []DynamicFilter         `json:"dynamicFilters"`
 }
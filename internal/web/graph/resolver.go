@@ -1,6 +1,8 @@
 package graph
 
 import (
+	"sync"
+
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
 )
@@ -12,6 +14,22 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	Config config.Config
-	Cache  types.Cache
+	cfgLock sync.RWMutex
+	Config  config.Config
+	Cache   types.Cache
+}
+
+// SetConfig replaces the configuration used by the resolvers.
+func (r *Resolver) SetConfig(cfg config.Config) {
+	r.cfgLock.Lock()
+	defer r.cfgLock.Unlock()
+
+	r.Config = cfg
+}
+
+func (r *Resolver) config() config.Config {
+	r.cfgLock.RLock()
+	defer r.cfgLock.RUnlock()
+
+	return r.Config
 }
@@ -51,3 +51,16 @@ func MarshalLocalizationCorner(obj types.LocalizationCorner) graphql.Marshaler {
 func UnmarshalLocalizationCorner(_ any) (types.LocalizationCorner, error) {
 	return types.LocalizationCorner{}, errUnsupportedGraphQLOperation
 }
+
+func MarshalGeometry(obj types.Geometry) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		err := json.NewEncoder(w).Encode(obj)
+		if err != nil {
+			logger.Error("[graphql] Failed to marshal Geometry: ", err)
+		}
+	})
+}
+
+func UnmarshalGeometry(_ any) (types.Geometry, error) {
+	return types.Geometry{}, errUnsupportedGraphQLOperation
+}
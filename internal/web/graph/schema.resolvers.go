@@ -40,11 +40,6 @@ func (r *imageResolver) ExternalViewerURLs(ctx context.Context, obj *types.Image
 	return toMapStringAny(obj.ExternalViewerURLs), nil
 }
 
-// DynamicFilters is the resolver for the dynamicFilters field.
-func (r *imageSummaryResolver) DynamicFilters(ctx context.Context, obj *types.ImageSummary) (map[string]any, error) {
-	return toMapStringAny(obj.DynamicFilters), nil
-}
-
 // GetAllImageSummaries is the resolver for the getAllImageSummaries field.
 func (r *queryResolver) GetAllImageSummaries(ctx context.Context, from *time.Time, to *time.Time) (types.AllImageSummaries, error) {
 	start := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
@@ -81,11 +76,11 @@ func (r *queryResolver) GetImage(ctx context.Context, bucket string, name string
 
 // GetDynamicData is the resolver for the getDynamicData field.
 func (r *queryResolver) GetDynamicData(ctx context.Context, group string, typeArg string) (*model.DynamicData, error) {
-	for _, grp := range r.Config.Products.ImageGroups {
+	for _, grp := range r.config().Products.ImageGroups {
 		if grp.GroupName == group {
 			for _, typ := range grp.Types {
 				if typ.Name == typeArg {
-					return convertDynamicData(typ.DynamicData)
+					return convertDynamicData(typ.DynamicData, typ.DynamicFilters)
 				}
 			}
 
@@ -96,21 +91,101 @@ func (r *queryResolver) GetDynamicData(ctx context.Context, group string, typeAr
 	return nil, fmt.Errorf("image group %q %w", group, errNotFound)
 }
 
+// DebugImage is the resolver for the debugImage field.
+func (r *queryResolver) DebugImage(ctx context.Context, bucket string, name string) (*types.ImageDebug, error) {
+	imgDebug, err := r.Cache.DebugImage(ctx, bucket, name)
+	if err != nil {
+		if errors.Is(err, types.ErrImageNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &imgDebug, nil
+}
+
+// DynamicFilterDomains is the resolver for the dynamicFilterDomains field.
+func (r *queryResolver) DynamicFilterDomains(ctx context.Context, group *string, typeArg *string) ([]*types.DynamicFilterDomain, error) {
+	var imgGroup, imgType string
+
+	if group != nil {
+		imgGroup = *group
+	}
+
+	if typeArg != nil {
+		imgType = *typeArg
+	}
+
+	domains := r.Cache.DynamicFilterDomains(ctx, imgGroup, imgType)
+	result := make([]*types.DynamicFilterDomain, len(domains))
+
+	for i := range domains {
+		result[i] = &domains[i]
+	}
+
+	return result, nil
+}
+
+// Search is the resolver for the search field.
+func (r *queryResolver) Search(ctx context.Context, query string, limit *int) ([]*types.SearchResult, error) {
+	var maxResults int
+
+	if limit != nil {
+		maxResults = *limit
+	}
+
+	results := r.Cache.Search(query, maxResults)
+	result := make([]*types.SearchResult, len(results))
+
+	for i := range results {
+		result[i] = &results[i]
+	}
+
+	return result, nil
+}
+
+// FootprintClusters is the resolver for the footprintClusters field.
+func (r *queryResolver) FootprintClusters(ctx context.Context, bbox []float64, zoom int, group *string, typeArg *string) ([]*types.FootprintCluster, error) {
+	if !validBBox(bbox) {
+		return nil, errInvalidBBox
+	}
+
+	if zoom < 0 || zoom > maxZoom {
+		return nil, fmt.Errorf("%w: %d", errInvalidZoom, zoom)
+	}
+
+	var imgGroup, imgType string
+
+	if group != nil {
+		imgGroup = *group
+	}
+
+	if typeArg != nil {
+		imgType = *typeArg
+	}
+
+	clusters := r.Cache.FootprintClusters([4]float64(bbox), zoom, imgGroup, imgType)
+	result := make([]*types.FootprintCluster, len(clusters))
+
+	for i := range clusters {
+		result[i] = &clusters[i]
+	}
+
+	return result, nil
+}
+
 // DynamicData returns DynamicDataResolver implementation.
 func (r *Resolver) DynamicData() DynamicDataResolver { return &dynamicDataResolver{r} }
 
 // Image returns ImageResolver implementation.
 func (r *Resolver) Image() ImageResolver { return &imageResolver{r} }
 
-// ImageSummary returns ImageSummaryResolver implementation.
-func (r *Resolver) ImageSummary() ImageSummaryResolver { return &imageSummaryResolver{r} }
-
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
 type (
-	dynamicDataResolver  struct{ *Resolver }
-	imageResolver        struct{ *Resolver }
-	imageSummaryResolver struct{ *Resolver }
-	queryResolver        struct{ *Resolver }
+	dynamicDataResolver struct{ *Resolver }
+	imageResolver       struct{ *Resolver }
+	queryResolver       struct{ *Resolver }
 )
@@ -3,6 +3,7 @@ package graph
 import (
 	"errors"
 	"fmt"
+	"math"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/web/graph/model"
@@ -10,9 +11,35 @@ import (
 
 var (
 	errInvalidTimeRange = errors.New("invalid time range")
+	errInvalidBBox      = errors.New("invalid bounding box, expected [min lon, min lat, max lon, max lat]")
+	errInvalidZoom      = errors.New("invalid zoom level")
 	errNotFound         = errors.New("not found")
 )
 
+// maxZoom is the highest zoom level of the maps.
+const maxZoom = 24
+
+// validBBox reports whether the given bounding box holds finite coordinates in range, its min latitude not greater
+// than its max one. Its min longitude is greater than its max one when it crosses the antimeridian.
+func validBBox(bbox []float64) bool {
+	if len(bbox) != 4 {
+		return false
+	}
+
+	for i, v := range bbox {
+		limit := 180.
+		if i%2 == 1 {
+			limit = 90
+		}
+
+		if math.IsNaN(v) || math.Abs(v) > limit {
+			return false
+		}
+	}
+
+	return bbox[1] <= bbox[3]
+}
+
 func toMapStringAny[V any](m map[string]V) map[string]any {
 	result := make(map[string]any, len(m))
 
@@ -23,7 +50,7 @@ func toMapStringAny[V any](m map[string]V) map[string]any {
 	return result
 }
 
-func convertDynamicData(dynData config.DynamicData) (*model.DynamicData, error) {
+func convertDynamicData(dynData config.DynamicData, dynFilters []config.DynamicFilter) (*model.DynamicData, error) {
 	fileSelectors := make(map[string]model.FileSelector, len(dynData.FileSelectors))
 	expressions := make(map[string]string, len(dynData.ExpressionsPrograms))
 
@@ -48,8 +75,21 @@ func convertDynamicData(dynData config.DynamicData) (*model.DynamicData, error)
 		expressions[name] = prgm.Node().String()
 	}
 
+	filters := make([]model.DynamicFilter, len(dynFilters))
+
+	for i, filter := range dynFilters {
+		filters[i] = model.DynamicFilter{
+			Name:       filter.Name,
+			Expression: filter.Expression,
+			Type:       filter.Type,
+			UIHint:     filter.UIHint,
+			Values:     append(make([]string, 0, len(filter.Values)), filter.Values...),
+		}
+	}
+
 	return &model.DynamicData{
-		FileSelectors: fileSelectors,
-		Expressions:   expressions,
+		FileSelectors:  fileSelectors,
+		Expressions:    expressions,
+		DynamicFilters: filters,
 	}, nil
 }
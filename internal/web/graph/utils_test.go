@@ -0,0 +1,31 @@
+package graph
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValidBBox(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		bbox     []float64
+		expected bool
+	}{
+		{bbox: []float64{-10, 40, 10, 50}, expected: true},
+		{bbox: []float64{170, -20, -170, -10}, expected: true},
+		{bbox: []float64{-180, -90, 180, 90}, expected: true},
+		{bbox: []float64{-180, -1e9, 180, 1e9}, expected: false},
+		{bbox: []float64{-181, 0, 0, 1}, expected: false},
+		{bbox: []float64{0, math.NaN(), 1, 1}, expected: false},
+		{bbox: []float64{math.Inf(-1), 0, 1, 1}, expected: false},
+		{bbox: []float64{0, 1, 1, 0}, expected: false},
+		{bbox: []float64{0, 0, 1}, expected: false},
+	}
+
+	for _, tc := range cases {
+		if valid := validBBox(tc.bbox); valid != tc.expected {
+			t.Errorf("validBBox(%v): want %t, got %t", tc.bbox, tc.expected, valid)
+		}
+	}
+}
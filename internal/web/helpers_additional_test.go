@@ -42,6 +42,10 @@ func TestDetectContentType(t *testing.T) {
 		t.Fatalf("unexpected content type for json extension: %q", got)
 	}
 
+	if got := detectContentType("preview.jpg.dzi", []byte("<?xml")); got != "application/xml" {
+		t.Fatalf("unexpected content type for dzi extension: %q", got)
+	}
+
 	pngHeader := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
 	if got := detectContentType("file.bin", pngHeader); got != "image/png" {
 		t.Fatalf("unexpected content type from sniffing: %q", got)
@@ -57,6 +61,8 @@ func TestProcessRouteForPrometheus(t *testing.T) {
 	}{
 		{uri: "/api/cache/abc/def", expected: "/api/cache"},
 		{uri: "/api/cache/", expected: "/api/cache"},
+		{uri: "/api/deepzoom/bkt/img/preview.jpg_files/12/3_4.jpg", expected: "/api/deepzoom"},
+		{uri: "/api/crop/bkt/img/preview.png", expected: "/api/crop"},
 		{uri: "/api/info", expected: "/api/info"},
 	}
 
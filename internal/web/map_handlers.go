@@ -0,0 +1,415 @@
+package web
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite" // registers the sqlite driver used to read the MBTiles files
+)
+
+// Kinds of map tiles, telling the frontend how to load them.
+const (
+	mapTilesPMTiles = "pmtiles"
+	mapTilesVector  = "vector"
+	mapTilesRaster  = "raster"
+)
+
+// Routes of the local map data, relative to the base URL.
+const (
+	mapPMTilesRoute = "/map/tiles.pmtiles"
+	mapTilesRoute   = "/map/tiles"
+	mapStyleRoute   = "/map/style"
+	mapStyleFile    = "style.json"
+	// mapStyleBaseURLPlaceholder is replaced by the base URL in the URLs of the local style.
+	mapStyleBaseURLPlaceholder = "{baseURL}"
+)
+
+// mbtilesFormatVector is the format of the MBTiles files holding Mapbox vector tiles.
+const mbtilesFormatVector = "pbf"
+
+var (
+	errNoMapData    = errors.New("no local map data is configured")
+	errInvalidTile  = errors.New("invalid tile coordinates")
+	errTileNotFound = errors.New("tile not found")
+)
+
+var gzipMagic = []byte{0x1f, 0x8b} //nolint: gochecknoglobals
+
+// mbtilesContentTypes maps the formats of the MBTiles files to the content type of their tiles.
+var mbtilesContentTypes = map[string]string{ //nolint: gochecknoglobals
+	mbtilesFormatVector: "application/x-protobuf",
+	"png":               "image/png",
+	"jpg":               "image/jpeg",
+	"webp":              "image/webp",
+}
+
+// mapSources are the local map data served by the web server.
+type mapSources struct {
+	pmtilesFile string
+	mbtiles     *sql.DB
+	// mbtilesFormat is the format of the tiles of the MBTiles file, pbf for vector tiles.
+	mbtilesFormat string
+	styleDir      string
+	// users counts the requests reading the MBTiles file, which must be done before it is closed.
+	users sync.WaitGroup
+}
+
+// openMapSources opens the local map data of the given configuration.
+func openMapSources(cfg config.UIMap) (*mapSources, error) {
+	sources := &mapSources{styleDir: cfg.StyleDir}
+
+	if cfg.PMTilesFile != "" {
+		if _, err := os.Stat(cfg.PMTilesFile); err != nil {
+			return nil, fmt.Errorf("can't use PMTiles file: %w", err)
+		}
+
+		sources.pmtilesFile = cfg.PMTilesFile
+	}
+
+	if cfg.StyleDir != "" {
+		if _, err := os.Stat(filepath.Join(cfg.StyleDir, mapStyleFile)); err != nil {
+			return nil, fmt.Errorf("can't use map style dir: %w", err)
+		}
+	}
+
+	if cfg.MBTilesFile != "" {
+		db, format, err := openMBTiles(cfg.MBTilesFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't open MBTiles file: %w", err)
+		}
+
+		sources.mbtiles, sources.mbtilesFormat = db, format
+	}
+
+	return sources, nil
+}
+
+// openMBTiles opens the given MBTiles file in read-only mode, and returns the format of its tiles.
+func openMBTiles(filePath string) (*sql.DB, string, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, "", err //nolint: wrapcheck // wrapped by caller
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, "", err //nolint: wrapcheck // wrapped by caller
+	}
+
+	db, err := sql.Open("sqlite", (&url.URL{Scheme: "file", Path: absPath, RawQuery: "mode=ro"}).String())
+	if err != nil {
+		return nil, "", err //nolint: wrapcheck // wrapped by caller
+	}
+
+	var format string
+
+	err = db.QueryRow(`SELECT value FROM metadata WHERE name = 'format'`).Scan(&format)
+	if err != nil {
+		_ = db.Close()
+
+		return nil, "", fmt.Errorf("reading format: %w", err)
+	}
+
+	if _, found := mbtilesContentTypes[format]; !found {
+		_ = db.Close()
+
+		return nil, "", fmt.Errorf("unsupported tile format %q", format)
+	}
+
+	return db, format, nil
+}
+
+func (sources *mapSources) close() {
+	if sources != nil && sources.mbtiles != nil {
+		if err := sources.mbtiles.Close(); err != nil {
+			logger.Warnf("Failed to close MBTiles file: %v", err)
+		}
+	}
+}
+
+// closeWhenUnused closes the sources once the requests using them are done.
+// The sources must no longer be acquirable, i.e. have been replaced in the server.
+func (sources *mapSources) closeWhenUnused() {
+	if sources == nil {
+		return
+	}
+
+	sources.users.Wait()
+	sources.close()
+}
+
+// tilesURL returns the URL of the local map tiles and how to load them, or empty strings if none are served.
+func (sources *mapSources) tilesURL(baseURL string) (tilesURL, kind string, err error) {
+	switch {
+	case sources.pmtilesFile != "":
+		tilesURL, err = url.JoinPath(baseURL, mapPMTilesRoute)
+
+		return tilesURL, mapTilesPMTiles, err //nolint: wrapcheck // wrapped by caller
+	case sources.mbtiles != nil:
+		tilesURL, err = url.JoinPath(baseURL, mapTilesRoute)
+		if err != nil {
+			return "", "", err //nolint: wrapcheck // wrapped by caller
+		}
+
+		kind = mapTilesRaster
+		if sources.mbtilesFormat == mbtilesFormatVector {
+			kind = mapTilesVector
+		}
+
+		return tilesURL + "/{z}/{x}/{y}", kind, nil
+	default:
+		return "", "", nil
+	}
+}
+
+// styleURL returns the URL of the local map style, or an empty string if none is served.
+func (sources *mapSources) styleURL(baseURL string) (string, error) {
+	if sources.styleDir == "" {
+		return "", nil
+	}
+
+	return url.JoinPath(baseURL, mapStyleRoute, mapStyleFile) //nolint: wrapcheck // wrapped by caller
+}
+
+// tile returns the data of the given XYZ tile of the MBTiles file, which numbers its rows from the south.
+func (sources *mapSources) tile(z, x, y int) ([]byte, error) {
+	if z < 0 || z > 30 || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		return nil, errInvalidTile
+	}
+
+	var data []byte
+
+	err := sources.mbtiles.QueryRow(
+		`SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`,
+		z, x, (1<<z)-1-y,
+	).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errTileNotFound
+	}
+
+	return data, err //nolint: wrapcheck // wrapped by caller
+}
+
+func (srv *Server) currentMapSources() *mapSources {
+	srv.infoLock.RLock()
+	defer srv.infoLock.RUnlock()
+
+	return srv.mapSources
+}
+
+// acquireMapSources returns the current map sources, which must be released once done with them,
+// so that a reload doesn't close them while in use.
+func (srv *Server) acquireMapSources() *mapSources {
+	srv.infoLock.RLock()
+	defer srv.infoLock.RUnlock()
+
+	if srv.mapSources != nil {
+		srv.mapSources.users.Add(1)
+	}
+
+	return srv.mapSources
+}
+
+// pmtilesHandler serves the local PMTiles file, supporting the range requests the PMTiles readers rely on.
+func (srv *Server) pmtilesHandler(c *gin.Context) {
+	sources := srv.currentMapSources()
+	if sources == nil || sources.pmtilesFile == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, Error{errNoMapData})
+
+		return
+	}
+
+	f, err := os.Open(sources.pmtilesFile)
+	if err != nil {
+		logger.Warnf("Failed to open PMTiles file: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, Error{errUnexpected})
+
+		return
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		logger.Warnf("Failed to stat PMTiles file: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, Error{errUnexpected})
+
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+}
+
+// mbtilesHandler serves the tiles of the local MBTiles file as an XYZ endpoint.
+// Missing tiles, frequent over the oceans, give an empty response.
+func (srv *Server) mbtilesHandler(c *gin.Context) {
+	sources := srv.acquireMapSources()
+	if sources == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, Error{errNoMapData})
+
+		return
+	}
+
+	defer sources.users.Done()
+
+	if sources.mbtiles == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, Error{errNoMapData})
+
+		return
+	}
+
+	var coordinates [3]int
+
+	for i, param := range []string{"z", "x", "y"} {
+		value, err := strconv.Atoi(c.Param(param))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, Error{fmt.Errorf("%w: %s", errInvalidTile, param)})
+
+			return
+		}
+
+		coordinates[i] = value
+	}
+
+	data, err := sources.tile(coordinates[0], coordinates[1], coordinates[2])
+
+	switch {
+	case errors.Is(err, errInvalidTile):
+		c.AbortWithStatusJSON(http.StatusBadRequest, Error{err})
+	case errors.Is(err, errTileNotFound):
+		c.Status(http.StatusNoContent)
+	case err != nil:
+		logger.Warnf("Failed to read tile %v from MBTiles file: %v", coordinates, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, Error{errUnexpected})
+	default:
+		// The vector tiles are usually stored compressed.
+		if bytes.HasPrefix(data, gzipMagic) {
+			c.Header("Content-Encoding", "gzip")
+		}
+
+		c.Data(http.StatusOK, mbtilesContentTypes[sources.mbtilesFormat], data)
+	}
+}
+
+// mapStyleHandler serves the files of the local style dir: the style, and the glyphs and sprites it refers to.
+// The URLs of the style are rewritten to point to the server.
+func (srv *Server) mapStyleHandler(c *gin.Context) {
+	sources := srv.currentMapSources()
+	if sources == nil || sources.styleDir == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, Error{errNoMapData})
+
+		return
+	}
+
+	filePath := c.Param("file_path")
+	if strings.TrimPrefix(filePath, "/") != mapStyleFile {
+		c.FileFromFS(filePath, http.Dir(sources.styleDir))
+
+		return
+	}
+
+	style, err := readMapStyle(filepath.Join(sources.styleDir, mapStyleFile), srv.uiCfg.BaseURL)
+	if err != nil {
+		logger.Warnf("Failed to read map style: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, Error{errUnexpected})
+
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", style)
+}
+
+// readMapStyle reads the given style, and rewrites the URLs of its sources, glyphs and sprites
+// to point to the server, as they are resolved against the page and not against the style.
+func readMapStyle(stylePath, baseURL string) ([]byte, error) {
+	data, err := os.ReadFile(stylePath)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	var style map[string]any
+
+	err = json.Unmarshal(data, &style)
+	if err != nil {
+		return nil, fmt.Errorf("decoding style: %w", err)
+	}
+
+	styleURL, err := url.JoinPath(baseURL, mapStyleRoute)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	rewrite := func(rawURL string) string {
+		return resolveMapStyleURL(rawURL, baseURL, styleURL)
+	}
+
+	if sources, ok := style["sources"].(map[string]any); ok {
+		for _, source := range sources {
+			source, ok := source.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			rewriteMapStyleURLs(source, "url", rewrite)
+			rewriteMapStyleURLs(source, "tiles", rewrite)
+		}
+	}
+
+	rewriteMapStyleURLs(style, "glyphs", rewrite)
+
+	// The sprite is either a URL, or a list of sprites with an id and a URL.
+	if sprites, ok := style["sprite"].([]any); ok {
+		for _, sprite := range sprites {
+			if sprite, ok := sprite.(map[string]any); ok {
+				rewriteMapStyleURLs(sprite, "url", rewrite)
+			}
+		}
+	} else {
+		rewriteMapStyleURLs(style, "sprite", rewrite)
+	}
+
+	return json.Marshal(style) //nolint: wrapcheck // wrapped by caller
+}
+
+// rewriteMapStyleURLs rewrites the URL, or the list of URLs, of the given key of the given object.
+func rewriteMapStyleURLs(object map[string]any, key string, rewrite func(string) string) {
+	switch value := object[key].(type) {
+	case string:
+		object[key] = rewrite(value)
+	case []any:
+		for i, item := range value {
+			if rawURL, ok := item.(string); ok {
+				value[i] = rewrite(rawURL)
+			}
+		}
+	}
+}
+
+// resolveMapStyleURL replaces the base URL placeholder of the given URL of the style,
+// and resolves it against the given style dir URL if it is relative.
+func resolveMapStyleURL(rawURL, baseURL, styleDirURL string) string {
+	if strings.Contains(rawURL, mapStyleBaseURLPlaceholder) {
+		return strings.ReplaceAll(rawURL, mapStyleBaseURLPlaceholder, strings.TrimSuffix(baseURL, "/"))
+	}
+
+	// The URLs hold template parameters like {z} or {fontstack}, so they aren't parsed.
+	if rawURL == "" || strings.HasPrefix(rawURL, "/") || strings.Contains(rawURL, "://") {
+		return rawURL
+	}
+
+	return strings.TrimSuffix(styleDirURL, "/") + "/" + strings.TrimPrefix(rawURL, "./")
+}
@@ -0,0 +1,321 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeMBTiles(t *testing.T, filePath, format string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for _, query := range []string{
+		`CREATE TABLE metadata (name TEXT, value TEXT)`,
+		`CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)`,
+		`INSERT INTO metadata VALUES ('format', '` + format + `')`,
+		// Tile x=1, y=0 of zoom 1, whose rows are numbered from the south.
+		`INSERT INTO tiles VALUES (1, 1, 1, X'1F8B0800')`,
+	} {
+		if _, err = db.Exec(query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+}
+
+func newMapTestServer(t *testing.T, cfg config.UIMap) (*Server, *gin.Engine) {
+	t.Helper()
+
+	sources, err := openMapSources(cfg)
+	if err != nil {
+		t.Fatal("Failed to open map sources:", err)
+	}
+
+	t.Cleanup(sources.close)
+
+	srv := &Server{mapSources: sources}
+
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET(mapPMTilesRoute, srv.pmtilesHandler)
+	router.GET(mapTilesRoute+"/:z/:x/:y", srv.mbtilesHandler)
+	router.GET(mapStyleRoute+"/*file_path", srv.mapStyleHandler)
+
+	return srv, router
+}
+
+func serve(router *gin.Engine, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestMapHandlers(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	mbtilesPath := filepath.Join(dir, "map.mbtiles")
+	pmtilesPath := filepath.Join(dir, "map.pmtiles")
+	styleDir := filepath.Join(dir, "style")
+
+	writeMBTiles(t, mbtilesPath, "pbf")
+
+	if err := os.WriteFile(pmtilesPath, []byte("PMTiles-0123456789"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(styleDir, "sprites"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{"style.json": `{"version": 8}`, "sprites/sprite.json": `{}`} {
+		if err := os.WriteFile(filepath.Join(styleDir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, mbtilesRouter := newMapTestServer(t, config.UIMap{MBTilesFile: mbtilesPath, StyleDir: styleDir})
+	_, pmtilesRouter := newMapTestServer(t, config.UIMap{PMTilesFile: pmtilesPath})
+
+	cases := []struct {
+		name             string
+		router           *gin.Engine
+		path             string
+		header           http.Header
+		expectedStatus   int
+		expectedBody     string
+		expectedEncoding string
+	}{
+		{
+			name:             "vector tile",
+			router:           mbtilesRouter,
+			path:             "/map/tiles/1/1/0",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "\x1f\x8b\x08\x00",
+			expectedEncoding: "gzip",
+		},
+		{name: "missing tile", router: mbtilesRouter, path: "/map/tiles/1/0/0", expectedStatus: http.StatusNoContent},
+		{name: "tile out of bounds", router: mbtilesRouter, path: "/map/tiles/1/2/0", expectedStatus: http.StatusBadRequest},
+		{name: "invalid tile", router: mbtilesRouter, path: "/map/tiles/1/a/0", expectedStatus: http.StatusBadRequest},
+		{name: "style", router: mbtilesRouter, path: "/map/style/style.json", expectedStatus: http.StatusOK, expectedBody: `{"version":8}`},
+		{name: "sprite", router: mbtilesRouter, path: "/map/style/sprites/sprite.json", expectedStatus: http.StatusOK, expectedBody: `{}`},
+		{name: "no PMTiles file", router: mbtilesRouter, path: "/map/tiles.pmtiles", expectedStatus: http.StatusNotFound},
+		{
+			name:           "PMTiles range",
+			router:         pmtilesRouter,
+			path:           "/map/tiles.pmtiles",
+			header:         http.Header{"Range": []string{"bytes=0-6"}},
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   "PMTiles",
+		},
+		{name: "no MBTiles file", router: pmtilesRouter, path: "/map/tiles/1/1/0", expectedStatus: http.StatusNotFound},
+		{name: "no style dir", router: pmtilesRouter, path: "/map/style/style.json", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := serve(tc.router, tc.path, tc.header)
+			if recorder.Code != tc.expectedStatus {
+				t.Fatalf("Unexpected status: want %d, got %d (%s)", tc.expectedStatus, recorder.Code, recorder.Body)
+			}
+
+			if tc.expectedBody != "" && recorder.Body.String() != tc.expectedBody {
+				t.Fatalf("Unexpected body: want %q, got %q", tc.expectedBody, recorder.Body)
+			}
+
+			if encoding := recorder.Header().Get("Content-Encoding"); encoding != tc.expectedEncoding {
+				t.Fatalf("Unexpected encoding: want %q, got %q", tc.expectedEncoding, encoding)
+			}
+		})
+	}
+}
+
+func TestReadMapStyle(t *testing.T) {
+	t.Parallel()
+
+	stylePath := filepath.Join(t.TempDir(), mapStyleFile)
+	style := `{
+		"version": 8,
+		"glyphs": "fonts/{fontstack}/{range}.pbf",
+		"sprite": [{"id": "default", "url": "./sprites/sprite"}, {"id": "remote", "url": "https://example.com/sprite"}],
+		"sources": {
+			"local": {"type": "vector", "tiles": ["{baseURL}/map/tiles/{z}/{x}/{y}"]},
+			"archive": {"type": "vector", "url": "pmtiles://{baseURL}/map/tiles.pmtiles"},
+			"absolute": {"type": "raster", "tiles": ["/tiles/{z}/{x}/{y}.png"]}
+		},
+		"layers": [{"id": "background", "type": "background"}]
+	}`
+
+	if err := os.WriteFile(stylePath, []byte(style), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := readMapStyle(stylePath, "/s3/")
+	if err != nil {
+		t.Fatal("Failed to read the style:", err)
+	}
+
+	var got map[string]any
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatal("Invalid style:", err)
+	}
+
+	expected := map[string]any{
+		"version": 8.,
+		"glyphs":  "/s3/map/style/fonts/{fontstack}/{range}.pbf",
+		"sprite": []any{
+			map[string]any{"id": "default", "url": "/s3/map/style/sprites/sprite"},
+			map[string]any{"id": "remote", "url": "https://example.com/sprite"},
+		},
+		"sources": map[string]any{
+			"local":    map[string]any{"type": "vector", "tiles": []any{"/s3/map/tiles/{z}/{x}/{y}"}},
+			"archive":  map[string]any{"type": "vector", "url": "pmtiles:///s3/map/tiles.pmtiles"},
+			"absolute": map[string]any{"type": "raster", "tiles": []any{"/tiles/{z}/{x}/{y}.png"}},
+		},
+		"layers": []any{map[string]any{"id": "background", "type": "background"}},
+	}
+
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Unexpected style (-want +got):\n%s", diff)
+	}
+}
+
+func TestMakeStaticInfoMapURLs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	rasterPath := filepath.Join(dir, "raster.mbtiles")
+
+	writeMBTiles(t, rasterPath, "png")
+
+	remote := config.UIMap{PMTilesURL: "https://example.com/map.pmtiles", PMTilesStyleURL: "https://example.com/style.json"}
+
+	cases := []struct {
+		name          string
+		mapCfg        config.UIMap
+		expectedURL   string
+		expectedStyle string
+		expectedType  string
+	}{
+		{
+			name:          "remote",
+			mapCfg:        remote,
+			expectedURL:   "https://example.com/map.pmtiles",
+			expectedStyle: "https://example.com/style.json",
+			expectedType:  mapTilesPMTiles,
+		},
+		{
+			name:          "local raster tiles",
+			mapCfg:        config.UIMap{PMTilesURL: remote.PMTilesURL, PMTilesStyleURL: remote.PMTilesStyleURL, MBTilesFile: rasterPath},
+			expectedURL:   "/viewer/map/tiles/{z}/{x}/{y}",
+			expectedStyle: "https://example.com/style.json",
+			expectedType:  mapTilesRaster,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sources, err := openMapSources(tc.mapCfg)
+			if err != nil {
+				t.Fatal("Failed to open map sources:", err)
+			}
+
+			defer sources.close()
+
+			staticInfo, err := makeStaticInfo(config.Config{UI: config.UI{BaseURL: "/viewer", Map: tc.mapCfg}}, "v1", sources)
+			if err != nil {
+				t.Fatal("Failed to make static info:", err)
+			}
+
+			if staticInfo.PMTilesURL != tc.expectedURL || staticInfo.PMTilesStyleURL != tc.expectedStyle || staticInfo.MapTilesType != tc.expectedType {
+				t.Fatalf("Unexpected map info %q, %q, %q", staticInfo.PMTilesURL, staticInfo.PMTilesStyleURL, staticInfo.MapTilesType)
+			}
+		})
+	}
+
+	if _, err := openMapSources(config.UIMap{MBTilesFile: filepath.Join(dir, "missing.mbtiles")}); err == nil {
+		t.Fatal("Expected an error for a missing MBTiles file")
+	}
+}
+
+func TestMapSourcesCloseWhenUnused(t *testing.T) {
+	t.Parallel()
+
+	mbtilesPath := filepath.Join(t.TempDir(), "map.mbtiles")
+	writeMBTiles(t, mbtilesPath, "png")
+
+	srv, _ := newMapTestServer(t, config.UIMap{MBTilesFile: mbtilesPath})
+
+	sources := srv.acquireMapSources()
+
+	// As done by a reload, which doesn't close the sources still in use.
+	srv.mapSources = &mapSources{}
+	closed := make(chan struct{})
+
+	go func() {
+		sources.closeWhenUnused()
+		close(closed)
+	}()
+
+	if _, err := sources.tile(1, 1, 0); err != nil {
+		t.Fatal("Expected the tile to be read from the replaced sources, got:", err)
+	}
+
+	sources.users.Done()
+	<-closed
+
+	if _, err := sources.tile(1, 1, 0); err == nil {
+		t.Fatal("Expected the MBTiles file to be closed once released")
+	}
+}
+
+func TestPrepareReload(t *testing.T) {
+	t.Parallel()
+
+	mbtilesPath := filepath.Join(t.TempDir(), "map.mbtiles")
+	writeMBTiles(t, mbtilesPath, "png")
+
+	srv, router := newMapTestServer(t, config.UIMap{MBTilesFile: mbtilesPath})
+
+	_, err := srv.PrepareReload(config.Config{UI: config.UI{Map: config.UIMap{StyleDir: t.TempDir()}}})
+	if err == nil {
+		t.Fatal("Expected an error for a style dir without style")
+	}
+
+	reload, err := srv.PrepareReload(config.Config{UI: config.UI{Map: config.UIMap{MBTilesFile: mbtilesPath}}})
+	if err != nil {
+		t.Fatal("Failed to prepare the reload:", err)
+	}
+
+	reload.Discard()
+
+	if recorder := serve(router, "/map/tiles/1/1/0", nil); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected the current MBTiles file to be kept, got status %d", recorder.Code)
+	}
+}
@@ -15,6 +15,7 @@ type endpoint string
 const (
 	endpointFront = "front"
 	endpointAPI   = "api"
+	endpointMap   = "map"
 )
 
 func metricsMiddleware(gatherer *observability.Metrics, endpoint endpoint) gin.HandlerFunc {
@@ -40,6 +41,14 @@ func processRouteForPrometheus(uri string) string {
 	switch {
 	case strings.HasPrefix(uri, "/api/cache/"):
 		return "/api/cache"
+	case strings.HasPrefix(uri, "/api/deepzoom/"):
+		return "/api/deepzoom"
+	case strings.HasPrefix(uri, "/api/crop/"):
+		return "/api/crop"
+	case strings.HasPrefix(uri, mapTilesRoute+"/"):
+		return mapTilesRoute
+	case strings.HasPrefix(uri, mapStyleRoute+"/"):
+		return mapStyleRoute
 	default:
 		return uri
 	}
@@ -43,6 +43,10 @@ func (srv *Server) defineRoutes(prod bool) error {
 	api := r.Group("/api").Use(metricsMiddleware(srv.gatherer, endpointAPI))
 	api.GET("/info", srv.infoHandler)
 	api.GET("/cache/*cache_key", srv.cacheHandler)
+	api.GET("/deepzoom/*path", srv.deepZoomHandler)
+	api.GET("/crop/*cache_key", srv.cropHandler)
+	api.GET("/export", srv.exportHandler)
+	api.GET("/slow-expressions", srv.slowExpressionsHandler)
 	api.GET("/ws", srv.wsHub.serveWs)
 	api.POST("/graphql", gin.WrapH(srv.graphqlHandler))
 
@@ -59,6 +63,13 @@ func (srv *Server) defineRoutes(prod bool) error {
 		api.GET("/playground", playgroundHandler)
 	}
 
+	// Local map data
+	mapData := r.Group("").Use(metricsMiddleware(srv.gatherer, endpointMap))
+	mapData.GET(mapPMTilesRoute, srv.pmtilesHandler)
+	mapData.HEAD(mapPMTilesRoute, srv.pmtilesHandler)
+	mapData.GET(mapTilesRoute+"/:z/:x/:y", srv.mbtilesHandler)
+	mapData.GET(mapStyleRoute+"/*file_path", srv.mapStyleHandler)
+
 	promHandler := promhttp.Handler()
 	r.GET("/metrics", gin.WrapH(promHandler))
 
@@ -8,6 +8,8 @@ import (
 	"io/fs"
 	"net"
 	"net/http"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/config"
@@ -33,7 +35,11 @@ type Server struct {
 	subFrontendFS  fs.FS
 	assetsFS       fs.FS
 	graphqlHandler *handler.Server
+	graphResolver  *graph.Resolver
+	version        string
+	infoLock       sync.RWMutex
 	staticInfo     StaticInfo
+	mapSources     *mapSources
 	router         *gin.Engine
 	wsHub          *wsHub
 }
@@ -61,22 +67,16 @@ func NewServer(cfg config.Config, cache types.Cache, frontendFS embed.FS, gather
 		Cache:  cache,
 	}
 
-	staticInfo := StaticInfo{
-		SoftwareVersion:        version,
-		WindowTitle:            cfg.UI.WindowTitle,
-		ApplicationTitle:       cfg.UI.ApplicationTitle,
-		FaviconBase64:          cfg.UI.FaviconPngBase64,
-		LogoBase64:             cfg.UI.LogoPngBase64,
-		ScaleInitialPercentage: int(cfg.UI.ScaleInitialPercentage),
-		MaxImagesDisplayCount:  int(cfg.UI.MaxImagesDisplayCount),
-		PMTilesURL:             cfg.UI.Map.PMTilesURL,
-		PMTilesStyleURL:        cfg.UI.Map.PMTilesStyleURL,
-		DynamicFilters:         utils.Map(cfg.Products.DynamicFilters, func(f config.DynamicFilter) string { return f.Name }),
+	mapSources, err := openMapSources(cfg.UI.Map)
+	if err != nil {
+		return nil, err
 	}
 
-	err = mapstructure.Decode(cfg.Products.ImageGroups, &staticInfo.ImageGroups)
+	staticInfo, err := makeStaticInfo(cfg, version, mapSources)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert image groups to static info: %w", err)
+		mapSources.close()
+
+		return nil, err
 	}
 
 	graphqlHandler := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graphResolver}))
@@ -96,13 +96,120 @@ func NewServer(cfg config.Config, cache types.Cache, frontendFS embed.FS, gather
 		subFrontendFS:  subFrontendFS,
 		assetsFS:       subAssetsFS,
 		graphqlHandler: graphqlHandler,
+		graphResolver:  graphResolver,
+		version:        version,
 		staticInfo:     staticInfo,
+		mapSources:     mapSources,
 		wsHub:          newWSHub(),
 	}
 
 	return srv, srv.defineRoutes(prod)
 }
 
+// makeStaticInfo returns the static info of the given configuration.
+// The map URLs point to the local map data when some is served.
+func makeStaticInfo(cfg config.Config, version string, mapSources *mapSources) (StaticInfo, error) {
+	staticInfo := StaticInfo{
+		SoftwareVersion:        version,
+		WindowTitle:            cfg.UI.WindowTitle,
+		ApplicationTitle:       cfg.UI.ApplicationTitle,
+		FaviconBase64:          cfg.UI.FaviconPngBase64,
+		LogoBase64:             cfg.UI.LogoPngBase64,
+		ScaleInitialPercentage: int(cfg.UI.ScaleInitialPercentage),
+		MaxImagesDisplayCount:  int(cfg.UI.MaxImagesDisplayCount),
+		PMTilesURL:             cfg.UI.Map.PMTilesURL,
+		PMTilesStyleURL:        cfg.UI.Map.PMTilesStyleURL,
+		MapTilesType:           mapTilesPMTiles,
+		DynamicFilters:         make([]string, 0),
+	}
+
+	tilesURL, tilesType, err := mapSources.tilesURL(cfg.UI.BaseURL)
+	if err != nil {
+		return StaticInfo{}, fmt.Errorf("failed to make map tiles URL: %w", err)
+	}
+
+	if tilesURL != "" {
+		staticInfo.PMTilesURL, staticInfo.MapTilesType = tilesURL, tilesType
+	}
+
+	styleURL, err := mapSources.styleURL(cfg.UI.BaseURL)
+	if err != nil {
+		return StaticInfo{}, fmt.Errorf("failed to make map style URL: %w", err)
+	}
+
+	if styleURL != "" {
+		staticInfo.PMTilesStyleURL = styleURL
+	}
+
+	err = mapstructure.Decode(cfg.Products.ImageGroups, &staticInfo.ImageGroups)
+	if err != nil {
+		return StaticInfo{}, fmt.Errorf("failed to convert image groups to static info: %w", err)
+	}
+
+	for g, group := range cfg.Products.ImageGroups {
+		for t, typ := range group.Types {
+			filterNames := utils.Map(typ.DynamicFilters, func(f config.DynamicFilter) string { return f.Name })
+			staticInfo.ImageGroups[g].Types[t].DynamicFilters = filterNames
+
+			for _, name := range filterNames {
+				if !slices.Contains(staticInfo.DynamicFilters, name) {
+					staticInfo.DynamicFilters = append(staticInfo.DynamicFilters, name)
+				}
+			}
+		}
+	}
+
+	return staticInfo, nil
+}
+
+// PendingReload holds the static info and the local map data of a new configuration,
+// prepared before the rest of the application is reloaded so that it can be applied without failing.
+type PendingReload struct {
+	srv        *Server
+	cfg        config.Config
+	staticInfo StaticInfo
+	mapSources *mapSources
+}
+
+// PrepareReload opens the local map data and builds the static info of the given configuration,
+// to be either applied or discarded.
+// The web server port and base URL are only taken into account after a restart.
+func (srv *Server) PrepareReload(cfg config.Config) (*PendingReload, error) {
+	mapSources, err := openMapSources(cfg.UI.Map)
+	if err != nil {
+		return nil, err
+	}
+
+	staticInfo, err := makeStaticInfo(cfg, srv.version, mapSources)
+	if err != nil {
+		mapSources.close()
+
+		return nil, err
+	}
+
+	return &PendingReload{srv: srv, cfg: cfg, staticInfo: staticInfo, mapSources: mapSources}, nil
+}
+
+// Apply updates the static info, the local map data and the GraphQL resolver with the prepared configuration.
+func (reload *PendingReload) Apply() {
+	srv := reload.srv
+
+	srv.infoLock.Lock()
+	previousMapSources := srv.mapSources
+	srv.staticInfo, srv.mapSources = reload.staticInfo, reload.mapSources
+	srv.infoLock.Unlock()
+
+	// The tile requests still reading the previous MBTiles file are let finish.
+	go previousMapSources.closeWhenUnused()
+
+	srv.graphResolver.SetConfig(reload.cfg)
+}
+
+// Discard releases the local map data opened for the prepared configuration.
+func (reload *PendingReload) Discard() {
+	reload.mapSources.close()
+}
+
 func (srv *Server) Start(ctx context.Context, eventsChan chan types.OutEvent) error {
 	srv.wsHub.goRun(ctx, eventsChan)
 
@@ -23,6 +23,8 @@ func detectContentType(filename string, data []byte) string {
 	switch strings.ToLower(filepath.Ext(filename)) {
 	case ".json":
 		return "application/json"
+	case ".dzi":
+		return "application/xml"
 	default:
 		return http.DetectContentType(data)
 	}
@@ -15,6 +15,7 @@ import (
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/logger"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/observability"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/server"
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/web"
 )
 
@@ -29,6 +30,11 @@ func main() {
 	configPath := flag.String("c", "", "config file path")
 	justPrintVersion := flag.Bool("v", false, "just print software version")
 	justPrintDocs := flag.Bool("d", false, "just print documentation")
+	justPrintSchema := flag.Bool("schema", false, "just print the JSON Schema of the configuration")
+	justCheckConfig := flag.Bool("check", false, "just validate the configuration, without connecting to S3")
+	justPrintConfig := flag.Bool("print-config", false, "just print the effective configuration, with secrets redacted")
+	justTestExprs := flag.Bool("test", false, "just run the expression tests of the configuration, without connecting to S3")
+	testsPath := flag.String("test-file", "", "file containing additional expression tests, implies -test")
 
 	flag.Usage = func() {
 		fmt.Println("S3 Image Server", version, "- usage") //nolint:forbidigo
@@ -63,9 +69,21 @@ func main() {
 			log.Fatalln("Failed to print documentation:", err)
 		}
 
+		os.Exit(0)
+	case *justPrintSchema:
+		schema, err := config.JSONSchema()
+		if err != nil {
+			log.Fatalln("Failed to generate JSON schema:", err)
+		}
+
+		fmt.Println(string(schema)) //nolint:forbidigo
 		os.Exit(0)
 	case *configPath == "":
 		log.Fatalln("No configuration file path provided. Use -c <path> to specify one.")
+	case *justTestExprs || *testsPath != "":
+		os.Exit(testExpressions(*configPath, *testsPath, os.Stdout, os.Stderr))
+	case *justCheckConfig || *justPrintConfig:
+		os.Exit(checkConfig(*configPath, *justPrintConfig, os.Stdout, os.Stderr))
 	}
 
 	cfg, warnings, err := config.Load(*configPath)
@@ -82,10 +100,10 @@ func main() {
 		logger.Warnf("Configuration warnings:\n- %s", strings.Join(warnings, "\n- "))
 	}
 
-	start(cfg)
+	start(cfg, *configPath)
 }
 
-func start(cfg config.Config) {
+func start(cfg config.Config, configPath string) {
 	logger.Info("Starting S3 Image Server ", version)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM)
@@ -108,6 +126,12 @@ func start(cfg config.Config) {
 		logger.Fatal("Can't initialize web server: ", err)
 	}
 
+	config.Watch(ctx, configPath, cfg.SourceFiles, config.DefaultWatchPeriod, func(newCfg config.Config, warnings []string) {
+		if appliedCfg, ok := reloadConfig(ctx, cfg, newCfg, warnings, srv, webSrv, outEvents); ok {
+			cfg = appliedCfg
+		}
+	})
+
 	err = webSrv.Start(ctx, outEvents)
 	if err != nil {
 		logger.Fatal("Can't start web server: ", err)
@@ -115,3 +139,43 @@ func start(cfg config.Config) {
 
 	logger.Info("Shutting down the server.")
 }
+
+// reloadConfig applies the new configuration, but for the sections requiring a restart, and returns it.
+func reloadConfig(ctx context.Context, currentCfg, newCfg config.Config, warnings []string, srv *server.Server, webSrv *web.Server, outEvents chan types.OutEvent) (config.Config, bool) {
+	if len(warnings) > 0 {
+		logger.Warnf("Configuration warnings:\n- %s", strings.Join(warnings, "\n- "))
+	}
+
+	if sections := config.RestartRequiredChanges(currentCfg, newCfg); len(sections) > 0 {
+		logger.Warnf("Changes to %s require a restart to be taken into account", strings.Join(sections, ", "))
+	}
+
+	appliedCfg := config.KeepRestartRequiredSections(currentCfg, newCfg)
+
+	// The web server resources are checked first, so that a failure leaves the whole application as is.
+	webReload, err := webSrv.PrepareReload(appliedCfg)
+	if err != nil {
+		logger.Error("Failed to reload the web server configuration: ", err)
+
+		return currentCfg, false
+	}
+
+	err = srv.Reload(ctx, appliedCfg)
+	if err != nil {
+		webReload.Discard()
+		logger.Error("Failed to reload the configuration: ", err)
+
+		return currentCfg, false
+	}
+
+	webReload.Apply()
+
+	select {
+	case outEvents <- types.OutEvent{EventType: types.EventReset}:
+	case <-ctx.Done():
+	}
+
+	logger.Info("Configuration reloaded")
+
+	return appliedCfg, true
+}
@@ -0,0 +1,157 @@
+package utils //nolint: revive,nolintlint
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+var (
+	ErrArchiveMemberNotFound = errors.New("no archive member matches")
+	ErrArchiveMemberTooLarge = errors.New("archive member too large")
+)
+
+// ExtractArchiveMember extracts the first entry matching the given pattern, in the syntax of [path.Match],
+// from the zip, tar or gzipped tar archive at the given path, to the given directory.
+// It returns the path of the extracted file, relative to this directory.
+// Entries of more than maxSize bytes, once decompressed, are refused with ErrArchiveMemberTooLarge if maxSize is positive.
+func ExtractArchiveMember(archivePath, pattern, destDir string, maxSize int64) (string, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+
+	header, err := reader.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err //nolint:wrapcheck
+	}
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return extractZipMember(f, pattern, destDir, maxSize)
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return "", err //nolint:wrapcheck
+		}
+
+		defer gzipReader.Close()
+
+		return extractTarMember(gzipReader, pattern, destDir, maxSize)
+	default:
+		return extractTarMember(reader, pattern, destDir, maxSize)
+	}
+}
+
+func extractZipMember(f *os.File, pattern, destDir string, maxSize int64) (string, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	zipReader, err := zip.NewReader(f, stat.Size())
+	if err != nil {
+		return "", fmt.Errorf("zip: %w", err)
+	}
+
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() || !matchesMember(pattern, file.Name) {
+			continue
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("zip: %w", err)
+		}
+
+		defer content.Close()
+
+		return writeMember(content, file.Name, destDir, maxSize)
+	}
+
+	return "", fmt.Errorf("%w %q", ErrArchiveMemberNotFound, pattern)
+}
+
+func extractTarMember(r io.Reader, pattern, destDir string, maxSize int64) (string, error) {
+	tarReader := tar.NewReader(r)
+
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("%w %q", ErrArchiveMemberNotFound, pattern)
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("tar: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg || !matchesMember(pattern, header.Name) {
+			continue
+		}
+
+		return writeMember(tarReader, header.Name, destDir, maxSize)
+	}
+}
+
+// matchesMember reports whether the given archive entry name matches the given pattern,
+// ignoring the leading "./" and "/" of the name.
+func matchesMember(pattern, name string) bool {
+	match, err := path.Match(pattern, memberPath(name))
+
+	return err == nil && match
+}
+
+// memberPath returns the cleaned relative path of the given archive entry name,
+// which can't escape the directory it is extracted to.
+func memberPath(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+// writeMember copies the given entry content to its path in the given directory,
+// reading at most maxSize bytes, as the sizes declared by the archive can't be trusted.
+func writeMember(content io.Reader, name, destDir string, maxSize int64) (string, error) {
+	relPath := filepath.FromSlash(memberPath(name))
+	destPath := filepath.Join(destDir, relPath)
+
+	err := os.MkdirAll(filepath.Dir(destPath), 0700)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	defer dest.Close()
+
+	if maxSize > 0 {
+		content = io.LimitReader(content, maxSize+1)
+	}
+
+	n, err := io.Copy(dest, content)
+	if err == nil && maxSize > 0 && n > maxSize {
+		err = fmt.Errorf("%w: %q exceeds %d bytes", ErrArchiveMemberTooLarge, name, maxSize)
+	}
+
+	if err != nil {
+		_ = dest.Close()
+		_ = os.Remove(destPath)
+
+		return "", err //nolint:wrapcheck
+	}
+
+	return relPath, dest.Close() //nolint:wrapcheck
+}
@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var archiveEntries = map[string]string{ //nolint: gochecknoglobals
+	"./product/":                 "",
+	"./product/metadata.json":    `{"id": 1}`,
+	"./product/quicklook.png":    "png",
+	"../../outside/evil.json":    "evil",
+	"./product/bands/B02.tif":    "tif",
+	"./product/bands/B03.tif":    "tif",
+	"./product/other/readme.txt": "readme",
+}
+
+var archiveOrder = []string{ //nolint: gochecknoglobals
+	"./product/",
+	"./product/metadata.json",
+	"./product/quicklook.png",
+	"../../outside/evil.json",
+	"./product/bands/B02.tif",
+	"./product/bands/B03.tif",
+	"./product/other/readme.txt",
+}
+
+func writeZip(t *testing.T, w io.Writer) {
+	t.Helper()
+
+	zipWriter := zip.NewWriter(w)
+
+	for _, name := range archiveOrder {
+		entry, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatalf("zip create failed: %v", err)
+		}
+
+		if _, err = entry.Write([]byte(archiveEntries[name])); err != nil {
+			t.Fatalf("zip write failed: %v", err)
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("zip close failed: %v", err)
+	}
+}
+
+func writeTar(t *testing.T, w io.Writer) {
+	t.Helper()
+
+	tarWriter := tar.NewWriter(w)
+
+	for _, name := range archiveOrder {
+		header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(archiveEntries[name])), Typeflag: tar.TypeReg}
+		if name[len(name)-1] == '/' {
+			header.Typeflag = tar.TypeDir
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("tar header failed: %v", err)
+		}
+
+		if _, err := tarWriter.Write([]byte(archiveEntries[name])); err != nil {
+			t.Fatalf("tar write failed: %v", err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("tar close failed: %v", err)
+	}
+}
+
+func TestExtractArchiveMember(t *testing.T) {
+	t.Parallel()
+
+	writers := map[string]func(t *testing.T, w io.Writer){
+		"zip": writeZip,
+		"tar": writeTar,
+		"tgz": func(t *testing.T, w io.Writer) {
+			t.Helper()
+
+			gzipWriter := gzip.NewWriter(w)
+			writeTar(t, gzipWriter)
+
+			if err := gzipWriter.Close(); err != nil {
+				t.Fatalf("gzip close failed: %v", err)
+			}
+		},
+	}
+
+	cases := []struct {
+		name            string
+		pattern         string
+		maxSize         int64
+		expectedPath    string
+		expectedContent string
+		expectedErr     error
+	}{
+		{
+			name:            "exact name",
+			pattern:         "product/metadata.json",
+			expectedPath:    filepath.Join("product", "metadata.json"),
+			expectedContent: `{"id": 1}`,
+		},
+		{
+			name:            "first match of a pattern",
+			pattern:         "product/bands/*.tif",
+			expectedPath:    filepath.Join("product", "bands", "B02.tif"),
+			expectedContent: "tif",
+		},
+		{
+			name:            "entry escaping the archive",
+			pattern:         "outside/*.json",
+			expectedPath:    filepath.Join("outside", "evil.json"),
+			expectedContent: "evil",
+		},
+		{
+			name:        "too large",
+			pattern:     "product/metadata.json",
+			maxSize:     int64(len(`{"id": 1}`)) - 1,
+			expectedErr: ErrArchiveMemberTooLarge,
+		},
+		{
+			name:            "as large as the limit",
+			pattern:         "product/metadata.json",
+			maxSize:         int64(len(`{"id": 1}`)),
+			expectedPath:    filepath.Join("product", "metadata.json"),
+			expectedContent: `{"id": 1}`,
+		},
+		{
+			name:        "directory",
+			pattern:     "product",
+			expectedErr: ErrArchiveMemberNotFound,
+		},
+		{
+			name:        "no match",
+			pattern:     "*.xml",
+			expectedErr: ErrArchiveMemberNotFound,
+		},
+	}
+
+	for format, write := range writers {
+		var archive bytes.Buffer
+
+		write(t, &archive)
+
+		archivePath := filepath.Join(t.TempDir(), "product."+format)
+		if err := os.WriteFile(archivePath, archive.Bytes(), 0o600); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+
+		for _, tc := range cases {
+			t.Run(format+"/"+tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				destDir := t.TempDir()
+
+				relPath, err := ExtractArchiveMember(archivePath, tc.pattern, destDir, tc.maxSize)
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("unexpected error: want %v, got %v", tc.expectedErr, err)
+				}
+
+				if relPath != tc.expectedPath {
+					t.Fatalf("unexpected path: want %q, got %q", tc.expectedPath, relPath)
+				}
+
+				if tc.expectedErr != nil {
+					if entries, _ := os.ReadDir(filepath.Join(destDir, "product")); len(entries) != 0 {
+						t.Fatalf("expected no extracted file, got %v", entries)
+					}
+
+					return
+				}
+
+				content, err := os.ReadFile(filepath.Join(destDir, relPath))
+				if err != nil {
+					t.Fatalf("read failed: %v", err)
+				}
+
+				if string(content) != tc.expectedContent {
+					t.Fatalf("unexpected content: want %q, got %q", tc.expectedContent, content)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractArchiveMemberInvalidArchive(t *testing.T) {
+	t.Parallel()
+
+	archivePath := filepath.Join(t.TempDir(), "product.zip")
+	if err := os.WriteFile(archivePath, []byte("not an archive at all"), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	if _, err := ExtractArchiveMember(archivePath, "*", t.TempDir(), 0); err == nil {
+		t.Fatal("expected an error for an invalid archive")
+	}
+}
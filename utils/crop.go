@@ -0,0 +1,97 @@
+package utils //nolint: revive,nolintlint
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+
+	"golang.org/x/image/draw"
+)
+
+const cropJPEGQuality = 90
+
+// CropImage extracts the given window of the image at the given path, clipped to the image,
+// downscaled to fit in maxSize pixels if positive, and encodes it in the given format.
+// An empty format keeps PNG images as PNG and encodes the others as JPEG.
+// Images of more than maxPixels pixels are refused with ErrImageTooLarge, before being decoded, if maxPixels is positive.
+func CropImage(imagePath string, window image.Rectangle, maxSize, maxPixels int, format string) ([]byte, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, fmt.Errorf("%w: not an image", types.ErrInvalidCrop)
+		}
+
+		return nil, fmt.Errorf("decoding image config: %w", err)
+	}
+
+	if maxPixels > 0 && cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels, the limit being %d", ErrImageTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err //nolint: wrapcheck // wrapped by caller
+	}
+
+	img, imgFormat, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+
+	if format == "" {
+		format = types.CropFormatJPEG
+		if imgFormat == types.CropFormatPNG {
+			format = types.CropFormatPNG
+		}
+	}
+
+	if format != types.CropFormatPNG && format != types.CropFormatJPEG {
+		return nil, fmt.Errorf("%w: unsupported format %q", types.ErrInvalidCrop, format)
+	}
+
+	window = window.Intersect(img.Bounds())
+	if window.Empty() {
+		return nil, fmt.Errorf("%w: the window is outside of the %dx%d image", types.ErrInvalidCrop, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+
+	width, height := window.Dx(), window.Dy()
+	if maxSize > 0 && max(width, height) > maxSize {
+		scale := float64(maxSize) / float64(max(width, height))
+		width, height = max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+	}
+
+	crop := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	if crop.Bounds().Size() == window.Size() {
+		draw.Copy(crop, image.Point{}, img, window, draw.Src, nil)
+	} else {
+		draw.CatmullRom.Scale(crop, crop.Bounds(), img, window, draw.Src, nil)
+	}
+
+	var buf bytes.Buffer
+
+	if format == types.CropFormatPNG {
+		err = png.Encode(&buf, crop)
+	} else {
+		err = jpeg.Encode(&buf, crop, &jpeg.Options{Quality: cropJPEGQuality})
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", format, err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+)
+
+func TestCropImage(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "preview.png")
+
+	// The left half of the image is red, the right one blue.
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for x := range 200 {
+		for y := range 100 {
+			img.Set(x, y, color.NRGBA{R: uint8(255 * (1 - x/100)), B: uint8(255 * (x / 100)), A: 255}) //nolint: gosec // 0 or 255
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(imagePath, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	notAnImage := filepath.Join(dir, "info.json")
+	if err := os.WriteFile(notAnImage, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name           string
+		imagePath      string
+		window         image.Rectangle
+		maxSize        int
+		maxPixels      int
+		format         string
+		expectedFormat string
+		expectedSize   image.Point
+		expectedColor  color.Color // Of the top left pixel
+		expectedErr    error
+	}{
+		{
+			name:           "window",
+			window:         image.Rect(120, 10, 180, 50),
+			expectedFormat: "png",
+			expectedSize:   image.Pt(60, 40),
+			expectedColor:  color.NRGBA{B: 255, A: 255},
+		},
+		{
+			name:           "clipped",
+			window:         image.Rect(-10, 50, 50, 150),
+			expectedFormat: "png",
+			expectedSize:   image.Pt(50, 50),
+			expectedColor:  color.NRGBA{R: 255, A: 255},
+		},
+		{
+			name:           "resized",
+			window:         image.Rect(0, 0, 200, 100),
+			maxSize:        50,
+			expectedFormat: "png",
+			expectedSize:   image.Pt(50, 25),
+			expectedColor:  color.NRGBA{R: 255, A: 255},
+		},
+		{
+			name:           "smaller than max size",
+			window:         image.Rect(0, 0, 20, 10),
+			maxSize:        50,
+			expectedFormat: "png",
+			expectedSize:   image.Pt(20, 10),
+			expectedColor:  color.NRGBA{R: 255, A: 255},
+		},
+		{
+			name:           "jpeg",
+			window:         image.Rect(0, 0, 100, 100),
+			format:         types.CropFormatJPEG,
+			expectedFormat: "jpeg",
+			expectedSize:   image.Pt(100, 100),
+		},
+		{
+			name:           "under the pixel limit",
+			window:         image.Rect(0, 0, 10, 10),
+			maxPixels:      20_000,
+			expectedFormat: "png",
+			expectedSize:   image.Pt(10, 10),
+			expectedColor:  color.NRGBA{R: 255, A: 255},
+		},
+		{
+			name:        "over the pixel limit",
+			window:      image.Rect(0, 0, 10, 10),
+			maxPixels:   19_999,
+			expectedErr: ErrImageTooLarge,
+		},
+		{
+			name:        "outside",
+			window:      image.Rect(200, 0, 300, 100),
+			expectedErr: types.ErrInvalidCrop,
+		},
+		{
+			name:        "unsupported format",
+			window:      image.Rect(0, 0, 10, 10),
+			format:      "gif",
+			expectedErr: types.ErrInvalidCrop,
+		},
+		{
+			name:        "not an image",
+			imagePath:   notAnImage,
+			window:      image.Rect(0, 0, 10, 10),
+			expectedErr: types.ErrInvalidCrop,
+		},
+		{
+			name:        "missing",
+			imagePath:   filepath.Join(dir, "missing.png"),
+			window:      image.Rect(0, 0, 10, 10),
+			expectedErr: os.ErrNotExist,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.imagePath == "" {
+				tc.imagePath = imagePath
+			}
+
+			data, err := CropImage(tc.imagePath, tc.window, tc.maxSize, tc.maxPixels, tc.format)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			crop, format, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal("Failed to decode the crop:", err)
+			}
+
+			if format != tc.expectedFormat {
+				t.Errorf("Expected format %q, got %q", tc.expectedFormat, format)
+			}
+
+			if size := crop.Bounds().Size(); size != tc.expectedSize {
+				t.Errorf("Expected size %v, got %v", tc.expectedSize, size)
+			}
+
+			if tc.expectedColor != nil && color.NRGBAModel.Convert(crop.At(0, 0)) != tc.expectedColor {
+				t.Errorf("Expected top left color %v, got %v", tc.expectedColor, crop.At(0, 0))
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 
 	"github.com/Maxi-Mega/s3-image-server-v2/internal/types"
+	_ "golang.org/x/image/tiff" // Register TIFF image format.
 )
 
 func GetImageSize(imagePath, cacheDir string) (types.ImageSize, error) {
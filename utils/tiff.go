@@ -0,0 +1,221 @@
+package utils //nolint: revive,nolintlint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+
+	"golang.org/x/image/tiff"
+)
+
+var ErrImageTooLarge = errors.New("image too large")
+
+// Fractions of the darkest and brightest values clipped by the contrast stretch of 16-bit images.
+const (
+	stretchLowPercentile  = 0.02
+	stretchHighPercentile = 0.98
+)
+
+// IsTIFF reports whether the file at the given path starts with a TIFF header.
+func IsTIFF(filePath string) (bool, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	defer f.Close()
+
+	header := make([]byte, 4)
+
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+
+		return false, err //nolint:wrapcheck
+	}
+
+	return bytes.Equal(header, []byte("II*\x00")) || bytes.Equal(header, []byte("MM\x00*")), nil
+}
+
+// ConvertTIFFToPNG converts the TIFF image at the given path to a PNG image written at the given destination.
+// Images with 16 bits per sample are reduced to 8 bits with a linear contrast stretch
+// between their 2nd and 98th percentiles, as their values rarely cover the whole range.
+// Images of more than maxPixels pixels are refused with ErrImageTooLarge, before being decoded, if maxPixels is positive.
+func ConvertTIFFToPNG(srcPath, destPath string, maxPixels int) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	defer src.Close()
+
+	cfg, err := tiff.DecodeConfig(src)
+	if err != nil {
+		return fmt.Errorf("decoding tiff config: %w", err)
+	}
+
+	if maxPixels > 0 && cfg.Width*cfg.Height > maxPixels {
+		return fmt.Errorf("%w: %dx%d pixels, the limit being %d", ErrImageTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	img, err := tiff.Decode(src)
+	if err != nil {
+		return fmt.Errorf("decoding tiff: %w", err)
+	}
+
+	switch img := img.(type) {
+	case *image.Gray16:
+		return encodePNG(destPath, stretchGray16(img))
+	case *image.NRGBA64:
+		return encodePNG(destPath, stretchRGBA64(img.Pix, img.Stride, img.Bounds(), false))
+	case *image.RGBA64:
+		return encodePNG(destPath, stretchRGBA64(img.Pix, img.Stride, img.Bounds(), true))
+	default:
+		return encodePNG(destPath, img)
+	}
+}
+
+func encodePNG(destPath string, img image.Image) error {
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	defer dest.Close()
+
+	err = png.Encode(dest, img)
+	if err != nil {
+		return fmt.Errorf("encoding png: %w", err)
+	}
+
+	return dest.Close() //nolint:wrapcheck
+}
+
+// stretchGray16 returns an 8-bit copy of the given image, with its values
+// linearly mapped from their [2nd, 98th] percentiles range to the full range.
+func stretchGray16(img *image.Gray16) *image.Gray {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	var histogram [1 << 16]int
+
+	for y := range height {
+		row := img.Pix[y*img.Stride:]
+		for x := range width {
+			histogram[binary.BigEndian.Uint16(row[2*x:])]++
+		}
+	}
+
+	stretch := stretchTable(histogram[:], width*height)
+	stretched := image.NewGray(bounds)
+
+	for y := range height {
+		row, out := img.Pix[y*img.Stride:], stretched.Pix[y*stretched.Stride:]
+		for x := range width {
+			out[x] = stretch[binary.BigEndian.Uint16(row[2*x:])]
+		}
+	}
+
+	return stretched
+}
+
+// stretchRGBA64 returns an 8-bit copy of the given 16-bit RGBA pixels, alpha-premultiplied or not,
+// with their color values linearly mapped from their [2nd, 98th] percentiles range to the full range.
+func stretchRGBA64(pix []byte, stride int, bounds image.Rectangle, premultiplied bool) *image.NRGBA {
+	width, height := bounds.Dx(), bounds.Dy()
+
+	var histogram [1 << 16]int
+
+	for y := range height {
+		row := pix[y*stride:]
+		for x := range width {
+			c := nrgba64At(row, x, premultiplied)
+
+			histogram[c.R]++
+			histogram[c.G]++
+			histogram[c.B]++
+		}
+	}
+
+	stretch := stretchTable(histogram[:], 3*width*height)
+	stretched := image.NewNRGBA(bounds)
+
+	for y := range height {
+		row, out := pix[y*stride:], stretched.Pix[y*stretched.Stride:]
+		for x := range width {
+			c := nrgba64At(row, x, premultiplied)
+
+			out[4*x], out[4*x+1], out[4*x+2], out[4*x+3] = stretch[c.R], stretch[c.G], stretch[c.B], uint8(c.A>>8)
+		}
+	}
+
+	return stretched
+}
+
+// nrgba64At returns the non-premultiplied color of the pixel at the given column of the given row of 16-bit RGBA samples.
+func nrgba64At(row []byte, x int, premultiplied bool) color.NRGBA64 {
+	s := row[8*x : 8*x+8]
+	c := color.NRGBA64{
+		R: binary.BigEndian.Uint16(s[0:]),
+		G: binary.BigEndian.Uint16(s[2:]),
+		B: binary.BigEndian.Uint16(s[4:]),
+		A: binary.BigEndian.Uint16(s[6:]),
+	}
+
+	if premultiplied && c.A != 0xffff {
+		if c.A == 0 {
+			return color.NRGBA64{}
+		}
+
+		unpremultiply := func(v uint16) uint16 { return uint16(min(uint32(v)*0xffff/uint32(c.A), 0xffff)) } //nolint: gosec // clamped
+
+		c.R, c.G, c.B = unpremultiply(c.R), unpremultiply(c.G), unpremultiply(c.B)
+	}
+
+	return c
+}
+
+// stretchTable returns the 8-bit value of each 16-bit value, linearly mapped
+// from the [2nd, 98th] percentiles range of the given histogram to the full range.
+func stretchTable(histogram []int, total int) *[1 << 16]uint8 {
+	low, high := percentile(histogram, total, stretchLowPercentile), percentile(histogram, total, stretchHighPercentile)
+	if high <= low {
+		low, high = 0, 1<<16-1
+	}
+
+	var table [1 << 16]uint8
+
+	for v := range table {
+		table[v] = uint8((min(max(v, low), high) - low) * 255 / (high - low)) //nolint: gosec // within [0, 255]
+	}
+
+	return &table
+}
+
+// percentile returns the smallest value of the given histogram below which the given fraction of its total count lies.
+func percentile(histogram []int, total int, fraction float64) int {
+	target := int(fraction * float64(total))
+	count := 0
+
+	for value, n := range histogram {
+		count += n
+		if count > target {
+			return value
+		}
+	}
+
+	return len(histogram) - 1
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+func writeTIFF(t *testing.T, img image.Image) string {
+	t.Helper()
+
+	tiffPath := filepath.Join(t.TempDir(), "preview.tif")
+
+	f, err := os.Create(tiffPath)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	defer f.Close()
+
+	if err = tiff.Encode(f, img, nil); err != nil {
+		t.Fatalf("tiff encode failed: %v", err)
+	}
+
+	return tiffPath
+}
+
+func TestConvertTIFFToPNG(t *testing.T) {
+	t.Parallel()
+
+	// A 16-bit image using a narrow range of values, with a few outliers.
+	gray16 := image.NewGray16(image.Rect(0, 0, 10, 10))
+	for i := range 100 {
+		gray16.SetGray16(i%10, i/10, color.Gray16{Y: uint16(1000 + i*10)}) //nolint: gosec // small test data
+	}
+
+	gray16.SetGray16(0, 0, color.Gray16{Y: 0})
+	gray16.SetGray16(9, 9, color.Gray16{Y: 65535})
+
+	// Premultiplied, the stretch applying to the non-premultiplied values.
+	rgba64 := image.NewRGBA64(image.Rect(0, 0, 2, 2))
+	rgba64.SetRGBA64(0, 0, color.RGBA64{R: 1000, G: 2000, B: 3000, A: 0xffff})
+	rgba64.SetRGBA64(1, 0, color.RGBA64{R: 200, G: 400, B: 600, A: 0xffff / 5})
+	rgba64.SetRGBA64(0, 1, color.RGBA64{R: 3000, G: 2000, B: 1000, A: 0xffff})
+	rgba64.SetRGBA64(1, 1, color.RGBA64{R: 2000, G: 3000, B: 1000, A: 0xffff})
+
+	rgba := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	rgba.SetNRGBA(0, 0, color.NRGBA{R: 10, G: 20, B: 30, A: 255})
+	rgba.SetNRGBA(1, 0, color.NRGBA{R: 200, G: 150, B: 100, A: 255})
+
+	cases := []struct {
+		name     string
+		img      image.Image
+		expected map[image.Point]color.Color
+	}{
+		{
+			name: "16-bit gray is stretched",
+			img:  gray16,
+			expected: map[image.Point]color.Color{
+				{0, 0}: color.Gray{Y: 0},
+				{1, 0}: color.Gray{Y: 0},
+				{5, 5}: color.Gray{Y: 140},
+				{8, 9}: color.Gray{Y: 255},
+				{9, 9}: color.Gray{Y: 255},
+			},
+		},
+		{
+			name: "16-bit color is stretched",
+			img:  rgba64,
+			expected: map[image.Point]color.Color{
+				{0, 0}: color.NRGBA{R: 0, G: 127, B: 255, A: 255},
+				{1, 0}: color.NRGBA{R: 0, G: 127, B: 255, A: 51},
+				{0, 1}: color.NRGBA{R: 255, G: 127, B: 0, A: 255},
+			},
+		},
+		{
+			name: "8-bit color is kept",
+			img:  rgba,
+			expected: map[image.Point]color.Color{
+				{0, 0}: color.NRGBA{R: 10, G: 20, B: 30, A: 255},
+				{1, 0}: color.NRGBA{R: 200, G: 150, B: 100, A: 255},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tiffPath := writeTIFF(t, tc.img)
+			pngPath := tiffPath + ".png"
+
+			if err := ConvertTIFFToPNG(tiffPath, pngPath, 100); err != nil {
+				t.Fatalf("conversion failed: %v", err)
+			}
+
+			f, err := os.Open(pngPath)
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+
+			defer f.Close()
+
+			img, err := png.Decode(f)
+			if err != nil {
+				t.Fatalf("png decode failed: %v", err)
+			}
+
+			if img.Bounds() != tc.img.Bounds() {
+				t.Fatalf("unexpected bounds: want %v, got %v", tc.img.Bounds(), img.Bounds())
+			}
+
+			for point, expected := range tc.expected {
+				got := img.ColorModel().Convert(img.At(point.X, point.Y))
+				if want := img.ColorModel().Convert(expected); got != want {
+					t.Errorf("unexpected color at %v: want %v, got %v", point, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertTIFFToPNGTooLarge(t *testing.T) {
+	t.Parallel()
+
+	tiffPath := writeTIFF(t, image.NewGray16(image.Rect(0, 0, 20, 10)))
+	pngPath := tiffPath + ".png"
+
+	err := ConvertTIFFToPNG(tiffPath, pngPath, 199)
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+
+	if _, err = os.Stat(pngPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected no png, got %v", err)
+	}
+
+	if err = ConvertTIFFToPNG(tiffPath, pngPath, 200); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+}
+
+func TestIsTIFF(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	cases := map[string]struct {
+		content  string
+		expected bool
+	}{
+		"little endian": {content: "II*\x00\x08\x00\x00\x00", expected: true},
+		"big endian":    {content: "MM\x00*\x00\x00\x00\x08", expected: true},
+		"png":           {content: "\x89PNG\r\n\x1a\n", expected: false},
+		"short":         {content: "II", expected: false},
+	}
+
+	for name, tc := range cases {
+		filePath := filepath.Join(dir, name)
+		if err := os.WriteFile(filePath, []byte(tc.content), 0o600); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+
+		isTIFF, err := IsTIFF(filePath)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		if isTIFF != tc.expected {
+			t.Errorf("%s: want %v, got %v", name, tc.expected, isTIFF)
+		}
+	}
+}
+
+func TestGetImageSizeTIFF(t *testing.T) {
+	t.Parallel()
+
+	tiffPath := writeTIFF(t, image.NewGray16(image.Rect(0, 0, 7, 3)))
+
+	size, err := GetImageSize(filepath.Base(tiffPath), filepath.Dir(tiffPath))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if size.Width != 7 || size.Height != 3 {
+		t.Fatalf("unexpected size: %+v", size)
+	}
+}